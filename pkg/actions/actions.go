@@ -0,0 +1,206 @@
+package actions
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+)
+
+// TokenParameter is the query parameter of the action URLs that holds the action token
+const TokenParameter = "token"
+
+var (
+	// ErrInvalidToken is returned if the token is malformed or its signature does not match
+	ErrInvalidToken = errors.New("invalid action token")
+	// ErrExpiredToken is returned if the token is no longer valid
+	ErrExpiredToken = errors.New("action token expired")
+	// ErrConsumedToken is returned by the handlers of the actions if the invocation of the token was already performed
+	ErrConsumedToken = errors.New("action token was already used")
+)
+
+// Invocation is the invocation of the action on the resource that the notification is about
+type Invocation struct {
+	Action    string `json:"action"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// ID identifies the invocation among the invocations of the action on the resource, the handlers perform an
+	// invocation once
+	ID string `json:"id,omitempty"`
+	// Expires is the unix time the token of the invocation expires at
+	Expires int64 `json:"expires"`
+}
+
+func sign(secret string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// NewToken returns the token of the invocation signed with the secret
+func NewToken(secret string, invocation Invocation) (string, error) {
+	data, err := json.Marshal(invocation)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + sign(secret, payload), nil
+}
+
+// ParseToken verifies the signature and the expiry of the token and returns the invocation it holds
+func ParseToken(secret string, token string, now time.Time) (Invocation, error) {
+	var invocation Invocation
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(sign(secret, parts[0])), []byte(parts[1])) {
+		return invocation, ErrInvalidToken
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return invocation, ErrInvalidToken
+	}
+	if err := json.Unmarshal(data, &invocation); err != nil {
+		return invocation, ErrInvalidToken
+	}
+	if now.Unix() >= invocation.Expires {
+		return invocation, ErrExpiredToken
+	}
+	return invocation, nil
+}
+
+// URL returns the URL of the actions endpoint that invokes the action using the token
+func URL(endpoint string, token string) string {
+	separator := "?"
+	if strings.Contains(endpoint, "?") {
+		separator = "&"
+	}
+	return endpoint + separator + TokenParameter + "=" + token
+}
+
+// HandlerFunc performs the action on the resource of the invocation
+type HandlerFunc func(ctx context.Context, invocation Invocation) error
+
+type handler struct {
+	secret   string
+	handlers map[string]HandlerFunc
+}
+
+// NewHandler returns the handler of the actions endpoint, which verifies the action token signed with the secret and
+// calls the handler registered for the name of the action. GET requests are answered with a page that asks to confirm
+// the action, the action is only performed on POST requests
+func NewHandler(secret string, handlers map[string]HandlerFunc) http.Handler {
+	return &handler{secret: secret, handlers: handlers}
+}
+
+// confirmationPage is served on GET requests, so that link previews and scanners that follow the links of the
+// notifications don't perform the actions, the action is performed when the form is submitted
+var confirmationPage = template.Must(template.New("confirmation").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Confirm action {{ .Invocation.Action }}</title></head>
+<body>
+<p>Perform action '{{ .Invocation.Action }}' on {{ .Invocation.Namespace }}/{{ .Invocation.Name }}?</p>
+<form method="post">
+<input type="hidden" name="` + TokenParameter + `" value="{{ .Token }}">
+<button type="submit">Confirm</button>
+</form>
+</body>
+</html>
+`))
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := r.FormValue(TokenParameter)
+	invocation, err := ParseToken(h.secret, token, time.Now())
+	if errors.Is(err, ErrExpiredToken) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	action, ok := h.handlers[invocation.Action]
+	if !ok {
+		http.Error(w, fmt.Sprintf("action '%s' is not supported", invocation.Action), http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := confirmationPage.Execute(w, map[string]interface{}{"Invocation": invocation, "Token": token}); err != nil {
+			log.Errorf("Failed to render the confirmation of action %s: %v", invocation.Action, err)
+		}
+		return
+	}
+	if err := action(r.Context(), invocation); errors.Is(err, ErrConsumedToken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Errorf("Failed to perform action %s on %s/%s: %v", invocation.Action, invocation.Namespace, invocation.Name, err)
+		http.Error(w, fmt.Sprintf("failed to perform action '%s'", invocation.Action), http.StatusInternalServerError)
+		return
+	}
+	log.Infof("Performed action %s on %s/%s", invocation.Action, invocation.Namespace, invocation.Name)
+	_, _ = fmt.Fprintf(w, "Action '%s' was performed on %s/%s\n", invocation.Action, invocation.Namespace, invocation.Name)
+}
+
+// AnnotateHandler returns the handler that sets the annotation of the resource to the value, e.g. the annotation that
+// requests the controller of the resource to retry an operation. The performed invocations are recorded in the actions
+// annotation of the resource until their tokens expire, the tokens of performed invocations are rejected
+func AnnotateHandler(client dynamic.NamespaceableResourceInterface, key string, value string) HandlerFunc {
+	return func(ctx context.Context, invocation Invocation) error {
+		resources := client.Namespace(invocation.Namespace)
+		obj, err := resources.Get(ctx, invocation.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		performed := map[string]int64{}
+		if val, ok := obj.GetAnnotations()[subscriptions.ActionsAnnotationKey()]; ok {
+			if err := json.Unmarshal([]byte(val), &performed); err != nil {
+				return fmt.Errorf("failed to parse the performed actions: %v", err)
+			}
+		}
+		id := invocation.Action + ":" + invocation.ID
+		if _, ok := performed[id]; ok {
+			return ErrConsumedToken
+		}
+		now := time.Now().Unix()
+		for k, expires := range performed {
+			if now >= expires {
+				delete(performed, k)
+			}
+		}
+		performed[id] = invocation.Expires
+		performedData, err := json.Marshal(performed)
+		if err != nil {
+			return err
+		}
+		// the resource version makes the patch fail if the resource was changed, e.g. by a concurrent invocation
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"resourceVersion": obj.GetResourceVersion(),
+				"annotations":     map[string]string{key: value, subscriptions.ActionsAnnotationKey(): string(performedData)},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = resources.Patch(ctx, invocation.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		return err
+	}
+}
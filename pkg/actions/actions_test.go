@@ -0,0 +1,131 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+)
+
+func TestToken(t *testing.T) {
+	now := time.Now()
+	invocation := Invocation{Action: "retry", Namespace: "default", Name: "guestbook", Expires: now.Add(time.Hour).Unix()}
+	token, err := NewToken("my-secret", invocation)
+	require.NoError(t, err)
+
+	parsed, err := ParseToken("my-secret", token, now)
+	assert.NoError(t, err)
+	assert.Equal(t, invocation, parsed)
+
+	_, err = ParseToken("other-secret", token, now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = ParseToken("my-secret", token, now.Add(2*time.Hour))
+	assert.ErrorIs(t, err, ErrExpiredToken)
+	_, err = ParseToken("my-secret", "invalid", now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestURL(t *testing.T) {
+	assert.Equal(t, "https://example.com/actions?token=abc", URL("https://example.com/actions", "abc"))
+	assert.Equal(t, "https://example.com/actions?source=slack&token=abc", URL("https://example.com/actions?source=slack", "abc"))
+}
+
+func TestHandler(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "List"},
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "Application",
+			"metadata":   map[string]interface{}{"name": "guestbook", "namespace": "default"},
+		}})
+	handler := NewHandler("my-secret", map[string]HandlerFunc{
+		"retry": AnnotateHandler(client.Resource(gvr), "argocd.argoproj.io/refresh", "hard"),
+	})
+
+	invoke := func(method string, action string, expires time.Time) *httptest.ResponseRecorder {
+		token, err := NewToken("my-secret", Invocation{Action: action, Namespace: "default", Name: "guestbook", Expires: expires.Unix()})
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		var req *http.Request
+		if method == http.MethodPost {
+			req = httptest.NewRequest(method, "/actions", strings.NewReader(url.Values{TokenParameter: {token}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req = httptest.NewRequest(method, "/actions?token="+url.QueryEscape(token), nil)
+		}
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	getAnnotation := func() string {
+		obj, err := client.Resource(gvr).Namespace("default").Get(context.Background(), "guestbook", metav1.GetOptions{})
+		require.NoError(t, err)
+		return obj.GetAnnotations()["argocd.argoproj.io/refresh"]
+	}
+
+	assert.Equal(t, http.StatusGone, invoke(http.MethodPost, "retry", time.Now().Add(-time.Minute)).Code)
+	assert.Equal(t, http.StatusNotFound, invoke(http.MethodPost, "delete", time.Now().Add(time.Hour)).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, invoke(http.MethodPut, "retry", time.Now().Add(time.Hour)).Code)
+
+	w := invoke(http.MethodGet, "retry", time.Now().Add(time.Hour))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<form method="post">`)
+	assert.Contains(t, w.Body.String(), "Perform action 'retry' on default/guestbook?")
+	assert.Equal(t, "", getAnnotation())
+
+	assert.Equal(t, http.StatusOK, invoke(http.MethodPost, "retry", time.Now().Add(time.Hour)).Code)
+	assert.Equal(t, "hard", getAnnotation())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/actions?token=invalid", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestHandler_ConsumedToken(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "List"},
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "Application",
+			"metadata": map[string]interface{}{"name": "guestbook", "namespace": "default", "annotations": map[string]interface{}{
+				// the expired invocations are pruned
+				subscriptions.ActionsAnnotationKey(): `{"retry:1":1}`,
+			}},
+		}})
+	handler := NewHandler("my-secret", map[string]HandlerFunc{
+		"retry": AnnotateHandler(client.Resource(gvr), "argocd.argoproj.io/refresh", "hard"),
+	})
+	expires := time.Now().Add(time.Hour).Unix()
+	post := func(id string) int {
+		token, err := NewToken("my-secret", Invocation{Action: "retry", Namespace: "default", Name: "guestbook", ID: id, Expires: expires})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/actions", strings.NewReader(url.Values{TokenParameter: {token}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, post("2"))
+	assert.Equal(t, http.StatusConflict, post("2"))
+	assert.Equal(t, http.StatusOK, post("3"))
+
+	obj, err := client.Resource(gvr).Namespace("default").Get(context.Background(), "guestbook", metav1.GetOptions{})
+	require.NoError(t, err)
+	var performed map[string]int64
+	require.NoError(t, json.Unmarshal([]byte(obj.GetAnnotations()[subscriptions.ActionsAnnotationKey()]), &performed))
+	assert.Equal(t, map[string]int64{"retry:2": expires, "retry:3": expires}, performed)
+}
@@ -1,9 +1,23 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"time"
 
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/argoproj/notifications-engine/pkg/actions"
 	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
 	"github.com/argoproj/notifications-engine/pkg/templates"
 	"github.com/argoproj/notifications-engine/pkg/triggers"
 )
@@ -11,9 +25,33 @@ import (
 const (
 	serviceTypeVarName = "serviceType"
 	recipientVarName   = "recipient"
+	stateVarName       = "state"
+	eventsVarName      = "events"
+	triggerVarName     = "trigger"
+	severityVarName    = "severity"
+	clusterVarName     = "cluster"
+	actionsVarName     = "actions"
 )
 
-//go:generate mockgen -destination=../mocks/api.go -package=mocks github.com/argoproj/notifications-engine/pkg/api API
+// tracer uses the global tracer provider, spans are not recorded unless the provider is configured
+var tracer = otel.Tracer("github.com/argoproj/notifications-engine/pkg/api")
+
+//go:generate mockgen -destination=../mocks/api.go -package=mocks github.com/argoproj/notifications-engine/pkg/api API,ContextAPI
+
+type severityKey struct{}
+
+// WithSeverity returns a context that exposes the severity of the notification to the templates in the severity variable
+func WithSeverity(ctx context.Context, severity string) context.Context {
+	return context.WithValue(ctx, severityKey{}, severity)
+}
+
+type clusterKey struct{}
+
+// WithCluster returns a context that exposes the name of the cluster of the resource to the templates in the cluster
+// variable
+func WithCluster(ctx context.Context, cluster string) context.Context {
+	return context.WithValue(ctx, clusterKey{}, cluster)
+}
 
 type GetVars func(obj map[string]interface{}, dest services.Destination) map[string]interface{}
 
@@ -26,6 +64,60 @@ type API interface {
 	GetConfig() Config
 }
 
+// ContextAPI is implemented by the APIs that use the context of the delivery, send aggregated notifications and
+// evaluate the send conditions of the subscriptions
+type ContextAPI interface {
+	API
+	// SendWithContext sends the notification like Send, the context cancels the delivery and carries the trace context
+	SendWithContext(ctx context.Context, obj map[string]interface{}, templates []string, dest services.Destination) error
+	// SendAggregated sends a single notification about the given events, the templates receive the variables of every
+	// event in the events variable
+	SendAggregated(ctx context.Context, events []AggregatedEvent, templates []string, dest services.Destination) error
+	RunTriggerWithContext(ctx context.Context, triggerName string, vars map[string]interface{}) ([]triggers.ConditionResult, error)
+	// MatchesSubscription returns false if the object does not meet the send condition of the subscription of the
+	// destination
+	MatchesSubscription(obj map[string]interface{}, dest services.Destination) (bool, error)
+}
+
+// NewContextAPI returns the given API as a ContextAPI, the APIs that only implement API ignore the context, send the
+// aggregated events one by one and do not support the send conditions
+func NewContextAPI(a API) ContextAPI {
+	if contextAPI, ok := a.(ContextAPI); ok {
+		return contextAPI
+	}
+	return &legacyAPI{a}
+}
+
+// legacyAPI adapts the APIs that only implement API
+type legacyAPI struct {
+	API
+}
+
+func (a *legacyAPI) SendWithContext(_ context.Context, obj map[string]interface{}, templates []string, dest services.Destination) error {
+	return a.Send(obj, templates, dest)
+}
+
+func (a *legacyAPI) SendAggregated(_ context.Context, events []AggregatedEvent, templates []string, dest services.Destination) error {
+	var errs []error
+	for _, event := range events {
+		if err := a.Send(event.Object, templates, dest); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (a *legacyAPI) RunTriggerWithContext(_ context.Context, triggerName string, vars map[string]interface{}) ([]triggers.ConditionResult, error) {
+	return a.RunTrigger(triggerName, vars)
+}
+
+func (a *legacyAPI) MatchesSubscription(_ map[string]interface{}, dest services.Destination) (bool, error) {
+	if dest.Parameters[subscriptions.WhenParameter] == "" {
+		return true, nil
+	}
+	return false, fmt.Errorf("send conditions of the subscriptions are not supported by the API")
+}
+
 type api struct {
 	notificationServices map[string]services.NotificationService
 	templatesService     templates.Service
@@ -38,6 +130,14 @@ func (n *api) GetConfig() Config {
 	return n.config
 }
 
+func (n *api) MatchesSubscription(obj map[string]interface{}, dest services.Destination) (bool, error) {
+	when := dest.Parameters[subscriptions.WhenParameter]
+	if when == "" {
+		return true, nil
+	}
+	return triggers.Evaluate(when, n.getVars(obj, dest))
+}
+
 // AddService adds new service with the specified name
 func (n *api) AddNotificationService(name string, service services.NotificationService) {
 	n.notificationServices[name] = service
@@ -50,30 +150,264 @@ func (n *api) GetNotificationServices() map[string]services.NotificationService
 
 // Send sends notification using specified service and template to the specified destination
 func (n *api) Send(obj map[string]interface{}, templates []string, dest services.Destination) error {
+	return n.SendWithContext(context.Background(), obj, templates, dest)
+}
+
+func (n *api) SendWithContext(ctx context.Context, obj map[string]interface{}, templates []string, dest services.Destination) (err error) {
+	ctx, span := tracer.Start(ctx, "notifications.send", trace.WithAttributes(
+		attribute.String("notifications.service", dest.Service),
+		attribute.StringSlice("notifications.templates", templates),
+	))
+	defer func() {
+		endSpan(span, err)
+	}()
+
 	notificationService, ok := n.notificationServices[dest.Service]
 	if !ok {
 		return fmt.Errorf("notification service '%s' is not supported", dest.Service)
 	}
+	if dest.Parameters[ResolverParameter] != "" {
+		return n.sendResolved(ctx, n.getVars(obj, dest), dest, func(resolved services.Destination) error {
+			return n.SendWithContext(ctx, obj, templates, resolved)
+		})
+	}
 
+	templates = n.config.LocalizedTemplates(templates, dest)
 	vars := n.getVars(obj, dest)
+	state := getState(obj)
 
 	in := make(map[string]interface{})
 	for k := range vars {
 		in[k] = vars[k]
 	}
+	in[stateVarName] = state
+	if severity, ok := ctx.Value(severityKey{}).(string); ok {
+		in[severityVarName] = severity
+	}
+	if cluster, ok := ctx.Value(clusterKey{}).(string); ok {
+		in[clusterVarName] = cluster
+	}
+	if links, err := n.actionLinks(obj, templates, time.Now()); err != nil {
+		return err
+	} else if len(links) > 0 {
+		in[actionsVarName] = links
+	}
+	// the state is only stored if the service changed it, so that the annotations of the resource are left untouched
+	initial := maps.Clone(state)
+	if err := n.deliver(ctx, notificationService, in, templates, dest, state); err != nil {
+		return err
+	}
+	if maps.Equal(initial, state) {
+		return nil
+	}
+	return setState(obj, state)
+}
+
+// actionLinks returns the links of the actions declared by the templates by action name, the links invoke the action
+// on the resource
+func (n *api) actionLinks(obj map[string]interface{}, templates []string, now time.Time) (map[string]string, error) {
+	links := map[string]string{}
+	for _, template := range templates {
+		for _, action := range n.config.Templates[template].Actions {
+			if n.config.Actions == nil {
+				return nil, fmt.Errorf("template '%s' declares actions, but the actions settings are not configured", template)
+			}
+			if _, ok := links[action]; ok {
+				continue
+			}
+			un := unstructured.Unstructured{Object: obj}
+			// the expiry is rounded up to the hour and the invocation is identified by the version of the resource, so
+			// that the links of identical notifications are identical, and that the links are used once
+			token, err := actions.NewToken(n.config.Actions.Secret, actions.Invocation{
+				Action:    action,
+				Namespace: un.GetNamespace(),
+				Name:      un.GetName(),
+				ID:        un.GetResourceVersion(),
+				Expires:   now.Truncate(time.Hour).Add(time.Hour + time.Duration(n.config.Actions.Expiry)*time.Second).Unix(),
+			})
+			if err != nil {
+				return nil, err
+			}
+			links[action] = actions.URL(n.config.Actions.URL, token)
+		}
+	}
+	return links, nil
+}
+
+// AggregatedEvent is a notification combined with other notifications sent to the same destination
+type AggregatedEvent struct {
+	Trigger  string
+	Severity string
+	Object   map[string]interface{}
+}
+
+func (n *api) SendAggregated(ctx context.Context, events []AggregatedEvent, templates []string, dest services.Destination) (err error) {
+	ctx, span := tracer.Start(ctx, "notifications.send", trace.WithAttributes(
+		attribute.String("notifications.service", dest.Service),
+		attribute.StringSlice("notifications.templates", templates),
+		attribute.Int("notifications.events", len(events)),
+	))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	notificationService, ok := n.notificationServices[dest.Service]
+	if !ok {
+		return fmt.Errorf("notification service '%s' is not supported", dest.Service)
+	}
+	if dest.Parameters[ResolverParameter] != "" && len(events) > 0 {
+		// the recipient is resolved using the variables of the first event
+		return n.sendResolved(ctx, n.getVars(events[0].Object, dest), dest, func(resolved services.Destination) error {
+			return n.SendAggregated(ctx, events, templates, resolved)
+		})
+	}
+
+	// the variables of the first event, e.g. the context, are available outside of the events too
+	in := make(map[string]interface{})
+	eventsVars := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		vars := n.getVars(event.Object, dest)
+		eventVars := make(map[string]interface{})
+		for k := range vars {
+			if i == 0 {
+				in[k] = vars[k]
+			}
+			eventVars[k] = vars[k]
+		}
+		eventVars[triggerVarName] = event.Trigger
+		eventVars[severityVarName] = event.Severity
+		eventsVars[i] = eventVars
+	}
+	in[eventsVarName] = eventsVars
+	if cluster, ok := ctx.Value(clusterKey{}).(string); ok {
+		in[clusterVarName] = cluster
+	}
+	// the notification is about several resources, so the state of the resources is not available to stateful services
+	return n.deliver(ctx, notificationService, in, n.config.LocalizedTemplates(templates, dest), dest, services.State{})
+}
+
+// deliver formats the notification using the given variables and sends it using the service
+func (n *api) deliver(ctx context.Context, notificationService services.NotificationService, in map[string]interface{}, templates []string, dest services.Destination, state services.State) error {
 	in[serviceTypeVarName] = dest.Service
 	in[recipientVarName] = dest.Recipient
+	_, renderSpan := tracer.Start(ctx, "notifications.render")
 	notification, err := n.templatesService.FormatNotification(in, templates...)
+	endSpan(renderSpan, err)
 	if err != nil {
 		return err
 	}
 
-	return notificationService.Send(*notification, dest)
+	if n.config.IsDryRun(dest.Service) {
+		log.WithField("destination", dest.String()).Infof("Dry run, not sending notification: %s", notification.Message)
+		return ErrDryRun
+	}
+
+	// the notification is claimed before it is sent, so that identical notifications sent concurrently are suppressed
+	deduplicator := deduplicatorOf(ctx)
+	if n.config.Deduplication == nil {
+		deduplicator = nil
+	}
+	var dedupKey string
+	if deduplicator != nil {
+		if dedupKey, err = deduplicationKey(services.TriggerOf(ctx), *notification, templates, dest); err != nil {
+			return err
+		}
+		if !deduplicator.claim(dedupKey, time.Duration(n.config.Deduplication.Window)*time.Second) {
+			return ErrDuplicate
+		}
+	}
+
+	serviceCtx, serviceSpan := tracer.Start(ctx, "notifications.service.send", trace.WithSpanKind(trace.SpanKindClient))
+	err = services.NewContextService(notificationService).SendWithContext(serviceCtx, *notification, dest, state)
+	endSpan(serviceSpan, err)
+	if err != nil {
+		if deduplicator != nil {
+			deduplicator.release(dedupKey)
+		}
+		return &DeliveryError{Notification: *notification, State: state, Err: err}
+	}
+	return nil
+}
+
+// ErrDryRun is returned instead of sending a notification using a service in dry-run mode, the rendered notification
+// is logged
+var ErrDryRun = errors.New("notification was not sent because of the dry-run mode")
+
+// DeliveryError is returned by Send if the notification service failed to send the rendered notification
+type DeliveryError struct {
+	Notification services.Notification
+	// State is the state of the notification services the notification was sent with
+	State services.State
+	Err   error
+}
+
+func (e *DeliveryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
 }
 
 func (n *api) RunTrigger(triggerName string, obj map[string]interface{}) ([]triggers.ConditionResult, error) {
+	return n.RunTriggerWithContext(context.Background(), triggerName, obj)
+}
+
+func (n *api) RunTriggerWithContext(ctx context.Context, triggerName string, obj map[string]interface{}) (res []triggers.ConditionResult, err error) {
+	_, span := tracer.Start(ctx, "notifications.trigger", trace.WithAttributes(
+		attribute.String("notifications.trigger", triggerName),
+	))
+	defer func() {
+		triggered := 0
+		for _, cr := range res {
+			if cr.Triggered {
+				triggered++
+			}
+		}
+		span.SetAttributes(attribute.Int("notifications.triggered_conditions", triggered))
+		endSpan(span, err)
+	}()
+
 	vars := n.getVars(obj, services.Destination{})
-	return n.triggersService.Run(triggerName, vars)
+	in := make(map[string]interface{})
+	for k := range vars {
+		in[k] = vars[k]
+	}
+	in[stateVarName] = getState(obj)
+	return n.triggersService.Run(triggerName, in)
+}
+
+// endSpan records the error, if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// getState returns the notification state stored in the annotations of the given resource
+func getState(obj map[string]interface{}) services.State {
+	state := services.State{}
+	val, ok, err := unstructured.NestedString(obj, "metadata", "annotations", subscriptions.StateAnnotationKey())
+	if err != nil || !ok {
+		return state
+	}
+	_ = json.Unmarshal([]byte(val), &state)
+	return state
+}
+
+// setState stores the notification state in the annotations of the given resource
+func setState(obj map[string]interface{}, state services.State) error {
+	if len(state) == 0 {
+		unstructured.RemoveNestedField(obj, "metadata", "annotations", subscriptions.StateAnnotationKey())
+		return nil
+	}
+	val, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return unstructured.SetNestedField(obj, string(val), "metadata", "annotations", subscriptions.StateAnnotationKey())
 }
 
 // NewAPI creates new api instance using provided config
@@ -90,10 +424,10 @@ func NewAPI(cfg Config, getVars GetVars) (*api, error) {
 	if err != nil {
 		return nil, err
 	}
-	templatesService, err := templates.NewService(cfg.Templates)
+	templatesService, err := templates.NewServiceWithPartials(cfg.Templates, cfg.Partials)
 	if err != nil {
 		return nil, err
 	}
 
-	return &api{notificationServices, templatesService, triggersService, getVars, cfg}, nil
+	return &api{notificationServices: notificationServices, templatesService: templatesService, triggersService: triggersService, getVars: getVars, config: cfg}, nil
 }
@@ -1,13 +1,30 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/argoproj/notifications-engine/pkg/actions"
 	"github.com/argoproj/notifications-engine/pkg/services"
 	"github.com/argoproj/notifications-engine/pkg/services/mocks"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
 )
 
 func getVars(in map[string]interface{}, _ services.Destination) map[string]interface{} {
@@ -56,6 +73,350 @@ func TestSend(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestSend_Locale(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dest := services.Destination{Service: "slack", Recipient: "my-channel", Parameters: map[string]string{LocaleParameter: "de"}}
+	cfg := getConfig(ctrl, func(service *mocks.MockNotificationService) {
+		service.EXPECT().Send(services.Notification{Message: "hallo world"}, dest).Return(nil)
+	})
+	cfg.Templates["my-template.de"] = services.Notification{Message: "hallo {{ .foo }}"}
+	api, err := NewAPI(cfg, getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = api.Send(map[string]interface{}{"foo": "world"}, []string{"my-template"}, dest)
+	assert.NoError(t, err)
+}
+
+func TestSendWithContext_Severity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := getConfig(ctrl, func(service *mocks.MockNotificationService) {
+		service.EXPECT().Send(services.Notification{
+			Message: "critical: world",
+		}, services.Destination{
+			Service:   "slack",
+			Recipient: "my-channel",
+		}).Return(nil)
+	})
+	cfg.Templates["my-severity"] = services.Notification{
+		Message: "{{ .severity }}: {{ .foo }}",
+	}
+	api, err := NewAPI(cfg, getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = api.SendWithContext(
+		WithSeverity(context.Background(), "critical"),
+		map[string]interface{}{"foo": "world"},
+		[]string{"my-severity"},
+		services.Destination{Service: "slack", Recipient: "my-channel"},
+	)
+	assert.NoError(t, err)
+}
+
+func TestSendWithContext_Cluster(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := getConfig(ctrl, func(service *mocks.MockNotificationService) {
+		service.EXPECT().Send(services.Notification{
+			Message: "production: world",
+		}, services.Destination{
+			Service:   "slack",
+			Recipient: "my-channel",
+		}).Return(nil)
+	})
+	cfg.Templates["my-cluster"] = services.Notification{
+		Message: "{{ .cluster }}: {{ .foo }}",
+	}
+	api, err := NewAPI(cfg, getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = api.SendWithContext(
+		WithCluster(context.Background(), "production"),
+		map[string]interface{}{"foo": "world"},
+		[]string{"my-cluster"},
+		services.Destination{Service: "slack", Recipient: "my-channel"},
+	)
+	assert.NoError(t, err)
+}
+
+func TestSend_DryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := getConfig(ctrl)
+	cfg.DryRunServices = map[string]bool{"slack": true}
+	api, err := NewAPI(cfg, getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = api.Send(
+		map[string]interface{}{"foo": "world"},
+		[]string{"my-template"},
+		services.Destination{Service: "slack", Recipient: "my-channel"},
+	)
+	assert.ErrorIs(t, err, ErrDryRun)
+
+	err = api.Send(
+		map[string]interface{}{"foo": "world"},
+		[]string{"missing-template"},
+		services.Destination{Service: "slack", Recipient: "my-channel"},
+	)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrDryRun)
+}
+
+func TestSend_Actions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var message string
+	cfg := getConfig(ctrl, func(service *mocks.MockNotificationService) {
+		service.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(notification services.Notification, _ services.Destination) error {
+			message = notification.Message
+			return nil
+		}).MaxTimes(1)
+	})
+	cfg.Templates["my-template"] = services.Notification{Message: "{{ .actions.retry }}", Actions: []string{"retry"}}
+	cfg.Actions = &ActionsConfig{URL: "https://example.com/actions", Secret: "my-secret", Expiry: 3600}
+	api, err := NewAPI(cfg, getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = api.Send(
+		map[string]interface{}{"metadata": map[string]interface{}{"name": "guestbook", "namespace": "default", "resourceVersion": "123"}},
+		[]string{"my-template"},
+		services.Destination{Service: "slack", Recipient: "my-channel"},
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	link, err := url.Parse(message)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "example.com", link.Host)
+	invocation, err := actions.ParseToken("my-secret", link.Query().Get(actions.TokenParameter), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, "retry", invocation.Action)
+	assert.Equal(t, "default", invocation.Namespace)
+	assert.Equal(t, "guestbook", invocation.Name)
+	assert.Equal(t, "123", invocation.ID)
+
+	cfg.Actions = nil
+	api, err = NewAPI(cfg, getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = api.Send(map[string]interface{}{}, []string{"my-template"}, services.Destination{Service: "slack", Recipient: "my-channel"})
+	assert.EqualError(t, err, "template 'my-template' declares actions, but the actions settings are not configured")
+}
+
+func TestSendAggregated(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := getConfig(ctrl, func(service *mocks.MockNotificationService) {
+		service.EXPECT().Send(services.Notification{
+			Message: "slack:my-channel on-sync-failed/app-1 on-deleted/app-2",
+		}, services.Destination{
+			Service:   "slack",
+			Recipient: "my-channel",
+		}).Return(nil)
+	})
+	cfg.Templates["my-events"] = services.Notification{
+		Message: "{{ .serviceType }}:{{ .recipient }}{{ range .events }} {{ .trigger }}/{{ .foo }}{{ end }}",
+	}
+	api, err := NewAPI(cfg, getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = api.SendAggregated(context.Background(), []AggregatedEvent{
+		{Trigger: "on-sync-failed", Object: map[string]interface{}{"foo": "app-1"}},
+		{Trigger: "on-deleted", Object: map[string]interface{}{"foo": "app-2"}},
+	}, []string{"my-events"}, services.Destination{Service: "slack", Recipient: "my-channel"})
+	assert.NoError(t, err)
+}
+
+func TestSend_DeliveryError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api, err := NewAPI(getConfig(ctrl, func(service *mocks.MockNotificationService) {
+		service.EXPECT().Send(gomock.Any(), gomock.Any()).Return(errors.New("service unavailable"))
+	}), getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = api.Send(
+		map[string]interface{}{"foo": "world"},
+		[]string{"my-template"},
+		services.Destination{Service: "slack", Recipient: "my-channel"},
+	)
+	var deliveryErr *DeliveryError
+	if assert.ErrorAs(t, err, &deliveryErr) {
+		assert.EqualError(t, deliveryErr, "service unavailable")
+		assert.Equal(t, services.Notification{Message: "hello world slack:my-channel"}, deliveryErr.Notification)
+	}
+}
+
+// spanRecorder forwards the spans to the recorder of the running test. The tracers of the global provider keep
+// delegating to the first provider it is set to, so the tests share one provider and swap the recorder
+type spanRecorder struct {
+	lock     sync.Mutex
+	recorder *tracetest.SpanRecorder
+}
+
+func (r *spanRecorder) get() *tracetest.SpanRecorder {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.recorder
+}
+
+func (r *spanRecorder) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	r.get().OnStart(ctx, s)
+}
+func (r *spanRecorder) OnEnd(s sdktrace.ReadOnlySpan)    { r.get().OnEnd(s) }
+func (r *spanRecorder) Shutdown(context.Context) error   { return nil }
+func (r *spanRecorder) ForceFlush(context.Context) error { return nil }
+
+var (
+	spans     = &spanRecorder{recorder: tracetest.NewSpanRecorder()}
+	spansOnce sync.Once
+)
+
+// recordSpans returns the recorder of the spans started by the test
+func recordSpans() *tracetest.SpanRecorder {
+	spansOnce.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	recorder := tracetest.NewSpanRecorder()
+	spans.lock.Lock()
+	spans.recorder = recorder
+	spans.lock.Unlock()
+	return recorder
+}
+
+func TestSend_Tracing(t *testing.T) {
+	recorder := recordSpans()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api, err := NewAPI(getConfig(ctrl, func(service *mocks.MockNotificationService) {
+		service.EXPECT().Send(gomock.Any(), gomock.Any()).Return(errors.New("service unavailable"))
+	}), getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_ = api.Send(
+		map[string]interface{}{"foo": "world"},
+		[]string{"my-template"},
+		services.Destination{Service: "slack", Recipient: "my-channel"},
+	)
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	assert.Equal(t, "notifications.render", spans[0].Name())
+	assert.Equal(t, "notifications.service.send", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "notifications.send", spans[2].Name())
+	assert.Equal(t, spans[2].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, spans[2].SpanContext().SpanID(), spans[1].Parent().SpanID())
+	assert.Contains(t, spans[2].Attributes(), attribute.String("notifications.service", "slack"))
+}
+
+func TestSendWithContext_TracesServiceRequest(t *testing.T) {
+	recorder := recordSpans()
+
+	var traceParent string
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, request *http.Request) {
+		traceParent = request.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	api, err := NewAPI(Config{
+		Templates: map[string]services.Notification{"my-template": {Message: "hello"}},
+		Services: map[string]ServiceFactory{
+			"webhook": func() (services.NotificationService, error) {
+				return services.NewWebhookService(services.WebhookOptions{URL: server.URL}), nil
+			},
+		},
+	}, getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "notifications.process")
+	err = api.SendWithContext(ctx, map[string]interface{}{}, []string{"my-template"}, services.Destination{Service: "webhook", Recipient: "test"})
+	parent.End()
+	assert.NoError(t, err)
+
+	ended := map[string]sdktrace.ReadOnlySpan{}
+	var requestSpan sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		ended[span.Name()] = span
+		if strings.HasPrefix(span.Name(), "HTTP ") {
+			requestSpan = span
+		}
+	}
+	if !assert.NotNil(t, requestSpan) {
+		return
+	}
+	assert.Equal(t, parent.SpanContext().SpanID(), ended["notifications.send"].Parent().SpanID())
+	assert.Equal(t, ended["notifications.send"].SpanContext().SpanID(), ended["notifications.service.send"].Parent().SpanID())
+	assert.Equal(t, ended["notifications.service.send"].SpanContext().SpanID(), requestSpan.Parent().SpanID())
+	assert.Equal(t, trace.SpanKindClient, requestSpan.SpanKind())
+	assert.Contains(t, traceParent, parent.SpanContext().TraceID().String())
+	assert.Contains(t, traceParent, requestSpan.SpanContext().SpanID().String())
+}
+
+func TestMatchesSubscription(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api, err := NewAPI(getConfig(ctrl), getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	obj := map[string]interface{}{"project": "payments"}
+
+	matches, err := api.MatchesSubscription(obj, services.Destination{Service: "slack", Recipient: "my-channel"})
+	assert.NoError(t, err)
+	assert.True(t, matches)
+
+	matches, err = api.MatchesSubscription(obj, services.Destination{Service: "slack", Recipient: "my-channel",
+		Parameters: map[string]string{subscriptions.WhenParameter: "project == 'payments'"}})
+	assert.NoError(t, err)
+	assert.True(t, matches)
+
+	matches, err = api.MatchesSubscription(obj, services.Destination{Service: "slack", Recipient: "my-channel",
+		Parameters: map[string]string{subscriptions.WhenParameter: "project == 'platform'"}})
+	assert.NoError(t, err)
+	assert.False(t, matches)
+
+	_, err = api.MatchesSubscription(obj, services.Destination{Service: "slack", Recipient: "my-channel",
+		Parameters: map[string]string{subscriptions.WhenParameter: "project"}})
+	assert.EqualError(t, err, "expression 'project' returned payments, expected a boolean")
+}
+
 func TestAddService(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -71,3 +432,98 @@ func TestAddService(t *testing.T) {
 	assert.NotNil(t, servicesMap["slack"])
 	assert.NotNil(t, servicesMap["hello"])
 }
+
+type statefulService struct {
+	notification services.Notification
+}
+
+func (s *statefulService) Send(notification services.Notification, _ services.Destination) error {
+	s.notification = notification
+	return nil
+}
+
+func (s *statefulService) SendWithContext(_ context.Context, notification services.Notification, _ services.Destination, state services.State) error {
+	s.notification = notification
+	state["id"] = "2"
+	return nil
+}
+
+func TestSend_WithState(t *testing.T) {
+	service := &statefulService{}
+	api, err := NewAPI(Config{
+		Templates: map[string]services.Notification{
+			"my-template": {Message: "previous id {{ .state.id }}"},
+		},
+		Services: map[string]ServiceFactory{
+			"stateful": func() (services.NotificationService, error) {
+				return service, nil
+			},
+		},
+	}, getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	obj := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				subscriptions.StateAnnotationKey(): `{"id":"1"}`,
+			},
+		},
+	}
+	err = api.Send(obj, []string{"my-template"}, services.Destination{Service: "stateful", Recipient: "my-channel"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "previous id 1", service.notification.Message)
+	assert.Equal(t, services.State{"id": "2"}, getState(obj))
+}
+
+func TestSetState_Empty(t *testing.T) {
+	obj := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				subscriptions.StateAnnotationKey(): `{"id":"1"}`,
+			},
+		},
+	}
+	assert.NoError(t, setState(obj, services.State{}))
+	assert.Equal(t, map[string]interface{}{"metadata": map[string]interface{}{"annotations": map[string]interface{}{}}}, obj)
+}
+
+func TestSend_Deduplication(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := getConfig(ctrl, func(service *mocks.MockNotificationService) {
+		service.EXPECT().Send(services.Notification{Message: "hello world slack:my-channel"}, gomock.Any()).Return(nil).Times(2)
+		service.EXPECT().Send(services.Notification{Message: "hello there slack:my-channel"}, gomock.Any()).Return(errors.New("fail"))
+		service.EXPECT().Send(services.Notification{Message: "hello there slack:my-channel"}, gomock.Any()).Return(nil)
+	})
+	cfg.Deduplication = &DeduplicationConfig{Window: 60}
+	api, err := NewAPI(cfg, getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	deduplicator := NewDeduplicator()
+	ctx := services.WithTrigger(WithDeduplicator(context.Background(), deduplicator), "my-trigger")
+	dest := services.Destination{Service: "slack", Recipient: "my-channel"}
+	assert.NoError(t, api.SendWithContext(ctx, map[string]interface{}{"foo": "world"}, []string{"my-template"}, dest))
+	assert.ErrorIs(t, api.SendWithContext(ctx, map[string]interface{}{"foo": "world"}, []string{"my-template"}, dest), ErrDuplicate)
+	// the notifications of other triggers are not identical
+	otherCtx := services.WithTrigger(ctx, "other-trigger")
+	assert.NoError(t, api.SendWithContext(otherCtx, map[string]interface{}{"foo": "world"}, []string{"my-template"}, dest))
+
+	// failed notifications are sent again
+	assert.Error(t, api.SendWithContext(ctx, map[string]interface{}{"foo": "there"}, []string{"my-template"}, dest))
+	assert.NoError(t, api.SendWithContext(ctx, map[string]interface{}{"foo": "there"}, []string{"my-template"}, dest))
+
+	// the deduplicator outlives the API of the configuration
+	cfg = getConfig(ctrl)
+	cfg.Deduplication = &DeduplicationConfig{Window: 60}
+	api, err = NewAPI(cfg, getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.ErrorIs(t, api.SendWithContext(ctx, map[string]interface{}{"foo": "world"}, []string{"my-template"}, dest), ErrDuplicate)
+}
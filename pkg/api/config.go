@@ -2,17 +2,21 @@ package api
 
 import (
 	"fmt"
+	"math"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/argoproj/notifications-engine/pkg/services"
 	"github.com/argoproj/notifications-engine/pkg/subscriptions"
 	"github.com/argoproj/notifications-engine/pkg/triggers"
+	"github.com/argoproj/notifications-engine/pkg/util/text"
 
+	"github.com/robfig/cron/v3"
 	log "github.com/sirupsen/logrus"
 	yaml3 "gopkg.in/yaml.v3"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/fields"
 	"sigs.k8s.io/yaml"
 )
 
@@ -23,6 +27,8 @@ type Config struct {
 	Services  map[string]ServiceFactory
 	Triggers  map[string][]triggers.Condition
 	Templates map[string]services.Notification
+	// Partials holds the template snippets by name that templates include using {{template "name" .}}
+	Partials map[string]string
 	// Subscriptions holds list of default application subscriptions
 	Subscriptions subscriptions.DefaultSubscriptions
 	// DefaultTriggers holds list of triggers that is used by default if subscriber don't specify trigger
@@ -31,10 +37,567 @@ type Config struct {
 	ServiceDefaultTriggers map[string][]string
 	Namespace              string
 	IsSelfServiceConfig    bool
+	// SelfServicePolicy restricts the destinations of the subscriptions of the self-service configuration, the
+	// destinations are not restricted if it is not set
+	SelfServicePolicy *SelfServicePolicy
+	// RetryPolicy holds the settings of retrying failed deliveries, failed deliveries are retried on the next
+	// processing of the resource if it is not set
+	RetryPolicy *RetryPolicy
+	// DeadLetter holds the settings of the dead-letter sink of deliveries that exhausted the retry policy
+	DeadLetter *DeadLetterConfig
+	// DeliveryHistory holds the settings of the delivery history recorded in the annotations of resources, the history
+	// is not recorded if it is not set
+	DeliveryHistory *DeliveryHistoryConfig
+	// Aggregation holds the settings of combining the notifications sent to the same destination into a single message,
+	// notifications are sent one by one if it is not set
+	Aggregation *AggregationConfig
+	// Digests holds the periodic summaries that subscriptions reference using the digest parameter of the destination
+	Digests map[string]Digest
+	// Deduplication holds the settings of suppressing identical notifications, identical notifications are sent if it
+	// is not set
+	Deduplication *DeduplicationConfig
+	// QuietHours holds the windows during which the notifications of the matching destinations are deferred or suppressed
+	QuietHours []QuietHours
+	// Escalations holds the escalation tiers by trigger, the tiers are notified if the notifications of the trigger are
+	// not acknowledged and the condition is still met after the delay of the tier
+	Escalations map[string][]EscalationTier
+	// NotifiedState holds the settings of the state that records which notifications were sent
+	NotifiedState *NotifiedStateConfig
+	// RecipientGroups holds the recipients of the groups by group name, subscriptions reference the groups using the
+	// group service, e.g. group:team-payments
+	RecipientGroups map[string][]string
+	// RecipientResolvers holds the resolvers of the recipientResolvers key by name, destinations reference the
+	// resolvers using the resolver parameter
+	RecipientResolvers map[string]*MappingResolver
+	// Fallbacks holds the destinations that receive the given up notifications of the services by service name
+	Fallbacks map[string]services.Destination
+	// DryRun renders the notifications of all services without sending them
+	DryRun bool
+	// DryRunServices holds the names of the services whose notifications are rendered without sending them
+	DryRunServices map[string]bool
+	// Actions holds the settings of the links of the actions declared by templates, templates cannot declare actions
+	// if it is not set
+	Actions *ActionsConfig
+}
+
+// IsDryRun returns true if the notifications of the service are rendered without sending them
+func (cfg Config) IsDryRun(service string) bool {
+	return cfg.DryRun || cfg.DryRunServices[service]
+}
+
+const (
+	// FallbackServiceParameter is the destination parameter that holds the service of the fallback destination
+	FallbackServiceParameter = "fallbackService"
+	// FallbackRecipientParameter is the destination parameter that holds the recipient of the fallback destination
+	FallbackRecipientParameter = "fallbackRecipient"
+)
+
+// GetFallback returns the destination that receives the notifications given up for the destination. The fallback of
+// the destination parameters takes precedence over the fallback of the service
+func (cfg Config) GetFallback(dest services.Destination) (services.Destination, bool) {
+	fallback, ok := cfg.Fallbacks[dest.Service]
+	if service := dest.Parameters[FallbackServiceParameter]; service != "" {
+		fallback, ok = services.Destination{Service: service, Recipient: dest.Parameters[FallbackRecipientParameter]}, true
+	}
+	if !ok || (fallback.Service == dest.Service && fallback.Recipient == dest.Recipient) {
+		return services.Destination{}, false
+	}
+	return fallback, true
+}
+
+// GroupService is the service of the destinations whose recipient is the name of a recipient group
+const GroupService = "group"
+
+// parseRecipient returns the destination of the service:recipient reference
+func parseRecipient(recipient string) services.Destination {
+	parts := strings.SplitN(recipient, ":", 2)
+	dest := services.Destination{Service: parts[0]}
+	if len(parts) > 1 {
+		dest.Recipient = parts[1]
+	}
+	return dest
+}
+
+// ExpandRecipientGroups replaces the destinations of the group service with the recipients of the group, the members
+// of the group receive the parameters of the destination. Destinations of unknown groups are dropped
+func (cfg Config) ExpandRecipientGroups(dests services.Destinations) services.Destinations {
+	res := services.Destinations{}
+	for trigger, destinations := range dests {
+		for _, dest := range destinations {
+			if dest.Service != GroupService {
+				res[trigger] = append(res[trigger], dest)
+				continue
+			}
+			res[trigger] = append(res[trigger], cfg.expandRecipientGroup(trigger, dest)...)
+		}
+	}
+	return res
+}
+
+// expandRecipientGroup returns the destinations of the members of the group of the destination, every member gets a
+// copy of the parameters of the destination
+func (cfg Config) expandRecipientGroup(trigger string, dest services.Destination) []services.Destination {
+	members, ok := cfg.RecipientGroups[dest.Recipient]
+	if !ok {
+		log.Warnf("Recipient group '%s' of trigger %s does not exist", dest.Recipient, trigger)
+		return nil
+	}
+	res := make([]services.Destination, 0, len(members))
+	for _, member := range members {
+		memberDest := parseRecipient(member)
+		if dest.Parameters != nil {
+			memberDest.Parameters = make(map[string]string, len(dest.Parameters))
+			for k, v := range dest.Parameters {
+				memberDest.Parameters[k] = v
+			}
+		}
+		res = append(res, memberDest)
+	}
+	return res
+}
+
+// EscalationTier holds the destinations notified once the notifications of a trigger were not acknowledged in time
+type EscalationTier struct {
+	// After is the number of seconds after the first notification the tier is notified
+	After int `json:"after"`
+	// Destinations are the destinations of the tier
+	Destinations []subscriptions.Destination `json:"destinations"`
+}
+
+func (t EscalationTier) validate() error {
+	if t.After <= 0 {
+		return fmt.Errorf("after must be greater than 0")
+	}
+	if len(t.Destinations) == 0 {
+		return fmt.Errorf("destinations must not be empty")
+	}
+	return nil
+}
+
+// getTierDestinations returns a destination for every recipient of the escalation tier of the trigger, the recipient
+// groups of the tier are replaced with the members of the groups. Every destination gets a copy of the parameters of
+// the tier destination
+func (cfg Config) getTierDestinations(trigger string, tier EscalationTier) []services.Destination {
+	var res []services.Destination
+	for _, dest := range tier.Destinations {
+		for _, recipient := range dest.Recipients {
+			tierDest := services.Destination{Service: dest.Service, Recipient: recipient}
+			if dest.Parameters != nil {
+				tierDest.Parameters = make(map[string]string, len(dest.Parameters))
+				for k, v := range dest.Parameters {
+					tierDest.Parameters[k] = v
+				}
+			}
+			if tierDest.Service == GroupService {
+				res = append(res, cfg.expandRecipientGroup(trigger, tierDest)...)
+				continue
+			}
+			res = append(res, tierDest)
+		}
+	}
+	return res
+}
+
+// GetEscalations returns the destinations of the escalation tiers of the trigger that are due at the given time if the
+// trigger was first notified at the given time, and the time the next tier is due, the zero time if no tier is pending
+func (cfg Config) GetEscalations(trigger string, notified time.Time, now time.Time) ([]services.Destination, time.Time) {
+	var due []services.Destination
+	var next time.Time
+	for _, tier := range cfg.Escalations[trigger] {
+		at := notified.Add(time.Duration(tier.After) * time.Second)
+		if at.After(now) {
+			if next.IsZero() || at.Before(next) {
+				next = at
+			}
+			continue
+		}
+		due = append(due, cfg.getTierDestinations(trigger, tier)...)
+	}
+	return due, next
+}
+
+// GetEscalationDestinations returns the destinations of all escalation tiers of the trigger
+func (cfg Config) GetEscalationDestinations(trigger string) []services.Destination {
+	var res []services.Destination
+	for _, tier := range cfg.Escalations[trigger] {
+		res = append(res, cfg.getTierDestinations(trigger, tier)...)
+	}
+	return res
+}
+
+const (
+	QuietHoursActionDefer    = "defer"
+	QuietHoursActionSuppress = "suppress"
+)
+
+// DelayParameter is the destination parameter that holds the number of seconds the condition must be met before the
+// notification is sent to the destination, it takes precedence over the delay of the condition
+const DelayParameter = "delay"
+
+// GetDelay returns how long the condition must be met before its notification is sent to the destination
+func (cfg Config) GetDelay(dest services.Destination, result triggers.ConditionResult) (time.Duration, error) {
+	delay := result.Delay
+	if val, ok := dest.Parameters[DelayParameter]; ok {
+		var err error
+		if delay, err = strconv.Atoi(val); err != nil || delay < 0 {
+			return 0, fmt.Errorf("invalid %s parameter '%s', expected a number of seconds", DelayParameter, val)
+		}
+	}
+	return time.Duration(delay) * time.Second, nil
+}
+
+// LocaleParameter is the destination parameter that holds the locale of the destination, e.g. de or de-CH. The variants
+// of templates for the locale are named after the template and the locale, e.g. app-deployed.de
+const LocaleParameter = "locale"
+
+// LocalizedTemplates returns the names of the variants of the templates for the locale of the destination. The variant
+// of the full locale is preferred over the variant of its language, e.g. app-deployed.de-CH over app-deployed.de, and
+// the template is used if it has no variant for the locale
+func (cfg Config) LocalizedTemplates(templates []string, dest services.Destination) []string {
+	locale := dest.Parameters[LocaleParameter]
+	if locale == "" {
+		return templates
+	}
+	candidates := []string{locale}
+	if language := strings.FieldsFunc(locale, func(r rune) bool { return r == '-' || r == '_' }); len(language) > 1 {
+		candidates = append(candidates, language[0])
+	}
+	res := make([]string, len(templates))
+	for i, template := range templates {
+		res[i] = template
+		for _, candidate := range candidates {
+			if _, ok := cfg.Templates[template+"."+candidate]; ok {
+				res[i] = template + "." + candidate
+				break
+			}
+		}
+	}
+	return res
+}
+
+// QuietHoursParameter is the destination parameter that references the quiet hours of the destination
+const QuietHoursParameter = "quietHours"
+
+const (
+	// MinSeverityParameter is the destination parameter that holds the lowest severity of the notifications of the destination
+	MinSeverityParameter = "minSeverity"
+	// MaxSeverityParameter is the destination parameter that holds the highest severity of the notifications of the destination
+	MaxSeverityParameter = "maxSeverity"
+)
+
+// MatchesSeverity returns true if the severity is within the range of the minSeverity and maxSeverity parameters of the
+// destination
+func (cfg Config) MatchesSeverity(dest services.Destination, severity string) (bool, error) {
+	level, err := triggers.SeverityLevel(severity)
+	if err != nil {
+		return false, err
+	}
+	if min, ok := dest.Parameters[MinSeverityParameter]; ok {
+		minLevel, err := triggers.SeverityLevel(min)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s parameter: %v", MinSeverityParameter, err)
+		}
+		if level < minLevel {
+			return false, nil
+		}
+	}
+	if max, ok := dest.Parameters[MaxSeverityParameter]; ok {
+		maxLevel, err := triggers.SeverityLevel(max)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s parameter: %v", MaxSeverityParameter, err)
+		}
+		if level > maxLevel {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// QuietHours configures recurring windows, e.g. nights or maintenance windows, during which notifications are not sent
+type QuietHours struct {
+	// Name is the name referenced by the quietHours parameter of destinations
+	Name string `json:"name"`
+	// Schedule is the cron expression of the start of the window, e.g. "0 22 * * *"
+	Schedule string `json:"schedule"`
+	// Duration is the number of seconds the window lasts
+	Duration int `json:"duration"`
+	// Timezone is the IANA time zone of the schedule, defaults to UTC
+	Timezone string `json:"timezone,omitempty"`
+	// Action is either defer, the notifications are sent once the window ends, or suppress. Defaults to defer
+	Action string `json:"action,omitempty"`
+	// Services lists the services whose notifications are affected in addition to the destinations referencing the window
+	Services []string `json:"services,omitempty"`
+
+	schedule cron.Schedule
+}
+
+func (q *QuietHours) parse() error {
+	if q.Duration <= 0 {
+		return fmt.Errorf("duration must be greater than 0")
+	}
+	switch q.Action {
+	case "":
+		q.Action = QuietHoursActionDefer
+	case QuietHoursActionDefer, QuietHoursActionSuppress:
+	default:
+		return fmt.Errorf("action must be %s or %s", QuietHoursActionDefer, QuietHoursActionSuppress)
+	}
+	spec := q.Schedule
+	if q.Timezone != "" {
+		spec = fmt.Sprintf("CRON_TZ=%s %s", q.Timezone, spec)
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("invalid schedule: %v", err)
+	}
+	q.schedule = schedule
+	return nil
+}
+
+// Suppresses returns true if the notifications are dropped during the window instead of being deferred
+func (q QuietHours) Suppresses() bool {
+	return q.Action == QuietHoursActionSuppress
+}
+
+// Applies returns true if the window affects the notifications of the destination
+func (q QuietHours) Applies(dest services.Destination) bool {
+	if q.Name != "" && dest.Parameters[QuietHoursParameter] == q.Name {
+		return true
+	}
+	for _, service := range q.Services {
+		if service == dest.Service {
+			return true
+		}
+	}
+	return false
+}
+
+// End returns the end of the window active at the given time, the zero time if no window is active
+func (q QuietHours) End(now time.Time) time.Time {
+	if q.schedule == nil {
+		return time.Time{}
+	}
+	duration := time.Duration(q.Duration) * time.Second
+	// the first window starting less than the duration ago is active
+	if start := q.schedule.Next(now.Add(-duration)); !start.After(now) {
+		return start.Add(duration)
+	}
+	return time.Time{}
+}
+
+// GetQuietHours returns the quiet hours affecting the destination at the given time and the end of the window
+func (cfg Config) GetQuietHours(dest services.Destination, now time.Time) (*QuietHours, time.Time) {
+	for i := range cfg.QuietHours {
+		if !cfg.QuietHours[i].Applies(dest) {
+			continue
+		}
+		if end := cfg.QuietHours[i].End(now); !end.IsZero() {
+			return &cfg.QuietHours[i], end
+		}
+	}
+	return nil, time.Time{}
+}
+
+// DefaultNotifiedStateMaxEntries is the number of entries of the notified state that are kept by default
+const DefaultNotifiedStateMaxEntries = 100
+
+// NotifiedStateConfig configures the state that records which notifications were sent
+type NotifiedStateConfig struct {
+	// MaxEntries is the number of entries kept in the state, the oldest entries are removed first. Defaults to 100
+	MaxEntries int `json:"maxEntries,omitempty"`
+	// Compress stores the state annotation compressed using gzip
+	Compress bool `json:"compress,omitempty"`
+	// Prune removes the entries of triggers, conditions and destinations that are no longer configured
+	Prune bool `json:"prune,omitempty"`
+}
+
+// GetNotifiedStateMaxEntries returns the number of entries kept in the notified state
+func (cfg Config) GetNotifiedStateMaxEntries() int {
+	if cfg.NotifiedState == nil || cfg.NotifiedState.MaxEntries == 0 {
+		return DefaultNotifiedStateMaxEntries
+	}
+	return cfg.NotifiedState.MaxEntries
+}
+
+// DeduplicationConfig configures the suppression of notifications identical to a notification sent within the window
+type DeduplicationConfig struct {
+	// Window is the number of seconds identical notifications are suppressed after a notification was sent
+	Window int `json:"window"`
+}
+
+const (
+	DigestScheduleHourly = "hourly"
+	DigestScheduleDaily  = "daily"
+)
+
+// DigestParameter is the destination parameter that references the digest collecting the notifications of the destination
+const DigestParameter = "digest"
+
+// Digest configures the periodic summary of the notifications sent to the destinations referencing the digest
+type Digest struct {
+	// Schedule is the period of the summary, either hourly or daily
+	Schedule string `json:"schedule"`
+	// At is the time of daily summaries in the HH:MM format, defaults to 00:00
+	At string `json:"at,omitempty"`
+	// Timezone is the IANA time zone of the summaries, which are sent at the whole hours or at the time of daily
+	// summaries in the time zone, defaults to UTC
+	Timezone string `json:"timezone,omitempty"`
+	// Template is the template of the summary, which receives the list of notifications in the events variable
+	Template string `json:"template"`
+}
+
+// Next returns the time of the first summary after the given time
+func (d Digest) Next(now time.Time) time.Time {
+	location := time.UTC
+	if d.Timezone != "" {
+		if loc, err := time.LoadLocation(d.Timezone); err == nil {
+			location = loc
+		}
+	}
+	now = now.In(location)
+	if d.Schedule == DigestScheduleHourly {
+		// the hours are truncated in the time zone, which might not be offset from UTC by whole hours
+		return time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, location).Add(time.Hour)
+	}
+	at, _ := time.Parse("15:04", text.Coalesce(d.At, "00:00"))
+	next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, location)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func (d Digest) validate() error {
+	switch d.Schedule {
+	case DigestScheduleHourly, DigestScheduleDaily:
+	default:
+		return fmt.Errorf("schedule must be %s or %s", DigestScheduleHourly, DigestScheduleDaily)
+	}
+	if d.At != "" {
+		if _, err := time.Parse("15:04", d.At); err != nil {
+			return fmt.Errorf("at must be in the HH:MM format")
+		}
+	}
+	if d.Timezone != "" {
+		if _, err := time.LoadLocation(d.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %v", err)
+		}
+	}
+	if d.Template == "" {
+		return fmt.Errorf("template is required")
+	}
+	return nil
+}
+
+// AggregationConfig configures the combination of the notifications sent to the same destination within a time window
+type AggregationConfig struct {
+	// Window is the number of seconds the notifications are collected before the combined message is sent
+	Window int `json:"window"`
+	// Template is the template of the combined message, which receives the list of notifications in the events variable
+	Template string `json:"template"`
+	// Triggers limits the aggregation to the notifications of the given triggers, notifications of all triggers are
+	// aggregated if it is empty
+	Triggers []string `json:"triggers,omitempty"`
+}
+
+// Aggregates returns true if the notifications of the given trigger are combined
+func (c AggregationConfig) Aggregates(trigger string) bool {
+	if len(c.Triggers) == 0 {
+		return true
+	}
+	for _, t := range c.Triggers {
+		if t == trigger {
+			return true
+		}
+	}
+	return false
+}
+
+const defaultDeliveryHistoryMaxRecords = 10
+
+// DeliveryHistoryConfig configures the delivery history recorded in the annotations of resources
+type DeliveryHistoryConfig struct {
+	// MaxRecords is the number of the latest delivery records kept per resource, defaults to 10
+	MaxRecords int `json:"maxRecords,omitempty"`
+}
+
+const defaultActionsExpiry = 86400
+
+// ActionsConfig configures the links of the actions declared by templates
+type ActionsConfig struct {
+	// URL is the URL of the actions endpoint served by the handler of the actions package
+	URL string `json:"url"`
+	// Secret is the key that signs the action tokens, it might reference a key of the Secret, e.g. $actions-secret
+	Secret string `json:"secret"`
+	// Expiry is the number of seconds the links are valid, defaults to 86400
+	Expiry int `json:"expiry,omitempty"`
+}
+
+// DeadLetterConfig configures where the notifications that could not be delivered are recorded
+type DeadLetterConfig struct {
+	// ConfigMap is the name of the ConfigMap in the namespace of the configuration that stores the notifications
+	ConfigMap string `json:"configMap,omitempty"`
+	// Service is the name of the notification service that is notified about the notifications
+	Service string `json:"service,omitempty"`
+	// Recipient is the recipient of the notification service
+	Recipient string `json:"recipient,omitempty"`
+	// MaxLetters is the number of notifications the ConfigMap keeps, the oldest are removed beyond it, defaults to 100
+	MaxLetters int `json:"maxLetters,omitempty"`
+	// MaxAge is the number of seconds after which the notifications are removed from the ConfigMap, the notifications
+	// don't expire if it is not set
+	MaxAge int `json:"maxAge,omitempty"`
+}
+
+// RetryPolicy configures the retries of failed deliveries using exponential backoff. Durations are in seconds
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts after which the delivery is given up
+	MaxAttempts int `json:"maxAttempts"`
+	// InitialDelay is the delay before the first retry, defaults to 10 seconds
+	InitialDelay int `json:"initialDelay,omitempty"`
+	// MaxDelay caps the delay between retries, defaults to 10 minutes
+	MaxDelay int `json:"maxDelay,omitempty"`
+	// MaxAge is the duration since the first failure after which the delivery is given up, no limit by default
+	MaxAge int `json:"maxAge,omitempty"`
+}
+
+const (
+	defaultRetryInitialDelay = 10
+	defaultRetryMaxDelay     = 600
+)
+
+// Backoff returns the delay before the next attempt of the delivery that failed the given number of times
+func (p RetryPolicy) Backoff(failures int) time.Duration {
+	initialDelay, maxDelay := p.InitialDelay, p.MaxDelay
+	if initialDelay <= 0 {
+		initialDelay = defaultRetryInitialDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	delay := float64(initialDelay) * math.Pow(2, float64(failures-1))
+	return time.Duration(math.Min(delay, float64(maxDelay))) * time.Second
+}
+
+// Exhausted returns true if the delivery that failed the given number of times since firstFailure must not be retried
+func (p RetryPolicy) Exhausted(failures int, firstFailure time.Time) bool {
+	if failures >= p.MaxAttempts {
+		return true
+	}
+	return p.MaxAge > 0 && time.Since(firstFailure) >= time.Duration(p.MaxAge)*time.Second
 }
 
 // Returns list of destinations for the specified trigger
 func (cfg Config) GetGlobalDestinations(labels map[string]string) services.Destinations {
+	resourceLabels := map[string]interface{}{}
+	for k, v := range labels {
+		resourceLabels[k] = v
+	}
+	return cfg.GetGlobalDestinationsOf(map[string]interface{}{"metadata": map[string]interface{}{"labels": resourceLabels}})
+}
+
+// GetGlobalDestinationsOf returns the destinations of the subscriptions whose label and field selectors match the
+// resource
+func (cfg Config) GetGlobalDestinationsOf(obj map[string]interface{}) services.Destinations {
 	dests := services.Destinations{}
 	for _, s := range cfg.Subscriptions {
 		triggers := s.Triggers
@@ -42,15 +605,21 @@ func (cfg Config) GetGlobalDestinations(labels map[string]string) services.Desti
 			triggers = cfg.DefaultTriggers
 		}
 		for _, trigger := range triggers {
-			if s.MatchesTrigger(trigger) && s.Selector.Matches(fields.Set(labels)) {
+			if s.MatchesTrigger(trigger) && s.MatchesResource(obj) {
 				for _, recipient := range s.Recipients {
-					parts := strings.Split(recipient, ":")
-					dest := services.Destination{Service: parts[0]}
-					if len(parts) > 1 {
-						dest.Recipient = parts[1]
-					}
+					dest := parseRecipient(recipient)
+					dest.Parameters = subscriptions.WithCondition(nil, s.When)
 					dests[trigger] = append(dests[trigger], dest)
 				}
+				for _, destination := range s.Destinations {
+					for _, recipient := range destination.Recipients {
+						dests[trigger] = append(dests[trigger], services.Destination{
+							Service:    destination.Service,
+							Recipient:  recipient,
+							Parameters: subscriptions.WithCondition(destination.Parameters, s.When),
+						})
+					}
+				}
 			}
 		}
 	}
@@ -71,7 +640,21 @@ func replaceStringSecret(val string, secretValues map[string][]byte) string {
 	})
 }
 
-// ParseConfig retrieves Config from given ConfigMap and Secret
+// resolveStringSecret returns the value of the secret key reference ( starts with $ ), or an error if the key does not
+// exist in the provided map
+func resolveStringSecret(val string, secretValues map[string][]byte) (string, error) {
+	if !strings.HasPrefix(val, "$") {
+		return val, nil
+	}
+	secretVal, ok := secretValues[val[1:]]
+	if !ok {
+		return "", fmt.Errorf("config referenced '%s', but key does not exist in secret", val)
+	}
+	return string(secretVal), nil
+}
+
+// ParseConfig retrieves Config from given ConfigMap and Secret. If the Secret is nil, the references to its keys are
+// not resolved, which only validates the structure of the configuration
 func ParseConfig(configMap *v1.ConfigMap, secret *v1.Secret) (*Config, error) {
 	cfg := Config{
 		Services:               map[string]ServiceFactory{},
@@ -86,6 +669,157 @@ func ParseConfig(configMap *v1.ConfigMap, secret *v1.Secret) (*Config, error) {
 		}
 	}
 
+	if retryPolicyYaml, ok := configMap.Data["retryPolicy"]; ok {
+		cfg.RetryPolicy = &RetryPolicy{}
+		if err := yaml.Unmarshal([]byte(retryPolicyYaml), cfg.RetryPolicy); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal retry policy: %v", err)
+		}
+		if cfg.RetryPolicy.MaxAttempts <= 0 {
+			return nil, fmt.Errorf("retry policy maxAttempts must be greater than 0")
+		}
+	}
+
+	if deadLetterYaml, ok := configMap.Data["deadLetter"]; ok {
+		cfg.DeadLetter = &DeadLetterConfig{}
+		if err := yaml.Unmarshal([]byte(deadLetterYaml), cfg.DeadLetter); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal dead-letter settings: %v", err)
+		}
+		if cfg.DeadLetter.ConfigMap == "" && cfg.DeadLetter.Service == "" {
+			return nil, fmt.Errorf("dead-letter settings must specify a configMap or a service")
+		}
+		if cfg.DeadLetter.MaxLetters < 0 || cfg.DeadLetter.MaxAge < 0 {
+			return nil, fmt.Errorf("dead-letter maxLetters and maxAge must not be negative")
+		}
+	}
+
+	if deliveryHistoryYaml, ok := configMap.Data["deliveryHistory"]; ok {
+		cfg.DeliveryHistory = &DeliveryHistoryConfig{}
+		if err := yaml.Unmarshal([]byte(deliveryHistoryYaml), cfg.DeliveryHistory); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal delivery history settings: %v", err)
+		}
+		if cfg.DeliveryHistory.MaxRecords <= 0 {
+			cfg.DeliveryHistory.MaxRecords = defaultDeliveryHistoryMaxRecords
+		}
+	}
+
+	if actionsYaml, ok := configMap.Data["actions"]; ok {
+		cfg.Actions = &ActionsConfig{}
+		if err := yaml.Unmarshal([]byte(actionsYaml), cfg.Actions); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal actions settings: %v", err)
+		}
+		if secret != nil {
+			actionsSecret, err := resolveStringSecret(cfg.Actions.Secret, secret.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve the secret of the actions settings: %v", err)
+			}
+			cfg.Actions.Secret = actionsSecret
+		}
+		if cfg.Actions.URL == "" || cfg.Actions.Secret == "" {
+			return nil, fmt.Errorf("actions settings must specify a url and a secret")
+		}
+		if cfg.Actions.Expiry <= 0 {
+			cfg.Actions.Expiry = defaultActionsExpiry
+		}
+	}
+
+	if aggregationYaml, ok := configMap.Data["aggregation"]; ok {
+		cfg.Aggregation = &AggregationConfig{}
+		if err := yaml.Unmarshal([]byte(aggregationYaml), cfg.Aggregation); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal aggregation settings: %v", err)
+		}
+		if cfg.Aggregation.Window <= 0 {
+			return nil, fmt.Errorf("aggregation window must be greater than 0")
+		}
+		if cfg.Aggregation.Template == "" {
+			return nil, fmt.Errorf("aggregation settings must specify a template")
+		}
+	}
+
+	if digestsYaml, ok := configMap.Data["digests"]; ok {
+		if err := yaml.Unmarshal([]byte(digestsYaml), &cfg.Digests); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal digests: %v", err)
+		}
+		for name, digest := range cfg.Digests {
+			if err := digest.validate(); err != nil {
+				return nil, fmt.Errorf("invalid digest %s: %v", name, err)
+			}
+		}
+	}
+
+	if deduplicationYaml, ok := configMap.Data["deduplication"]; ok {
+		cfg.Deduplication = &DeduplicationConfig{}
+		if err := yaml.Unmarshal([]byte(deduplicationYaml), cfg.Deduplication); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal deduplication settings: %v", err)
+		}
+		if cfg.Deduplication.Window <= 0 {
+			return nil, fmt.Errorf("deduplication window must be greater than 0")
+		}
+	}
+
+	if quietHoursYaml, ok := configMap.Data["quietHours"]; ok {
+		if err := yaml.Unmarshal([]byte(quietHoursYaml), &cfg.QuietHours); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal quiet hours: %v", err)
+		}
+		for i := range cfg.QuietHours {
+			if err := cfg.QuietHours[i].parse(); err != nil {
+				return nil, fmt.Errorf("invalid quiet hours %s: %v", cfg.QuietHours[i].Name, err)
+			}
+		}
+	}
+
+	if notifiedStateYaml, ok := configMap.Data["notifiedState"]; ok {
+		cfg.NotifiedState = &NotifiedStateConfig{}
+		if err := yaml.Unmarshal([]byte(notifiedStateYaml), cfg.NotifiedState); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal notified state settings: %v", err)
+		}
+		if cfg.NotifiedState.MaxEntries < 0 {
+			return nil, fmt.Errorf("notified state maxEntries must not be negative")
+		}
+	}
+
+	if escalationsYaml, ok := configMap.Data["escalations"]; ok {
+		if err := yaml.Unmarshal([]byte(escalationsYaml), &cfg.Escalations); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal escalations: %v", err)
+		}
+		for trigger, tiers := range cfg.Escalations {
+			for i, tier := range tiers {
+				if err := tier.validate(); err != nil {
+					return nil, fmt.Errorf("invalid escalation tier %d of trigger %s: %v", i+1, trigger, err)
+				}
+			}
+		}
+	}
+
+	if recipientGroupsYaml, ok := configMap.Data["recipientGroups"]; ok {
+		if err := yaml.Unmarshal([]byte(recipientGroupsYaml), &cfg.RecipientGroups); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal recipient groups: %v", err)
+		}
+		for name, members := range cfg.RecipientGroups {
+			for _, member := range members {
+				if dest := parseRecipient(member); dest.Service == "" || dest.Service == GroupService {
+					return nil, fmt.Errorf("invalid member '%s' of recipient group %s, expected service:recipient", member, name)
+				}
+			}
+		}
+	}
+
+	if recipientResolversYaml, ok := configMap.Data["recipientResolvers"]; ok {
+		if err := yaml.Unmarshal([]byte(recipientResolversYaml), &cfg.RecipientResolvers); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal recipient resolvers: %v", err)
+		}
+		for name, resolver := range cfg.RecipientResolvers {
+			if err := resolver.validate(); err != nil {
+				return nil, fmt.Errorf("invalid recipient resolver %s: %v", name, err)
+			}
+		}
+	}
+
+	if dryRunYaml, ok := configMap.Data["dryRun"]; ok {
+		if err := yaml.Unmarshal([]byte(dryRunYaml), &cfg.DryRun); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal dry-run setting: %v", err)
+		}
+	}
+
 	if defaultTriggersYaml, ok := configMap.Data["defaultTriggers"]; ok {
 		if err := yaml.Unmarshal([]byte(defaultTriggersYaml), &cfg.DefaultTriggers); err != nil {
 			return nil, err
@@ -102,6 +836,11 @@ func ParseConfig(configMap *v1.ConfigMap, secret *v1.Secret) (*Config, error) {
 				return nil, fmt.Errorf("failed to unmarshal template %s: %v", name, err)
 			}
 			cfg.Templates[name] = template
+		case strings.HasPrefix(k, "partial."):
+			if cfg.Partials == nil {
+				cfg.Partials = map[string]string{}
+			}
+			cfg.Partials[strings.Join(parts[1:], ".")] = v
 		case strings.HasPrefix(k, "service."):
 			name := ""
 			serviceType := ""
@@ -122,6 +861,29 @@ func ParseConfig(configMap *v1.ConfigMap, secret *v1.Secret) (*Config, error) {
 			cfg.Services[name] = func() (services.NotificationService, error) {
 				return services.NewService(serviceType, optsData)
 			}
+
+			var opts struct {
+				Fallback *services.Destination `json:"fallback,omitempty"`
+				DryRun   bool                  `json:"dryRun,omitempty"`
+			}
+			if err := yaml.Unmarshal(optsData, &opts); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal service configuration %s: %v", name, err)
+			}
+			if opts.Fallback != nil {
+				if opts.Fallback.Service == "" {
+					return nil, fmt.Errorf("fallback of service %s must specify a service", name)
+				}
+				if cfg.Fallbacks == nil {
+					cfg.Fallbacks = map[string]services.Destination{}
+				}
+				cfg.Fallbacks[name] = *opts.Fallback
+			}
+			if opts.DryRun {
+				if cfg.DryRunServices == nil {
+					cfg.DryRunServices = map[string]bool{}
+				}
+				cfg.DryRunServices[name] = true
+			}
 		case strings.HasPrefix(k, "trigger."):
 			name := strings.Join(parts[1:], ".")
 			var trigger []triggers.Condition
@@ -142,6 +904,9 @@ func ParseConfig(configMap *v1.ConfigMap, secret *v1.Secret) (*Config, error) {
 }
 
 func replaceServiceConfigSecrets(inputYaml string, secret *v1.Secret) ([]byte, error) {
+	if secret == nil {
+		return []byte(inputYaml), nil
+	}
 	var node yaml3.Node
 	err := yaml3.Unmarshal([]byte(inputYaml), &node)
 	if err != nil {
@@ -2,9 +2,11 @@ package api
 
 import (
 	"testing"
+	"time"
 
 	"github.com/argoproj/notifications-engine/pkg/services"
 	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+	"github.com/argoproj/notifications-engine/pkg/triggers"
 
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
@@ -43,6 +45,18 @@ message: hello world
 	}, cfg.Templates)
 }
 
+func TestParseConfig_Partials(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{Data: map[string]string{
+		"partial.footer": "Sent by {{.context.argocdUrl}}",
+	}}, emptySecret)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, map[string]string{"footer": "Sent by {{.context.argocdUrl}}"}, cfg.Partials)
+}
+
 func TestParseConfig_DefaultServiceTriggers(t *testing.T) {
 	cfg, err := ParseConfig(&v1.ConfigMap{Data: map[string]string{
 		"defaultTriggers.slack": `
@@ -193,3 +207,607 @@ func TestParseConfig_Subscriptions(t *testing.T) {
 		{Triggers: []string{"my-trigger2"}, Selector: label},
 	}), cfg.Subscriptions)
 }
+
+func TestGetGlobalDestinations_Parameters(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"subscriptions": `
+- recipients: [slack:my-channel]
+  destinations:
+  - service: telegram
+    recipients: ["-100123"]
+    parameters:
+      topic: "42"
+  triggers:
+  - my-trigger`,
+		},
+	}, emptySecret)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, services.Destinations{"my-trigger": {
+		{Service: "slack", Recipient: "my-channel"},
+		{Service: "telegram", Recipient: "-100123", Parameters: map[string]string{"topic": "42"}},
+	}}, cfg.GetGlobalDestinations(map[string]string{}))
+}
+
+func TestGetGlobalDestinations_When(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"subscriptions": `
+- recipients: [slack:payments]
+  triggers: [my-trigger]
+  when: app.spec.project == 'payments'`,
+		},
+	}, emptySecret)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, services.Destinations{"my-trigger": {
+		{Service: "slack", Recipient: "payments", Parameters: map[string]string{subscriptions.WhenParameter: "app.spec.project == 'payments'"}},
+	}}, cfg.GetGlobalDestinations(map[string]string{}))
+}
+
+func TestGetGlobalDestinationsOf_Selectors(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"subscriptions": `
+- recipients: [slack:platform]
+  triggers: [my-trigger]
+  selector: tier=frontend
+  fieldSelector: metadata.namespace=prod,spec.project!=sandbox`,
+		},
+	}, emptySecret)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newResource := func(namespace string, labels map[string]interface{}, project string) map[string]interface{} {
+		return map[string]interface{}{
+			"metadata": map[string]interface{}{"namespace": namespace, "labels": labels},
+			"spec":     map[string]interface{}{"project": project},
+		}
+	}
+	frontend := map[string]interface{}{"tier": "frontend"}
+
+	assert.Equal(t, services.Destinations{"my-trigger": {{Service: "slack", Recipient: "platform"}}},
+		cfg.GetGlobalDestinationsOf(newResource("prod", frontend, "payments")))
+	assert.Empty(t, cfg.GetGlobalDestinationsOf(newResource("prod", frontend, "sandbox")))
+	assert.Empty(t, cfg.GetGlobalDestinationsOf(newResource("dev", frontend, "payments")))
+	assert.Empty(t, cfg.GetGlobalDestinationsOf(newResource("prod", map[string]interface{}{"tier": "backend"}, "payments")))
+}
+
+func TestParseConfig_SubscriptionsInvalidFieldSelector(t *testing.T) {
+	_, err := ParseConfig(&v1.ConfigMap{Data: map[string]string{"subscriptions": `
+- recipients: [slack:platform]
+  fieldSelector: metadata.namespace`}}, emptySecret)
+	assert.Error(t, err)
+}
+
+func TestParseConfig_RecipientGroups(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"recipientGroups": `
+team-payments:
+- slack:payments
+- email:payments@example.com`,
+			"subscriptions": `
+- recipients: [group:team-payments, group:unknown]
+  triggers: [my-trigger]`,
+		},
+	}, emptySecret)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string][]string{"team-payments": {"slack:payments", "email:payments@example.com"}}, cfg.RecipientGroups)
+
+	dests := cfg.GetGlobalDestinations(map[string]string{})
+	dests.Merge(services.Destinations{"my-trigger": {{Service: GroupService, Recipient: "team-payments", Parameters: map[string]string{"topic": "42"}}}})
+	assert.Equal(t, services.Destinations{"my-trigger": {
+		{Service: "slack", Recipient: "payments"},
+		{Service: "email", Recipient: "payments@example.com"},
+		{Service: "slack", Recipient: "payments", Parameters: map[string]string{"topic": "42"}},
+		{Service: "email", Recipient: "payments@example.com", Parameters: map[string]string{"topic": "42"}},
+	}}, cfg.ExpandRecipientGroups(dests))
+}
+
+func TestExpandRecipientGroups_CopiesParameters(t *testing.T) {
+	cfg := Config{RecipientGroups: map[string][]string{"team-payments": {"slack:payments", "email:payments@example.com"}}}
+	expanded := cfg.ExpandRecipientGroups(services.Destinations{"my-trigger": {{Service: GroupService, Recipient: "team-payments", Parameters: map[string]string{"topic": "42"}}}})
+
+	expanded["my-trigger"][0].Parameters["topic"] = "43"
+	assert.Equal(t, "42", expanded["my-trigger"][1].Parameters["topic"])
+}
+
+func TestParseConfig_RecipientGroupsInvalid(t *testing.T) {
+	_, err := ParseConfig(&v1.ConfigMap{Data: map[string]string{"recipientGroups": `
+team-payments:
+- group:team-platform`}}, emptySecret)
+	assert.EqualError(t, err, "invalid member 'group:team-platform' of recipient group team-payments, expected service:recipient")
+}
+
+func TestParseConfig_RecipientResolvers(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{Data: map[string]string{"recipientResolvers": `
+owner:
+  key: app.metadata.labels.team
+  mapping:
+    payments: [payments-oncall]
+  default: [platform]`}}, emptySecret)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]*MappingResolver{"owner": {
+		Key:     "app.metadata.labels.team",
+		Mapping: map[string][]string{"payments": {"payments-oncall"}},
+		Default: []string{"platform"},
+	}}, cfg.RecipientResolvers)
+
+	_, err = ParseConfig(&v1.ConfigMap{Data: map[string]string{"recipientResolvers": `
+owner:
+  key: app.metadata.labels.team`}}, emptySecret)
+	assert.EqualError(t, err, "invalid recipient resolver owner: mapping must not be empty")
+}
+
+func TestParseConfig_RetryPolicy(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"retryPolicy": `
+maxAttempts: 5
+initialDelay: 30
+maxDelay: 300`,
+		},
+	}, emptySecret)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &RetryPolicy{MaxAttempts: 5, InitialDelay: 30, MaxDelay: 300}, cfg.RetryPolicy)
+}
+
+func TestParseConfig_RetryPolicyInvalid(t *testing.T) {
+	_, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"retryPolicy": `initialDelay: 30`,
+		},
+	}, emptySecret)
+
+	assert.EqualError(t, err, "retry policy maxAttempts must be greater than 0")
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, MaxDelay: 60}
+
+	assert.Equal(t, 10*time.Second, policy.Backoff(1))
+	assert.Equal(t, 20*time.Second, policy.Backoff(2))
+	assert.Equal(t, 40*time.Second, policy.Backoff(3))
+	assert.Equal(t, 60*time.Second, policy.Backoff(4))
+}
+
+func TestRetryPolicy_Exhausted(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, MaxAge: 3600}
+
+	assert.False(t, policy.Exhausted(2, time.Now()))
+	assert.True(t, policy.Exhausted(3, time.Now()))
+	assert.True(t, policy.Exhausted(1, time.Now().Add(-2*time.Hour)))
+}
+
+func TestParseConfig_DeadLetter(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"deadLetter": `
+configMap: notifications-dead-letters
+service: slack
+recipient: ops`,
+		},
+	}, emptySecret)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &DeadLetterConfig{ConfigMap: "notifications-dead-letters", Service: "slack", Recipient: "ops"}, cfg.DeadLetter)
+}
+
+func TestParseConfig_DeadLetterInvalid(t *testing.T) {
+	_, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"deadLetter": `recipient: ops`,
+		},
+	}, emptySecret)
+
+	assert.EqualError(t, err, "dead-letter settings must specify a configMap or a service")
+}
+
+func TestParseConfig_DeliveryHistory(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"deliveryHistory": `{}`,
+		},
+	}, emptySecret)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &DeliveryHistoryConfig{MaxRecords: 10}, cfg.DeliveryHistory)
+}
+
+func TestParseConfig_Aggregation(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"aggregation": `
+window: 60
+template: app-events
+triggers: [on-sync-failed]`,
+		},
+	}, emptySecret)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &AggregationConfig{Window: 60, Template: "app-events", Triggers: []string{"on-sync-failed"}}, cfg.Aggregation)
+	assert.True(t, cfg.Aggregation.Aggregates("on-sync-failed"))
+	assert.False(t, cfg.Aggregation.Aggregates("on-sync-succeeded"))
+}
+
+func TestParseConfig_AggregationInvalid(t *testing.T) {
+	_, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"aggregation": `template: app-events`,
+		},
+	}, emptySecret)
+
+	assert.EqualError(t, err, "aggregation window must be greater than 0")
+}
+
+func TestParseConfig_Digests(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"digests": `
+ops-daily:
+  schedule: daily
+  at: "09:30"
+  template: app-digest`,
+		},
+	}, emptySecret)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]Digest{"ops-daily": {Schedule: "daily", At: "09:30", Template: "app-digest"}}, cfg.Digests)
+}
+
+func TestParseConfig_DigestsInvalid(t *testing.T) {
+	_, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"digests": `
+ops-weekly:
+  schedule: weekly
+  template: app-digest`,
+		},
+	}, emptySecret)
+
+	assert.EqualError(t, err, "invalid digest ops-weekly: schedule must be hourly or daily")
+
+	_, err = ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"digests": `
+ops-daily:
+  schedule: daily
+  timezone: Mars/Olympus
+  template: app-digest`,
+		},
+	}, emptySecret)
+	assert.ErrorContains(t, err, "invalid digest ops-daily: invalid timezone")
+}
+
+func TestDigest_Next(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC), Digest{Schedule: DigestScheduleHourly}.Next(now))
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Digest{Schedule: DigestScheduleDaily}.Next(now))
+	assert.Equal(t, time.Date(2024, 1, 1, 18, 0, 0, 0, time.UTC), Digest{Schedule: DigestScheduleDaily, At: "18:00"}.Next(now))
+	assert.Equal(t, time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC), Digest{Schedule: DigestScheduleDaily, At: "09:00"}.Next(now))
+
+	// 09:00 in Berlin is 08:00 UTC in winter
+	next := Digest{Schedule: DigestScheduleDaily, At: "09:00", Timezone: "Europe/Berlin"}.Next(now)
+	assert.True(t, time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC).Equal(next), next)
+	next = Digest{Schedule: DigestScheduleDaily, At: "12:00", Timezone: "Europe/Berlin"}.Next(now)
+	assert.True(t, time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC).Equal(next), next)
+
+	// 10:15 UTC is 15:45 in Kolkata, which is offset from UTC by 5:30, the next whole hour is 16:00 or 10:30 UTC
+	next = Digest{Schedule: DigestScheduleHourly, Timezone: "Asia/Kolkata"}.Next(now)
+	assert.True(t, time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC).Equal(next), next)
+}
+
+func TestParseConfig_Deduplication(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"deduplication": `window: 300`,
+		},
+	}, emptySecret)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &DeduplicationConfig{Window: 300}, cfg.Deduplication)
+}
+
+func TestParseConfig_QuietHours(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"quietHours": `
+- name: nights
+  schedule: "0 22 * * *"
+  duration: 28800
+  timezone: Europe/Berlin
+  services: [slack]`,
+		},
+	}, emptySecret)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Len(t, cfg.QuietHours, 1) {
+		return
+	}
+	quietHours := cfg.QuietHours[0]
+	assert.Equal(t, QuietHoursActionDefer, quietHours.Action)
+	assert.False(t, quietHours.Suppresses())
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, time.Date(2024, 1, 2, 6, 0, 0, 0, berlin), quietHours.End(time.Date(2024, 1, 1, 23, 0, 0, 0, berlin)))
+	assert.Equal(t, time.Date(2024, 1, 2, 6, 0, 0, 0, berlin), quietHours.End(time.Date(2024, 1, 2, 5, 0, 0, 0, berlin)))
+	assert.True(t, quietHours.End(time.Date(2024, 1, 2, 12, 0, 0, 0, berlin)).IsZero())
+
+	assert.True(t, quietHours.Applies(services.Destination{Service: "slack", Recipient: "ops"}))
+	assert.True(t, quietHours.Applies(services.Destination{Service: "email", Parameters: map[string]string{QuietHoursParameter: "nights"}}))
+	assert.False(t, quietHours.Applies(services.Destination{Service: "email"}))
+
+	active, end := cfg.GetQuietHours(services.Destination{Service: "slack"}, time.Date(2024, 1, 1, 23, 0, 0, 0, berlin))
+	if assert.NotNil(t, active) {
+		assert.Equal(t, "nights", active.Name)
+		assert.Equal(t, time.Date(2024, 1, 2, 6, 0, 0, 0, berlin), end)
+	}
+}
+
+func TestParseConfig_QuietHoursInvalid(t *testing.T) {
+	_, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"quietHours": `
+- name: nights
+  schedule: "0 22 * *"
+  duration: 28800`,
+		},
+	}, emptySecret)
+
+	assert.ErrorContains(t, err, "invalid quiet hours nights: invalid schedule")
+}
+
+func TestParseConfig_Escalations(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"escalations": `
+on-sync-failed:
+- after: 900
+  destinations:
+  - service: slack
+    recipients: [team-leads]
+- after: 3600
+  destinations:
+  - service: pagerduty
+    recipients: [on-call, backup]
+  - service: group
+    recipients: [team-payments]`,
+			"recipientGroups": `
+team-payments:
+- slack:payments`,
+		},
+	}, emptySecret)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+	notified := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	due, next := cfg.GetEscalations("on-sync-failed", notified, notified.Add(time.Minute))
+	assert.Empty(t, due)
+	assert.Equal(t, notified.Add(15*time.Minute), next)
+
+	due, next = cfg.GetEscalations("on-sync-failed", notified, notified.Add(20*time.Minute))
+	assert.Equal(t, []services.Destination{{Service: "slack", Recipient: "team-leads"}}, due)
+	assert.Equal(t, notified.Add(time.Hour), next)
+
+	due, next = cfg.GetEscalations("on-sync-failed", notified, notified.Add(2*time.Hour))
+	assert.Equal(t, []services.Destination{
+		{Service: "slack", Recipient: "team-leads"},
+		{Service: "pagerduty", Recipient: "on-call"},
+		{Service: "pagerduty", Recipient: "backup"},
+		{Service: "slack", Recipient: "payments"},
+	}, due)
+	assert.True(t, next.IsZero())
+
+	due, next = cfg.GetEscalations("on-deployed", notified, notified.Add(2*time.Hour))
+	assert.Empty(t, due)
+	assert.True(t, next.IsZero())
+}
+
+func TestGetEscalations_CopiesParameters(t *testing.T) {
+	cfg := Config{Escalations: map[string][]EscalationTier{"on-sync-failed": {{
+		After: 900,
+		Destinations: []subscriptions.Destination{
+			{Service: "slack", Recipients: []string{"team-leads", "on-call"}, Parameters: map[string]string{"topic": "42"}},
+		},
+	}}}}
+	notified := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	due, _ := cfg.GetEscalations("on-sync-failed", notified, notified.Add(time.Hour))
+	if !assert.Len(t, due, 2) {
+		return
+	}
+	due[0].Parameters["topic"] = "7"
+	assert.Equal(t, "42", due[1].Parameters["topic"])
+	assert.Equal(t, "42", cfg.Escalations["on-sync-failed"][0].Destinations[0].Parameters["topic"])
+}
+
+func TestParseConfig_EscalationsInvalid(t *testing.T) {
+	_, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"escalations": `
+on-sync-failed:
+- after: 900`,
+		},
+	}, emptySecret)
+
+	assert.ErrorContains(t, err, "invalid escalation tier 1 of trigger on-sync-failed: destinations must not be empty")
+}
+
+func TestMatchesSeverity(t *testing.T) {
+	pagerduty := services.Destination{Service: "pagerduty", Parameters: map[string]string{MinSeverityParameter: triggers.SeverityCritical}}
+	slack := services.Destination{Service: "slack", Parameters: map[string]string{MaxSeverityParameter: triggers.SeverityWarning}}
+
+	for _, tc := range []struct {
+		dest     services.Destination
+		severity string
+		matches  bool
+	}{
+		{pagerduty, triggers.SeverityCritical, true},
+		{pagerduty, triggers.SeverityError, false},
+		{pagerduty, "", false},
+		{slack, "", true},
+		{slack, triggers.SeverityWarning, true},
+		{slack, triggers.SeverityCritical, false},
+		{services.Destination{Service: "email"}, triggers.SeverityCritical, true},
+	} {
+		matches, err := Config{}.MatchesSeverity(tc.dest, tc.severity)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.matches, matches, "%s: %s", tc.dest.Service, tc.severity)
+	}
+
+	_, err := Config{}.MatchesSeverity(services.Destination{Parameters: map[string]string{MinSeverityParameter: "fatal"}}, triggers.SeverityInfo)
+	assert.ErrorContains(t, err, "invalid minSeverity parameter")
+}
+
+func TestParseConfig_Fallbacks(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{
+		Data: map[string]string{
+			"service.slack": `
+token: my-token
+fallback:
+  service: email
+  recipient: ops@example.com`,
+		},
+	}, emptySecret)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+	email := services.Destination{Service: "email", Recipient: "ops@example.com"}
+	assert.Equal(t, map[string]services.Destination{"slack": email}, cfg.Fallbacks)
+
+	fallback, ok := cfg.GetFallback(services.Destination{Service: "slack", Recipient: "my-channel"})
+	assert.True(t, ok)
+	assert.Equal(t, email, fallback)
+
+	fallback, ok = cfg.GetFallback(services.Destination{Service: "slack", Recipient: "my-channel", Parameters: map[string]string{
+		FallbackServiceParameter:   "slack",
+		FallbackRecipientParameter: "backup-channel",
+	}})
+	assert.True(t, ok)
+	assert.Equal(t, services.Destination{Service: "slack", Recipient: "backup-channel"}, fallback)
+
+	_, ok = cfg.GetFallback(services.Destination{Service: "email", Recipient: "ops@example.com"})
+	assert.False(t, ok)
+}
+
+func TestParseConfig_NotifiedState(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{Data: map[string]string{}}, emptySecret)
+	if assert.NoError(t, err) {
+		assert.Equal(t, DefaultNotifiedStateMaxEntries, cfg.GetNotifiedStateMaxEntries())
+	}
+
+	cfg, err = ParseConfig(&v1.ConfigMap{Data: map[string]string{"notifiedState": "{maxEntries: 500, compress: true}"}}, emptySecret)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 500, cfg.GetNotifiedStateMaxEntries())
+		assert.True(t, cfg.NotifiedState.Compress)
+	}
+
+	_, err = ParseConfig(&v1.ConfigMap{Data: map[string]string{"notifiedState": "{maxEntries: -1}"}}, emptySecret)
+	assert.ErrorContains(t, err, "notified state maxEntries must not be negative")
+}
+
+func TestParseConfig_DryRun(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{Data: map[string]string{
+		"service.slack":          "token: abc",
+		"service.webhook.github": "{url: 'https://api.github.com', dryRun: true}",
+	}}, emptySecret)
+	if assert.NoError(t, err) {
+		assert.False(t, cfg.IsDryRun("slack"))
+		assert.True(t, cfg.IsDryRun("github"))
+	}
+
+	cfg, err = ParseConfig(&v1.ConfigMap{Data: map[string]string{"dryRun": "true"}}, emptySecret)
+	if assert.NoError(t, err) {
+		assert.True(t, cfg.IsDryRun("slack"))
+	}
+
+	_, err = ParseConfig(&v1.ConfigMap{Data: map[string]string{"dryRun": "[]"}}, emptySecret)
+	assert.ErrorContains(t, err, "failed to unmarshal dry-run setting")
+}
+
+func TestParseConfig_Actions(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{Data: map[string]string{
+		"actions": "{url: 'https://example.com/actions', secret: $actions-secret}",
+	}}, &v1.Secret{Data: map[string][]byte{"actions-secret": []byte("my-secret")}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, &ActionsConfig{URL: "https://example.com/actions", Secret: "my-secret", Expiry: 86400}, cfg.Actions)
+	}
+
+	_, err = ParseConfig(&v1.ConfigMap{Data: map[string]string{"actions": "{url: 'https://example.com/actions'}"}}, emptySecret)
+	assert.EqualError(t, err, "actions settings must specify a url and a secret")
+
+	_, err = ParseConfig(&v1.ConfigMap{Data: map[string]string{
+		"actions": "{url: 'https://example.com/actions', secret: $actions-secret}",
+	}}, emptySecret)
+	assert.EqualError(t, err, "failed to resolve the secret of the actions settings: config referenced '$actions-secret', but key does not exist in secret")
+
+	// the references are not resolved when only the structure of the configuration is validated
+	_, err = ParseConfig(&v1.ConfigMap{Data: map[string]string{
+		"actions": "{url: 'https://example.com/actions', secret: $actions-secret}",
+	}}, nil)
+	assert.NoError(t, err)
+}
+
+func TestGetDelay(t *testing.T) {
+	result := triggers.ConditionResult{Delay: 600}
+	delay, err := Config{}.GetDelay(services.Destination{}, result)
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, delay)
+
+	delay, err = Config{}.GetDelay(services.Destination{Parameters: map[string]string{DelayParameter: "60"}}, result)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, delay)
+
+	_, err = Config{}.GetDelay(services.Destination{Parameters: map[string]string{DelayParameter: "10m"}}, result)
+	assert.EqualError(t, err, "invalid delay parameter '10m', expected a number of seconds")
+}
+
+func TestLocalizedTemplates(t *testing.T) {
+	cfg := Config{Templates: map[string]services.Notification{
+		"app-deployed":       {},
+		"app-deployed.de":    {},
+		"app-deployed.fr-CA": {},
+		"app-degraded":       {},
+	}}
+	templates := []string{"app-deployed", "app-degraded"}
+	localized := func(locale string) []string {
+		return cfg.LocalizedTemplates(templates, services.Destination{Parameters: map[string]string{LocaleParameter: locale}})
+	}
+
+	assert.Equal(t, templates, cfg.LocalizedTemplates(templates, services.Destination{}))
+	assert.Equal(t, []string{"app-deployed.de", "app-degraded"}, localized("de"))
+	assert.Equal(t, []string{"app-deployed.de", "app-degraded"}, localized("de-CH"))
+	assert.Equal(t, []string{"app-deployed.fr-CA", "app-degraded"}, localized("fr-CA"))
+	assert.Equal(t, templates, localized("fr"))
+}
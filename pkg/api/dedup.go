@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/argoproj/notifications-engine/pkg/services"
+)
+
+// ErrDuplicate is returned instead of sending a notification identical to a notification sent within the deduplication window
+var ErrDuplicate = errors.New("identical notification was sent within the deduplication window")
+
+// Deduplicator remembers the hashes of the sent notifications. It is kept by the controller rather than by the API of a
+// configuration, so that the sent notifications are not forgotten when the configuration changes
+type Deduplicator struct {
+	lock sync.Mutex
+	sent map[string]time.Time
+}
+
+func NewDeduplicator() *Deduplicator {
+	return &Deduplicator{sent: map[string]time.Time{}}
+}
+
+type deduplicatorKey struct{}
+
+// WithDeduplicator returns the context of deliveries that are suppressed if an identical notification was sent within
+// the deduplication window of the configuration. Notifications are not deduplicated without a deduplicator
+func WithDeduplicator(ctx context.Context, d *Deduplicator) context.Context {
+	return context.WithValue(ctx, deduplicatorKey{}, d)
+}
+
+func deduplicatorOf(ctx context.Context) *Deduplicator {
+	d, _ := ctx.Value(deduplicatorKey{}).(*Deduplicator)
+	return d
+}
+
+// deduplicationKey returns the hash of the rendered notification of the trigger sent using the templates to the destination
+func deduplicationKey(trigger string, notification services.Notification, templates []string, dest services.Destination) (string, error) {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s\n%s\n%s\n%s", trigger, dest, strings.Join(templates, ","), payload)))
+	return fmt.Sprintf("%x", hash), nil
+}
+
+// claim records that the notification with the given key is sent and returns true, or returns false if the notification
+// was sent within the window. The notifications sent before the window are forgotten
+func (d *Deduplicator) claim(key string, window time.Duration) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	now := time.Now()
+	for k, sentAt := range d.sent {
+		if now.Sub(sentAt) >= window {
+			delete(d.sent, k)
+		}
+	}
+	if _, ok := d.sent[key]; ok {
+		return false
+	}
+	d.sent[key] = now
+	return true
+}
+
+// release forgets the notification with the given key, so that it is sent again after its delivery failed
+func (d *Deduplicator) release(key string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.sent, key)
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeduplicator_ClaimsOnce(t *testing.T) {
+	deduplicator := NewDeduplicator()
+	var wg sync.WaitGroup
+	var claimed atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if deduplicator.claim("key", time.Minute) {
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), claimed.Load())
+}
@@ -11,8 +11,11 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 	v1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 )
 
 // Settings holds a set of settings required for API creation
@@ -21,12 +24,24 @@ type Settings struct {
 	ConfigMapName string
 	// SecretName holds Kubernetes Secret name that contains sensitive information
 	SecretName string
+	// OverlayConfigMapNames holds the names of the ConfigMaps that are merged on top of the ConfigMap in the given
+	// order, the keys of a ConfigMap override the keys of the same name of the ConfigMaps before it
+	OverlayConfigMapNames []string
+	// OverlaySecretNames holds the names of the Secrets that are merged on top of the Secret in the given order
+	OverlaySecretNames []string
 	// InitGetVars returns a function that produces notifications context variables
 	InitGetVars func(cfg *Config, configMap *v1.ConfigMap, secret *v1.Secret) (GetVars, error)
 	// DefaultNamespace default namespace for ConfigMap and Secret.
 	// For self-service notification, we get notification configurations from rollout resource namespace
 	// and also the default namespace
 	DefaultNamespace string
+	// SelfServiceContributions enables the ConfigMaps in the namespaces of the resources to contribute templates,
+	// triggers and subscriptions to the configuration of the default namespace, instead of configuring notifications
+	// independently of it. The contributed configuration cannot configure services
+	SelfServiceContributions bool
+	// SelfServiceAllowedServices holds the names of the services of the default namespace that the contributed
+	// configuration can use
+	SelfServiceAllowedServices []string
 }
 
 // Factory creates an API instance
@@ -35,17 +50,25 @@ type Factory interface {
 	GetAPIsFromNamespace(namespace string) (map[string]API, error)
 }
 
+// FactoryOption configures the API factory
+type FactoryOption func(f *apiFactory)
+
 type apiFactory struct {
 	Settings
 
-	cmLister     v1listers.ConfigMapLister
-	secretLister v1listers.SecretLister
-	lock         sync.Mutex
-	apiMap       map[string]API
+	cmLister        v1listers.ConfigMapLister
+	secretLister    v1listers.SecretLister
+	resourcesClient dynamic.Interface
+	resourceListers map[schema.GroupVersionResource]cache.GenericLister
+	// statusQueue holds the resources whose status is updated while the status updates are running
+	statusQueue     workqueue.RateLimitingInterface
+	statusQueueLock sync.Mutex
+	lock            sync.Mutex
+	apiMap          map[string]API
 }
 
 // NewFactory creates a new API factory if namespace is not empty, it will override the default namespace set in settings
-func NewFactory(settings Settings, defaultNamespace string, secretsInformer cache.SharedIndexInformer, cmInformer cache.SharedIndexInformer) *apiFactory {
+func NewFactory(settings Settings, defaultNamespace string, secretsInformer cache.SharedIndexInformer, cmInformer cache.SharedIndexInformer, opts ...FactoryOption) *apiFactory {
 	if defaultNamespace != "" {
 		settings.DefaultNamespace = defaultNamespace
 	}
@@ -57,40 +80,55 @@ func NewFactory(settings Settings, defaultNamespace string, secretsInformer cach
 		apiMap:       make(map[string]API),
 	}
 
+	secretNames := append([]string{settings.SecretName}, settings.OverlaySecretNames...)
+	configMapNames := append([]string{settings.ConfigMapName}, settings.OverlayConfigMapNames...)
 	secretsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
-			factory.invalidateIfHasName(settings.SecretName, obj)
+			factory.invalidateIfHasName(secretNames, obj)
 		},
 		DeleteFunc: func(obj interface{}) {
-			factory.invalidateIfHasName(settings.SecretName, obj)
+			factory.invalidateIfHasName(secretNames, obj)
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
-			factory.invalidateIfHasName(settings.SecretName, newObj)
+			factory.invalidateIfHasName(secretNames, newObj)
 		}})
 	cmInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
-			factory.invalidateIfHasName(settings.ConfigMapName, obj)
+			factory.invalidateIfHasName(configMapNames, obj)
 		},
 		DeleteFunc: func(obj interface{}) {
-			factory.invalidateIfHasName(settings.ConfigMapName, obj)
+			factory.invalidateIfHasName(configMapNames, obj)
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
-			factory.invalidateIfHasName(settings.ConfigMapName, newObj)
+			factory.invalidateIfHasName(configMapNames, newObj)
 		}})
+	for _, opt := range opts {
+		opt(factory)
+	}
 	return factory
 }
 
-func (f *apiFactory) invalidateIfHasName(name string, obj interface{}) {
+func (f *apiFactory) invalidateIfHasName(names []string, obj interface{}) {
 	metaObj, ok := obj.(metav1.Object)
 	if !ok {
 		return
 	}
-	if metaObj.GetName() == name {
-		f.lock.Lock()
-		defer f.lock.Unlock()
+	if slices.Contains(names, metaObj.GetName()) {
+		f.invalidate(metaObj)
+	}
+}
+
+func (f *apiFactory) invalidate(metaObj metav1.Object) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if metaObj.GetNamespace() == f.DefaultNamespace {
+		// the configurations of the namespaces depend on the self-service policies and the contributed configurations
+		// include the configuration of the default namespace
+		f.apiMap = make(map[string]API)
+	} else {
 		f.apiMap[metaObj.GetNamespace()] = nil
-		log.Info("invalidated cache for resource in namespace: ", metaObj.GetNamespace(), " with the name: ", metaObj.GetName())
 	}
+	log.Info("invalidated cache for resource in namespace: ", metaObj.GetNamespace(), " with the name: ", metaObj.GetName())
 }
 
 func (f *apiFactory) getConfigMapAndSecretWithListers(cmLister v1listers.ConfigMapNamespaceLister, secretLister v1listers.SecretNamespaceLister) (*v1.ConfigMap, *v1.Secret, error) {
@@ -112,10 +150,46 @@ func (f *apiFactory) getConfigMapAndSecretWithListers(cmLister v1listers.ConfigM
 		}
 	}
 
-	if errors.IsNotFound(err) {
-		return cm, secret, nil
+	if len(f.OverlayConfigMapNames) > 0 {
+		cm = cm.DeepCopy()
+		for _, name := range f.OverlayConfigMapNames {
+			overlay, err := cmLister.Get(name)
+			if errors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return nil, nil, err
+			}
+			if cm.Namespace == "" {
+				cm.Namespace = overlay.Namespace
+			}
+			if cm.Data == nil {
+				cm.Data = map[string]string{}
+			}
+			for k, v := range overlay.Data {
+				cm.Data[k] = v
+			}
+		}
 	}
-	return cm, secret, err
+
+	if len(f.OverlaySecretNames) > 0 {
+		secret = secret.DeepCopy()
+		for _, name := range f.OverlaySecretNames {
+			overlay, err := secretLister.Get(name)
+			if errors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return nil, nil, err
+			}
+			if secret.Data == nil {
+				secret.Data = map[string][]byte{}
+			}
+			for k, v := range overlay.Data {
+				secret.Data[k] = v
+			}
+		}
+	}
+
+	return cm, secret, nil
 }
 
 func (f *apiFactory) getConfigMapAndSecret(namespace string) (*v1.ConfigMap, *v1.Secret, error) {
@@ -147,6 +221,13 @@ func (f *apiFactory) GetAPIsFromNamespace(namespace string) (map[string]API, err
 	if !slices.Contains(namespaces, f.Settings.DefaultNamespace) {
 		namespaces = append(namespaces, f.Settings.DefaultNamespace)
 	}
+	if f.SelfServiceContributions && namespace != f.Settings.DefaultNamespace {
+		// the contributed configuration includes the configuration of the default namespace
+		namespaces = []string{f.Settings.DefaultNamespace}
+		if _, err := f.cmLister.ConfigMaps(namespace).Get(f.ConfigMapName); err == nil {
+			namespaces = []string{namespace}
+		}
+	}
 
 	errors := []error{}
 	for _, namespace := range namespaces {
@@ -171,12 +252,32 @@ func (f *apiFactory) GetAPIsFromNamespace(namespace string) (map[string]API, err
 }
 
 func (f *apiFactory) getApiFromNamespace(namespace string) (API, error) {
-	cm, secret, err := f.getConfigMapAndSecret(namespace)
+	var cm *v1.ConfigMap
+	var secret *v1.Secret
+	var err error
+	if f.SelfServiceContributions && namespace != f.DefaultNamespace {
+		cm, secret, err = f.getContributedConfigMapAndSecret(namespace)
+	} else {
+		cm, secret, err = f.getMergedConfigMapAndSecret(namespace)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return f.getApiFromConfigmapAndSecret(cm, secret)
+}
 
+// getMergedConfigMapAndSecret returns the ConfigMap and Secret of the namespace including the configuration resources
+func (f *apiFactory) getMergedConfigMapAndSecret(namespace string) (*v1.ConfigMap, *v1.Secret, error) {
+	cm, secret, err := f.getConfigMapAndSecret(namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.resourceListers != nil {
+		if cm, err = f.mergeConfigResources(namespace, cm, secret); err != nil {
+			return nil, nil, err
+		}
+	}
+	return cm, secret, nil
 }
 
 func (f *apiFactory) getApiFromConfigmapAndSecret(cm *v1.ConfigMap, secret *v1.Secret) (API, error) {
@@ -187,6 +288,15 @@ func (f *apiFactory) getApiFromConfigmapAndSecret(cm *v1.ConfigMap, secret *v1.S
 
 	if cm.Namespace != f.Settings.DefaultNamespace {
 		cfg.IsSelfServiceConfig = true
+		if cfg.SelfServicePolicy, err = f.getSelfServicePolicy(cm.Namespace); err != nil {
+			return nil, err
+		}
+		// the contributed subscriptions are validated before they are merged with the subscriptions of the default namespace
+		if cfg.SelfServicePolicy != nil && !f.SelfServiceContributions {
+			if err := cfg.SelfServicePolicy.validateSubscriptions(*cfg, cfg.Subscriptions); err != nil {
+				return nil, fmt.Errorf("invalid subscriptions of namespace %s: %v", cm.Namespace, err)
+			}
+		}
 	}
 	getVars, err := f.InitGetVars(cfg, cm, secret)
 	if err != nil {
@@ -71,3 +71,70 @@ func TestGetAPI(t *testing.T) {
 	assert.Len(t, svcs, 1)
 	assert.NotNil(t, svcs["email"])
 }
+
+func TestGetAPI_Overlays(t *testing.T) {
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-config-map", Namespace: "default"},
+		Data: map[string]string{
+			"service.slack":         `{"token": "$slack-token"}`,
+			"template.my-template":  `message: from platform`,
+			"template.platform-ops": `message: platform`,
+		},
+	}
+	teamCm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-config-map", Namespace: "default"},
+		Data: map[string]string{
+			"template.my-template": `message: from team`,
+		},
+	}
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-secret", Namespace: "default"},
+		Data:       map[string][]byte{"slack-token": []byte("platform")},
+	}
+	teamSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-secret", Namespace: "default"},
+		Data:       map[string][]byte{"team-token": []byte("team")},
+	}
+
+	clientset := fake.NewSimpleClientset(cm, teamCm, secret, teamSecret)
+	informerFactory := informers.NewSharedInformerFactory(clientset, time.Minute)
+
+	secrets := informerFactory.Core().V1().Secrets().Informer()
+	configMaps := informerFactory.Core().V1().ConfigMaps().Informer()
+	overlaySettings := settings
+	overlaySettings.OverlayConfigMapNames = []string{"missing-config-map", "team-config-map"}
+	overlaySettings.OverlaySecretNames = []string{"team-secret"}
+	var secretData map[string][]byte
+	overlaySettings.InitGetVars = func(cfg *Config, configMap *v1.ConfigMap, secret *v1.Secret) (GetVars, error) {
+		secretData = secret.Data
+		return settings.InitGetVars(cfg, configMap, secret)
+	}
+	factory := NewFactory(overlaySettings, "default", secrets, configMaps)
+
+	go informerFactory.Start(context.Background().Done())
+	if !cache.WaitForCacheSync(context.Background().Done(), configMaps.HasSynced, secrets.HasSynced) {
+		assert.Fail(t, "failed to sync informers")
+	}
+
+	api, err := factory.GetAPI()
+	require.NoError(t, err)
+
+	cfg := api.GetConfig()
+	assert.Equal(t, "from team", cfg.Templates["my-template"].Message)
+	assert.Equal(t, "platform", cfg.Templates["platform-ops"].Message)
+	assert.Equal(t, map[string][]byte{"slack-token": []byte("platform"), "team-token": []byte("team")}, secretData)
+
+	_, err = clientset.CoreV1().ConfigMaps("default").Update(context.Background(), &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-config-map", Namespace: "default"},
+		Data: map[string]string{
+			"template.my-template": `message: updated by team`,
+		},
+	}, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	time.Sleep(1 * time.Second)
+
+	api, err = factory.GetAPI()
+	require.NoError(t, err)
+	assert.Equal(t, "updated by team", api.GetConfig().Templates["my-template"].Message)
+}
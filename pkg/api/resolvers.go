@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/antonmedv/expr"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/argoproj/notifications-engine/pkg/services"
+)
+
+// ResolverParameter is the destination parameter that holds the name of the resolver of the recipients of the
+// destination, the recipient of the destination is the abstract recipient the resolver resolves, e.g. owner
+const ResolverParameter = "resolver"
+
+// RecipientResolver resolves the abstract recipient of a destination, e.g. the owner of the resource, into the
+// recipients of the service when the notification is sent. The variables are the variables of the notification
+type RecipientResolver interface {
+	Resolve(ctx context.Context, recipient string, vars map[string]interface{}) ([]string, error)
+}
+
+type deliveredRecipientsKey struct{}
+
+// WithDeliveredRecipients returns the context of the retry of a delivery to a destination using a resolver, the
+// resolved recipients that previous attempts delivered the notification to are not notified again
+func WithDeliveredRecipients(ctx context.Context, recipients []string) context.Context {
+	return context.WithValue(ctx, deliveredRecipientsKey{}, recipients)
+}
+
+// PartialDeliveryError is returned if the notification was only delivered to some of the resolved recipients of a
+// destination. Delivered holds the recipients that were notified, including those of previous attempts
+type PartialDeliveryError struct {
+	Delivered []string
+	Err       error
+}
+
+func (e *PartialDeliveryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PartialDeliveryError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	resolversLock sync.RWMutex
+	resolvers     = map[string]RecipientResolver{}
+)
+
+// RegisterRecipientResolver registers the resolver that destinations reference by name using the resolver parameter,
+// e.g. a resolver that looks up the members of LDAP or OIDC groups. The resolvers of the recipientResolvers key of
+// the configuration take precedence over the registered resolvers of the same name
+func RegisterRecipientResolver(name string, resolver RecipientResolver) {
+	resolversLock.Lock()
+	defer resolversLock.Unlock()
+	resolvers[name] = resolver
+}
+
+// MappingResolver resolves the recipients using the mapping of the configuration
+type MappingResolver struct {
+	// Key is the expression whose result is the key of the mapping, the expression receives the variables of the
+	// notification and the abstract recipient in the recipient variable, the key is the recipient if it is not set
+	Key string `json:"key,omitempty"`
+	// Mapping holds the recipients by key
+	Mapping map[string][]string `json:"mapping"`
+	// Default holds the recipients of the keys that are not mapped
+	Default []string `json:"default,omitempty"`
+}
+
+func (r *MappingResolver) validate() error {
+	if r == nil || (len(r.Mapping) == 0 && len(r.Default) == 0) {
+		return errors.New("mapping must not be empty")
+	}
+	if r.Key != "" {
+		if _, err := expr.Compile(r.Key); err != nil {
+			return fmt.Errorf("invalid key: %v", err)
+		}
+	}
+	return nil
+}
+
+func (r *MappingResolver) Resolve(_ context.Context, recipient string, vars map[string]interface{}) ([]string, error) {
+	key := recipient
+	if r.Key != "" {
+		in := make(map[string]interface{}, len(vars)+1)
+		for k := range vars {
+			in[k] = vars[k]
+		}
+		in[recipientVarName] = recipient
+		res, err := expr.Eval(r.Key, in)
+		if err != nil {
+			return nil, err
+		}
+		key = fmt.Sprint(res)
+	}
+	if recipients, ok := r.Mapping[key]; ok {
+		return recipients, nil
+	}
+	return r.Default, nil
+}
+
+// getResolver returns the resolver of the given name
+func (n *api) getResolver(name string) (RecipientResolver, error) {
+	if resolver, ok := n.config.RecipientResolvers[name]; ok {
+		return resolver, nil
+	}
+	resolversLock.RLock()
+	defer resolversLock.RUnlock()
+	if resolver, ok := resolvers[name]; ok {
+		return resolver, nil
+	}
+	return nil, fmt.Errorf("recipient resolver '%s' is not supported", name)
+}
+
+// sendResolved sends the notification using the send function to every recipient the resolver of the destination
+// resolves the recipient of the destination into, the resolved destinations keep the other parameters. The resolved
+// recipients that the self-service policy of the configuration does not allow are not notified, like the recipients
+// whose notification is a duplicate or is not sent because of the dry-run mode, and count as delivered. The recipients
+// that were delivered by previous attempts, see WithDeliveredRecipients, are skipped, and a PartialDeliveryError is
+// returned if the notification could only be delivered to some of the recipients
+func (n *api) sendResolved(ctx context.Context, vars map[string]interface{}, dest services.Destination, send func(dest services.Destination) error) error {
+	name := dest.Parameters[ResolverParameter]
+	resolver, err := n.getResolver(name)
+	if err != nil {
+		return err
+	}
+	recipients, err := resolver.Resolve(ctx, dest.Recipient, vars)
+	if err != nil {
+		return fmt.Errorf("failed to resolve recipient '%s' using resolver %s: %v", dest.Recipient, name, err)
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf("resolver %s resolved recipient '%s' into no recipients", name, dest.Recipient)
+	}
+	var parameters map[string]string
+	for k, v := range dest.Parameters {
+		if k == ResolverParameter {
+			continue
+		}
+		if parameters == nil {
+			parameters = map[string]string{}
+		}
+		parameters[k] = v
+	}
+	previous, _ := ctx.Value(deliveredRecipientsKey{}).([]string)
+	var delivered []string
+	var errs []error
+	sent := false
+	// skipped is the error of the recipients that were not sent because of the deduplication or the dry-run mode
+	var skipped error
+	for _, recipient := range recipients {
+		if slices.Contains(previous, recipient) {
+			delivered = append(delivered, recipient)
+			continue
+		}
+		resolved := services.Destination{Service: dest.Service, Recipient: recipient, Parameters: parameters}
+		if policy := n.config.SelfServicePolicy; policy != nil && !policy.allowsDestination(resolved) {
+			log.Warnf("Resolved recipient '%s' of '%s' is not allowed by the self-service policy, skipping it", recipient, dest.Recipient)
+			delivered = append(delivered, recipient)
+			continue
+		}
+		if err := send(resolved); errors.Is(err, ErrDuplicate) || errors.Is(err, ErrDryRun) {
+			log.Infof("Notification to resolved recipient '%s' of '%s' is not sent: %v", recipient, dest.Recipient, err)
+			skipped = err
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify resolved recipient '%s': %w", recipient, err))
+			continue
+		} else {
+			sent = true
+		}
+		delivered = append(delivered, recipient)
+	}
+	if len(errs) == 0 {
+		if !sent && skipped != nil {
+			return skipped
+		}
+		return nil
+	}
+	if len(delivered) == 0 {
+		return errors.Join(errs...)
+	}
+	return &PartialDeliveryError{Delivered: delivered, Err: errors.Join(errs...)}
+}
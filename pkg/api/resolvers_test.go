@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/services/mocks"
+)
+
+func TestSend_Resolver(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := getConfig(ctrl, func(service *mocks.MockNotificationService) {
+		service.EXPECT().Send(services.Notification{Message: "hello world slack:payments-oncall"},
+			services.Destination{Service: "slack", Recipient: "payments-oncall", Parameters: map[string]string{"topic": "42"}}).Return(nil)
+		service.EXPECT().Send(services.Notification{Message: "hello world slack:payments-devs"},
+			services.Destination{Service: "slack", Recipient: "payments-devs", Parameters: map[string]string{"topic": "42"}}).Return(nil)
+	})
+	cfg.RecipientResolvers = map[string]*MappingResolver{
+		"team": {Key: "team + '-' + recipient", Mapping: map[string][]string{"payments-owner": {"payments-oncall", "payments-devs"}}},
+	}
+	api, err := NewAPI(cfg, getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = api.Send(map[string]interface{}{"foo": "world", "team": "payments"}, []string{"my-template"},
+		services.Destination{Service: "slack", Recipient: "owner", Parameters: map[string]string{ResolverParameter: "team", "topic": "42"}})
+	assert.NoError(t, err)
+
+	err = api.Send(map[string]interface{}{"foo": "world", "team": "platform"}, []string{"my-template"},
+		services.Destination{Service: "slack", Recipient: "owner", Parameters: map[string]string{ResolverParameter: "team"}})
+	assert.EqualError(t, err, "resolver team resolved recipient 'owner' into no recipients")
+
+	err = api.Send(map[string]interface{}{"foo": "world"}, []string{"my-template"},
+		services.Destination{Service: "slack", Recipient: "owner", Parameters: map[string]string{ResolverParameter: "unknown"}})
+	assert.EqualError(t, err, "recipient resolver 'unknown' is not supported")
+}
+
+func TestSend_ResolverSelfServicePolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := getConfig(ctrl, func(service *mocks.MockNotificationService) {
+		service.EXPECT().Send(services.Notification{Message: "hello world slack:team-payments"},
+			services.Destination{Service: "slack", Recipient: "team-payments"}).Return(nil)
+	})
+	cfg.RecipientResolvers = map[string]*MappingResolver{
+		"team": {Default: []string{"team-payments", "platform"}},
+	}
+	cfg.SelfServicePolicy = &SelfServicePolicy{AllowedDestinations: []string{"slack:team-*"}}
+	api, err := NewAPI(cfg, getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = api.Send(map[string]interface{}{"foo": "world"}, []string{"my-template"},
+		services.Destination{Service: "slack", Recipient: "owner", Parameters: map[string]string{ResolverParameter: "team"}})
+	// the recipient that is not allowed is skipped instead of failing the delivery
+	assert.NoError(t, err)
+}
+
+func TestSend_ResolverDryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := getConfig(ctrl)
+	cfg.RecipientResolvers = map[string]*MappingResolver{"team": {Default: []string{"oncall", "devs"}}}
+	cfg.DryRunServices = map[string]bool{"slack": true}
+	api, err := NewAPI(cfg, getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = api.Send(map[string]interface{}{"foo": "world"}, []string{"my-template"},
+		services.Destination{Service: "slack", Recipient: "owner", Parameters: map[string]string{ResolverParameter: "team"}})
+	var partialErr *PartialDeliveryError
+	assert.False(t, errors.As(err, &partialErr))
+	assert.ErrorIs(t, err, ErrDryRun)
+}
+
+func TestSend_ResolverPartialDelivery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := getConfig(ctrl, func(service *mocks.MockNotificationService) {
+		service.EXPECT().Send(services.Notification{Message: "hello world slack:oncall"},
+			services.Destination{Service: "slack", Recipient: "oncall"}).Return(nil)
+		service.EXPECT().Send(services.Notification{Message: "hello world slack:devs"},
+			services.Destination{Service: "slack", Recipient: "devs"}).Return(errors.New("service unavailable")).Times(2)
+	})
+	cfg.RecipientResolvers = map[string]*MappingResolver{"team": {Default: []string{"oncall", "devs"}}}
+	api, err := NewAPI(cfg, getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	dest := services.Destination{Service: "slack", Recipient: "owner", Parameters: map[string]string{ResolverParameter: "team"}}
+
+	err = api.SendWithContext(context.Background(), map[string]interface{}{"foo": "world"}, []string{"my-template"}, dest)
+	var partialErr *PartialDeliveryError
+	if assert.ErrorAs(t, err, &partialErr) {
+		assert.Equal(t, []string{"oncall"}, partialErr.Delivered)
+	}
+
+	// the retry only notifies the recipients that were not delivered
+	err = api.SendWithContext(WithDeliveredRecipients(context.Background(), partialErr.Delivered), map[string]interface{}{"foo": "world"}, []string{"my-template"}, dest)
+	if assert.ErrorAs(t, err, &partialErr) {
+		assert.Equal(t, []string{"oncall"}, partialErr.Delivered)
+	}
+}
+
+type staticResolver []string
+
+func (r staticResolver) Resolve(_ context.Context, _ string, _ map[string]interface{}) ([]string, error) {
+	return r, nil
+}
+
+func TestRegisterRecipientResolver(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	RegisterRecipientResolver("static", staticResolver{"my-channel"})
+	api, err := NewAPI(getConfig(ctrl, func(service *mocks.MockNotificationService) {
+		service.EXPECT().Send(services.Notification{Message: "hello world slack:my-channel"},
+			services.Destination{Service: "slack", Recipient: "my-channel"}).Return(nil)
+	}), getVars)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = api.Send(map[string]interface{}{"foo": "world"}, []string{"my-template"},
+		services.Destination{Service: "slack", Recipient: "owner", Parameters: map[string]string{ResolverParameter: "static"}})
+	assert.NoError(t, err)
+}
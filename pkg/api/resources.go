@@ -0,0 +1,338 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	// TriggersResource is the custom resource that defines a trigger, the spec holds the list of conditions
+	TriggersResource = schema.GroupVersionResource{Group: "notifications.argoproj.io", Version: "v1alpha1", Resource: "notificationtriggers"}
+	// TemplatesResource is the custom resource that defines a template, the spec holds the template
+	TemplatesResource = schema.GroupVersionResource{Group: "notifications.argoproj.io", Version: "v1alpha1", Resource: "notificationtemplates"}
+	// ServicesResource is the custom resource that defines a service, the spec holds the type and the configuration
+	ServicesResource = schema.GroupVersionResource{Group: "notifications.argoproj.io", Version: "v1alpha1", Resource: "notificationservices"}
+
+	configResources = []schema.GroupVersionResource{TriggersResource, TemplatesResource, ServicesResource}
+)
+
+const (
+	// ConfigResourceValidCondition is the type of the status condition that reports if the resource is valid
+	ConfigResourceValidCondition = "Valid"
+)
+
+// ConfigResourceStatusUpdater is implemented by the factories that merge custom resources into the configuration. The
+// controller runs the updates while it processes resources, so that only the leader reports the validation results
+type ConfigResourceStatusUpdater interface {
+	// RunConfigResourceStatusUpdates reports the result of the validation of the resources in their status until the
+	// context is done
+	RunConfigResourceStatusUpdates(ctx context.Context)
+}
+
+// configResourceKey is the key of a resource whose status is updated
+type configResourceKey struct {
+	resource schema.GroupVersionResource
+	key      string
+}
+
+// WithConfigResources merges the triggers, templates and services defined by custom resources into the configuration
+// of the ConfigMap in the same namespace. A resource overrides the ConfigMap key of the same name and resources that
+// fail validation are skipped, the result of the validation is reported in the status of the resource by the
+// controller, see ConfigResourceStatusUpdater. The informers are created using the given informer factory, which must
+// be started after the creation of the API factory
+func WithConfigResources(client dynamic.Interface, informers dynamicinformer.DynamicSharedInformerFactory) FactoryOption {
+	return func(f *apiFactory) {
+		f.resourcesClient = client
+		f.resourceListers = map[schema.GroupVersionResource]cache.GenericLister{}
+		for _, resource := range configResources {
+			resource := resource
+			informer := informers.ForResource(resource)
+			f.resourceListers[resource] = informer.Lister()
+			informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+				AddFunc: func(obj interface{}) {
+					f.onConfigResourceChanged(resource, obj)
+				},
+				DeleteFunc: func(obj interface{}) {
+					if metaObj, ok := obj.(metav1.Object); ok {
+						f.invalidate(metaObj)
+					}
+				},
+				UpdateFunc: func(oldObj, newObj interface{}) {
+					// the updates of the status and the resyncs don't change the configuration
+					if oldUn, ok := oldObj.(*unstructured.Unstructured); ok {
+						if newUn, ok := newObj.(*unstructured.Unstructured); ok && equality.Semantic.DeepEqual(oldUn.Object["spec"], newUn.Object["spec"]) {
+							return
+						}
+					}
+					f.onConfigResourceChanged(resource, newObj)
+				}})
+		}
+	}
+}
+
+// configResourceEntry returns the ConfigMap key and value equivalent to the resource
+func configResourceEntry(resource schema.GroupVersionResource, obj *unstructured.Unstructured) (string, string, error) {
+	var key string
+	var spec interface{}
+	switch resource {
+	case TriggersResource:
+		key = "trigger." + obj.GetName()
+		spec, _, _ = unstructured.NestedFieldNoCopy(obj.Object, "spec", "conditions")
+	case TemplatesResource:
+		key = "template." + obj.GetName()
+		spec = obj.Object["spec"]
+	case ServicesResource:
+		serviceType, _, _ := unstructured.NestedString(obj.Object, "spec", "type")
+		if serviceType == "" {
+			return "", "", fmt.Errorf("service must specify a type")
+		}
+		key = "service." + serviceType
+		if obj.GetName() != serviceType {
+			key += "." + obj.GetName()
+		}
+		spec, _, _ = unstructured.NestedFieldNoCopy(obj.Object, "spec", "config")
+	default:
+		return "", "", fmt.Errorf("unsupported resource %s", resource.Resource)
+	}
+	if spec == nil {
+		spec = map[string]interface{}{}
+	}
+	value, err := yaml.Marshal(spec)
+	if err != nil {
+		return "", "", err
+	}
+	return key, string(value), nil
+}
+
+// validateConfigEntry parses the ConfigMap key and value and creates the triggers, templates and services it defines
+func validateConfigEntry(key string, value string, secret *v1.Secret) error {
+	return ValidateConfig(&v1.ConfigMap{Data: map[string]string{key: value}}, secret)
+}
+
+// ValidateConfig returns an error if the configuration fails to parse or its triggers, templates or services are
+// invalid. The secret provides the values referenced by the configuration of services, the services are not
+// instantiated if the secret is nil since the values of the references are unknown
+func ValidateConfig(cm *v1.ConfigMap, secret *v1.Secret) error {
+	cfg, err := ParseConfig(cm, secret)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		cfg.Services = nil
+	}
+	_, err = NewAPI(*cfg, nil)
+	return err
+}
+
+// ValidateConfigResource returns an error if the trigger, template or service defined by the resource is invalid. The
+// secret provides the values referenced by the configuration of services, see ValidateConfig
+func ValidateConfigResource(resource schema.GroupVersionResource, obj *unstructured.Unstructured, secret *v1.Secret) error {
+	key, value, err := configResourceEntry(resource, obj)
+	if err != nil {
+		return err
+	}
+	return validateConfigEntry(key, value, secret)
+}
+
+// serviceName returns the name of the service defined by the ConfigMap key
+func serviceName(key string) string {
+	parts := strings.Split(key, ".")
+	return parts[len(parts)-1]
+}
+
+// mergeConfigResources returns a copy of the ConfigMap with the entries of the valid resources in the namespace
+func (f *apiFactory) mergeConfigResources(namespace string, cm *v1.ConfigMap, secret *v1.Secret) (*v1.ConfigMap, error) {
+	cm = cm.DeepCopy()
+	cm.Namespace = namespace
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	for _, resource := range configResources {
+		objs, err := f.resourceListers[resource].ByNamespace(namespace).List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(objs, func(i, j int) bool {
+			return objs[i].(metav1.Object).GetName() < objs[j].(metav1.Object).GetName()
+		})
+		for _, obj := range objs {
+			un, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			key, value, err := configResourceEntry(resource, un)
+			if err == nil {
+				err = validateConfigEntry(key, value, secret)
+			}
+			if err != nil {
+				log.Warnf("Skipping invalid %s %s/%s: %v", resource.Resource, namespace, un.GetName(), err)
+				continue
+			}
+			if resource == ServicesResource {
+				for existing := range cm.Data {
+					if strings.HasPrefix(existing, "service.") && serviceName(existing) == serviceName(key) {
+						delete(cm.Data, existing)
+					}
+				}
+			}
+			cm.Data[key] = value
+		}
+	}
+	return cm, nil
+}
+
+func (f *apiFactory) onConfigResourceChanged(resource schema.GroupVersionResource, obj interface{}) {
+	un, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	f.invalidate(un)
+	f.enqueueConfigResourceStatus(resource, un)
+}
+
+// enqueueConfigResourceStatus schedules the update of the status of the resource if the status updates are running
+func (f *apiFactory) enqueueConfigResourceStatus(resource schema.GroupVersionResource, obj metav1.Object) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	f.statusQueueLock.Lock()
+	defer f.statusQueueLock.Unlock()
+	if f.statusQueue != nil {
+		f.statusQueue.Add(configResourceKey{resource: resource, key: key})
+	}
+}
+
+func (f *apiFactory) RunConfigResourceStatusUpdates(ctx context.Context) {
+	if f.resourcesClient == nil {
+		return
+	}
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	f.statusQueueLock.Lock()
+	if f.statusQueue != nil {
+		// the updates are already run by another controller using the factory
+		f.statusQueueLock.Unlock()
+		return
+	}
+	f.statusQueue = queue
+	f.statusQueueLock.Unlock()
+	defer func() {
+		f.statusQueueLock.Lock()
+		f.statusQueue = nil
+		f.statusQueueLock.Unlock()
+	}()
+	go func() {
+		<-ctx.Done()
+		queue.ShutDown()
+	}()
+
+	// the resources that changed while another replica was the leader
+	for resource, lister := range f.resourceListers {
+		objs, err := lister.List(labels.Everything())
+		if err != nil {
+			log.Errorf("Failed to list %s: %v", resource.Resource, err)
+			continue
+		}
+		for _, obj := range objs {
+			if metaObj, ok := obj.(metav1.Object); ok {
+				f.enqueueConfigResourceStatus(resource, metaObj)
+			}
+		}
+	}
+	for f.processConfigResourceStatus(ctx, queue) {
+	}
+}
+
+// processConfigResourceStatus validates the next resource of the queue and updates its status, the update is retried
+// if it fails
+func (f *apiFactory) processConfigResourceStatus(ctx context.Context, queue workqueue.RateLimitingInterface) bool {
+	item, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(item)
+	key := item.(configResourceKey)
+	namespace, name, err := cache.SplitMetaNamespaceKey(key.key)
+	if err != nil {
+		queue.Forget(item)
+		return true
+	}
+	obj, err := f.resourceListers[key.resource].ByNamespace(namespace).Get(name)
+	if err != nil {
+		// the resource was deleted
+		queue.Forget(item)
+		return true
+	}
+	un, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		queue.Forget(item)
+		return true
+	}
+
+	_, secret, err := f.getConfigMapAndSecret(namespace)
+	if err == nil {
+		err = f.updateConfigResourceStatus(ctx, key.resource, un, ValidateConfigResource(key.resource, un, secret))
+	}
+	if err != nil {
+		log.Errorf("Failed to update the status of %s %s: %v", key.resource.Resource, key.key, err)
+		queue.AddRateLimited(item)
+		return true
+	}
+	queue.Forget(item)
+	return true
+}
+
+// updateConfigResourceStatus sets the valid condition of the resource according to the validation error, the
+// resource is not updated if the condition did not change
+func (f *apiFactory) updateConfigResourceStatus(ctx context.Context, resource schema.GroupVersionResource, obj *unstructured.Unstructured, validationErr error) error {
+	condition := metav1.Condition{
+		Type:               ConfigResourceValidCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Valid",
+		ObservedGeneration: obj.GetGeneration(),
+	}
+	if validationErr != nil {
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, "InvalidSpec", validationErr.Error()
+	}
+
+	var status struct {
+		Conditions []metav1.Condition `json:"conditions,omitempty"`
+	}
+	if existing, ok := obj.Object["status"].(map[string]interface{}); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(existing, &status); err != nil {
+			return err
+		}
+	}
+	if existing := meta.FindStatusCondition(status.Conditions, condition.Type); existing != nil &&
+		existing.Status == condition.Status && existing.Reason == condition.Reason &&
+		existing.Message == condition.Message && existing.ObservedGeneration == condition.ObservedGeneration {
+		return nil
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+
+	updated, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+	obj = obj.DeepCopy()
+	obj.Object["status"] = updated
+	_, err = f.resourcesClient.Resource(resource).Namespace(obj.GetNamespace()).UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newConfigResource(kind string, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "notifications.argoproj.io/v1alpha1",
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+		"spec":       spec,
+	}}
+}
+
+func getValidCondition(t *testing.T, obj *unstructured.Unstructured) *metav1.Condition {
+	var status struct {
+		Conditions []metav1.Condition `json:"conditions"`
+	}
+	if raw, ok := obj.Object["status"].(map[string]interface{}); ok {
+		require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &status))
+	}
+	return meta.FindStatusCondition(status.Conditions, ConfigResourceValidCondition)
+}
+
+func TestGetAPI_ConfigResources(t *testing.T) {
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-config-map", Namespace: "default"},
+		Data: map[string]string{
+			"service.email.team":   `{"username": "test"}`,
+			"template.my-template": `message: from config map`,
+		},
+	}
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-secret", Namespace: "default"},
+		Data:       map[string][]byte{"slack-token": []byte("abc")},
+	}
+	clientset := fake.NewSimpleClientset(cm, secret)
+	informerFactory := informers.NewSharedInformerFactory(clientset, time.Minute)
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		TriggersResource:  "NotificationTriggerList",
+		TemplatesResource: "NotificationTemplateList",
+		ServicesResource:  "NotificationServiceList",
+	},
+		newConfigResource("NotificationTemplate", "my-template", map[string]interface{}{"message": "from resource"}),
+		newConfigResource("NotificationTrigger", "on-sync", map[string]interface{}{
+			"conditions": []interface{}{map[string]interface{}{"when": "true", "send": []interface{}{"my-template"}}},
+		}),
+		newConfigResource("NotificationTrigger", "invalid", map[string]interface{}{
+			"conditions": []interface{}{map[string]interface{}{"when": "app.status ==", "send": []interface{}{"my-template"}}},
+		}),
+		newConfigResource("NotificationService", "team", map[string]interface{}{
+			"type":   "slack",
+			"config": map[string]interface{}{"token": "$slack-token"},
+		}),
+	)
+	dynamicInformerFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, time.Minute)
+
+	secrets := informerFactory.Core().V1().Secrets().Informer()
+	configMaps := informerFactory.Core().V1().ConfigMaps().Informer()
+	factory := NewFactory(settings, "default", secrets, configMaps, WithConfigResources(dynamicClient, dynamicInformerFactory))
+
+	go informerFactory.Start(context.Background().Done())
+	if !cache.WaitForCacheSync(context.Background().Done(), configMaps.HasSynced, secrets.HasSynced) {
+		assert.Fail(t, "failed to sync informers")
+	}
+	dynamicInformerFactory.Start(context.Background().Done())
+	for resource, synced := range dynamicInformerFactory.WaitForCacheSync(context.Background().Done()) {
+		require.True(t, synced, "failed to sync informer of %s", resource.Resource)
+	}
+
+	api, err := factory.GetAPI()
+	require.NoError(t, err)
+
+	cfg := api.GetConfig()
+	assert.False(t, cfg.IsSelfServiceConfig)
+	assert.Equal(t, "from resource", cfg.Templates["my-template"].Message)
+	assert.Contains(t, cfg.Triggers, "on-sync")
+	assert.NotContains(t, cfg.Triggers, "invalid")
+	svcs := api.GetNotificationServices()
+	assert.Len(t, svcs, 1)
+	assert.NotNil(t, svcs["team"])
+
+	// the status is only updated by the controller running the status updates
+	obj, err := dynamicClient.Resource(TriggersResource).Namespace("default").Get(context.Background(), "invalid", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, getValidCondition(t, obj))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go factory.RunConfigResourceStatusUpdates(ctx)
+
+	assert.Eventually(t, func() bool {
+		obj, err := dynamicClient.Resource(TriggersResource).Namespace("default").Get(context.Background(), "invalid", metav1.GetOptions{})
+		require.NoError(t, err)
+		condition := getValidCondition(t, obj)
+		return condition != nil && condition.Status == metav1.ConditionFalse && condition.Reason == "InvalidSpec"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		obj, err := dynamicClient.Resource(TriggersResource).Namespace("default").Get(context.Background(), "on-sync", metav1.GetOptions{})
+		require.NoError(t, err)
+		condition := getValidCondition(t, obj)
+		return condition != nil && condition.Status == metav1.ConditionTrue
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the status updates don't invalidate the cached configuration
+	cached, err := factory.GetAPI()
+	require.NoError(t, err)
+	assert.Same(t, api, cached)
+}
+
+func TestConfigResourceEntry(t *testing.T) {
+	key, value, err := configResourceEntry(ServicesResource, newConfigResource("NotificationService", "slack", map[string]interface{}{
+		"type":   "slack",
+		"config": map[string]interface{}{"token": "abc"},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "service.slack", key)
+	assert.Equal(t, "token: abc\n", value)
+
+	_, _, err = configResourceEntry(ServicesResource, newConfigResource("NotificationService", "team", map[string]interface{}{}))
+	assert.EqualError(t, err, "service must specify a type")
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/strings/slices"
+	"sigs.k8s.io/yaml"
+
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+)
+
+// selfServicePoliciesKey is the key of the ConfigMap of the default namespace that holds the self-service policies
+const selfServicePoliciesKey = "selfServicePolicies"
+
+// SelfServicePolicy restricts the destinations that the subscriptions of the configuration of namespaces can use
+type SelfServicePolicy struct {
+	// Namespaces holds the names of the namespaces of the policy, the names can be glob patterns, e.g. team-*
+	Namespaces []string `json:"namespaces"`
+	// AllowedDestinations holds the services the subscriptions can use, optionally limited to the recipients matching
+	// a glob pattern, e.g. slack or slack:team-*
+	AllowedDestinations []string `json:"allowedDestinations"`
+}
+
+// parseSelfServicePolicies returns the self-service policies of the ConfigMap of the default namespace
+func parseSelfServicePolicies(cm *v1.ConfigMap) ([]SelfServicePolicy, error) {
+	var policies []SelfServicePolicy
+	if err := yaml.Unmarshal([]byte(cm.Data[selfServicePoliciesKey]), &policies); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal self-service policies: %v", err)
+	}
+	for i, policy := range policies {
+		for _, pattern := range append(policy.Namespaces, policy.AllowedDestinations...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern '%s' of self-service policy %d: %v", pattern, i+1, err)
+			}
+		}
+	}
+	return policies, nil
+}
+
+// getSelfServicePolicy returns the first policy of the namespace, or nil if the destinations of the namespace are not
+// restricted
+func getSelfServicePolicy(policies []SelfServicePolicy, namespace string) *SelfServicePolicy {
+	for i := range policies {
+		for _, pattern := range policies[i].Namespaces {
+			if matches, _ := path.Match(pattern, namespace); matches {
+				return &policies[i]
+			}
+		}
+	}
+	return nil
+}
+
+// allowsDestination returns true if the service and, unless the recipient is resolved when the notification is sent,
+// the recipient of the destination match an allowed destination
+func (p *SelfServicePolicy) allowsDestination(dest services.Destination) bool {
+	for _, allowed := range p.AllowedDestinations {
+		allowedDest := parseRecipient(allowed)
+		if allowedDest.Service != dest.Service {
+			continue
+		}
+		if allowedDest.Recipient == "" || dest.Parameters[ResolverParameter] != "" {
+			return true
+		}
+		if matches, _ := path.Match(allowedDest.Recipient, dest.Recipient); matches {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an error naming the destination that the policy does not allow the notifications to the destination
+// to be sent to. Besides the destination itself, the notifications are sent to the fallback of its parameters once they
+// are given up. Digests of the destination are sent to the destination itself, and the recipients of resolvers are
+// checked when they are resolved
+func (p *SelfServicePolicy) Check(dest services.Destination) error {
+	if !p.allowsDestination(dest) {
+		return fmt.Errorf("the destination %s:%s is not allowed by the self-service policy (allowed: %s)",
+			dest.Service, dest.Recipient, strings.Join(p.AllowedDestinations, ", "))
+	}
+	if service := dest.Parameters[FallbackServiceParameter]; service != "" {
+		fallback := services.Destination{Service: service, Recipient: dest.Parameters[FallbackRecipientParameter]}
+		if !p.allowsDestination(fallback) {
+			return fmt.Errorf("the fallback %s:%s of the destination %s:%s is not allowed by the self-service policy (allowed: %s)",
+				fallback.Service, fallback.Recipient, dest.Service, dest.Recipient, strings.Join(p.AllowedDestinations, ", "))
+		}
+	}
+	return nil
+}
+
+// Filter returns the destinations that the policy allows the subscriptions to use and the errors of the destinations
+// that are not allowed
+func (p *SelfServicePolicy) Filter(dests services.Destinations) (services.Destinations, []error) {
+	res := services.Destinations{}
+	var rejected []error
+	for trigger, destinations := range dests {
+		for _, dest := range destinations {
+			if err := p.Check(dest); err != nil {
+				rejected = append(rejected, fmt.Errorf("subscription of trigger %s is ignored: %v", trigger, err))
+				continue
+			}
+			res[trigger] = append(res[trigger], dest)
+		}
+	}
+	return res, rejected
+}
+
+// validateSubscriptions returns an error if the subscriptions use a destination that the policy does not allow, the
+// recipient groups of the subscriptions are expanded using the given configuration
+func (p *SelfServicePolicy) validateSubscriptions(cfg Config, subs subscriptions.DefaultSubscriptions) error {
+	for i, sub := range subs {
+		dests := services.Destinations{}
+		for _, recipient := range sub.Recipients {
+			dests[""] = append(dests[""], parseRecipient(recipient))
+		}
+		for _, destination := range sub.Destinations {
+			for _, recipient := range destination.Recipients {
+				dests[""] = append(dests[""], services.Destination{Service: destination.Service, Recipient: recipient, Parameters: destination.Parameters})
+			}
+		}
+		for _, dest := range cfg.ExpandRecipientGroups(dests)[""] {
+			if err := p.Check(dest); err != nil {
+				return fmt.Errorf("subscription %d: %v", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// isContributedKey returns true if the ConfigMap key can be contributed by the configuration of a namespace
+func isContributedKey(key string) bool {
+	return strings.HasPrefix(key, "template.") || strings.HasPrefix(key, "trigger.") ||
+		key == "subscriptions" || key == "defaultTriggers" || strings.HasPrefix(key, "defaultTriggers.")
+}
+
+// getContributedConfigMapAndSecret returns the configuration of the default namespace limited to the allowed services,
+// with the templates, triggers and subscriptions contributed by the configuration of the namespace. Templates and
+// triggers of the namespace override the ones of the same name and subscriptions are added to the default ones
+func (f *apiFactory) getContributedConfigMapAndSecret(namespace string) (*v1.ConfigMap, *v1.Secret, error) {
+	cm, secret, err := f.getMergedConfigMapAndSecret(f.DefaultNamespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	contributedCm, _, err := f.getMergedConfigMapAndSecret(namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	contributed := cm.DeepCopy()
+	contributed.Namespace = namespace
+	contributed.Data = map[string]string{}
+	for k, v := range cm.Data {
+		if strings.HasPrefix(k, "service.") && !slices.Contains(f.SelfServiceAllowedServices, serviceName(k)) {
+			continue
+		}
+		contributed.Data[k] = v
+	}
+	for k, v := range contributedCm.Data {
+		if !isContributedKey(k) {
+			log.Warnf("Ignoring key %s of the configuration in namespace %s, namespaces can only contribute templates, triggers and subscriptions", k, namespace)
+			continue
+		}
+		if k == "subscriptions" {
+			if err := validateContributedSubscriptions(cm, namespace, v); err != nil {
+				return nil, nil, err
+			}
+		}
+		if k == "subscriptions" && contributed.Data[k] != "" {
+			if v, err = mergeSubscriptions(contributed.Data[k], v); err != nil {
+				return nil, nil, fmt.Errorf("failed to merge subscriptions of namespace %s: %v", namespace, err)
+			}
+		}
+		contributed.Data[k] = v
+	}
+	return contributed, secret, nil
+}
+
+// validateContributedSubscriptions returns an error if the subscriptions contributed by the namespace use a destination
+// that the self-service policy of the namespace does not allow, the subscriptions of the default namespace are not
+// restricted
+func validateContributedSubscriptions(cm *v1.ConfigMap, namespace string, subscriptionsYaml string) error {
+	policies, err := parseSelfServicePolicies(cm)
+	if err != nil {
+		return err
+	}
+	policy := getSelfServicePolicy(policies, namespace)
+	if policy == nil {
+		return nil
+	}
+	var subs subscriptions.DefaultSubscriptions
+	if err := yaml.Unmarshal([]byte(subscriptionsYaml), &subs); err != nil {
+		return fmt.Errorf("failed to unmarshal subscriptions of namespace %s: %v", namespace, err)
+	}
+	cfg := Config{}
+	if err := yaml.Unmarshal([]byte(cm.Data["recipientGroups"]), &cfg.RecipientGroups); err != nil {
+		return fmt.Errorf("failed to unmarshal recipient groups: %v", err)
+	}
+	if err := policy.validateSubscriptions(cfg, subs); err != nil {
+		return fmt.Errorf("invalid subscriptions of namespace %s: %v", namespace, err)
+	}
+	return nil
+}
+
+// getSelfServicePolicy returns the self-service policy of the namespace of the configuration of the default namespace
+func (f *apiFactory) getSelfServicePolicy(namespace string) (*SelfServicePolicy, error) {
+	cm, _, err := f.getMergedConfigMapAndSecret(f.DefaultNamespace)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := parseSelfServicePolicies(cm)
+	if err != nil {
+		return nil, err
+	}
+	return getSelfServicePolicy(policies, namespace), nil
+}
+
+func mergeSubscriptions(defaultYaml string, contributedYaml string) (string, error) {
+	var defaults, contributed []interface{}
+	if err := yaml.Unmarshal([]byte(defaultYaml), &defaults); err != nil {
+		return "", err
+	}
+	if err := yaml.Unmarshal([]byte(contributedYaml), &contributed); err != nil {
+		return "", err
+	}
+	merged, err := yaml.Marshal(append(defaults, contributed...))
+	if err != nil {
+		return "", err
+	}
+	return string(merged), nil
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/argoproj/notifications-engine/pkg/services"
+)
+
+func TestGetAPIsFromNamespace_SelfServiceContributions(t *testing.T) {
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-config-map", Namespace: "default"},
+		Data: map[string]string{
+			"service.slack":        `{"token": "abc"}`,
+			"service.email":        `{"username": "test"}`,
+			"template.my-template": `message: default`,
+			"trigger.on-sync":      `[{"when": "true", "send": ["my-template"]}]`,
+			"subscriptions":        `[{"recipients": ["slack:platform"]}]`,
+		},
+	}
+	teamCm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-config-map", Namespace: "team"},
+		Data: map[string]string{
+			"service.webhook.team":  `{"url": "https://example.com"}`,
+			"template.team-message": `message: team`,
+			"subscriptions":         `[{"recipients": ["slack:team"], "triggers": ["on-sync"]}]`,
+		},
+	}
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-secret", Namespace: "default"},
+	}
+
+	clientset := fake.NewSimpleClientset(cm, teamCm, secret)
+	informerFactory := informers.NewSharedInformerFactory(clientset, time.Minute)
+
+	secrets := informerFactory.Core().V1().Secrets().Informer()
+	configMaps := informerFactory.Core().V1().ConfigMaps().Informer()
+	selfServiceSettings := settings
+	selfServiceSettings.SelfServiceContributions = true
+	selfServiceSettings.SelfServiceAllowedServices = []string{"slack"}
+	factory := NewFactory(selfServiceSettings, "default", secrets, configMaps)
+
+	go informerFactory.Start(context.Background().Done())
+	if !cache.WaitForCacheSync(context.Background().Done(), configMaps.HasSynced, secrets.HasSynced) {
+		assert.Fail(t, "failed to sync informers")
+	}
+
+	apis, err := factory.GetAPIsFromNamespace("team")
+	require.NoError(t, err)
+	require.Len(t, apis, 1)
+	api := apis["team"]
+	require.NotNil(t, api)
+
+	cfg := api.GetConfig()
+	assert.True(t, cfg.IsSelfServiceConfig)
+	assert.Equal(t, "team", cfg.Namespace)
+	assert.Contains(t, cfg.Templates, "my-template")
+	assert.Contains(t, cfg.Templates, "team-message")
+	assert.Contains(t, cfg.Triggers, "on-sync")
+	assert.Len(t, cfg.Subscriptions, 2)
+	svcs := api.GetNotificationServices()
+	assert.Len(t, svcs, 1)
+	assert.NotNil(t, svcs["slack"])
+
+	apis, err = factory.GetAPIsFromNamespace("other")
+	require.NoError(t, err)
+	require.Len(t, apis, 1)
+	assert.NotNil(t, apis["default"])
+	assert.Len(t, apis["default"].GetNotificationServices(), 2)
+
+	_, err = clientset.CoreV1().ConfigMaps("default").Update(context.Background(), &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-config-map", Namespace: "default"},
+		Data: map[string]string{
+			"service.slack":        `{"token": "abc"}`,
+			"template.my-template": `message: updated`,
+		},
+	}, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	time.Sleep(1 * time.Second)
+
+	apis, err = factory.GetAPIsFromNamespace("team")
+	require.NoError(t, err)
+	assert.Equal(t, "updated", apis["team"].GetConfig().Templates["my-template"].Message)
+	assert.Len(t, apis["team"].GetConfig().Subscriptions, 1)
+}
+
+func TestGetAPIsFromNamespace_SelfServicePolicy(t *testing.T) {
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-config-map", Namespace: "default"},
+		Data: map[string]string{
+			"service.slack":     `{"token": "abc"}`,
+			"service.pagerduty": `{"token": "abc"}`,
+			"subscriptions":     `[{"recipients": ["pagerduty:platform"]}]`,
+			"recipientGroups":   `{"team-payments": ["slack:team-payments", "pagerduty:payments"]}`,
+			"selfServicePolicies": `
+- namespaces: [team-*]
+  allowedDestinations: [slack, "pagerduty:team-*"]`,
+		},
+	}
+	newTeamCm := func(namespace string, subscriptions string) *v1.ConfigMap {
+		return &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "my-config-map", Namespace: namespace},
+			Data:       map[string]string{"subscriptions": subscriptions},
+		}
+	}
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-secret", Namespace: "default"},
+	}
+
+	clientset := fake.NewSimpleClientset(cm, secret,
+		newTeamCm("team-allowed", `[{"recipients": ["slack:team", "pagerduty:team-payments"]}]`),
+		newTeamCm("team-denied", `[{"recipients": ["pagerduty:platform"]}]`),
+		newTeamCm("team-group", `[{"recipients": ["group:team-payments"]}]`),
+		newTeamCm("team-fallback", `[{"destinations": [{"service": "slack", "recipients": ["team"], "parameters": {"fallbackService": "pagerduty", "fallbackRecipient": "platform"}}]}]`),
+		newTeamCm("unrestricted", `[{"recipients": ["pagerduty:platform"]}]`))
+	informerFactory := informers.NewSharedInformerFactory(clientset, time.Minute)
+
+	secrets := informerFactory.Core().V1().Secrets().Informer()
+	configMaps := informerFactory.Core().V1().ConfigMaps().Informer()
+	selfServiceSettings := settings
+	selfServiceSettings.SelfServiceContributions = true
+	selfServiceSettings.SelfServiceAllowedServices = []string{"slack", "pagerduty"}
+	factory := NewFactory(selfServiceSettings, "default", secrets, configMaps)
+
+	go informerFactory.Start(context.Background().Done())
+	if !cache.WaitForCacheSync(context.Background().Done(), configMaps.HasSynced, secrets.HasSynced) {
+		assert.Fail(t, "failed to sync informers")
+	}
+
+	apis, err := factory.GetAPIsFromNamespace("team-allowed")
+	require.NoError(t, err)
+	require.NotNil(t, apis["team-allowed"])
+	assert.Len(t, apis["team-allowed"].GetConfig().Subscriptions, 2)
+	assert.NotNil(t, apis["team-allowed"].GetConfig().SelfServicePolicy)
+
+	_, err = factory.GetAPIsFromNamespace("team-denied")
+	assert.ErrorContains(t, err, "invalid subscriptions of namespace team-denied: subscription 1: the destination pagerduty:platform is not allowed by the self-service policy (allowed: slack, pagerduty:team-*)")
+
+	_, err = factory.GetAPIsFromNamespace("team-group")
+	assert.ErrorContains(t, err, "subscription 1: the destination pagerduty:payments is not allowed")
+
+	_, err = factory.GetAPIsFromNamespace("team-fallback")
+	assert.ErrorContains(t, err, "subscription 1: the fallback pagerduty:platform of the destination slack:team is not allowed")
+
+	apis, err = factory.GetAPIsFromNamespace("unrestricted")
+	require.NoError(t, err)
+	require.NotNil(t, apis["unrestricted"])
+	assert.Nil(t, apis["unrestricted"].GetConfig().SelfServicePolicy)
+
+	// the policies also apply to the namespaces that configure notifications independently of the default namespace
+	factory = NewFactory(settings, "default", secrets, configMaps)
+	apis, err = factory.GetAPIsFromNamespace("team-denied")
+	assert.ErrorContains(t, err, "invalid subscriptions of namespace team-denied")
+	assert.NotNil(t, apis["default"])
+}
+
+func TestSelfServicePolicy_Filter(t *testing.T) {
+	policy := &SelfServicePolicy{AllowedDestinations: []string{"slack", "email:*@example.com"}}
+	allowed, rejected := policy.Filter(services.Destinations{"my-trigger": {
+		{Service: "slack", Recipient: "team"},
+		{Service: "email", Recipient: "team@example.com"},
+		{Service: "email", Recipient: "owner", Parameters: map[string]string{ResolverParameter: "owners"}},
+		{Service: "email", Recipient: "team@other.com"},
+		{Service: "pagerduty", Recipient: "team"},
+		{Service: "slack", Recipient: "team", Parameters: map[string]string{FallbackServiceParameter: "pagerduty", FallbackRecipientParameter: "team"}},
+	}})
+	assert.Equal(t, services.Destinations{"my-trigger": {
+		{Service: "slack", Recipient: "team"},
+		{Service: "email", Recipient: "team@example.com"},
+		{Service: "email", Recipient: "owner", Parameters: map[string]string{ResolverParameter: "owners"}},
+	}}, allowed)
+	assert.Len(t, rejected, 3)
+	assert.EqualError(t, rejected[2], "subscription of trigger my-trigger is ignored: the fallback pagerduty:team of the destination slack:team is not allowed by the self-service policy (allowed: slack, email:*@example.com)")
+}
+
+func TestParseSelfServicePolicies_Invalid(t *testing.T) {
+	_, err := parseSelfServicePolicies(&v1.ConfigMap{Data: map[string]string{"selfServicePolicies": `[{"namespaces": ["team-["]}]`}})
+	assert.EqualError(t, err, "invalid pattern 'team-[' of self-service policy 1: syntax error in pattern")
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/argoproj/notifications-engine/pkg/triggers"
+)
+
+// triggeredCallPattern matches the calls of the function of conditions that references other triggers with a literal name
+var triggeredCallPattern = regexp.MustCompile(triggers.TriggeredFunc + `\(\s*["']([^"']+)["']\s*\)`)
+
+// ValidateReferences returns an error listing the templates, triggers and services that the configuration references
+// but does not configure
+func (cfg Config) ValidateReferences() error {
+	problems := cfg.invalidReferences()
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid references: %s", strings.Join(problems, "; "))
+}
+
+// invalidReferences returns the sorted descriptions of the references to templates, triggers and services which are
+// not configured
+func (cfg Config) invalidReferences() []string {
+	var problems []string
+	checkTemplate := func(template string, owner string) {
+		if _, ok := cfg.Templates[template]; !ok {
+			problems = append(problems, fmt.Sprintf("%s references template %s which is not configured", owner, template))
+		}
+	}
+	checkTrigger := func(trigger string, owner string) {
+		if _, ok := cfg.Triggers[trigger]; !ok {
+			problems = append(problems, fmt.Sprintf("%s references trigger %s which is not configured", owner, trigger))
+		}
+	}
+	checkService := func(service string, owner string) {
+		if _, ok := cfg.Services[service]; !ok {
+			problems = append(problems, fmt.Sprintf("%s references service %s which is not configured", owner, service))
+		}
+	}
+
+	for name, conditions := range cfg.Triggers {
+		for _, condition := range conditions {
+			for _, template := range condition.Send {
+				checkTemplate(template, "trigger "+name)
+			}
+			if condition.OncePerResetBy != "" {
+				checkTrigger(condition.OncePerResetBy, "trigger "+name)
+			}
+			for _, match := range triggeredCallPattern.FindAllStringSubmatch(condition.When, -1) {
+				checkTrigger(match[1], "trigger "+name)
+			}
+		}
+	}
+	for i, subscription := range cfg.Subscriptions {
+		owner := fmt.Sprintf("subscription %d", i+1)
+		for _, trigger := range subscription.Triggers {
+			checkTrigger(trigger, owner)
+		}
+		for _, recipient := range subscription.Recipients {
+			checkService(strings.Split(recipient, ":")[0], owner)
+		}
+		for _, destination := range subscription.Destinations {
+			checkService(destination.Service, owner)
+		}
+	}
+	for _, trigger := range cfg.DefaultTriggers {
+		checkTrigger(trigger, "default triggers")
+	}
+	for service, triggers := range cfg.ServiceDefaultTriggers {
+		checkService(service, "default triggers of service "+service)
+		for _, trigger := range triggers {
+			checkTrigger(trigger, "default triggers of service "+service)
+		}
+	}
+	for service, fallback := range cfg.Fallbacks {
+		checkService(fallback.Service, "fallback of service "+service)
+	}
+	for trigger, tiers := range cfg.Escalations {
+		checkTrigger(trigger, "escalations")
+		for i, tier := range tiers {
+			for _, destination := range tier.Destinations {
+				checkService(destination.Service, fmt.Sprintf("escalation tier %d of trigger %s", i+1, trigger))
+			}
+		}
+	}
+	if cfg.DeadLetter != nil && cfg.DeadLetter.Service != "" {
+		checkService(cfg.DeadLetter.Service, "dead-letter settings")
+	}
+	if cfg.Aggregation != nil {
+		checkTemplate(cfg.Aggregation.Template, "aggregation settings")
+	}
+	for name, template := range cfg.Templates {
+		if len(template.Actions) > 0 && cfg.Actions == nil {
+			problems = append(problems, fmt.Sprintf("template %s declares actions, but the actions settings are not configured", name))
+		}
+	}
+	for name, digest := range cfg.Digests {
+		checkTemplate(digest.Template, "digest "+name)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	unique := problems[:1]
+	for _, problem := range problems[1:] {
+		if problem != unique[len(unique)-1] {
+			unique = append(unique, problem)
+		}
+	}
+	return unique
+}
+
+// Lint returns the problems of the configuration: the keys that fail to parse, the trigger conditions and templates
+// that fail to compile, the services that cannot be created and the references to templates, triggers and services
+// which are not configured. Unlike ParseConfig, every key is checked, so that all problems are reported at once
+func Lint(configMap *v1.ConfigMap, secret *v1.Secret) []string {
+	var problems []string
+	keys := make([]string, 0, len(configMap.Data))
+	for key := range configMap.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := validateConfigEntry(key, configMap.Data[key], secret); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+	if len(problems) > 0 {
+		// the references are checked once all keys are valid since invalid keys are missing from the configuration
+		return problems
+	}
+	cfg, err := ParseConfig(configMap, secret)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return cfg.invalidReferences()
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestValidateReferences(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{Data: map[string]string{
+		"service.slack":        "token: abc",
+		"template.my-template": "message: hello",
+		"trigger.on-sync":      "[{when: 'true', send: [my-template]}]",
+		"defaultTriggers":      "[on-sync]",
+		"subscriptions":        "[{recipients: ['slack:my-channel', 'email:user@example.com']}]",
+		"escalations": `
+on-missing:
+- after: 60
+  destinations: [{service: slack, recipients: [oncall]}]`,
+	}}, &v1.Secret{})
+	require.NoError(t, err)
+
+	err = cfg.ValidateReferences()
+	assert.EqualError(t, err, "invalid references: escalations references trigger on-missing which is not configured; "+
+		"subscription 1 references service email which is not configured")
+
+	delete(cfg.Escalations, "on-missing")
+	cfg.Subscriptions[0].Recipients = []string{"slack:my-channel"}
+	assert.NoError(t, cfg.ValidateReferences())
+}
+
+func TestValidateReferences_CompositeTriggers(t *testing.T) {
+	cfg, err := ParseConfig(&v1.ConfigMap{Data: map[string]string{
+		"trigger.on-degraded":  "[{when: 'true'}]",
+		"trigger.on-composite": `[{when: "triggered('on-degraded') && !triggered( 'on-syncing' )"}]`,
+	}}, &v1.Secret{})
+	require.NoError(t, err)
+
+	err = cfg.ValidateReferences()
+	assert.EqualError(t, err, "invalid references: trigger on-composite references trigger on-syncing which is not configured")
+}
+
+func TestLint(t *testing.T) {
+	problems := Lint(&v1.ConfigMap{Data: map[string]string{
+		"service.slack":        "token: abc",
+		"template.my-template": "message: hello {{.app.metadata.name",
+		"trigger.on-sync":      "[{when: 'app.status ==', send: [my-template]}]",
+		"retryPolicy":          "maxAttempts: 0",
+	}}, &v1.Secret{})
+	require.Len(t, problems, 3)
+	assert.Contains(t, problems[0], "retryPolicy: ")
+	assert.Contains(t, problems[1], "template.my-template: ")
+	assert.Contains(t, problems[2], "trigger.on-sync: ")
+
+	problems = Lint(&v1.ConfigMap{Data: map[string]string{
+		"service.slack":   "token: abc",
+		"trigger.on-sync": "[{when: 'true', send: [my-template]}]",
+	}}, &v1.Secret{})
+	assert.Equal(t, []string{"trigger on-sync references template my-template which is not configured"}, problems)
+
+	assert.Empty(t, Lint(&v1.ConfigMap{Data: map[string]string{"service.slack": "token: abc"}}, &v1.Secret{}))
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/deadletter"
+	"github.com/argoproj/notifications-engine/pkg/util/misc"
+)
+
+func newDeadLetterCommand(cmdContext *commandContext) *cobra.Command {
+	var command = cobra.Command{
+		Use:   "deadletter",
+		Short: "Commands to manage the notifications that could not be delivered",
+		RunE: func(c *cobra.Command, args []string) error {
+			return errors.New("select child command")
+		},
+	}
+	command.AddCommand(newDeadLetterListCommand(cmdContext))
+	command.AddCommand(newDeadLetterReplayCommand(cmdContext))
+
+	return &command
+}
+
+// getDeadLetterStore returns the store configured by the dead-letter settings of the notifications ConfigMap
+func (c *commandContext) getDeadLetterStore(api api.API) (deadletter.Store, error) {
+	cfg := api.GetConfig().DeadLetter
+	if cfg == nil || cfg.ConfigMap == "" {
+		return nil, fmt.Errorf("dead-letter ConfigMap is not configured in '%s' ConfigMap", c.ConfigMapName)
+	}
+	return deadletter.NewConfigMapStore(c.k8sClient, c.namespace, cfg.ConfigMap), nil
+}
+
+func newDeadLetterListCommand(cmdContext *commandContext) *cobra.Command {
+	var (
+		output string
+	)
+	var command = cobra.Command{
+		Use: "list",
+		Example: fmt.Sprintf(`
+# prints the notifications that could not be delivered
+%s deadletter list
+`, cmdContext.cliName),
+		Short: "Prints the notifications that could not be delivered",
+		RunE: func(c *cobra.Command, args []string) error {
+			api, err := cmdContext.getAPI()
+			if err != nil {
+				_, _ = fmt.Fprintf(cmdContext.stderr, "failed to get api: %v\n", err)
+				return nil
+			}
+			store, err := cmdContext.getDeadLetterStore(api)
+			if err != nil {
+				_, _ = fmt.Fprintf(cmdContext.stderr, "failed to get dead-letter store: %v\n", err)
+				return nil
+			}
+			letters, err := store.List()
+			if err != nil {
+				_, _ = fmt.Fprintf(cmdContext.stderr, "failed to list dead letters: %v\n", err)
+				return nil
+			}
+			switch output {
+			case "", "wide":
+				w := tabwriter.NewWriter(cmdContext.stdout, 5, 0, 2, ' ', 0)
+				_, _ = fmt.Fprintf(w, "ID\tRESOURCE\tTRIGGER\tDESTINATION\tATTEMPTS\tFAILED AT\tREASON\n")
+				for _, letter := range letters {
+					_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s:%s\t%d\t%s\t%s\n", letter.ID, letter.ResourceName, letter.Trigger,
+						letter.Destination.Service, letter.Destination.Recipient, letter.Attempts, letter.FailedAt.Format(time.RFC3339), letter.Reason)
+				}
+				_ = w.Flush()
+			case "name":
+				for _, letter := range letters {
+					_, _ = fmt.Fprintln(cmdContext.stdout, letter.ID)
+				}
+			default:
+				return misc.PrintFormatted(letters, output, cmdContext.stdout)
+			}
+			return nil
+		},
+	}
+	addOutputFlags(&command, &output)
+	return &command
+}
+
+func newDeadLetterReplayCommand(cmdContext *commandContext) *cobra.Command {
+	var (
+		all bool
+	)
+	var command = cobra.Command{
+		Use: "replay [ID...]",
+		Example: fmt.Sprintf(`
+# sends the notification that could not be delivered again
+%s deadletter replay 20240101120000-0a1b2c3d
+
+# sends all notifications that could not be delivered again
+%s deadletter replay --all
+`, cmdContext.cliName, cmdContext.cliName),
+		Short: "Sends the notifications that could not be delivered again and removes the delivered notifications",
+		RunE: func(c *cobra.Command, args []string) error {
+			if len(args) == 0 && !all {
+				return errors.New("expected dead letter ids or --all flag")
+			}
+			api, err := cmdContext.getAPI()
+			if err != nil {
+				_, _ = fmt.Fprintf(cmdContext.stderr, "failed to get api: %v\n", err)
+				return nil
+			}
+			store, err := cmdContext.getDeadLetterStore(api)
+			if err != nil {
+				_, _ = fmt.Fprintf(cmdContext.stderr, "failed to get dead-letter store: %v\n", err)
+				return nil
+			}
+			ids := args
+			if all {
+				letters, err := store.List()
+				if err != nil {
+					_, _ = fmt.Fprintf(cmdContext.stderr, "failed to list dead letters: %v\n", err)
+					return nil
+				}
+				ids = nil
+				for _, letter := range letters {
+					ids = append(ids, letter.ID)
+				}
+			}
+			replayed, err := deadletter.Replay(context.Background(), store, api.GetNotificationServices(), ids...)
+			for _, letter := range replayed {
+				_, _ = fmt.Fprintf(cmdContext.stdout, "%s replayed\n", letter.ID)
+			}
+			if err != nil {
+				_, _ = fmt.Fprintf(cmdContext.stderr, "failed to replay dead letters: %v\n", err)
+			}
+			return nil
+		},
+	}
+	command.Flags().BoolVar(&all, "all", false, "Replay all dead letters")
+	return &command
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/argoproj/notifications-engine/pkg/deadletter"
+	"github.com/argoproj/notifications-engine/pkg/services"
+)
+
+func TestDeadLetterList(t *testing.T) {
+	cmData := map[string]string{
+		"deadLetter": `configMap: dead-letters`,
+	}
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	ctx, closer, err := newTestContext(&stdout, &stderr, cmData)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer closer()
+
+	letter := deadletter.NewLetter("default", "guestbook", "on-sync-failed", services.Destination{Service: "slack", Recipient: "my-channel"},
+		services.Notification{Message: "hello"}, "channel_not_found", 3)
+	assert.NoError(t, deadletter.NewConfigMapStore(ctx.k8sClient, "default", "dead-letters").Add(letter))
+
+	command := newDeadLetterListCommand(ctx)
+	err = command.RunE(command, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, stderr.String())
+	assert.Contains(t, stdout.String(), letter.ID)
+	assert.Contains(t, stdout.String(), "slack:my-channel")
+	assert.Contains(t, stdout.String(), "channel_not_found")
+}
+
+func TestDeadLetterList_NotConfigured(t *testing.T) {
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	ctx, closer, err := newTestContext(&stdout, &stderr, map[string]string{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer closer()
+
+	command := newDeadLetterListCommand(ctx)
+	err = command.RunE(command, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, stderr.String(), "dead-letter ConfigMap is not configured in 'my-config-map' ConfigMap")
+}
+
+func TestDeadLetterReplay(t *testing.T) {
+	var received int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+	}))
+	defer server.Close()
+
+	cmData := map[string]string{
+		"deadLetter":      `configMap: dead-letters`,
+		"service.webhook": "url: " + server.URL,
+	}
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	ctx, closer, err := newTestContext(&stdout, &stderr, cmData)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer closer()
+
+	store := deadletter.NewConfigMapStore(ctx.k8sClient, "default", "dead-letters")
+	letter := deadletter.NewLetter("default", "guestbook", "on-sync-failed", services.Destination{Service: "webhook"},
+		services.Notification{Webhook: services.WebhookNotifications{"webhook": {Method: http.MethodPost, Body: "hello"}}}, "timeout", 3)
+	assert.NoError(t, store.Add(letter))
+
+	command := newDeadLetterReplayCommand(ctx)
+	assert.NoError(t, command.Flags().Set("all", "true"))
+	err = command.RunE(command, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, stderr.String())
+	assert.Contains(t, stdout.String(), letter.ID+" replayed")
+	assert.Equal(t, 1, received)
+
+	letters, err := store.List()
+	assert.NoError(t, err)
+	assert.Empty(t, letters)
+}
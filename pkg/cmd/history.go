@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/argoproj/notifications-engine/pkg/controller"
+	"github.com/argoproj/notifications-engine/pkg/util/misc"
+)
+
+func newHistoryCommand(cmdContext *commandContext) *cobra.Command {
+	var (
+		output  string
+		trigger string
+		service string
+	)
+	var command = cobra.Command{
+		Use: "history RESOURCE_NAME",
+		Example: fmt.Sprintf(`
+# prints the notifications sent about the resource
+%s history guestbook
+
+# prints the notifications sent about the resource to slack when the on-sync-failed trigger fired
+%s history guestbook --trigger on-sync-failed --service slack
+`, cmdContext.cliName, cmdContext.cliName),
+		Short: "Prints the delivery history of the notifications about the resource",
+		RunE: func(c *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return fmt.Errorf("expected one argument, got %d", len(args))
+			}
+			res, err := cmdContext.loadResource(args[0])
+			if err != nil {
+				_, _ = fmt.Fprintf(cmdContext.stderr, "failed to load resource: %v\n", err)
+				return nil
+			}
+			history := controller.NewHistoryFromRes(res).Filter(trigger, service)
+			switch output {
+			case "", "wide":
+				w := tabwriter.NewWriter(cmdContext.stdout, 5, 0, 2, ' ', 0)
+				_, _ = fmt.Fprintf(w, "TIMESTAMP\tTRIGGER\tDESTINATION\tATTEMPTS\tRESULT\tERROR\n")
+				for _, record := range history {
+					_, _ = fmt.Fprintf(w, "%s\t%s\t%s:%s\t%d\t%s\t%s\n", time.Unix(record.Timestamp, 0).UTC().Format(time.RFC3339),
+						record.Trigger, record.Destination.Service, record.Destination.Recipient, record.Attempts, record.Result, record.Error)
+				}
+				_ = w.Flush()
+			default:
+				return misc.PrintFormatted(history, output, cmdContext.stdout)
+			}
+			return nil
+		},
+	}
+	command.Flags().StringVar(&trigger, "trigger", "", "Prints the notifications of the trigger only")
+	command.Flags().StringVar(&service, "service", "", "Prints the notifications sent using the service only")
+	command.Flags().StringVarP(&output, "output", "o", "wide", "Output format. One of:json|yaml|wide")
+	return &command
+}
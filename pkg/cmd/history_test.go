@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/argoproj/notifications-engine/pkg/controller"
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+)
+
+func TestHistory(t *testing.T) {
+	history := controller.DeliveryHistory{}
+	history.Add("on-sync-failed", services.Destination{Service: "slack", Recipient: "my-channel"}, nil)
+	history.Add("on-sync-succeeded", services.Destination{Service: "email", Recipient: "user@example.com"}, nil)
+	annotations := map[string]string{}
+	if !assert.NoError(t, history.Persist(annotations, 10)) {
+		return
+	}
+	app := newTestResource("guestbook")
+	app.SetAnnotations(annotations)
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	ctx, closer, err := newTestContext(&stdout, &stderr, map[string]string{}, app)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer closer()
+
+	command := newHistoryCommand(ctx)
+	assert.NoError(t, command.Flags().Set("trigger", "on-sync-failed"))
+	err = command.RunE(command, []string{"guestbook"})
+	assert.NoError(t, err)
+	assert.Empty(t, stderr.String())
+	assert.Contains(t, stdout.String(), "slack:my-channel")
+	assert.Contains(t, stdout.String(), "succeeded")
+	assert.NotContains(t, stdout.String(), "user@example.com")
+	assert.NotEmpty(t, annotations[subscriptions.HistoryAnnotationKey()])
+}
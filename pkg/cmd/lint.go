@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/argoproj/notifications-engine/pkg/api"
+)
+
+func newLintCommand(cmdContext *commandContext) *cobra.Command {
+	var command = cobra.Command{
+		Use: "lint",
+		Example: fmt.Sprintf(`
+# reports the problems of the '%s' ConfigMap
+%s lint
+
+# reports the problems of the ConfigMap and Secret of the files
+%s lint --config-map ./my-config-map.yaml --secret ./my-secret.yaml
+`, cmdContext.ConfigMapName, cmdContext.cliName, cmdContext.cliName),
+		Short: "Reports the problems of the notifications configuration, fails if the configuration has problems",
+		// the command fails to let CI pipelines detect invalid configurations, the usage does not help to fix them
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			cm, err := cmdContext.getConfigMap()
+			if err != nil {
+				return fmt.Errorf("failed to get config map: %v", err)
+			}
+			secret, err := cmdContext.getSecret()
+			if err != nil {
+				return fmt.Errorf("failed to get secret: %v", err)
+			}
+			problems := api.Lint(cm, secret)
+			for _, problem := range problems {
+				_, _ = fmt.Fprintln(cmdContext.stdout, problem)
+			}
+			if len(problems) > 0 {
+				return fmt.Errorf("found %d problems in the configuration", len(problems))
+			}
+			return nil
+		},
+	}
+	return &command
+}
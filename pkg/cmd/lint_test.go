@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLint(t *testing.T) {
+	cmData := map[string]string{
+		"trigger.my-trigger": `
+- when: app.metadata.name == 'guestbook'
+  send: [my-template]`,
+	}
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	ctx, closer, err := newTestContext(&stdout, &stderr, cmData)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer closer()
+
+	command := newLintCommand(ctx)
+	err = command.RunE(command, nil)
+	assert.EqualError(t, err, "found 1 problems in the configuration")
+	assert.Contains(t, stdout.String(), "trigger my-trigger references template my-template which is not configured")
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	notificationApi "github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/services"
+)
+
+func newSendCommand(cmdContext *commandContext) *cobra.Command {
+	var (
+		service   string
+		recipient string
+	)
+	var command = cobra.Command{
+		Use: "send TEMPLATE RESOURCE_NAME",
+		Example: fmt.Sprintf(`
+# Sends the app-sync-succeeded notification about the resource to the Slack channel, without evaluating any trigger
+%s send app-sync-succeeded guestbook --service slack --recipient my-channel
+
+# Sends the notification using the configuration of the files
+%s send app-sync-succeeded ./sample-app.yaml --service slack --recipient my-channel \
+    --config-map ./my-config-map.yaml --secret ./my-secret.yaml
+`, cmdContext.cliName, cmdContext.cliName),
+		Short: "Delivers the notification rendered using the template to the service immediately, to verify the integration",
+		// the command fails if the delivery fails, the usage does not help to fix the integration
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			cancel := withDebugLogs()
+			defer cancel()
+			if len(args) < 2 {
+				return fmt.Errorf("expected two arguments, got %d", len(args))
+			}
+			if service == "" {
+				return errors.New("the --service flag is required")
+			}
+			name := args[0]
+			resourceName := args[1]
+			api, err := cmdContext.getAPI()
+			if err != nil {
+				_, _ = fmt.Fprintf(cmdContext.stderr, "failed to create API: %v\n", err)
+				return nil
+			}
+			if _, ok := api.GetConfig().Templates[name]; !ok {
+				_, _ = fmt.Fprintf(cmdContext.stderr, "template with name '%s' does not exist\n", name)
+				return nil
+			}
+			if _, ok := api.GetNotificationServices()[service]; !ok {
+				var names []string
+				for name := range api.GetNotificationServices() {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				_, _ = fmt.Fprintf(cmdContext.stderr,
+					"service with name '%s' does not exist (found %s)\n", service, strings.Join(names, ", "))
+				return nil
+			}
+
+			res, err := cmdContext.loadResource(resourceName)
+			if err != nil {
+				_, _ = fmt.Fprintf(cmdContext.stderr, "failed to load resource: %v\n", err)
+				return nil
+			}
+
+			dest := services.Destination{Service: service, Recipient: recipient}
+			if err := api.Send(res.Object, []string{name}, dest); err != nil {
+				if errors.Is(err, notificationApi.ErrDryRun) {
+					_, _ = fmt.Fprintf(cmdContext.stderr, "service '%s' is in dry-run mode, the notification was logged instead of sent\n", service)
+					return nil
+				}
+				return fmt.Errorf("failed to notify '%s:%s': %v", service, recipient, err)
+			}
+			_, _ = fmt.Fprintf(cmdContext.stdout, "Notification sent to '%s:%s'\n", service, recipient)
+			return nil
+		},
+	}
+	command.Flags().StringVar(&service, "service", "", "Name of the service that delivers the notification")
+	command.Flags().StringVar(&recipient, "recipient", "", "Recipient of the notification, e.g. the Slack channel")
+
+	return &command
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSend(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		received = string(data)
+	}))
+	defer server.Close()
+
+	cmData := map[string]string{
+		"service.webhook.test":    "url: " + server.URL,
+		"service.webhook.failing": "url: " + server.URL + "/fail",
+		"template.my-template": `
+message: hello {{.app.metadata.name}}`,
+	}
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	ctx, closer, err := newTestContext(&stdout, &stderr, cmData, newTestResource("guestbook"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer closer()
+
+	command := newSendCommand(ctx)
+	assert.NoError(t, command.Flags().Set("service", "test"))
+	err = command.RunE(command, []string{"my-template", "guestbook"})
+	assert.NoError(t, err)
+	assert.Empty(t, stderr.String())
+	assert.Contains(t, stdout.String(), "Notification sent to 'test:'")
+	assert.Equal(t, "hello guestbook", received)
+
+	stdout.Reset()
+	assert.NoError(t, command.Flags().Set("service", "slack"))
+	err = command.RunE(command, []string{"my-template", "guestbook"})
+	assert.NoError(t, err)
+	assert.Contains(t, stderr.String(), "service with name 'slack' does not exist (found failing, test)")
+	assert.Empty(t, stdout.String())
+
+	assert.NoError(t, command.Flags().Set("service", "failing"))
+	err = command.RunE(command, []string{"my-template", "guestbook"})
+	assert.ErrorContains(t, err, "failed to notify 'failing:'")
+	assert.Empty(t, stdout.String())
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/argoproj/notifications-engine/pkg/api"
+	notificationstesting "github.com/argoproj/notifications-engine/pkg/testing"
+)
+
+func newTestCommand(cmdContext *commandContext) *cobra.Command {
+	var (
+		update bool
+	)
+	var command = cobra.Command{
+		Use: "test FIXTURES_FILE",
+		Example: fmt.Sprintf(`
+# runs the fixtures of the file using the ConfigMap and Secret of the files
+%s test ./notifications-tests.yaml --config-map ./my-config-map.yaml --secret ./my-secret.yaml
+
+# writes the notifications rendered by the fixtures to their golden files
+%s test ./notifications-tests.yaml --config-map ./my-config-map.yaml --secret :empty --update
+`, cmdContext.cliName, cmdContext.cliName),
+		Short: "Runs the fixtures of triggers and templates, fails if the results differ from the expected results",
+		// the command fails to let CI pipelines detect failed fixtures, the usage does not help to fix them
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected one argument, got %d", len(args))
+			}
+			cm, err := cmdContext.getConfigMap()
+			if err != nil {
+				return fmt.Errorf("failed to get config map: %v", err)
+			}
+			secret, err := cmdContext.getSecret()
+			if err != nil {
+				return fmt.Errorf("failed to get secret: %v", err)
+			}
+			cfg, err := api.ParseConfig(cm, secret)
+			if err != nil {
+				return fmt.Errorf("failed to parse config: %v", err)
+			}
+			getVars, err := cmdContext.InitGetVars(cfg, cm, secret)
+			if err != nil {
+				return fmt.Errorf("failed to initialize variables: %v", err)
+			}
+
+			results, err := notificationstesting.Run(*cfg, getVars, args[0], update)
+			if err != nil {
+				return fmt.Errorf("failed to run fixtures: %v", err)
+			}
+			failed := 0
+			for _, result := range results {
+				if result.Passed() {
+					_, _ = fmt.Fprintf(cmdContext.stdout, "PASS %s\n", result.Fixture.Name)
+					continue
+				}
+				failed++
+				_, _ = fmt.Fprintf(cmdContext.stdout, "FAIL %s\n", result.Fixture.Name)
+				for _, failure := range result.Failures {
+					_, _ = fmt.Fprintf(cmdContext.stdout, "    %s\n", failure)
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d fixtures failed", failed, len(results))
+			}
+			return nil
+		},
+	}
+	command.Flags().BoolVar(&update, "update", false, "Write the rendered notifications to the golden files instead of comparing them")
+	return &command
+}
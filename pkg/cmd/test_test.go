@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTest(t *testing.T) {
+	cmData := map[string]string{
+		"trigger.my-trigger": `
+- when: app.metadata.name == 'guestbook'
+  send: [my-template]`,
+		"template.my-template": `
+message: hello {{.app.metadata.name}}`,
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "guestbook.yaml"), []byte("metadata:\n  name: guestbook\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "guestbook.golden.yaml"), []byte("- message: hello guestbook\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tests.yaml"), []byte(`
+- name: guestbook
+  resource: guestbook.yaml
+  trigger: my-trigger
+  triggered: true
+  golden: guestbook.golden.yaml
+- name: not triggered
+  resource: guestbook.yaml
+  trigger: my-trigger
+  triggered: false`), 0o644))
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	ctx, closer, err := newTestContext(&stdout, &stderr, cmData)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer closer()
+
+	command := newTestCommand(ctx)
+	err = command.RunE(command, []string{filepath.Join(dir, "tests.yaml")})
+	assert.EqualError(t, err, "1 of 2 fixtures failed")
+	assert.Contains(t, stdout.String(), "PASS guestbook")
+	assert.Contains(t, stdout.String(), "FAIL not triggered")
+	assert.Contains(t, stdout.String(), "expected trigger my-trigger to return false, got true")
+}
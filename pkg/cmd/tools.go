@@ -47,6 +47,11 @@ func NewToolsCommand(name string, cliName string, resource schema.GroupVersionRe
 
 	command.AddCommand(newTriggerCommand(&cmdContext))
 	command.AddCommand(newTemplateCommand(&cmdContext))
+	command.AddCommand(newDeadLetterCommand(&cmdContext))
+	command.AddCommand(newHistoryCommand(&cmdContext))
+	command.AddCommand(newLintCommand(&cmdContext))
+	command.AddCommand(newSendCommand(&cmdContext))
+	command.AddCommand(newTestCommand(&cmdContext))
 
 	command.PersistentFlags().StringVar(&cmdContext.configMapPath,
 		"config-map", "", fmt.Sprintf("%s.yaml file path", settings.ConfigMapName))
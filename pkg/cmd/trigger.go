@@ -3,9 +3,13 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"text/tabwriter"
+	"time"
 
+	"github.com/argoproj/notifications-engine/pkg/controller"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
 	"github.com/argoproj/notifications-engine/pkg/triggers"
 	"github.com/argoproj/notifications-engine/pkg/util/misc"
 
@@ -22,6 +26,7 @@ func newTriggerCommand(cmdContext *commandContext) *cobra.Command {
 	}
 	command.AddCommand(newTriggerRunCommand(cmdContext))
 	command.AddCommand(newTriggerGetCommand(cmdContext))
+	command.AddCommand(newTriggerExplainCommand(cmdContext))
 
 	return &command
 }
@@ -139,3 +144,89 @@ func newTriggerGetCommand(cmdContext *commandContext) *cobra.Command {
 	addOutputFlags(&command, &output)
 	return &command
 }
+
+func newTriggerExplainCommand(cmdContext *commandContext) *cobra.Command {
+	var command = cobra.Command{
+		Use:     "explain NAME RESOURCE_NAME",
+		Aliases: []string{"why"},
+		Short:   "Explains why the trigger would or would not send notifications about the resource",
+		Example: fmt.Sprintf(`
+# Explain the notifications of the trigger about the resource of the cluster
+%s trigger explain on-sync-succeeded guestbook
+
+# Explain the notifications of the trigger about the resource of the file
+%s trigger why on-sync-succeeded ./sample-app.yaml
+`, cmdContext.cliName, cmdContext.cliName),
+		RunE: func(c *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return fmt.Errorf("expected two arguments, got %d", len(args))
+			}
+			name := args[0]
+			resourceName := args[1]
+			notificationApi, err := cmdContext.getAPI()
+			if err != nil {
+				_, _ = fmt.Fprintf(cmdContext.stderr, "failed to get api: %v\n", err)
+				return nil
+			}
+			cfg := notificationApi.GetConfig()
+			if _, ok := cfg.Triggers[name]; !ok {
+				var names []string
+				for name := range cfg.Triggers {
+					names = append(names, name)
+				}
+				_, _ = fmt.Fprintf(cmdContext.stderr,
+					"trigger with name '%s' does not exist (found %s)\n", name, strings.Join(names, ", "))
+				return nil
+			}
+			r, err := cmdContext.loadResource(resourceName)
+			if err != nil {
+				_, _ = fmt.Fprintf(cmdContext.stderr, "failed to load resource: %v\n", err)
+				return nil
+			}
+
+			res, err := notificationApi.RunTrigger(name, r.Object)
+			if err != nil {
+				_, _ = fmt.Fprintf(cmdContext.stderr, "failed to execute trigger %s: %v\n", name, err)
+				return nil
+			}
+			destinations := cfg.GetGlobalDestinationsOf(r.Object)
+			destinations.Merge(subscriptions.NewAnnotations(r.GetAnnotations()).GetDestinations(cfg.DefaultTriggers, cfg.ServiceDefaultTriggers))
+			destinations = cfg.ExpandRecipientGroups(destinations).Dedup()
+			sort.Slice(destinations[name], func(i, j int) bool {
+				return destinations[name][i].String() < destinations[name][j].String()
+			})
+			state := controller.NewStateFromRes(r)
+			retries := controller.NewRetriesFromRes(r)
+
+			w := tabwriter.NewWriter(cmdContext.stdout, 5, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintf(w, "CONDITION\tRESULT\tONCE PER\tDESTINATION\tNOTIFIED\tREASON\n")
+			for i, cr := range res {
+				oncePer := cr.OncePer
+				if oncePer == "" {
+					oncePer = "-"
+				}
+				when := cfg.Triggers[name][i].When
+				if len(destinations[name]) == 0 {
+					reason := "no subscriptions to the trigger"
+					if !cr.Triggered {
+						reason = "condition is not met"
+					}
+					_, _ = fmt.Fprintf(w, "%s\t%v\t%s\t-\t-\t%s\n", when, cr.Triggered, oncePer, reason)
+					continue
+				}
+				for _, to := range destinations[name] {
+					notified := "-"
+					if timestamp, ok := state[controller.StateItemKey(cfg.IsSelfServiceConfig, cfg.Namespace, name, cr, to)]; ok {
+						notified = time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+					}
+					_, _ = fmt.Fprintf(w, "%s\t%v\t%s\t%s:%s\t%s\t%s\n", when, cr.Triggered, oncePer, to.Service, to.Recipient,
+						notified, controller.ExplainNotification(notificationApi, cfg.IsSelfServiceConfig, r.Object, state, retries, name, cr, to))
+				}
+			}
+			_ = w.Flush()
+			return nil
+		},
+	}
+
+	return &command
+}
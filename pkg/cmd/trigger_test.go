@@ -8,7 +8,10 @@ import (
 	"testing"
 
 	"github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/controller"
 	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+	"github.com/argoproj/notifications-engine/pkg/triggers"
 
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
@@ -133,3 +136,48 @@ message: hello {{.app.metadata.name}}`,
 	assert.Contains(t, stdout.String(), "my-trigger1")
 	assert.Contains(t, stdout.String(), "my-trigger2")
 }
+
+func TestTriggerExplain(t *testing.T) {
+	cmData := map[string]string{
+		"trigger.my-trigger": `
+- when: app.metadata.name == 'guestbook'
+  send: [my-template]`,
+		"template.my-template": `
+message: hello {{.app.metadata.name}}`,
+	}
+	condition := triggers.Condition{When: "app.metadata.name == 'guestbook'", Send: []string{"my-template"}}
+	state := controller.NotificationsState{}
+	state.SetAlreadyNotified(false, "", "my-trigger", triggers.ConditionResult{Key: triggers.ConditionKey(0, condition)},
+		services.Destination{Service: "slack", Recipient: "my-channel"}, true)
+	app := newTestResource("guestbook")
+	app.SetAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "slack"): "my-channel",
+		subscriptions.SubscribeAnnotationKey("my-trigger", "email"): "user@example.com",
+	})
+	annotations, err := state.Persist(app)
+	if !assert.NoError(t, err) {
+		return
+	}
+	app.SetAnnotations(annotations)
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	ctx, closer, err := newTestContext(&stdout, &stderr, cmData, app)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer closer()
+
+	command := newTriggerExplainCommand(ctx)
+	err = command.RunE(command, []string{"my-trigger", "guestbook"})
+	assert.NoError(t, err)
+	assert.Empty(t, stderr.String())
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if !assert.Len(t, lines, 3) {
+		return
+	}
+	assert.Contains(t, lines[1], "email:user@example.com")
+	assert.Contains(t, lines[1], "would notify")
+	assert.Contains(t, lines[2], "slack:my-channel")
+	assert.Contains(t, lines[2], "already notified")
+}
@@ -0,0 +1,339 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/delivery"
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/triggers"
+)
+
+// aggregationBatch holds the notifications collected for a destination during the aggregation window
+type aggregationBatch struct {
+	api       api.API
+	namespace string
+	template  string
+	dest      services.Destination
+	events    []api.AggregatedEvent
+	// failures is the number of failed attempts to send the batch kept in memory
+	failures     int
+	firstFailure time.Time
+}
+
+// aggregator collects the notifications sent to the same destination and flushes them once the aggregation window
+// elapsed or the digest is due. The collected notifications are kept in memory if the controller has no delivery
+// queue, otherwise they are stored in the queue and the aggregator only tracks the flush time of the batches
+type aggregator struct {
+	lock    sync.Mutex
+	batches map[string]*aggregationBatch
+	timers  map[string]*time.Timer
+	// flushTimes holds the flush times of the batches stored in the delivery queue
+	flushTimes map[string]time.Time
+	flush      func(key string, batch *aggregationBatch)
+	stopped    bool
+}
+
+func newAggregator(flush func(key string, batch *aggregationBatch)) *aggregator {
+	return &aggregator{
+		batches:    map[string]*aggregationBatch{},
+		timers:     map[string]*time.Timer{},
+		flushTimes: map[string]time.Time{},
+		flush:      flush,
+	}
+}
+
+// add collects the notification about the resource in the batch of the key. The first notification of the batch
+// schedules the flush of the batch after the delay
+func (a *aggregator) add(key string, delay time.Duration, newBatch func() *aggregationBatch, event api.AggregatedEvent) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	batch, ok := a.batches[key]
+	if !ok {
+		batch = newBatch()
+		a.schedule(key, delay, batch)
+	}
+	batch.events = append(batch.events, event)
+}
+
+// retry schedules the flush of the batch that failed to be sent after the delay. The batch is retried separately from
+// the notifications collected for the same destination in the meantime
+func (a *aggregator) retry(key string, delay time.Duration, batch *aggregationBatch) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.schedule("retry/"+key, delay, batch)
+}
+
+func (a *aggregator) schedule(key string, delay time.Duration, batch *aggregationBatch) {
+	a.batches[key] = batch
+	if a.stopped {
+		return
+	}
+	a.timers[key] = time.AfterFunc(delay, func() {
+		if batch := a.take(key); batch != nil {
+			a.flush(key, batch)
+		}
+	})
+}
+
+func (a *aggregator) take(key string) *aggregationBatch {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	batch := a.batches[key]
+	delete(a.batches, key)
+	delete(a.timers, key)
+	return batch
+}
+
+// flushTime returns the flush time of the batch of the key stored in the delivery queue, the flush time of a new
+// batch is initialized using the given function
+func (a *aggregator) flushTime(key string, init func() (time.Time, error)) (time.Time, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	// the batch might have been flushed by another replica once its flush time passed
+	if flushTime, ok := a.flushTimes[key]; ok && flushTime.After(time.Now()) {
+		return flushTime, nil
+	}
+	flushTime, err := init()
+	if err != nil {
+		return time.Time{}, err
+	}
+	a.flushTimes[key] = flushTime
+	return flushTime, nil
+}
+
+// flushed forgets the flush time of the batch of the key stored in the delivery queue
+func (a *aggregator) flushed(key string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.flushTimes, key)
+}
+
+// stop stops the timers of the batches kept in memory and returns the number of notifications that were not flushed
+func (a *aggregator) stop() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.stopped = true
+	for key, timer := range a.timers {
+		timer.Stop()
+		delete(a.timers, key)
+	}
+	pending := 0
+	for _, batch := range a.batches {
+		pending += len(batch.events)
+	}
+	return pending
+}
+
+// aggregate collects the notification if the destination references a digest or the notifications of the trigger are
+// aggregated, and returns false if the notification must be sent immediately. The notification is stored in the
+// delivery queue, if configured, without holding the lock of the pool
+func (c *notificationController) aggregate(ctx context.Context, pool *deliveryPool, notificationsAPI api.API, cfg api.Config, trigger string, cr triggers.ConditionResult, dest services.Destination, un *unstructured.Unstructured, logEntry *log.Entry) (bool, error) {
+	var key, template string
+	var flushAt func(now time.Time) time.Time
+	if name := dest.Parameters[api.DigestParameter]; name != "" {
+		digest, ok := cfg.Digests[name]
+		if !ok {
+			logEntry.Warnf("Digest %s referenced by '%v' is not configured in namespace %s, sending the notification immediately", name, dest, cfg.Namespace)
+			return false, nil
+		}
+		key, template, flushAt = fmt.Sprintf("digest/%s/%s/%s", cfg.Namespace, name, dest), digest.Template, digest.Next
+	} else if cfg.Aggregation != nil && cfg.Aggregation.Aggregates(trigger) {
+		window := time.Duration(cfg.Aggregation.Window) * time.Second
+		key, template = fmt.Sprintf("aggregation/%s/%s", cfg.Namespace, dest), cfg.Aggregation.Template
+		flushAt = func(now time.Time) time.Time {
+			return now.Add(window)
+		}
+	} else {
+		return false, nil
+	}
+
+	if c.deliveryQueue == nil {
+		event := api.AggregatedEvent{Trigger: trigger, Severity: cr.Severity, Object: un.DeepCopy().Object}
+		c.aggregator.add(key, time.Until(flushAt(time.Now())), func() *aggregationBatch {
+			return &aggregationBatch{api: notificationsAPI, namespace: cfg.Namespace, template: template, dest: dest}
+		}, event)
+		return true, nil
+	}
+
+	task := delivery.NewTask(cfg.Namespace, trigger, []string{template}, cr.Severity, dest, un.GetNamespace(), un.GetName())
+	task.Aggregate = key
+	var err error
+	pool.Unlocked(func() {
+		// the notifications of the batch are delivered together once the first notification of the batch is due
+		task.NextAttempt, err = c.aggregator.flushTime(key, func() (time.Time, error) {
+			tasks, err := c.deliveryQueue.Pending(ctx)
+			if err != nil {
+				return time.Time{}, err
+			}
+			for _, pending := range tasks {
+				if pending.Aggregate == key {
+					return pending.NextAttempt, nil
+				}
+			}
+			return flushAt(time.Now()), nil
+		})
+		if err == nil {
+			err = c.deliveryQueue.Add(ctx, task)
+		}
+	})
+	return err == nil, err
+}
+
+// dispatchAggregated sends the notifications of the batch stored in the delivery queue in a single message, the
+// notifications are rendered using the resources as they are when the batch is sent. The batch is sent by the replica
+// owning the first resource of the batch that still exists
+func (c *notificationController) dispatchAggregated(ctx context.Context, key string, tasks []delivery.Task) {
+	var batch *aggregationBatch
+	for _, task := range tasks {
+		resource, err := c.getQueuedResource(task)
+		if err != nil {
+			log.Errorf("Failed to get the resource of queued notification %s: %v", task.ID, err)
+			return
+		}
+		if resource == nil {
+			log.Infof("Dropping queued notification %s about trigger %s since resource %s/%s no longer exists", task.ID, task.Trigger, task.ResourceNamespace, task.ResourceName)
+			continue
+		}
+		if batch == nil {
+			if !c.owns(resource) {
+				return
+			}
+			notificationsAPI, err := c.getAPI(task.ResourceNamespace, task.APINamespace)
+			if err != nil {
+				log.Errorf("Failed to get api of queued notification %s: %v", task.ID, err)
+				return
+			}
+			batch = &aggregationBatch{api: notificationsAPI, namespace: task.APINamespace, template: task.Templates[0], dest: task.Destination}
+		}
+		batch.events = append(batch.events, api.AggregatedEvent{Trigger: task.Trigger, Severity: task.Severity, Object: resource.Object})
+	}
+	if batch != nil {
+		if err := c.sendAggregated(ctx, batch); err != nil && c.retryQueuedAggregated(ctx, batch, tasks, err) {
+			return
+		}
+	}
+	for _, task := range tasks {
+		c.completeQueued(ctx, task, log.NewEntry(log.StandardLogger()))
+	}
+	c.aggregator.flushed(key)
+}
+
+// retryQueuedAggregated records the failed attempt in the tasks of the batch stored in the delivery queue and returns
+// true if the batch is retried. Like queued notifications, batches are retried until they succeed if the configuration
+// has no retry policy, batches that are given up are recorded in the dead-letter sink and sent to the fallback
+func (c *notificationController) retryQueuedAggregated(ctx context.Context, batch *aggregationBatch, tasks []delivery.Task, sendErr error) bool {
+	cfg := batch.api.GetConfig()
+	first := tasks[0]
+	failures := first.Failures + 1
+	if !services.IsRetryable(sendErr) {
+		c.giveUpAggregated(ctx, cfg, batch, sendErr, failures)
+		return false
+	}
+	policy := api.RetryPolicy{}
+	if cfg.RetryPolicy != nil {
+		policy = *cfg.RetryPolicy
+	}
+	firstFailure := first.FirstFailure
+	if first.Failures == 0 {
+		firstFailure = time.Now()
+	}
+	if cfg.RetryPolicy != nil && policy.Exhausted(failures, firstFailure) {
+		c.giveUpAggregated(ctx, cfg, batch, sendErr, failures)
+		return false
+	}
+	nextAttempt := time.Now().Add(retryDelay(policy, failures, sendErr))
+	for _, task := range tasks {
+		task.Failures, task.FirstFailure, task.NextAttempt = failures, firstFailure, nextAttempt
+		if err := c.deliveryQueue.Add(ctx, task); err != nil {
+			log.Errorf("Failed to update queued notification %s: %v", task.ID, err)
+		}
+	}
+	return true
+}
+
+// flushAggregated sends the batch kept in memory. The batch is retried according to the retry policy of the
+// configuration, batches that are given up are recorded in the dead-letter sink and sent to the fallback
+func (c *notificationController) flushAggregated(key string, batch *aggregationBatch) {
+	ctx := c.context()
+	sendErr := c.sendAggregated(ctx, batch)
+	if sendErr == nil {
+		return
+	}
+	cfg := batch.api.GetConfig()
+	if batch.failures == 0 {
+		batch.firstFailure = time.Now()
+	}
+	batch.failures++
+	if services.IsRetryable(sendErr) && cfg.RetryPolicy != nil && !cfg.RetryPolicy.Exhausted(batch.failures, batch.firstFailure) {
+		delay := retryDelay(*cfg.RetryPolicy, batch.failures, sendErr)
+		log.Infof("Retrying %d aggregated notifications to '%v' in %s", len(batch.events), batch.dest, delay)
+		c.aggregator.retry(strings.TrimPrefix(key, "retry/"), delay, batch)
+		return
+	}
+	c.giveUpAggregated(ctx, cfg, batch, sendErr, batch.failures)
+}
+
+// retryDelay returns the delay of the next attempt after the given number of failures, but not before the service
+// accepts requests again if it rate limited the delivery
+func retryDelay(policy api.RetryPolicy, failures int, sendErr error) time.Duration {
+	delay := jitter(policy.Backoff(failures))
+	var rateLimitedErr *services.RateLimitedError
+	if errors.As(sendErr, &rateLimitedErr) && time.Until(rateLimitedErr.RetryAfter) > delay {
+		delay = time.Until(rateLimitedErr.RetryAfter)
+	}
+	return delay
+}
+
+// giveUpAggregated records the batch that could not be sent in the dead-letter sink and sends it to the fallback
+// destination, if configured. The dead letter references the first resource of the batch
+func (c *notificationController) giveUpAggregated(ctx context.Context, cfg api.Config, batch *aggregationBatch, sendErr error, attempts int) {
+	logEntry := log.WithField("destination", batch.dest.String())
+	logEntry.Errorf("Giving up %d aggregated notifications after %d failed attempts", len(batch.events), attempts)
+	if cfg.DeadLetter != nil && len(batch.events) > 0 {
+		resource := &unstructured.Unstructured{Object: batch.events[0].Object}
+		c.addDeadLetter(batch.api, *cfg.DeadLetter, batch.namespace, resource, batch.events[0].Trigger, batch.dest, sendErr, attempts, logEntry)
+	}
+	if fallback, ok := cfg.GetFallback(batch.dest); ok {
+		logEntry.Infof("Sending %d aggregated notifications to the fallback '%v'", len(batch.events), fallback)
+		fallbackBatch := *batch
+		fallbackBatch.dest = fallback
+		if err := c.sendAggregated(ctx, &fallbackBatch); err != nil {
+			logEntry.Errorf("Failed to notify fallback %s: %v", fallback, err)
+		}
+	}
+}
+
+// sendAggregated sends the notifications collected in the batch in a single message
+func (c *notificationController) sendAggregated(ctx context.Context, batch *aggregationBatch) error {
+	ctx, cancel := c.sendContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	err := api.NewContextAPI(batch.api).SendAggregated(ctx, batch.events, []string{batch.template}, batch.dest)
+	if isDryRun(err) {
+		for _, event := range batch.events {
+			c.metrics.IncDryRunsCounter(event.Trigger, batch.dest.Service)
+		}
+		log.Infof("%d aggregated notifications to '%v' were not sent because of the dry-run mode of the configuration in namespace %s", len(batch.events), batch.dest, batch.namespace)
+		return nil
+	}
+	c.metrics.ObserveSendDuration(batch.dest.Service, err == nil, time.Since(start))
+	for _, event := range batch.events {
+		c.metrics.IncDeliveriesCounter(event.Trigger, batch.dest.Service, err == nil)
+	}
+	if err != nil {
+		log.Errorf("Failed to send %d aggregated notifications to '%v': %v using the configuration in namespace %s", len(batch.events), batch.dest, err, batch.namespace)
+		return err
+	}
+	log.Infof("Sent %d aggregated notifications to '%v' using the configuration in namespace %s", len(batch.events), batch.dest, batch.namespace)
+	return nil
+}
@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	notificationApi "github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/delivery"
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+	"github.com/argoproj/notifications-engine/pkg/triggers"
+)
+
+func TestAggregatesNotifications(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	app1 := newResource("app-1", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+	app2 := newResource("app-2", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app1, app2))
+	assert.NoError(t, err)
+
+	sent := make(chan []notificationApi.AggregatedEvent, 1)
+	api.EXPECT().GetConfig().Return(notificationApi.Config{Aggregation: &notificationApi.AggregationConfig{Window: 1, Template: "events"}}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil).Times(2)
+	api.EXPECT().SendAggregated(gomock.Any(), gomock.Any(), []string{"events"}, dest).
+		DoAndReturn(func(_ context.Context, events []notificationApi.AggregatedEvent, _ []string, _ services.Destination) error {
+			sent <- events
+			return nil
+		})
+
+	for _, app := range []*unstructured.Unstructured{app1, app2} {
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		assert.NotNil(t, NewState(annotations[notifiedAnnotationKey])[StateItemKey(false, "", "my-trigger", triggers.ConditionResult{}, dest)])
+	}
+
+	select {
+	case events := <-sent:
+		if assert.Len(t, events, 2) {
+			assert.Equal(t, "my-trigger", events[0].Trigger)
+			assert.Equal(t, "app-1", events[0].Object["metadata"].(map[string]interface{})["name"])
+			assert.Equal(t, "app-2", events[1].Object["metadata"].(map[string]interface{})["name"])
+		}
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "aggregated notification was not sent")
+	}
+}
+
+func TestCollectsDigestNotifications(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	dest := services.Destination{Service: "mock", Recipient: "recipient", Parameters: map[string]string{notificationApi.DigestParameter: "ops-daily"}}
+	app := newResource("app-1", withAnnotations(map[string]string{
+		"notifications.argoproj.io/subscriptions": `
+- trigger: [my-trigger]
+  destinations:
+  - service: mock
+    recipients: [recipient]
+    parameters:
+      digest: ops-daily`,
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{Digests: map[string]notificationApi.Digest{
+		"ops-daily": {Schedule: notificationApi.DigestScheduleDaily, Template: "digest"},
+	}}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendAggregated(gomock.Any(), gomock.Any(), []string{"digest"}, dest).Return(nil)
+
+	_, err = ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+
+	batch := ctrl.aggregator.take("digest//ops-daily/" + dest.String())
+	if assert.NotNil(t, batch) {
+		assert.Len(t, batch.events, 1)
+		assert.NoError(t, ctrl.sendAggregated(ctx, batch))
+	}
+}
+
+func TestAggregatesNotificationsInDeliveryQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	app1 := newResource("app-1", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+	app2 := newResource("app-2", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+
+	queue := delivery.NewMemoryQueue()
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app1, app2), WithDeliveryQueue(queue))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{Namespace: "default", Aggregation: &notificationApi.AggregationConfig{Window: 60, Template: "events"}}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil).Times(2)
+
+	for _, app := range []*unstructured.Unstructured{app1, app2} {
+		_, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+	}
+
+	// the collected notifications are persisted in the queue and flushed together
+	tasks, err := queue.Pending(ctx)
+	assert.NoError(t, err)
+	if !assert.Len(t, tasks, 2) {
+		return
+	}
+	assert.Equal(t, "aggregation/default/"+dest.String(), tasks[0].Aggregate)
+	assert.Equal(t, tasks[0].NextAttempt, tasks[1].NextAttempt)
+	assert.True(t, tasks[0].NextAttempt.After(time.Now().Add(50*time.Second)))
+	assert.Equal(t, tasks[0].NextAttempt, ctrl.dispatchQueued(ctx))
+
+	for _, task := range tasks {
+		task.NextAttempt = time.Now()
+		assert.NoError(t, queue.Add(ctx, task))
+	}
+	api.EXPECT().SendAggregated(gomock.Any(), gomock.Any(), []string{"events"}, dest).
+		DoAndReturn(func(_ context.Context, events []notificationApi.AggregatedEvent, _ []string, _ services.Destination) error {
+			if assert.Len(t, events, 2) {
+				assert.Equal(t, "app-1", events[0].Object["metadata"].(map[string]interface{})["name"])
+				assert.Equal(t, "app-2", events[1].Object["metadata"].(map[string]interface{})["name"])
+			}
+			return nil
+		})
+	ctrl.dispatchQueued(ctx)
+
+	tasks, err = queue.Pending(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, tasks)
+}
+
+func TestAggregator_Stop(t *testing.T) {
+	flushed := make(chan struct{}, 1)
+	aggregator := newAggregator(func(key string, batch *aggregationBatch) {
+		flushed <- struct{}{}
+	})
+	newBatch := func() *aggregationBatch {
+		return &aggregationBatch{}
+	}
+	aggregator.add("my-batch", 10*time.Millisecond, newBatch, notificationApi.AggregatedEvent{Trigger: "my-trigger"})
+	assert.Equal(t, 1, aggregator.stop())
+
+	select {
+	case <-flushed:
+		assert.Fail(t, "the batch was flushed after the aggregator was stopped")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFlushAggregated_RetryAndFallback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	fallback := services.Destination{Service: "mock", Recipient: "fallback"}
+	ctrl, api, err := newContextController(t, ctx, newFakeClient())
+	assert.NoError(t, err)
+	ctrl.aggregator.stop()
+
+	cfg := notificationApi.Config{
+		RetryPolicy: &notificationApi.RetryPolicy{MaxAttempts: 2},
+		Fallbacks:   map[string]services.Destination{"mock": fallback},
+	}
+	api.EXPECT().GetConfig().Return(cfg).AnyTimes()
+	events := []notificationApi.AggregatedEvent{{Trigger: "my-trigger", Object: map[string]interface{}{}}}
+	api.EXPECT().SendAggregated(gomock.Any(), events, []string{"events"}, dest).Return(errors.New("service unavailable")).Times(2)
+	api.EXPECT().SendAggregated(gomock.Any(), events, []string{"events"}, fallback).Return(nil)
+
+	ctrl.flushAggregated("aggregation//"+dest.String(), &aggregationBatch{api: api, template: "events", dest: dest, events: events})
+	batch := ctrl.aggregator.take("retry/aggregation//" + dest.String())
+	if assert.NotNil(t, batch, "the batch is retried") {
+		assert.Equal(t, 1, batch.failures)
+		ctrl.flushAggregated("retry/aggregation//"+dest.String(), batch)
+	}
+	assert.Nil(t, ctrl.aggregator.take("retry/aggregation//"+dest.String()), "the batch is given up")
+}
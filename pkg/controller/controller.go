@@ -3,26 +3,39 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"runtime/debug"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
 	runtimeutil "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 
 	"github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/deadletter"
+	"github.com/argoproj/notifications-engine/pkg/delivery"
+	"github.com/argoproj/notifications-engine/pkg/metrics"
 	"github.com/argoproj/notifications-engine/pkg/services"
 	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+	"github.com/argoproj/notifications-engine/pkg/triggers"
 )
 
+// tracer uses the global tracer provider, spans are not recorded unless the provider is configured
+var tracer = otel.Tracer("github.com/argoproj/notifications-engine/pkg/controller")
+
 // NotificationDelivery represents a notification that was delivered
 type NotificationDelivery struct {
 	// Trigger is the trigger of the notification delivery
@@ -74,7 +87,14 @@ func WithToUnstructured(f func(obj v1.Object) (*unstructured.Unstructured, error
 
 func WithMetricsRegistry(r *MetricsRegistry) Opts {
 	return func(ctrl *notificationController) {
-		ctrl.metricsRegistry = r
+		ctrl.metrics = r.Metrics
+	}
+}
+
+// WithMetrics sets the metrics updated by the controller, e.g. metrics registered into the registry of the caller
+func WithMetrics(m *metrics.Metrics) Opts {
+	return func(ctrl *notificationController) {
+		ctrl.metrics = m
 	}
 }
 
@@ -90,6 +110,67 @@ func WithSkipProcessing(f func(obj v1.Object) (bool, string)) Opts {
 	}
 }
 
+// WithKubeClient sets the client used to store the notifications that could not be delivered in the dead-letter ConfigMap
+func WithKubeClient(client kubernetes.Interface) Opts {
+	return func(ctrl *notificationController) {
+		ctrl.kubeClient = client
+	}
+}
+
+// WithSendTimeout sets the maximum duration of a single notification delivery, deliveries are not limited by default
+func WithSendTimeout(timeout time.Duration) Opts {
+	return func(ctrl *notificationController) {
+		ctrl.sendTimeout = timeout
+	}
+}
+
+// WithParallelism sets the number of notifications about a resource that are sent concurrently, defaults to 1
+func WithParallelism(parallelism int) Opts {
+	return func(ctrl *notificationController) {
+		ctrl.parallelism = parallelism
+	}
+}
+
+// WithDeliveryQueue decouples the delivery of notifications from the processing of resources. Notifications are stored
+// in the queue and sent in the background, so they are not lost if the controller restarts
+func WithDeliveryQueue(queue delivery.Queue) Opts {
+	return func(ctrl *notificationController) {
+		ctrl.deliveryQueue = queue
+	}
+}
+
+// WithStateStore sets the store of the notification state, the state is kept in the annotations of the resources by
+// default
+func WithStateStore(store StateStore) Opts {
+	return func(ctrl *notificationController) {
+		ctrl.stateStore = store
+	}
+}
+
+// WithCluster sets the name of the cluster of the resources, which is logged and exposed to the templates in the
+// cluster variable
+func WithCluster(name string) Opts {
+	return func(ctrl *notificationController) {
+		ctrl.cluster = name
+	}
+}
+
+// WithShard limits the resources processed by the controller to the resources owned by the shard, so that the
+// resources are distributed across several replicas. Every replica must use a different shard
+func WithShard(shard Shard) Opts {
+	return func(ctrl *notificationController) {
+		ctrl.shard = shard
+	}
+}
+
+// WithShutdownTimeout sets the time the resources in progress are allowed to finish processing once the controller is
+// stopped, before the deliveries in progress are cancelled. Deliveries are cancelled immediately by default
+func WithShutdownTimeout(timeout time.Duration) Opts {
+	return func(ctrl *notificationController) {
+		ctrl.shutdownTimeout = timeout
+	}
+}
+
 // WithEventCallback registers a callback to invoke when an object has been
 // processed for notifications.
 func WithEventCallback(f func(eventSequence NotificationEventSequence)) Opts {
@@ -105,41 +186,62 @@ func NewController(
 	opts ...Opts,
 ) *notificationController {
 	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	ctrl := &notificationController{
+		client:       client,
+		informer:     informer,
+		queue:        queue,
+		metrics:      metrics.New(""),
+		apiFactory:   apiFactory,
+		stateStore:   NewAnnotationStateStore(),
+		deduplicator: api.NewDeduplicator(),
+		toUnstructured: func(obj v1.Object) (*unstructured.Unstructured, error) {
+			res, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				return nil, fmt.Errorf("Object must be *unstructured.Unstructured but was: %v", res)
+			}
+			return res, nil
+		},
+	}
+	ctrl.aggregator = newAggregator(ctrl.flushAggregated)
+	for i := range opts {
+		opts[i](ctrl)
+	}
 	informer.AddEventHandler(
 		cache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj interface{}) {
 				key, err := cache.MetaNamespaceKeyFunc(obj)
-				if err == nil {
+				if err == nil && ctrl.owns(obj) {
 					queue.Add(key)
 				}
 			},
 			UpdateFunc: func(old, new interface{}) {
 				key, err := cache.MetaNamespaceKeyFunc(new)
-				if err == nil {
+				if err == nil && ctrl.owns(new) {
 					queue.Add(key)
 				}
 			},
+			DeleteFunc: ctrl.deleteState,
 		},
 	)
+	return ctrl
+}
 
-	ctrl := &notificationController{
-		client:          client,
-		informer:        informer,
-		queue:           queue,
-		metricsRegistry: NewMetricsRegistry(""),
-		apiFactory:      apiFactory,
-		toUnstructured: func(obj v1.Object) (*unstructured.Unstructured, error) {
-			res, ok := obj.(*unstructured.Unstructured)
-			if !ok {
-				return nil, fmt.Errorf("Object must be *unstructured.Unstructured but was: %v", res)
-			}
-			return res, nil
-		},
+// deleteState removes the state of the deleted resource from the state store if the store keeps it outside of the cluster
+func (c *notificationController) deleteState(obj interface{}) {
+	deleter, ok := c.stateStore.(StateDeleter)
+	if !ok {
+		return
 	}
-	for i := range opts {
-		opts[i](ctrl)
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	resource, ok := obj.(v1.Object)
+	if !ok || !c.owns(resource) {
+		return
+	}
+	if err := deleter.Delete(c.context(), resource); err != nil {
+		log.Warnf("Failed to delete the notification state of the deleted resource %s/%s: %v", resource.GetNamespace(), resource.GetName(), err)
 	}
-	return ctrl
 }
 
 // NewControllerWithNamespaceSupport For self-service notification
@@ -159,102 +261,493 @@ type notificationController struct {
 	informer          cache.SharedIndexInformer
 	queue             workqueue.RateLimitingInterface
 	apiFactory        api.Factory
-	metricsRegistry   *MetricsRegistry
+	metrics           *metrics.Metrics
 	skipProcessing    func(obj v1.Object) (bool, string)
 	alterDestinations func(obj v1.Object, destinations services.Destinations, cfg api.Config) services.Destinations
 	toUnstructured    func(obj v1.Object) (*unstructured.Unstructured, error)
 	eventCallback     func(eventSequence NotificationEventSequence)
 	namespaceSupport  bool
+	kubeClient        kubernetes.Interface
+	sendTimeout       time.Duration
+	parallelism       int
+	deliveryQueue     delivery.Queue
+	stateStore        StateStore
+	aggregator        *aggregator
+	deduplicator      *api.Deduplicator
+	cluster           string
+	shutdownTimeout   time.Duration
+	stopCh            <-chan struct{}
+	shard             Shard
+	// deadLetterSinks holds the dead-letter sinks by the namespace of the configuration
+	deadLetterSinks     map[string]deadLetterSink
+	deadLetterSinksLock sync.Mutex
+	// ctx is the context of the running controller, which is cancelled once the controller stopped
+	ctx context.Context
 }
 
 func (c *notificationController) Run(threadiness int, stopCh <-chan struct{}) {
 	defer runtimeutil.HandleCrash()
-	defer c.queue.ShutDown()
+	// the context cancels the deliveries in progress once the controller is stopped and the shutdown timeout elapsed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.stopCh = stopCh
+	c.ctx = ctx
 
 	log.Warn("Controller is running.")
+	if updater, ok := c.apiFactory.(api.ConfigResourceStatusUpdater); ok {
+		// the status of the configuration resources is only updated by the replica that processes the resources
+		statusCtx, cancelStatus := context.WithCancel(ctx)
+		defer cancelStatus()
+		go updater.RunConfigResourceStatusUpdates(statusCtx)
+	}
+	var workers sync.WaitGroup
 	for i := 0; i < threadiness; i++ {
-		go wait.Until(func() {
-			for c.processQueueItem() {
-			}
-		}, time.Second, stopCh)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			wait.Until(func() {
+				for c.processQueueItem() {
+				}
+			}, time.Second, stopCh)
+		}()
+	}
+	if c.deliveryQueue != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			c.runDeliveryQueue(ctx, stopCh)
+		}()
 	}
 	<-stopCh
+	c.queue.ShutDown()
+	if pending := c.aggregator.stop(); pending > 0 {
+		log.Warnf("Dropping %d aggregated notifications kept in memory, use a delivery queue to persist them.", pending)
+	}
+
+	// the resources in progress are processed to completion within the shutdown timeout, so that the state of the sent
+	// notifications is persisted before another replica takes over
+	stopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(stopped)
+	}()
+	if c.shutdownTimeout > 0 {
+		select {
+		case <-stopped:
+		case <-time.After(c.shutdownTimeout):
+			log.Warn("Shutdown timeout elapsed, cancelling the deliveries in progress.")
+		}
+	}
+	cancel()
+	<-stopped
 	log.Warn("Controller has stopped.")
 }
 
+// context returns the context of the running controller, or the background context if the controller is not running
+func (c *notificationController) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// owns returns true if the resource is processed by the controller
+func (c *notificationController) owns(obj interface{}) bool {
+	if c.shard == nil {
+		return true
+	}
+	metaObj, ok := obj.(v1.Object)
+	return ok && c.shard.Owns(metaObj)
+}
+
+// stopped returns true once the controller is stopped and must not start processing other resources
+func (c *notificationController) stopped() bool {
+	select {
+	case <-c.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
 // check if an api is a self-service API
 func (c *notificationController) isSelfServiceConfigureApi(api api.API) bool {
 	return c.namespaceSupport && api.GetConfig().IsSelfServiceConfig
 }
 
-func (c *notificationController) processResourceWithAPI(api api.API, resource v1.Object, logEntry *log.Entry, eventSequence *NotificationEventSequence) (map[string]string, error) {
-	apiNamespace := api.GetConfig().Namespace
-	notificationsState := NewStateFromRes(resource)
+func (c *notificationController) processResourceWithAPI(notificationsAPI api.API, resource v1.Object, logEntry *log.Entry, eventSequence *NotificationEventSequence) (map[string]string, error) {
+	ctx, span := tracer.Start(c.context(), "notifications.process", trace.WithAttributes(
+		attribute.String("notifications.resource.namespace", resource.GetNamespace()),
+		attribute.String("notifications.resource.name", resource.GetName()),
+	))
+	defer span.End()
 
-	destinations := c.getDestinations(resource, api.GetConfig())
-	if len(destinations) == 0 {
-		return resource.GetAnnotations(), nil
+	contextAPI := api.NewContextAPI(notificationsAPI)
+	apiNamespace := notificationsAPI.GetConfig().Namespace
+	notificationsState, err := c.stateStore.Load(ctx, resource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the notification state: %v", err)
 	}
+	retries := NewRetriesFromRes(resource)
+	history := NewHistoryFromRes(resource)
 
 	un, err := c.toUnstructured(resource)
 	if err != nil {
 		return nil, err
 	}
-
+	cfg := notificationsAPI.GetConfig()
+	destinations := c.getDestinations(resource, un.Object, cfg, eventSequence)
+	if len(destinations) == 0 {
+		return resource.GetAnnotations(), nil
+	}
+	// sending notifications might update the notification state annotation, so don't modify the informer cache object
+	un = un.DeepCopy()
+
+	var unacknowledged, unresolved []string
+	// the recovery triggers that reset the oncePer values of conditions are evaluated once per resource
+	recovered := map[string]bool{}
+	isRecovered := func(trigger string) bool {
+		if res, ok := recovered[trigger]; ok {
+			return res
+		}
+		res, err := contextAPI.RunTriggerWithContext(ctx, trigger, un.Object)
+		if err != nil {
+			logEntry.Debugf("Failed to execute condition of recovery trigger %s: %v using the configuration in namespace %s", trigger, err, apiNamespace)
+		}
+		for _, cr := range res {
+			recovered[trigger] = recovered[trigger] || cr.Triggered
+		}
+		return recovered[trigger]
+	}
+	// the deliveries update the state of the resource holding the lock of the pool
+	pool := newDeliveryPool(c.parallelism)
+	pool.Lock()
 	for trigger, destinations := range destinations {
-		res, err := api.RunTrigger(trigger, un.Object)
+		trigger, destinations := trigger, destinations
+		ctx := services.WithTrigger(ctx, trigger)
+		res, err := contextAPI.RunTriggerWithContext(ctx, trigger, un.Object)
 		if err != nil {
+			c.metrics.IncTriggerEvaluationErrorsCounter(trigger)
 			logEntry.Debugf("Failed to execute condition of trigger %s: %v using the configuration in namespace %s", trigger, err, apiNamespace)
 			eventSequence.addWarning(fmt.Errorf("failed to execute condition of trigger %s: %v using the configuration in namespace %s", trigger, err, apiNamespace))
 		}
 		logEntry.Infof("Trigger %s result: %v", trigger, res)
 
+		acknowledged := subscriptions.NewAnnotations(resource.GetAnnotations()).Acknowledged(trigger)
+		resolved := subscriptions.NewAnnotations(resource.GetAnnotations()).Resolved(trigger)
+		escalations := cfg.GetEscalationDestinations(trigger)
+		triggered := false
 		for _, cr := range res {
-			c.metricsRegistry.IncTriggerEvaluationsCounter(trigger, cr.Triggered)
+			cr := cr
+			c.metrics.IncTriggerEvaluationsCounter(trigger, cr.Triggered)
 
 			if !cr.Triggered {
-				for _, to := range destinations {
-					notificationsState.SetAlreadyNotified(c.isSelfServiceConfigureApi(api), apiNamespace, trigger, cr, to, false)
+				reset := cr.OncePerResetBy != "" && isRecovered(cr.OncePerResetBy)
+				for _, to := range append(escalations, destinations...) {
+					if cr.Cooldown > 0 {
+						notificationsState.startCooldown(c.isSelfServiceConfigureApi(notificationsAPI), apiNamespace, trigger, cr, to)
+					}
+					notificationsState.SetAlreadyNotified(c.isSelfServiceConfigureApi(notificationsAPI), apiNamespace, trigger, cr, to, false)
+					delete(retries, StateItemKey(c.isSelfServiceConfigureApi(notificationsAPI), apiNamespace, trigger, cr, to))
+					notificationsState.clearTracked(c.isSelfServiceConfigureApi(notificationsAPI), apiNamespace, trigger, cr, to)
+					if reset {
+						notificationsState.resetOncePer(c.isSelfServiceConfigureApi(notificationsAPI), apiNamespace, trigger, cr, to)
+					}
 				}
+				if reset {
+					logEntry.Debugf("Recovery trigger %s reset the oncePer values of condition '%s.%s'", cr.OncePerResetBy, trigger, cr.Key)
+				}
+				continue
+			}
+			triggered = true
+			if resolved {
+				logEntry.Debugf("Notifications about condition '%s.%s' were resolved externally", trigger, cr.Key)
 				continue
 			}
 
-			for _, to := range destinations {
-				if changed := notificationsState.SetAlreadyNotified(c.isSelfServiceConfigureApi(api), apiNamespace, trigger, cr, to, true); !changed {
-					logEntry.Infof("Notification about condition '%s.%s' already sent to '%v' using the configuration in namespace %s", trigger, cr.Key, to, apiNamespace)
-					eventSequence.addDelivered(NotificationDelivery{
-						Trigger:         trigger,
-						Destination:     to,
-						AlreadyNotified: true,
-					})
-				} else {
-					logEntry.Infof("Sending notification about condition '%s.%s' to '%v' using the configuration in namespace %s", trigger, cr.Key, to, apiNamespace)
-					if err := api.Send(un.Object, cr.Templates, to); err != nil {
-						logEntry.Errorf("Failed to notify recipient %s defined in resource %s/%s: %v using the configuration in namespace %s",
-							to, resource.GetNamespace(), resource.GetName(), err, apiNamespace)
-						notificationsState.SetAlreadyNotified(c.isSelfServiceConfigureApi(api), apiNamespace, trigger, cr, to, false)
-						c.metricsRegistry.IncDeliveriesCounter(trigger, to.Service, false)
-						eventSequence.addError(fmt.Errorf("failed to deliver notification %s to %s: %v using the configuration in namespace %s", trigger, to, err, apiNamespace))
-					} else {
-						logEntry.Debugf("Notification %s was sent using the configuration in namespace %s", to.Recipient, apiNamespace)
-						c.metricsRegistry.IncDeliveriesCounter(trigger, to.Service, true)
-						eventSequence.addDelivered(NotificationDelivery{
-							Trigger:         trigger,
-							Destination:     to,
-							AlreadyNotified: false,
-						})
-					}
+			notify := func(to services.Destination) {
+				c.notify(&notification{
+					pendingNotification: &pendingNotification{
+						cfg:          cfg,
+						isSelfConfig: c.isSelfServiceConfigureApi(notificationsAPI),
+						trigger:      trigger,
+						cr:           cr,
+						to:           to,
+						state:        notificationsState,
+						retries:      retries,
+						matchesSubscription: func(to services.Destination) (bool, error) {
+							return contextAPI.MatchesSubscription(un.Object, to)
+						},
+						requeue: func(delay time.Duration) {
+							c.requeueAfter(resource, delay)
+						},
+						logEntry: logEntry,
+					},
+					ctx:           ctx,
+					api:           notificationsAPI,
+					pool:          pool,
+					resource:      resource,
+					un:            un,
+					history:       &history,
+					eventSequence: eventSequence,
+				})
+			}
+			// the escalation tiers are notified if the condition is still met after their delay
+			escalate := !acknowledged && len(escalations) > 0
+			var notified time.Time
+			if escalate {
+				if notified = notificationsState.FirstNotified(c.isSelfServiceConfigureApi(notificationsAPI), apiNamespace, trigger, cr, destinations); notified.IsZero() {
+					notified = time.Now()
 				}
 			}
+			for _, to := range destinations {
+				to := to
+				pool.Go(func() { notify(to) })
+			}
+
+			if !escalate {
+				continue
+			}
+			due, next := cfg.GetEscalations(trigger, notified, time.Now())
+			for _, to := range due {
+				to := to
+				pool.Go(func() { notify(to) })
+			}
+			if !next.IsZero() {
+				c.requeueAfter(resource, time.Until(next))
+			}
+		}
+		if acknowledged && !triggered && err == nil {
+			// the acknowledgement ends once the condition is no longer met
+			unacknowledged = append(unacknowledged, trigger)
+		}
+		if resolved && !triggered && err == nil {
+			// the resolution ends once the condition is no longer met
+			unresolved = append(unresolved, trigger)
+		}
+	}
+	pool.Unlock()
+	pool.Wait()
+
+	// the state is shared by the configurations of all namespaces, so the entries of other configurations are kept
+	if !c.namespaceSupport {
+		liveKeys := liveStateKeys(cfg, destinations)
+		if cfg.NotifiedState != nil && cfg.NotifiedState.Prune {
+			notificationsState.prune(liveKeys)
+		}
+		retries.prune(liveKeys)
+	}
+	notificationsState.truncate(cfg.GetNotifiedStateMaxEntries())
+	annotations := map[string]string{}
+	for k, v := range resource.GetAnnotations() {
+		annotations[k] = v
+	}
+	if err := c.stateStore.Save(ctx, resource, notificationsState, annotations); err != nil {
+		return nil, fmt.Errorf("failed to save the notification state: %v", err)
+	}
+	if val, ok := annotations[subscriptions.NotifiedAnnotationKey()]; ok && cfg.NotifiedState != nil && cfg.NotifiedState.Compress {
+		if annotations[subscriptions.NotifiedAnnotationKey()], err = compressState(val); err != nil {
+			return nil, err
+		}
+	}
+	for _, trigger := range unacknowledged {
+		subscriptions.NewAnnotations(annotations).Unacknowledge(trigger)
+	}
+	for _, trigger := range unresolved {
+		subscriptions.NewAnnotations(annotations).Unresolve(trigger)
+	}
+	if err := retries.Persist(annotations); err != nil {
+		return nil, err
+	}
+	if cfg.DeliveryHistory != nil {
+		if err := history.Persist(annotations, cfg.DeliveryHistory.MaxRecords); err != nil {
+			return nil, err
+		}
+	}
+	// services might have recorded values in the notification state stored in the annotations of the unstructured resource
+	stateAnnotationKey := subscriptions.StateAnnotationKey()
+	if state, ok := un.GetAnnotations()[stateAnnotationKey]; ok {
+		annotations[stateAnnotationKey] = state
+	} else {
+		delete(annotations, stateAnnotationKey)
+	}
+	return annotations, nil
+}
+
+// liveStateKeys returns the state item keys of the conditions of the configured triggers and the destinations
+func liveStateKeys(cfg api.Config, destinations services.Destinations) map[string]bool {
+	keys := map[string]bool{}
+	for trigger, dests := range destinations {
+		for i, condition := range cfg.Triggers[trigger] {
+			cr := triggers.ConditionResult{Key: triggers.ConditionKey(i, condition)}
+			for _, dest := range append(cfg.GetEscalationDestinations(trigger), dests...) {
+				keys[StateItemKey(false, cfg.Namespace, trigger, cr, dest)] = true
+			}
 		}
 	}
+	return keys
+}
+
+// isDuplicate returns true if the notification was suppressed because an identical notification was sent recently
+func isDuplicate(err error) bool {
+	return errors.Is(err, api.ErrDuplicate)
+}
 
-	return notificationsState.Persist(resource)
+// isDryRun returns true if the notification was rendered but not sent because of the dry-run mode
+func isDryRun(err error) bool {
+	return errors.Is(err, api.ErrDryRun)
+}
+
+// withDeliveredRecipients returns the context of the retry of the delivery, which skips the resolved recipients that
+// previous attempts delivered the notification to
+func withDeliveredRecipients(ctx context.Context, retry DeliveryRetry) context.Context {
+	if len(retry.Delivered) == 0 {
+		return ctx
+	}
+	return api.WithDeliveredRecipients(ctx, retry.Delivered)
 }
 
-func (c *notificationController) getDestinations(resource v1.Object, cfg api.Config) services.Destinations {
-	res := cfg.GetGlobalDestinations(resource.GetLabels())
-	res.Merge(subscriptions.NewAnnotations(resource.GetAnnotations()).GetDestinations(cfg.DefaultTriggers, cfg.ServiceDefaultTriggers))
+// recordDeliveredRecipients records the resolved recipients that the notification was delivered to if the delivery only
+// partially failed, so that they are not notified again when the delivery is retried
+func recordDeliveredRecipients(retries DeliveryRetries, key string, err error) {
+	var partialErr *api.PartialDeliveryError
+	if errors.As(err, &partialErr) {
+		retry := retries[key]
+		retry.Delivered = partialErr.Delivered
+		retries[key] = retry
+	}
+}
+
+// sendUnlocked sends the notification without holding the lock of the pool. The notification is sent using a copy of
+// the resource and the state recorded by stateful services is merged into the resource afterwards
+func (c *notificationController) sendUnlocked(ctx context.Context, pool *deliveryPool, notificationsAPI api.API, un *unstructured.Unstructured, cr triggers.ConditionResult, dest services.Destination) error {
+	obj := un.DeepCopy().Object
+	before := getServiceState(obj)
+	var err error
+	pool.Unlocked(func() {
+		err = c.send(ctx, notificationsAPI, obj, cr, dest)
+	})
+	mergeServiceState(un.Object, before, getServiceState(obj))
+	return err
+}
+
+// send sends the notification about the condition to the destination, the severity of the condition is exposed to
+// the templates
+func (c *notificationController) send(ctx context.Context, notificationsAPI api.API, obj map[string]interface{}, cr triggers.ConditionResult, dest services.Destination) error {
+	ctx, cancel := c.sendContext(api.WithSeverity(ctx, cr.Severity))
+	defer cancel()
+	return api.NewContextAPI(notificationsAPI).SendWithContext(ctx, obj, cr.Templates, dest)
+}
+
+// retryDelivery records the failed delivery and schedules the processing of the resource when the delivery is retried,
+// but not before retryAfter. giveUp is invoked with the number of failed attempts if the retry policy is exhausted
+func (c *notificationController) retryDelivery(retries DeliveryRetries, key string, policy api.RetryPolicy, retryAfter time.Time, resource v1.Object, logEntry *log.Entry, giveUp func(attempts int)) {
+	backoff := policy.Backoff
+	if delay := time.Until(retryAfter); delay > 0 {
+		backoff = func(failures int) time.Duration {
+			if d := policy.Backoff(failures); d > delay {
+				return d
+			}
+			return delay
+		}
+	}
+	retry := retries.Failed(key, backoff)
+	if policy.Exhausted(retry.Failures, time.Unix(retry.FirstFailure, 0)) {
+		logEntry.Errorf("Giving up notification %s after %d failed attempts", key, retry.Failures)
+		delete(retries, key)
+		giveUp(retry.Failures)
+		return
+	}
+	c.requeueAfter(resource, time.Until(time.Unix(retry.NextAttempt, 0)))
+}
+
+// deadLetterSink is the dead-letter sink of the configuration of a namespace, the sink is created again once the
+// configuration changed
+type deadLetterSink struct {
+	api  api.API
+	sink deadletter.Sink
+}
+
+// getDeadLetterSink returns the dead-letter sink of the configuration in the given namespace
+func (c *notificationController) getDeadLetterSink(notificationsAPI api.API, cfg api.DeadLetterConfig, namespace string) (deadletter.Sink, error) {
+	c.deadLetterSinksLock.Lock()
+	defer c.deadLetterSinksLock.Unlock()
+	if existing, ok := c.deadLetterSinks[namespace]; ok && existing.api == notificationsAPI {
+		return existing.sink, nil
+	}
+	sink, err := deadletter.NewSink(cfg, namespace, c.kubeClient, notificationsAPI.GetNotificationServices())
+	if err != nil {
+		return nil, err
+	}
+	if c.deadLetterSinks == nil {
+		c.deadLetterSinks = map[string]deadLetterSink{}
+	}
+	c.deadLetterSinks[namespace] = deadLetterSink{api: notificationsAPI, sink: sink}
+	return sink, nil
+}
+
+// addDeadLetter records the rendered notification that could not be delivered in the configured dead-letter sink
+func (c *notificationController) addDeadLetter(notificationsAPI api.API, cfg api.DeadLetterConfig, namespace string, resource v1.Object, trigger string, dest services.Destination, sendErr error, attempts int, logEntry *log.Entry) {
+	var notification services.Notification
+	var state services.State
+	var deliveryErr *api.DeliveryError
+	if errors.As(sendErr, &deliveryErr) {
+		notification = deliveryErr.Notification
+		state = deliveryErr.State
+	}
+	sink, err := c.getDeadLetterSink(notificationsAPI, cfg, namespace)
+	if err != nil {
+		logEntry.Errorf("Failed to create dead-letter sink: %v", err)
+		return
+	}
+	letter := deadletter.NewLetter(resource.GetNamespace(), resource.GetName(), trigger, dest, notification, sendErr.Error(), attempts)
+	letter.State = state
+	if err := sink.Add(letter); err != nil {
+		logEntry.Errorf("Failed to record dead letter %s: %v", letter.ID, err)
+		return
+	}
+	logEntry.Infof("Recorded notification %s to '%v' as dead letter %s", trigger, dest, letter.ID)
+}
+
+// logEntry returns the log entry of the processing of the resource with the given key
+func (c *notificationController) logEntry(key interface{}) *log.Entry {
+	logEntry := log.WithField("resource", key)
+	if c.cluster != "" {
+		logEntry = logEntry.WithField("cluster", c.cluster)
+	}
+	return logEntry
+}
+
+// sendContext returns the context of a single notification delivery
+func (c *notificationController) sendContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = api.WithDeduplicator(ctx, c.deduplicator)
+	if c.cluster != "" {
+		ctx = api.WithCluster(ctx, c.cluster)
+	}
+	if c.sendTimeout > 0 {
+		return context.WithTimeout(ctx, c.sendTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func (c *notificationController) requeueAfter(resource v1.Object, delay time.Duration) {
+	if key, err := cache.MetaNamespaceKeyFunc(resource); err == nil {
+		c.queue.AddAfter(key, delay)
+	}
+}
+
+func (c *notificationController) getDestinations(resource v1.Object, obj map[string]interface{}, cfg api.Config, eventSequence *NotificationEventSequence) services.Destinations {
+	res := cfg.GetGlobalDestinationsOf(obj)
+	annotated := subscriptions.NewAnnotations(resource.GetAnnotations()).GetDestinations(cfg.DefaultTriggers, cfg.ServiceDefaultTriggers)
+	if cfg.SelfServicePolicy != nil {
+		var rejected []error
+		annotated, rejected = cfg.SelfServicePolicy.Filter(cfg.ExpandRecipientGroups(annotated))
+		for _, err := range rejected {
+			eventSequence.addWarning(err)
+		}
+	}
+	res.Merge(annotated)
+	res = cfg.ExpandRecipientGroups(res)
 	if c.alterDestinations != nil {
 		res = c.alterDestinations(resource, res, cfg)
 	}
@@ -267,6 +760,11 @@ func (c *notificationController) processQueueItem() (processNext bool) {
 		processNext = false
 		return
 	}
+	if c.stopped() {
+		c.queue.Done(key)
+		return false
+	}
+	c.metrics.SetQueueDepth(c.queue.Len())
 	processNext = true
 	defer func() {
 		if r := recover(); r != nil {
@@ -300,7 +798,7 @@ func (c *notificationController) processQueueItem() (processNext bool) {
 	}
 	eventSequence.Resource = resource
 
-	logEntry := log.WithField("resource", key)
+	logEntry := c.logEntry(key)
 	logEntry.Info("Start processing")
 	if c.skipProcessing != nil {
 		if skipProcessing, reason := c.skipProcessing(resource); skipProcessing {
@@ -377,7 +875,7 @@ func (c *notificationController) processResource(api api.API, resource v1.Object
 			eventSequence.addWarning(fmt.Errorf("failed to marshal annotations patch %v", err))
 			return
 		}
-		resource, err = c.client.Namespace(resource.GetNamespace()).Patch(context.Background(), resource.GetName(), types.MergePatchType, patchData, v1.PatchOptions{})
+		resource, err = c.client.Namespace(resource.GetNamespace()).Patch(c.context(), resource.GetName(), types.MergePatchType, patchData, v1.PatchOptions{})
 		if err != nil {
 			logEntry.Errorf("Failed to patch resource: %v", err)
 			eventSequence.addWarning(fmt.Errorf("failed to patch resource annotations %v", err))
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -12,6 +14,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -25,6 +28,7 @@ import (
 	notificationApi "github.com/argoproj/notifications-engine/pkg/api"
 	"github.com/argoproj/notifications-engine/pkg/mocks"
 	"github.com/argoproj/notifications-engine/pkg/services"
+	servicemocks "github.com/argoproj/notifications-engine/pkg/services/mocks"
 	"github.com/argoproj/notifications-engine/pkg/subscriptions"
 	"github.com/argoproj/notifications-engine/pkg/triggers"
 )
@@ -66,12 +70,22 @@ func newResource(name string, modifiers ...func(app *unstructured.Unstructured))
 }
 
 func newController(t *testing.T, ctx context.Context, client dynamic.Interface, opts ...Opts) (*notificationController, *mocks.MockAPI, error) {
+	return newControllerWithAPI(t, ctx, client, mocks.NewMockAPI, opts...)
+}
+
+// newContextController returns a controller using a mock of the API that supports the context of the deliveries
+func newContextController(t *testing.T, ctx context.Context, client dynamic.Interface, opts ...Opts) (*notificationController, *mocks.MockContextAPI, error) {
+	return newControllerWithAPI(t, ctx, client, mocks.NewMockContextAPI, opts...)
+}
+
+// newControllerWithAPI returns a controller using the mock API created by newAPI
+func newControllerWithAPI[T notificationApi.API](t *testing.T, ctx context.Context, client dynamic.Interface, newAPI func(*gomock.Controller) T, opts ...Opts) (*notificationController, T, error) {
 	mockCtrl := gomock.NewController(t)
 	go func() {
 		<-ctx.Done()
 		mockCtrl.Finish()
 	}()
-	mockAPI := mocks.NewMockAPI(mockCtrl)
+	mockAPI := newAPI(mockCtrl)
 	resourceClient := client.Resource(testGVR)
 	informer := cache.NewSharedIndexInformer(
 		&cache.ListWatch{
@@ -91,7 +105,8 @@ func newController(t *testing.T, ctx context.Context, client dynamic.Interface,
 
 	c := NewControllerWithNamespaceSupport(resourceClient, informer, &mocks.FakeFactory{Api: mockAPI}, opts...)
 	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
-		return nil, nil, errors.New("failed to sync informers")
+		var zero T
+		return nil, zero, errors.New("failed to sync informers")
 	}
 
 	return c, mockAPI, nil
@@ -166,6 +181,56 @@ func TestSendsNotificationIfTriggered(t *testing.T) {
 	assert.Equal(t, app.Object, receivedObj)
 }
 
+func TestPersistsStateRecordedBySend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	stateAnnotationKey := subscriptions.StateAnnotationKey()
+	api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, services.Destination{Service: "mock", Recipient: "recipient"}).
+		DoAndReturn(func(_ context.Context, obj map[string]interface{}, _ []string, _ services.Destination) error {
+			return unstructured.SetNestedField(obj, `{"incidentId":"123"}`, "metadata", "annotations", stateAnnotationKey)
+		})
+
+	annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, `{"incidentId":"123"}`, annotations[stateAnnotationKey])
+	// informer cache object must not be modified
+	assert.NotContains(t, app.GetAnnotations(), stateAnnotationKey)
+}
+
+func TestSendTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app), WithSendTimeout(time.Minute))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, services.Destination{Service: "mock", Recipient: "recipient"}).
+		DoAndReturn(func(sendCtx context.Context, _ map[string]interface{}, _ []string, _ services.Destination) error {
+			deadline, ok := sendCtx.Deadline()
+			assert.True(t, ok)
+			assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 5*time.Second)
+			return nil
+		})
+
+	_, err = ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+}
+
 func TestDoesNotSendNotificationIfAnnotationPresent(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.TODO())
 	defer cancel()
@@ -213,6 +278,929 @@ func TestRemovesAnnotationIfNoTrigger(t *testing.T) {
 	assert.Empty(t, state)
 }
 
+func TestRecordsRetryIfSendFailed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{RetryPolicy: &notificationApi.RetryPolicy{MaxAttempts: 3}}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, services.Destination{Service: "mock", Recipient: "recipient"}).Return(errors.New("service unavailable"))
+
+	annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+
+	assert.Empty(t, NewState(annotations[notifiedAnnotationKey]))
+	retries := DeliveryRetries{}
+	assert.NoError(t, json.Unmarshal([]byte(annotations[subscriptions.RetriesAnnotationKey()]), &retries))
+	retry := retries[StateItemKey(false, "", "my-trigger", triggers.ConditionResult{}, services.Destination{Service: "mock", Recipient: "recipient"})]
+	assert.Equal(t, 1, retry.Failures)
+	assert.Greater(t, retry.NextAttempt, time.Now().Unix())
+}
+
+func TestRecordsDeliveredRecipientsIfSendPartiallyFailed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{RetryPolicy: &notificationApi.RetryPolicy{MaxAttempts: 3}}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, services.Destination{Service: "mock", Recipient: "recipient"}).
+		Return(&notificationApi.PartialDeliveryError{Delivered: []string{"oncall"}, Err: errors.New("service unavailable")})
+
+	annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+
+	retries := DeliveryRetries{}
+	assert.NoError(t, json.Unmarshal([]byte(annotations[subscriptions.RetriesAnnotationKey()]), &retries))
+	retry := retries[StateItemKey(false, "", "my-trigger", triggers.ConditionResult{}, services.Destination{Service: "mock", Recipient: "recipient"})]
+	assert.Equal(t, 1, retry.Failures)
+	assert.Equal(t, []string{"oncall"}, retry.Delivered)
+}
+
+func TestDoesNotSendNotificationBeforeNextAttempt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	key := StateItemKey(false, "", "my-trigger", triggers.ConditionResult{}, services.Destination{Service: "mock", Recipient: "recipient"})
+	retries := DeliveryRetries{key: {Failures: 1, FirstFailure: time.Now().Unix(), NextAttempt: time.Now().Add(time.Minute).Unix()}}
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+		subscriptions.RetriesAnnotationKey():                       mustToJson(retries),
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{RetryPolicy: &notificationApi.RetryPolicy{MaxAttempts: 3}}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+
+	annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+
+	assert.Empty(t, NewState(annotations[notifiedAnnotationKey]))
+	assert.Equal(t, mustToJson(retries), annotations[subscriptions.RetriesAnnotationKey()])
+}
+
+func TestGivesUpIfRetriesExhausted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	key := StateItemKey(false, "", "my-trigger", triggers.ConditionResult{}, services.Destination{Service: "mock", Recipient: "recipient"})
+	retries := DeliveryRetries{key: {Failures: 2, FirstFailure: time.Now().Add(-time.Minute).Unix(), NextAttempt: time.Now().Add(-time.Second).Unix()}}
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+		subscriptions.RetriesAnnotationKey():                       mustToJson(retries),
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{RetryPolicy: &notificationApi.RetryPolicy{MaxAttempts: 3}}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, services.Destination{Service: "mock", Recipient: "recipient"}).Return(errors.New("service unavailable"))
+
+	annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+
+	assert.NotNil(t, NewState(annotations[notifiedAnnotationKey])[key])
+	assert.NotContains(t, annotations, subscriptions.RetriesAnnotationKey())
+}
+
+func TestGivesUpIfPermanentFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	key := StateItemKey(false, "", "my-trigger", triggers.ConditionResult{}, services.Destination{Service: "mock", Recipient: "recipient"})
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{RetryPolicy: &notificationApi.RetryPolicy{MaxAttempts: 3}}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, services.Destination{Service: "mock", Recipient: "recipient"}).
+		Return(&services.AuthError{Err: errors.New("invalid token")})
+
+	annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+
+	assert.NotNil(t, NewState(annotations[notifiedAnnotationKey])[key])
+	assert.NotContains(t, annotations, subscriptions.RetriesAnnotationKey())
+}
+
+func TestSendsGivenUpNotificationToFallback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	fallback := services.Destination{Service: "mock", Recipient: "fallback"}
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{
+		RetryPolicy: &notificationApi.RetryPolicy{MaxAttempts: 3},
+		Fallbacks:   map[string]services.Destination{"mock": fallback},
+	}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, services.Destination{Service: "mock", Recipient: "recipient"}).
+		Return(&services.PermanentError{Err: errors.New("channel is archived")})
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, fallback).Return(nil)
+
+	eventSequence := NotificationEventSequence{}
+	_, err = ctrl.processResourceWithAPI(api, app, logEntry, &eventSequence)
+	assert.NoError(t, err)
+	if assert.Len(t, eventSequence.Delivered, 1) {
+		assert.Equal(t, fallback, eventSequence.Delivered[0].Destination)
+	}
+}
+
+func TestSendsFailedNotificationToFallbackWithoutRetryPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	fallback := services.Destination{Service: "mock", Recipient: "fallback"}
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{
+		Fallbacks: map[string]services.Destination{"mock": fallback},
+	}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, services.Destination{Service: "mock", Recipient: "recipient"}).
+		Return(errors.New("timeout"))
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, fallback).Return(nil)
+
+	eventSequence := NotificationEventSequence{}
+	annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &eventSequence)
+	assert.NoError(t, err)
+	if assert.Len(t, eventSequence.Delivered, 1) {
+		assert.Equal(t, fallback, eventSequence.Delivered[0].Destination)
+	}
+	assert.NotNil(t, NewState(annotations[notifiedAnnotationKey])[StateItemKey(false, "", "my-trigger", triggers.ConditionResult{}, services.Destination{Service: "mock", Recipient: "recipient"})])
+	assert.NotContains(t, annotations, subscriptions.RetriesAnnotationKey())
+}
+
+func TestSendsNotificationsConcurrently(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient1;recipient2",
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app), WithParallelism(2))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	// every delivery waits until both deliveries started
+	var started sync.WaitGroup
+	started.Add(2)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, _ map[string]interface{}, _ []string, _ services.Destination) error {
+			started.Done()
+			started.Wait()
+			return nil
+		}).Times(2)
+
+	eventSequence := NotificationEventSequence{}
+	_, err = ctrl.processResourceWithAPI(api, app, logEntry, &eventSequence)
+	assert.NoError(t, err)
+	assert.Len(t, eventSequence.Delivered, 2)
+}
+
+func TestQuietHours(t *testing.T) {
+	for _, action := range []string{notificationApi.QuietHoursActionDefer, notificationApi.QuietHoursActionSuppress} {
+		t.Run(action, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.TODO())
+			defer cancel()
+			dest := services.Destination{Service: "mock", Recipient: "recipient"}
+			app := newResource("test", withAnnotations(map[string]string{
+				subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+			}))
+
+			ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+			assert.NoError(t, err)
+
+			// the window starting every minute and lasting an hour is always active
+			cfg, err := notificationApi.ParseConfig(&corev1.ConfigMap{Data: map[string]string{"quietHours": fmt.Sprintf(`
+- name: always
+  schedule: "* * * * *"
+  duration: 3600
+  action: %s
+  services: [mock]`, action)}}, &corev1.Secret{})
+			if !assert.NoError(t, err) {
+				return
+			}
+			api.EXPECT().GetConfig().Return(*cfg).AnyTimes()
+			api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+
+			annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+			assert.NoError(t, err)
+
+			state := NewState(annotations[notifiedAnnotationKey])
+			key := StateItemKey(false, "", "my-trigger", triggers.ConditionResult{}, dest)
+			if action == notificationApi.QuietHoursActionSuppress {
+				assert.Contains(t, state, key)
+			} else {
+				assert.NotContains(t, state, key)
+			}
+		})
+	}
+}
+
+func TestEscalation(t *testing.T) {
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	escalation := services.Destination{Service: "mock", Recipient: "team-lead"}
+	cfg, err := notificationApi.ParseConfig(&corev1.ConfigMap{Data: map[string]string{"escalations": `
+my-trigger:
+- after: 600
+  destinations:
+  - service: mock
+    recipients: [team-lead]`}}, &corev1.Secret{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	newApp := func(notified time.Time, acknowledged bool) *unstructured.Unstructured {
+		state, err := json.Marshal(NotificationsState{StateItemKey(false, "", "my-trigger", triggers.ConditionResult{}, dest): notified.Unix()})
+		assert.NoError(t, err)
+		annotations := map[string]string{
+			subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+			notifiedAnnotationKey: string(state),
+		}
+		if acknowledged {
+			annotations[subscriptions.AcknowledgedAnnotationKey()] = "my-trigger"
+		}
+		return newResource("test", withAnnotations(annotations))
+	}
+
+	t.Run("Escalated", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		app := newApp(time.Now().Add(-20*time.Minute), false)
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		api.EXPECT().GetConfig().Return(*cfg).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+		api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, escalation).Return(nil)
+
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		assert.Contains(t, NewState(annotations[notifiedAnnotationKey]), StateItemKey(false, "", "my-trigger", triggers.ConditionResult{}, escalation))
+	})
+
+	t.Run("NotDue", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		app := newApp(time.Now().Add(-time.Minute), false)
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		api.EXPECT().GetConfig().Return(*cfg).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		assert.NotContains(t, NewState(annotations[notifiedAnnotationKey]), StateItemKey(false, "", "my-trigger", triggers.ConditionResult{}, escalation))
+	})
+
+	t.Run("Acknowledged", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		app := newApp(time.Now().Add(-20*time.Minute), true)
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		api.EXPECT().GetConfig().Return(*cfg).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		assert.Contains(t, annotations, subscriptions.AcknowledgedAnnotationKey())
+	})
+
+	t.Run("Cleared", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		app := newApp(time.Now().Add(-20*time.Minute), true)
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		api.EXPECT().GetConfig().Return(*cfg).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: false}}, nil)
+
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		assert.NotContains(t, annotations, subscriptions.AcknowledgedAnnotationKey())
+	})
+}
+
+func TestDelayedNotification(t *testing.T) {
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	result := triggers.ConditionResult{Key: "[0].abc", Triggered: true, Templates: []string{"test"}, Delay: 600}
+	newApp := func(pendingSince time.Time) *unstructured.Unstructured {
+		annotations := map[string]string{subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient"}
+		if !pendingSince.IsZero() {
+			state, err := json.Marshal(NotificationsState{pendingStatePrefix + StateItemKey(false, "", "my-trigger", result, dest): pendingSince.Unix()})
+			assert.NoError(t, err)
+			annotations[notifiedAnnotationKey] = string(state)
+		}
+		return newResource("test", withAnnotations(annotations))
+	}
+
+	t.Run("Delayed", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		app := newApp(time.Time{})
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{result}, nil)
+
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		state := NewState(annotations[notifiedAnnotationKey])
+		assert.NotContains(t, state, StateItemKey(false, "", "my-trigger", result, dest))
+		assert.Contains(t, state, pendingStatePrefix+StateItemKey(false, "", "my-trigger", result, dest))
+	})
+
+	t.Run("Due", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		app := newApp(time.Now().Add(-20 * time.Minute))
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{result}, nil)
+		api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, dest).Return(nil)
+
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		assert.Contains(t, NewState(annotations[notifiedAnnotationKey]), StateItemKey(false, "", "my-trigger", result, dest))
+	})
+
+	t.Run("Cleared", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		app := newApp(time.Now().Add(-time.Minute))
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Key: result.Key}}, nil)
+
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		assert.Empty(t, NewState(annotations[notifiedAnnotationKey]))
+	})
+}
+
+func TestRepeatedNotification(t *testing.T) {
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	result := triggers.ConditionResult{Key: "[0].abc", Triggered: true, Templates: []string{"test"}, RepeatEvery: 600}
+	key := StateItemKey(false, "", "my-trigger", result, dest)
+	newApp := func(notified time.Time) *unstructured.Unstructured {
+		state, err := json.Marshal(NotificationsState{key: notified.Unix()})
+		assert.NoError(t, err)
+		return newResource("test", withAnnotations(map[string]string{
+			subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+			notifiedAnnotationKey: string(state),
+		}))
+	}
+
+	t.Run("Reminded", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		notified := time.Now().Add(-20 * time.Minute)
+		app := newApp(notified)
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{result}, nil)
+		api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, dest).Return(nil)
+
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		state := NewState(annotations[notifiedAnnotationKey])
+		assert.Equal(t, notified.Unix(), state[key])
+		assert.Contains(t, state, remindedStatePrefix+key)
+	})
+
+	t.Run("DeferredByQuietHours", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		app := newApp(time.Now().Add(-20 * time.Minute))
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		// the window starting every minute and lasting an hour is always active
+		cfg, err := notificationApi.ParseConfig(&corev1.ConfigMap{Data: map[string]string{"quietHours": `
+- name: always
+  schedule: "* * * * *"
+  duration: 3600
+  services: [mock]`}}, &corev1.Secret{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		api.EXPECT().GetConfig().Return(*cfg).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{result}, nil)
+
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		assert.NotContains(t, NewState(annotations[notifiedAnnotationKey]), remindedStatePrefix+key)
+	})
+
+	t.Run("NotDue", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		app := newApp(time.Now().Add(-time.Minute))
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{result}, nil)
+
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		assert.NotContains(t, NewState(annotations[notifiedAnnotationKey]), remindedStatePrefix+key)
+	})
+
+	t.Run("Cleared", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		app := newApp(time.Now().Add(-20 * time.Minute))
+		state := NewStateFromRes(app)
+		state[remindedStatePrefix+key] = time.Now().Unix()
+		annotations, err := state.Persist(app)
+		assert.NoError(t, err)
+		app.SetAnnotations(annotations)
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Key: result.Key}}, nil)
+
+		annotations, err = ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		assert.Empty(t, NewState(annotations[notifiedAnnotationKey]))
+	})
+}
+
+func TestOncePer_TTL(t *testing.T) {
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	result := triggers.ConditionResult{Key: "[0].abc", Triggered: true, Templates: []string{"test"}, OncePer: "v1", OncePerTTL: 600}
+	key := StateItemKey(false, "", "my-trigger", result, dest)
+	newApp := func(notified time.Time) *unstructured.Unstructured {
+		state, err := json.Marshal(NotificationsState{key: notified.Unix()})
+		assert.NoError(t, err)
+		return newResource("test", withAnnotations(map[string]string{
+			subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+			notifiedAnnotationKey: string(state),
+		}))
+	}
+
+	t.Run("Expired", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		app := newApp(time.Now().Add(-20 * time.Minute))
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{result}, nil)
+		api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, dest).Return(nil)
+
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		assert.InDelta(t, time.Now().Unix(), NewState(annotations[notifiedAnnotationKey])[key], 5)
+	})
+
+	t.Run("NotExpired", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		notified := time.Now().Add(-time.Minute)
+		app := newApp(notified)
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{result}, nil)
+
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		assert.Equal(t, notified.Unix(), NewState(annotations[notifiedAnnotationKey])[key])
+	})
+}
+
+func TestOncePer_ResetBy(t *testing.T) {
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	result := triggers.ConditionResult{Key: "[0].abc", OncePerResetBy: "on-recovered", Templates: []string{"test"}}
+	key := StateItemKey(false, "", "my-trigger", triggers.ConditionResult{Key: result.Key, OncePer: "v1"}, dest)
+
+	for name, recovered := range map[string]bool{"Recovered": true, "NotRecovered": false} {
+		recovered := recovered
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.TODO())
+			defer cancel()
+			state, err := json.Marshal(NotificationsState{key: time.Now().Unix()})
+			assert.NoError(t, err)
+			app := newResource("test", withAnnotations(map[string]string{
+				subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+				notifiedAnnotationKey: string(state),
+			}))
+			ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+			assert.NoError(t, err)
+			api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+			api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{result}, nil)
+			api.EXPECT().RunTriggerWithContext(gomock.Any(), "on-recovered", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: recovered}}, nil)
+
+			annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+			assert.NoError(t, err)
+			_, ok := NewState(annotations[notifiedAnnotationKey])[key]
+			assert.Equal(t, !recovered, ok)
+		})
+	}
+}
+
+func TestCooldown(t *testing.T) {
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	result := triggers.ConditionResult{Key: "[0].abc", Triggered: true, Templates: []string{"test"}, Cooldown: 600}
+	key := StateItemKey(false, "", "my-trigger", result, dest)
+	newApp := func(state NotificationsState) *unstructured.Unstructured {
+		data, err := json.Marshal(state)
+		assert.NoError(t, err)
+		return newResource("test", withAnnotations(map[string]string{
+			subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+			notifiedAnnotationKey: string(data),
+		}))
+	}
+	process := func(app *unstructured.Unstructured, cr triggers.ConditionResult, send bool) NotificationsState {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{cr}, nil)
+		if send {
+			api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, dest).Return(nil)
+		}
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		return NewState(annotations[notifiedAnnotationKey])
+	}
+	notified := time.Now().Add(-time.Minute).Unix()
+
+	t.Run("Started", func(t *testing.T) {
+		notRunning := result
+		notRunning.Triggered = false
+		state := process(newApp(NotificationsState{key: notified}), notRunning, false)
+		assert.Equal(t, NotificationsState{cooldownStatePrefix + key: notified}, state)
+	})
+
+	t.Run("InCooldown", func(t *testing.T) {
+		state := process(newApp(NotificationsState{cooldownStatePrefix + key: notified}), result, false)
+		assert.Equal(t, NotificationsState{cooldownStatePrefix + key: notified}, state)
+	})
+
+	t.Run("Ended", func(t *testing.T) {
+		state := process(newApp(NotificationsState{cooldownStatePrefix + key: time.Now().Add(-20 * time.Minute).Unix()}), result, true)
+		assert.Contains(t, state, key)
+		assert.NotContains(t, state, cooldownStatePrefix+key)
+	})
+}
+
+func TestSubscriptionCondition(t *testing.T) {
+	for _, matches := range []bool{true, false} {
+		ctx, cancel := context.WithCancel(context.TODO())
+		app := newResource("test", withAnnotations(map[string]string{
+			"notifications.argoproj.io/subscriptions": `
+- trigger: [my-trigger]
+  when: app.spec.project == 'payments'
+  destinations:
+  - service: mock
+    recipients: [recipient]`,
+		}))
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		dest := services.Destination{Service: "mock", Recipient: "recipient", Parameters: map[string]string{subscriptions.WhenParameter: "app.spec.project == 'payments'"}}
+		api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+		api.EXPECT().MatchesSubscription(gomock.Any(), dest).Return(matches, nil)
+		if matches {
+			api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, dest).Return(nil)
+		}
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		assert.Equal(t, matches, len(NewState(annotations[notifiedAnnotationKey])) > 0)
+		cancel()
+	}
+}
+
+func TestResolved(t *testing.T) {
+	newApp := func() *unstructured.Unstructured {
+		return newResource("test", withAnnotations(map[string]string{
+			subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+			subscriptions.ResolvedAnnotationKey():                      "my-trigger",
+		}))
+	}
+
+	t.Run("NotNotified", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		app := newApp()
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		assert.Contains(t, annotations, subscriptions.ResolvedAnnotationKey())
+		assert.Empty(t, NewState(annotations[notifiedAnnotationKey]))
+	})
+
+	t.Run("Cleared", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		app := newApp()
+		ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+		assert.NoError(t, err)
+		api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+		api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: false}}, nil)
+
+		annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+		assert.NoError(t, err)
+		assert.NotContains(t, annotations, subscriptions.ResolvedAnnotationKey())
+	})
+}
+
+func TestSeverityRouting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	app := newResource("test", withAnnotations(map[string]string{
+		"notifications.argoproj.io/subscriptions": `
+- trigger: [my-trigger]
+  destinations:
+  - service: mock
+    recipients: [chat]
+    parameters:
+      maxSeverity: warning
+  - service: mock
+    recipients: [pager]
+    parameters:
+      minSeverity: critical`,
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	pager := services.Destination{Service: "mock", Recipient: "pager", Parameters: map[string]string{notificationApi.MinSeverityParameter: triggers.SeverityCritical}}
+	api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}, Severity: triggers.SeverityCritical}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, pager).Return(nil)
+
+	eventSequence := NotificationEventSequence{}
+	_, err = ctrl.processResourceWithAPI(api, app, logEntry, &eventSequence)
+	assert.NoError(t, err)
+	if assert.Len(t, eventSequence.Delivered, 1) {
+		assert.Equal(t, pager, eventSequence.Delivered[0].Destination)
+	}
+}
+
+func TestCompressesAndPrunesNotifiedState(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	cfg, err := notificationApi.ParseConfig(&corev1.ConfigMap{Data: map[string]string{
+		"trigger.my-trigger": `[{when: "true", send: [test]}]`,
+		"notifiedState":      `{compress: true, prune: true}`,
+	}}, &corev1.Secret{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	key := StateItemKey(false, "", "my-trigger", triggers.ConditionResult{Key: triggers.ConditionKey(0, cfg.Triggers["my-trigger"][0])}, dest)
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+		notifiedAnnotationKey: `{"removed-trigger:[0].abc:mock:recipient": 1}`,
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+	ctrl.namespaceSupport = false
+
+	api.EXPECT().GetConfig().Return(*cfg).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}, Key: triggers.ConditionKey(0, cfg.Triggers["my-trigger"][0])}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, dest).Return(nil)
+
+	annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(annotations[notifiedAnnotationKey], compressedStatePrefix))
+	state := NewState(annotations[notifiedAnnotationKey])
+	assert.Contains(t, state, key)
+	assert.Len(t, state, 1)
+}
+
+func TestPrunesRetriesOfRemovedSubscriptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	cfg, err := notificationApi.ParseConfig(&corev1.ConfigMap{Data: map[string]string{
+		"trigger.my-trigger": `[{when: "true", send: [test]}]`,
+	}}, &corev1.Secret{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+		subscriptions.RetriesAnnotationKey():                       `{"removed-trigger:[0].abc:mock:recipient": {"failures": 1}}`,
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+	ctrl.namespaceSupport = false
+
+	api.EXPECT().GetConfig().Return(*cfg).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}, Key: triggers.ConditionKey(0, cfg.Triggers["my-trigger"][0])}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, dest).Return(nil)
+
+	annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+	assert.NotContains(t, annotations, subscriptions.RetriesAnnotationKey())
+}
+
+func TestSuppressesDuplicateNotification(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{DeliveryHistory: &notificationApi.DeliveryHistoryConfig{MaxRecords: 10}}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, dest).Return(notificationApi.ErrDuplicate)
+
+	eventSequence := NotificationEventSequence{}
+	annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &eventSequence)
+	assert.NoError(t, err)
+
+	assert.NotNil(t, NewState(annotations[notifiedAnnotationKey])[StateItemKey(false, "", "my-trigger", triggers.ConditionResult{}, dest)])
+	assert.Empty(t, eventSequence.Errors)
+	history := DeliveryHistory{}
+	assert.NoError(t, json.Unmarshal([]byte(annotations[subscriptions.HistoryAnnotationKey()]), &history))
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, DeliveryResultSuppressed, history[0].Result)
+	}
+}
+
+func TestRecordsDryRunNotification(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{DeliveryHistory: &notificationApi.DeliveryHistoryConfig{MaxRecords: 10}}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, dest).Return(notificationApi.ErrDryRun)
+
+	eventSequence := NotificationEventSequence{}
+	annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &eventSequence)
+	assert.NoError(t, err)
+
+	assert.Contains(t, NewState(annotations[notifiedAnnotationKey]), StateItemKey(false, "", "my-trigger", triggers.ConditionResult{}, dest))
+	assert.Empty(t, eventSequence.Errors)
+	history := DeliveryHistory{}
+	assert.NoError(t, json.Unmarshal([]byte(annotations[subscriptions.HistoryAnnotationKey()]), &history))
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, DeliveryResultDryRun, history[0].Result)
+	}
+}
+
+func TestRetriesRateLimitedNotificationAfterRetryAfter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	key := StateItemKey(false, "", "my-trigger", triggers.ConditionResult{}, services.Destination{Service: "mock", Recipient: "recipient"})
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	retryAfter := time.Now().Add(time.Hour)
+	api.EXPECT().GetConfig().Return(notificationApi.Config{RetryPolicy: &notificationApi.RetryPolicy{MaxAttempts: 3}}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, services.Destination{Service: "mock", Recipient: "recipient"}).
+		Return(&services.RateLimitedError{RetryAfter: retryAfter, Err: errors.New("too many requests")})
+
+	annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+
+	retries := DeliveryRetries{}
+	assert.NoError(t, json.Unmarshal([]byte(annotations[subscriptions.RetriesAnnotationKey()]), &retries))
+	assert.Equal(t, 1, retries[key].Failures)
+	assert.GreaterOrEqual(t, retries[key].NextAttempt, retryAfter.Unix())
+}
+
+func TestDoesNotRecordRetryIfCircuitOpen(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{RetryPolicy: &notificationApi.RetryPolicy{MaxAttempts: 3}}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, services.Destination{Service: "mock", Recipient: "recipient"}).
+		Return(&services.CircuitOpenError{RetryAfter: time.Now().Add(time.Minute)})
+
+	annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+
+	assert.Empty(t, NewState(annotations[notifiedAnnotationKey]))
+	assert.NotContains(t, annotations, subscriptions.RetriesAnnotationKey())
+}
+
+func TestAddsDeadLetterIfRetriesExhausted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	key := StateItemKey(false, "", "my-trigger", triggers.ConditionResult{}, dest)
+	retries := DeliveryRetries{key: {Failures: 2, FirstFailure: time.Now().Add(-time.Minute).Unix(), NextAttempt: time.Now().Add(-time.Second).Unix()}}
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+		subscriptions.RetriesAnnotationKey():                       mustToJson(retries),
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	deadLetterService := servicemocks.NewMockNotificationService(gomock.NewController(t))
+	api.EXPECT().GetConfig().Return(notificationApi.Config{
+		RetryPolicy: &notificationApi.RetryPolicy{MaxAttempts: 3},
+		DeadLetter:  &notificationApi.DeadLetterConfig{Service: "ops", Recipient: "alerts"},
+	}).AnyTimes()
+	api.EXPECT().GetNotificationServices().Return(map[string]services.NotificationService{"ops": deadLetterService})
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, dest).
+		Return(&notificationApi.DeliveryError{Notification: services.Notification{Message: "hello"}, Err: errors.New("service unavailable")})
+	deadLetterService.EXPECT().Send(gomock.Any(), services.Destination{Service: "ops", Recipient: "alerts"}).
+		DoAndReturn(func(notification services.Notification, _ services.Destination) error {
+			assert.Contains(t, notification.Message, "could not be delivered to {mock recipient} after 3 attempts: service unavailable")
+			return nil
+		})
+
+	_, err = ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+
+	// the sink is created once per configuration
+	_, err = ctrl.getDeadLetterSink(api, notificationApi.DeadLetterConfig{Service: "ops", Recipient: "alerts"}, "")
+	assert.NoError(t, err)
+}
+
+func TestRecordsDeliveryHistory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{DeliveryHistory: &notificationApi.DeliveryHistoryConfig{MaxRecords: 10}}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, services.Destination{Service: "mock", Recipient: "recipient"}).Return(errors.New("service unavailable"))
+
+	annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+
+	history := NewHistoryFromRes(newResource("test", withAnnotations(annotations)))
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "my-trigger", history[0].Trigger)
+		assert.Equal(t, services.Destination{Service: "mock", Recipient: "recipient"}, history[0].Destination)
+		assert.Equal(t, DeliveryResultFailed, history[0].Result)
+		assert.Equal(t, "service unavailable", history[0].Error)
+	}
+}
+
 func TestUpdatedAnnotationsSavedAsPatch(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.TODO())
 	defer cancel()
@@ -485,3 +1473,45 @@ func TestProcessItemsWithSelfService(t *testing.T) {
 	}
 
 }
+
+func TestRun_FinishesInProgressDeliveriesWithinShutdownTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app), WithShutdownTimeout(5*time.Second))
+	assert.NoError(t, err)
+
+	started := make(chan struct{})
+	sendErr := make(chan error, 1)
+	api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, _ map[string]interface{}, _ []string, _ services.Destination) error {
+			close(started)
+			select {
+			case <-ctx.Done():
+			case <-time.After(100 * time.Millisecond):
+			}
+			sendErr <- ctx.Err()
+			return ctx.Err()
+		})
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		ctrl.Run(1, stopCh)
+		close(done)
+	}()
+	<-started
+	close(stopCh)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("controller did not stop")
+	}
+	assert.NoError(t, <-sendErr)
+}
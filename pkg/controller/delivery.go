@@ -0,0 +1,324 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/delivery"
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+	"github.com/argoproj/notifications-engine/pkg/triggers"
+)
+
+// deliveryQueueInterval is the interval of checking the delivery queue for due notifications, if the queue does not
+// notify about its changes, and the interval of the resync of the queues that do
+var (
+	deliveryQueueInterval       = time.Second
+	deliveryQueueResyncInterval = time.Minute
+)
+
+// enqueue stores the notification about the condition in the delivery queue without holding the lock of the pool
+func (c *notificationController) enqueue(ctx context.Context, pool *deliveryPool, apiNamespace string, trigger string, cr triggers.ConditionResult, dest services.Destination, un *unstructured.Unstructured) error {
+	task := delivery.NewTask(apiNamespace, trigger, cr.Templates, cr.Severity, dest, un.GetNamespace(), un.GetName())
+	var err error
+	pool.Unlocked(func() {
+		err = c.deliveryQueue.Add(ctx, task)
+	})
+	return err
+}
+
+// runDeliveryQueue dispatches the queued notifications until the controller is stopped. The notifications are
+// dispatched whenever the queue changed or the next queued notification is due if the queue notifies about its
+// changes, and polled every deliveryQueueInterval otherwise
+func (c *notificationController) runDeliveryQueue(ctx context.Context, stopCh <-chan struct{}) {
+	watcher, ok := c.deliveryQueue.(delivery.Watcher)
+	if !ok {
+		wait.Until(func() {
+			c.dispatchQueued(ctx)
+		}, deliveryQueueInterval, stopCh)
+		return
+	}
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changes := watcher.Watch(watchCtx)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-changes:
+		case <-timer.C:
+		}
+		delay := deliveryQueueResyncInterval
+		if next := c.dispatchQueued(ctx); !next.IsZero() && time.Until(next) < delay {
+			delay = time.Until(next)
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(delay)
+	}
+}
+
+// dispatchQueued delivers the queued notifications that are due and returns the time the next queued notification
+// is due at, or zero if no notification is queued
+func (c *notificationController) dispatchQueued(ctx context.Context) time.Time {
+	tasks, err := c.deliveryQueue.Pending(ctx)
+	if err != nil {
+		log.Errorf("Failed to get queued notifications: %v", err)
+		return time.Time{}
+	}
+	now := time.Now()
+	var next time.Time
+	var aggregates []string
+	batches := map[string][]delivery.Task{}
+	for _, task := range tasks {
+		if task.Aggregate == "" {
+			continue
+		}
+		if _, ok := batches[task.Aggregate]; !ok {
+			aggregates = append(aggregates, task.Aggregate)
+		}
+		batches[task.Aggregate] = append(batches[task.Aggregate], task)
+	}
+	for _, task := range tasks {
+		if ctx.Err() != nil {
+			return time.Time{}
+		}
+		if task.Aggregate != "" {
+			continue
+		}
+		if !task.Due(now) {
+			if next.IsZero() || task.NextAttempt.Before(next) {
+				next = task.NextAttempt
+			}
+			continue
+		}
+		c.deliverQueued(ctx, task)
+	}
+	for _, key := range aggregates {
+		if ctx.Err() != nil {
+			return time.Time{}
+		}
+		// the tasks are ordered by their creation, so the first task of the batch determines when it is due
+		if first := batches[key][0]; !first.Due(now) {
+			if next.IsZero() || first.NextAttempt.Before(next) {
+				next = first.NextAttempt
+			}
+			continue
+		}
+		c.dispatchAggregated(ctx, key, batches[key])
+	}
+	return next
+}
+
+// getQueuedResource returns the resource of the queued notification from the informer, or nil if it does not exist
+func (c *notificationController) getQueuedResource(task delivery.Task) (*unstructured.Unstructured, error) {
+	key := task.ResourceName
+	if task.ResourceNamespace != "" {
+		key = task.ResourceNamespace + "/" + task.ResourceName
+	}
+	obj, exists, err := c.informer.GetIndexer().GetByKey(key)
+	if err != nil || !exists {
+		return nil, err
+	}
+	resource, ok := obj.(v1.Object)
+	if !ok {
+		return nil, fmt.Errorf("unexpected resource type %T", obj)
+	}
+	un, err := c.toUnstructured(resource)
+	if err != nil {
+		return nil, err
+	}
+	return un.DeepCopy(), nil
+}
+
+// deliverQueued sends the queued notification using the resource as it is when the notification is delivered. Failed
+// deliveries stay in the queue until they are retried, or are given up according to the retry policy of the
+// configuration. The notifications of the resources owned by other shards are left to the replicas owning them
+func (c *notificationController) deliverQueued(ctx context.Context, task delivery.Task) {
+	ctx = services.WithTrigger(ctx, task.Trigger)
+	resource, err := c.getQueuedResource(task)
+	if err != nil {
+		log.Errorf("Failed to get the resource of queued notification %s: %v", task.ID, err)
+		return
+	}
+	if resource == nil {
+		log.Infof("Dropping queued notification %s about trigger %s since resource %s/%s no longer exists", task.ID, task.Trigger, task.ResourceNamespace, task.ResourceName)
+		c.completeQueued(ctx, task, log.NewEntry(log.StandardLogger()))
+		return
+	}
+	if !c.owns(resource) {
+		return
+	}
+	key, _ := cache.MetaNamespaceKeyFunc(resource)
+	logEntry := c.logEntry(key)
+
+	notificationsAPI, err := c.getAPI(task.ResourceNamespace, task.APINamespace)
+	if err != nil {
+		logEntry.Errorf("Failed to get api of queued notification %s: %v", task.ID, err)
+		return
+	}
+	cfg := notificationsAPI.GetConfig()
+	cr := triggers.ConditionResult{Templates: task.Templates, Severity: task.Severity}
+
+	logEntry.Infof("Sending queued notification %s about trigger %s to '%v' using the configuration in namespace %s", task.ID, task.Trigger, task.Destination, task.APINamespace)
+	before := getServiceState(resource.Object)
+	start := time.Now()
+	err = c.send(ctx, notificationsAPI, resource.Object, cr, task.Destination)
+	if isDuplicate(err) {
+		logEntry.Infof("Queued notification %s is identical to a notification sent recently", task.ID)
+		c.metrics.IncDuplicatesCounter(task.Trigger, task.Destination.Service)
+		c.completeQueued(ctx, task, logEntry)
+		return
+	}
+	if isDryRun(err) {
+		logEntry.Infof("Queued notification %s was not sent because of the dry-run mode", task.ID)
+		c.metrics.IncDryRunsCounter(task.Trigger, task.Destination.Service)
+		c.completeQueued(ctx, task, logEntry)
+		return
+	}
+	c.metrics.ObserveSendDuration(task.Destination.Service, err == nil, time.Since(start))
+	c.metrics.IncDeliveriesCounter(task.Trigger, task.Destination.Service, err == nil)
+	if err == nil {
+		if err := c.persistServiceState(ctx, key, before, getServiceState(resource.Object)); err != nil {
+			logEntry.Errorf("Failed to persist the notification state of queued notification %s: %v", task.ID, err)
+		}
+		c.completeQueued(ctx, task, logEntry)
+		return
+	}
+
+	logEntry.Errorf("Failed to deliver queued notification %s to '%v': %v using the configuration in namespace %s", task.ID, task.Destination, err, task.APINamespace)
+	now := time.Now()
+	var circuitOpenErr *services.CircuitOpenError
+	var rateLimitedErr *services.RateLimitedError
+	_, hasFallback := cfg.GetFallback(task.Destination)
+	switch {
+	case errors.As(err, &circuitOpenErr):
+		// the delivery was not attempted, so it does not count against the retry policy
+		c.metrics.IncCircuitBreakerRejectionsCounter(task.Destination.Service)
+		if cfg.RetryPolicy == nil && hasFallback {
+			c.giveUpQueued(ctx, notificationsAPI, cfg, task, resource, err, task.Failures, logEntry)
+			return
+		}
+		task.NextAttempt = circuitOpenErr.RetryAfter
+	case !services.IsRetryable(err):
+		logEntry.Errorf("Giving up queued notification %s to '%v' after a permanent failure", task.ID, task.Destination)
+		c.giveUpQueued(ctx, notificationsAPI, cfg, task, resource, err, task.Failures+1, logEntry)
+		return
+	case cfg.RetryPolicy == nil && hasFallback:
+		// without a retry policy the notification is sent to the fallback right away
+		logEntry.Errorf("Giving up queued notification %s to '%v' since the configuration has no retry policy", task.ID, task.Destination)
+		c.giveUpQueued(ctx, notificationsAPI, cfg, task, resource, err, task.Failures+1, logEntry)
+		return
+	default:
+		// deliveries are retried until they succeed if the configuration has no retry policy nor fallback
+		policy := api.RetryPolicy{}
+		if cfg.RetryPolicy != nil {
+			policy = *cfg.RetryPolicy
+		}
+		if task.Failures == 0 {
+			task.FirstFailure = now
+		}
+		task.Failures++
+		if cfg.RetryPolicy != nil && policy.Exhausted(task.Failures, task.FirstFailure) {
+			logEntry.Errorf("Giving up queued notification %s after %d failed attempts", task.ID, task.Failures)
+			c.giveUpQueued(ctx, notificationsAPI, cfg, task, resource, err, task.Failures, logEntry)
+			return
+		}
+		task.NextAttempt = now.Add(jitter(policy.Backoff(task.Failures)))
+		if errors.As(err, &rateLimitedErr) && rateLimitedErr.RetryAfter.After(task.NextAttempt) {
+			task.NextAttempt = rateLimitedErr.RetryAfter
+		}
+	}
+	if err := c.deliveryQueue.Add(ctx, task); err != nil {
+		logEntry.Errorf("Failed to update queued notification %s: %v", task.ID, err)
+	}
+}
+
+// giveUpQueued removes the queued notification after recording it in the dead-letter sink and sending it to the
+// fallback destination, if configured
+func (c *notificationController) giveUpQueued(ctx context.Context, notificationsAPI api.API, cfg api.Config, task delivery.Task, resource *unstructured.Unstructured, sendErr error, attempts int, logEntry *log.Entry) {
+	if cfg.DeadLetter != nil {
+		c.addDeadLetter(notificationsAPI, *cfg.DeadLetter, task.APINamespace, resource, task.Trigger, task.Destination, sendErr, attempts, logEntry)
+	}
+	if fallback, ok := cfg.GetFallback(task.Destination); ok {
+		logEntry.Infof("Sending queued notification %s to the fallback '%v' of '%v'", task.ID, fallback, task.Destination)
+		err := c.send(ctx, notificationsAPI, resource.Object, triggers.ConditionResult{Templates: task.Templates, Severity: task.Severity}, fallback)
+		c.metrics.IncDeliveriesCounter(task.Trigger, fallback.Service, err == nil)
+		if err != nil {
+			logEntry.Errorf("Failed to notify fallback %s of recipient %s: %v", fallback, task.Destination, err)
+		}
+	}
+	c.completeQueued(ctx, task, logEntry)
+}
+
+func (c *notificationController) completeQueued(ctx context.Context, task delivery.Task, logEntry *log.Entry) {
+	if err := c.deliveryQueue.Done(ctx, task.ID); err != nil {
+		logEntry.Errorf("Failed to remove queued notification %s: %v", task.ID, err)
+	}
+}
+
+// getAPI returns the api of the configuration in the given namespace that is used for the resources of the namespace
+func (c *notificationController) getAPI(namespace string, apiNamespace string) (api.API, error) {
+	if !c.namespaceSupport {
+		return c.apiFactory.GetAPI()
+	}
+	apis, err := c.apiFactory.GetAPIsFromNamespace(namespace)
+	if notificationsAPI, ok := apis[apiNamespace]; ok {
+		return notificationsAPI, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("configuration in namespace %s not found", apiNamespace)
+}
+
+// persistServiceState applies the changes of the state recorded by the services during a queued delivery to the
+// annotations of the resource
+func (c *notificationController) persistServiceState(ctx context.Context, key string, before services.State, after services.State) error {
+	if mapsEqual(before, after) {
+		return nil
+	}
+	obj, exists, err := c.informer.GetIndexer().GetByKey(key)
+	if err != nil || !exists {
+		return err
+	}
+	resource, ok := obj.(v1.Object)
+	if !ok {
+		return fmt.Errorf("unexpected resource type %T", obj)
+	}
+	un, err := c.toUnstructured(resource)
+	if err != nil {
+		return err
+	}
+	un = un.DeepCopy()
+	mergeServiceState(un.Object, before, after)
+	var state interface{}
+	if val, ok := un.GetAnnotations()[subscriptions.StateAnnotationKey()]; ok {
+		state = val
+	}
+	patchData, err := json.Marshal(map[string]map[string]interface{}{
+		"metadata": {"annotations": map[string]interface{}{subscriptions.StateAnnotationKey(): state}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Namespace(resource.GetNamespace()).Patch(ctx, resource.GetName(), types.MergePatchType, patchData, v1.PatchOptions{})
+	return err
+}
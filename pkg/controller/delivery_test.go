@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	notificationApi "github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/delivery"
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+	"github.com/argoproj/notifications-engine/pkg/triggers"
+)
+
+func TestDeliveryQueue(t *testing.T) {
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	for name, tc := range map[string]struct {
+		sendErr error
+		pending int
+	}{
+		"Delivered": {},
+		"Retried":   {sendErr: errors.New("timeout"), pending: 1},
+		"GivenUp":   {sendErr: &services.PermanentError{Err: errors.New("channel is archived")}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.TODO())
+			defer cancel()
+			app := newResource("test", withAnnotations(map[string]string{
+				subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+			}))
+			queue := delivery.NewMemoryQueue()
+			ctrl, api, err := newContextController(t, ctx, newFakeClient(app), WithDeliveryQueue(queue))
+			assert.NoError(t, err)
+
+			api.EXPECT().GetConfig().Return(notificationApi.Config{Namespace: "default", RetryPolicy: &notificationApi.RetryPolicy{MaxAttempts: 3}}).AnyTimes()
+			api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil)
+
+			annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+			assert.NoError(t, err)
+			assert.Contains(t, NewState(annotations[notifiedAnnotationKey]), StateItemKey(false, "default", "my-trigger", triggers.ConditionResult{}, dest))
+			tasks, err := queue.Pending(ctx)
+			assert.NoError(t, err)
+			if !assert.Len(t, tasks, 1) {
+				return
+			}
+			assert.Equal(t, dest, tasks[0].Destination)
+
+			api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, dest).Return(tc.sendErr)
+			ctrl.dispatchQueued(ctx)
+
+			tasks, err = queue.Pending(ctx)
+			assert.NoError(t, err)
+			if assert.Len(t, tasks, tc.pending) && tc.pending > 0 {
+				assert.Equal(t, 1, tasks[0].Failures)
+				assert.True(t, tasks[0].NextAttempt.After(time.Now()))
+				// the retry is not due yet
+				ctrl.dispatchQueued(ctx)
+			}
+		})
+	}
+}
+
+func TestDeliveryQueue_FallbackWithoutRetryPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	fallback := services.Destination{Service: "mock", Recipient: "fallback"}
+	app := newResource("test")
+	queue := delivery.NewMemoryQueue()
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app), WithDeliveryQueue(queue))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{Namespace: "default", Fallbacks: map[string]services.Destination{"mock": fallback}}).AnyTimes()
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, dest).Return(errors.New("timeout"))
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, fallback).Return(nil)
+
+	assert.NoError(t, queue.Add(ctx, delivery.NewTask("default", "my-trigger", []string{"test"}, "", dest, "default", "test")))
+	ctrl.dispatchQueued(ctx)
+
+	tasks, err := queue.Pending(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, tasks)
+}
+
+func TestDeliveryQueue_ResourceDeleted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	queue := delivery.NewMemoryQueue()
+	ctrl, _, err := newContextController(t, ctx, newFakeClient(), WithDeliveryQueue(queue))
+	assert.NoError(t, err)
+
+	task := delivery.NewTask("default", "my-trigger", []string{"test"}, "", services.Destination{Service: "mock", Recipient: "recipient"}, "default", "deleted")
+	assert.NoError(t, queue.Add(ctx, task))
+	ctrl.dispatchQueued(ctx)
+
+	tasks, err := queue.Pending(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, tasks)
+}
+
+func TestRunDeliveryQueue_Watch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	dest := services.Destination{Service: "mock", Recipient: "recipient"}
+	app := newResource("test")
+	queue := delivery.NewMemoryQueue()
+	ctrl, api, err := newContextController(t, ctx, newFakeClient(app), WithDeliveryQueue(queue))
+	assert.NoError(t, err)
+
+	api.EXPECT().GetConfig().Return(notificationApi.Config{Namespace: "default"}).AnyTimes()
+	sent := make(chan struct{})
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, dest).DoAndReturn(
+		func(_ context.Context, _ map[string]interface{}, _ []string, _ services.Destination) error {
+			close(sent)
+			return nil
+		})
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		ctrl.runDeliveryQueue(ctx, stopCh)
+		close(done)
+	}()
+	assert.NoError(t, queue.Add(ctx, delivery.NewTask("default", "my-trigger", []string{"test"}, "", dest, app.GetNamespace(), app.GetName())))
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the queued notification was not delivered")
+	}
+	close(stopCh)
+	<-done
+}
@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+	"github.com/argoproj/notifications-engine/pkg/triggers"
+)
+
+// pendingNotification is the notification about a condition result to a destination that the gates decide about
+type pendingNotification struct {
+	cfg          api.Config
+	isSelfConfig bool
+	trigger      string
+	cr           triggers.ConditionResult
+	to           services.Destination
+	state        NotificationsState
+	retries      DeliveryRetries
+	// matchesSubscription evaluates the send condition of the subscription of the destination
+	matchesSubscription func(to services.Destination) (bool, error)
+	// requeue processes the resource again after the delay
+	requeue  func(delay time.Duration)
+	logEntry *log.Entry
+	// remind is set if the notification is a reminder that the condition is still met
+	remind bool
+}
+
+func (n *pendingNotification) key() string {
+	return StateItemKey(n.isSelfConfig, n.cfg.Namespace, n.trigger, n.cr, n.to)
+}
+
+func (n *pendingNotification) notified() bool {
+	_, notified := n.state[n.key()]
+	return notified
+}
+
+// verdict is the decision of a gate to not send the notification
+type verdict struct {
+	// reason describes why the notification is not sent
+	reason string
+	// until is the time the notification is decided about again, the notification is skipped if it is zero
+	until time.Time
+	// alreadyNotified is set if the notification counts as sent
+	alreadyNotified bool
+}
+
+// gate decides whether the notification is sent, it returns nil to pass the notification to the next gate. The gates
+// record the state of the decisions, e.g. the time the condition of a delayed notification was first met
+type gate func(n *pendingNotification) *verdict
+
+// notificationGates are the gates of the notifications in the order they are evaluated, the notification is sent if
+// it passes every gate
+var notificationGates = []gate{
+	checkSeverity,
+	checkSubscription,
+	expireOncePer,
+	checkReminder,
+	checkCooldown,
+	checkDelay,
+	checkAlreadyNotified,
+	checkRetry,
+	checkQuietHours,
+}
+
+// decide evaluates the gates of the notification, it returns nil if the notification is sent
+func decide(n *pendingNotification) *verdict {
+	for _, g := range notificationGates {
+		if v := g(n); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+func checkSeverity(n *pendingNotification) *verdict {
+	if matches, err := n.cfg.MatchesSeverity(n.to, n.cr.Severity); err != nil {
+		n.logEntry.Warnf("Failed to match the severity of condition '%s.%s' with '%v': %v, sending the notification", n.trigger, n.cr.Key, n.to, err)
+	} else if !matches {
+		return &verdict{reason: fmt.Sprintf("filtered by severity %s", n.cr.Severity)}
+	}
+	return nil
+}
+
+func checkSubscription(n *pendingNotification) *verdict {
+	if n.to.Parameters[subscriptions.WhenParameter] == "" {
+		return nil
+	}
+	if matches, err := n.matchesSubscription(n.to); err != nil {
+		n.logEntry.Warnf("Failed to evaluate the send condition of the subscription of '%v' to condition '%s.%s': %v, skipping the notification", n.to, n.trigger, n.cr.Key, err)
+		return &verdict{reason: fmt.Sprintf("failed to evaluate the send condition of the subscription: %v", err)}
+	} else if !matches {
+		return &verdict{reason: "filtered by the send condition of the subscription"}
+	}
+	return nil
+}
+
+func expireOncePer(n *pendingNotification) *verdict {
+	if n.cr.OncePer != "" && n.cr.OncePerTTL > 0 && n.state.expireOncePer(n.isSelfConfig, n.cfg.Namespace, n.trigger, n.cr, n.to, time.Duration(n.cr.OncePerTTL)*time.Second) {
+		n.logEntry.Infof("The oncePer value %s of condition '%s.%s' to '%v' expired", n.cr.OncePer, n.trigger, n.cr.Key, n.to)
+	}
+	return nil
+}
+
+// checkReminder sends the notification again every repeatEvery seconds while the condition is met, the reminder is
+// recorded once it is delivered
+func checkReminder(n *pendingNotification) *verdict {
+	if n.cr.RepeatEvery <= 0 {
+		return nil
+	}
+	if next := n.state.nextReminder(n.isSelfConfig, n.cfg.Namespace, n.trigger, n.cr, n.to); next.IsZero() || time.Now().Before(next) {
+		if next.IsZero() {
+			next = time.Now().Add(time.Duration(n.cr.RepeatEvery) * time.Second)
+		}
+		n.requeue(time.Until(next))
+	} else {
+		n.logEntry.Infof("Reminding '%v' about condition '%s.%s' which is still met", n.to, n.trigger, n.cr.Key)
+		n.remind = true
+	}
+	return nil
+}
+
+// checkCooldown sends the notification once the cooldown ended if the condition is still met
+func checkCooldown(n *pendingNotification) *verdict {
+	if n.notified() || n.cr.Cooldown <= 0 {
+		return nil
+	}
+	if until := n.state.cooldownUntil(n.isSelfConfig, n.cfg.Namespace, n.trigger, n.cr, n.to); !until.IsZero() {
+		return &verdict{reason: fmt.Sprintf("in cooldown until %s", until.UTC().Format(time.RFC3339)), until: until}
+	}
+	return nil
+}
+
+// checkDelay evaluates the condition again once the delay elapsed, the notification is only sent if it is still met
+func checkDelay(n *pendingNotification) *verdict {
+	if n.notified() {
+		return nil
+	}
+	delay, err := n.cfg.GetDelay(n.to, n.cr)
+	if err != nil {
+		n.logEntry.Warnf("Failed to get the delay of condition '%s.%s' to '%v': %v, sending the notification without delay", n.trigger, n.cr.Key, n.to, err)
+	}
+	if delay <= 0 {
+		return nil
+	}
+	if due := n.state.delayedUntil(n.isSelfConfig, n.cfg.Namespace, n.trigger, n.cr, n.to, delay); time.Now().Before(due) {
+		return &verdict{reason: fmt.Sprintf("delayed until %s", due.UTC().Format(time.RFC3339)), until: due}
+	}
+	return nil
+}
+
+func checkAlreadyNotified(n *pendingNotification) *verdict {
+	if !n.notified() || n.remind {
+		return nil
+	}
+	if n.cr.OncePer != "" {
+		return &verdict{reason: fmt.Sprintf("already notified for %s", n.cr.OncePer), alreadyNotified: true}
+	}
+	return &verdict{reason: "already notified, waiting for the condition to stop being met", alreadyNotified: true}
+}
+
+func checkRetry(n *pendingNotification) *verdict {
+	if retry, ok := n.retries[n.key()]; ok && n.cfg.RetryPolicy != nil && time.Now().Unix() < retry.NextAttempt {
+		at := time.Unix(retry.NextAttempt, 0)
+		return &verdict{reason: fmt.Sprintf("retried at %s", at.UTC().Format(time.RFC3339)), until: at}
+	}
+	return nil
+}
+
+func checkQuietHours(n *pendingNotification) *verdict {
+	quietHours, end := n.cfg.GetQuietHours(n.to, time.Now())
+	if quietHours == nil {
+		return nil
+	}
+	if quietHours.Suppresses() {
+		delete(n.retries, n.key())
+		return &verdict{reason: fmt.Sprintf("suppressed during the quiet hours %s", quietHours.Name), alreadyNotified: true}
+	}
+	return &verdict{reason: fmt.Sprintf("deferred until the quiet hours %s end at %s", quietHours.Name, end.UTC().Format(time.RFC3339)), until: end}
+}
+
+// ExplainNotification returns the reason the controller sends or does not send the notification about the condition
+// result of the trigger to the destination, given the state and the delivery retries of the resource. The state and
+// the retries are not modified. isSelfConfig must be true if the controller supports namespaces and the configuration
+// of the API is a self-service configuration, like the state keys of the controller
+func ExplainNotification(notificationAPI api.API, isSelfConfig bool, obj map[string]interface{}, state NotificationsState, retries DeliveryRetries, trigger string, cr triggers.ConditionResult, to services.Destination) string {
+	if !cr.Triggered {
+		return "condition is not met"
+	}
+	cfg := notificationAPI.GetConfig()
+	discard := log.New()
+	discard.SetOutput(io.Discard)
+	n := &pendingNotification{
+		cfg:          cfg,
+		isSelfConfig: isSelfConfig,
+		trigger:      trigger,
+		cr:           cr,
+		to:           to,
+		state:        NotificationsState{},
+		retries:      DeliveryRetries{},
+		matchesSubscription: func(to services.Destination) (bool, error) {
+			return api.NewContextAPI(notificationAPI).MatchesSubscription(obj, to)
+		},
+		requeue:  func(time.Duration) {},
+		logEntry: log.NewEntry(discard),
+	}
+	for k, v := range state {
+		n.state[k] = v
+	}
+	for k, v := range retries {
+		n.retries[k] = v
+	}
+	if v := decide(n); v != nil {
+		return v.reason
+	}
+	// the notifications of services in dry-run mode are not sent when they are delivered
+	if cfg.IsDryRun(to.Service) {
+		return "not sent because of the dry-run mode"
+	}
+	return "would notify"
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	notificationApi "github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/mocks"
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+	"github.com/argoproj/notifications-engine/pkg/triggers"
+)
+
+func TestExplainNotification(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	api := mocks.NewMockAPI(mockCtrl)
+	api.EXPECT().GetConfig().Return(notificationApi.Config{RetryPolicy: &notificationApi.RetryPolicy{}}).AnyTimes()
+	to := services.Destination{Service: "mock", Recipient: "recipient"}
+	cr := triggers.ConditionResult{Key: "[0]", Triggered: true}
+
+	assert.Equal(t, "condition is not met", ExplainNotification(api, false, nil, NotificationsState{}, DeliveryRetries{}, "my-trigger", triggers.ConditionResult{}, to))
+	assert.Equal(t, "would notify", ExplainNotification(api, false, nil, NotificationsState{}, DeliveryRetries{}, "my-trigger", cr, to))
+
+	state := NotificationsState{}
+	state.SetAlreadyNotified(false, "", "my-trigger", cr, to, true)
+	assert.Equal(t, "already notified, waiting for the condition to stop being met", ExplainNotification(api, false, nil, state, DeliveryRetries{}, "my-trigger", cr, to))
+
+	delayed := cr
+	delayed.Delay = 60
+	assert.Contains(t, ExplainNotification(api, false, nil, NotificationsState{}, DeliveryRetries{}, "my-trigger", delayed, to), "delayed until")
+
+	retries := DeliveryRetries{StateItemKey(false, "", "my-trigger", cr, to): {Failures: 1, NextAttempt: time.Now().Add(time.Minute).Unix()}}
+	assert.Contains(t, ExplainNotification(api, false, nil, NotificationsState{}, retries, "my-trigger", cr, to), "retried at")
+
+	// explaining the notification does not record the decisions in the state of the resource
+	state = NotificationsState{}
+	ExplainNotification(api, false, nil, state, DeliveryRetries{}, "my-trigger", delayed, to)
+	assert.Empty(t, state)
+}
+
+func TestExplainNotification_MatchesReconcile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	app := newResource("test", withAnnotations(map[string]string{
+		subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): "recipient",
+	}))
+	// the configuration is self-service, but the controller does not support namespaces
+	ctrl, api, err := newController(t, ctx, newFakeClient(app))
+	assert.NoError(t, err)
+	ctrl.namespaceSupport = false
+	to := services.Destination{Service: "mock", Recipient: "recipient"}
+	cr := triggers.ConditionResult{Key: "[0]", Triggered: true, Templates: []string{"test"}}
+	api.EXPECT().GetConfig().Return(notificationApi.Config{IsSelfServiceConfig: true, Namespace: "selfservice_namespace"}).AnyTimes()
+	api.EXPECT().RunTrigger("my-trigger", gomock.Any()).Return([]triggers.ConditionResult{cr}, nil).Times(2)
+	api.EXPECT().Send(gomock.Any(), []string{"test"}, to).Return(nil)
+
+	annotations, err := ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+	app.SetAnnotations(annotations)
+
+	reason := ExplainNotification(api, ctrl.isSelfServiceConfigureApi(api), nil, NewStateFromRes(app), NewRetriesFromRes(app), "my-trigger", cr, to)
+	assert.Equal(t, "already notified, waiting for the condition to stop being met", reason)
+
+	// the controller does not send the notification again either
+	_, err = ctrl.processResourceWithAPI(api, app, logEntry, &NotificationEventSequence{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"encoding/json"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+)
+
+type DeliveryResult string
+
+const (
+	DeliveryResultSucceeded DeliveryResult = "succeeded"
+	DeliveryResultFailed    DeliveryResult = "failed"
+	// DeliveryResultSuppressed is the result of notifications identical to a notification sent recently
+	DeliveryResultSuppressed DeliveryResult = "suppressed"
+	// DeliveryResultDryRun is the result of notifications rendered but not sent because of the dry-run mode
+	DeliveryResultDryRun DeliveryResult = "dry-run"
+)
+
+// DeliveryRecord records an attempt to deliver a notification
+type DeliveryRecord struct {
+	Trigger     string               `json:"trigger"`
+	Destination services.Destination `json:"destination"`
+	// Timestamp is the unix time of the attempt
+	Timestamp int64 `json:"timestamp"`
+	// Attempts is the number of consecutive attempts to deliver the notification to the destination
+	Attempts int            `json:"attempts"`
+	Result   DeliveryResult `json:"result"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// DeliveryHistory holds the delivery records of a resource starting from the oldest one
+type DeliveryHistory []DeliveryRecord
+
+// Add appends the record of the attempt to deliver the notification about the trigger to the destination
+func (h *DeliveryHistory) Add(trigger string, dest services.Destination, err error) DeliveryRecord {
+	record := DeliveryRecord{
+		Trigger:     trigger,
+		Destination: dest,
+		Timestamp:   time.Now().Unix(),
+		Attempts:    1,
+		Result:      DeliveryResultSucceeded,
+	}
+	if isDuplicate(err) {
+		record.Result = DeliveryResultSuppressed
+	} else if isDryRun(err) {
+		record.Result = DeliveryResultDryRun
+	} else if err != nil {
+		record.Result = DeliveryResultFailed
+		record.Error = err.Error()
+	}
+	if last, ok := h.Last(trigger, dest); ok && last.Result == DeliveryResultFailed {
+		record.Attempts = last.Attempts + 1
+	}
+	*h = append(*h, record)
+	return record
+}
+
+// Last returns the latest record of the notification about the trigger to the destination
+func (h DeliveryHistory) Last(trigger string, dest services.Destination) (DeliveryRecord, bool) {
+	for i := len(h) - 1; i >= 0; i-- {
+		if h[i].Trigger == trigger && h[i].Destination.String() == dest.String() {
+			return h[i], true
+		}
+	}
+	return DeliveryRecord{}, false
+}
+
+// Filter returns the records matching the given trigger and service, empty values match any record
+func (h DeliveryHistory) Filter(trigger string, service string) DeliveryHistory {
+	var res DeliveryHistory
+	for _, record := range h {
+		if (trigger == "" || record.Trigger == trigger) && (service == "" || record.Destination.Service == service) {
+			res = append(res, record)
+		}
+	}
+	return res
+}
+
+// Persist stores the latest maxSize records in the annotations
+func (h DeliveryHistory) Persist(annotations map[string]string, maxSize int) error {
+	historyAnnotationKey := subscriptions.HistoryAnnotationKey()
+	if len(h) > maxSize {
+		h = h[len(h)-maxSize:]
+	}
+	if len(h) == 0 {
+		delete(annotations, historyAnnotationKey)
+		return nil
+	}
+	historyJson, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	annotations[historyAnnotationKey] = string(historyJson)
+	return nil
+}
+
+// NewHistoryFromRes returns the delivery history recorded in the annotations of the resource
+func NewHistoryFromRes(res metav1.Object) DeliveryHistory {
+	var history DeliveryHistory
+	if val := res.GetAnnotations()[subscriptions.HistoryAnnotationKey()]; val != "" {
+		if err := json.Unmarshal([]byte(val), &history); err != nil {
+			return nil
+		}
+	}
+	return history
+}
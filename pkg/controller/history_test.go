@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+)
+
+func TestDeliveryHistory_Add(t *testing.T) {
+	slack := services.Destination{Service: "slack", Recipient: "my-channel"}
+	email := services.Destination{Service: "email", Recipient: "user@example.com"}
+
+	history := DeliveryHistory{}
+	assert.Equal(t, 1, history.Add("on-sync-failed", slack, errors.New("timeout")).Attempts)
+	assert.Equal(t, 1, history.Add("on-sync-failed", email, nil).Attempts)
+
+	record := history.Add("on-sync-failed", slack, errors.New("timeout"))
+	assert.Equal(t, 2, record.Attempts)
+	assert.Equal(t, DeliveryResultFailed, record.Result)
+	assert.Equal(t, "timeout", record.Error)
+
+	record = history.Add("on-sync-failed", slack, nil)
+	assert.Equal(t, 3, record.Attempts)
+	assert.Equal(t, DeliveryResultSucceeded, record.Result)
+
+	assert.Equal(t, 1, history.Add("on-sync-failed", slack, nil).Attempts)
+	assert.Len(t, history, 5)
+	assert.Len(t, history.Filter("", "slack"), 4)
+	assert.Len(t, history.Filter("on-sync-succeeded", ""), 0)
+}
+
+func TestDeliveryHistory_Persist(t *testing.T) {
+	history := DeliveryHistory{}
+	for i := 0; i < 5; i++ {
+		history.Add("on-sync-failed", services.Destination{Service: "slack", Recipient: "my-channel"}, nil)
+	}
+
+	annotations := map[string]string{}
+	assert.NoError(t, history.Persist(annotations, 3))
+
+	persisted := NewHistoryFromRes(newResource("test", withAnnotations(annotations)))
+	assert.Equal(t, history[2:], persisted)
+
+	assert.NoError(t, DeliveryHistory{}.Persist(annotations, 3))
+	assert.NotContains(t, annotations, subscriptions.HistoryAnnotationKey())
+}
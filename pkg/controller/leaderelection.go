@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeaderElection holds the settings of the election of the replica that processes the resources
+type LeaderElection struct {
+	// Lock is the lock held by the leader, e.g. a Lease created using resourcelock.New
+	Lock resourcelock.Interface
+	// LeaseDuration is the duration other replicas wait before they take over the lock of the leader, defaults to 15s
+	LeaseDuration time.Duration
+	// RenewDeadline is the duration the leader retries renewing the lock before it stops leading, defaults to 10s
+	RenewDeadline time.Duration
+	// RetryPeriod is the duration between attempts to acquire or renew the lock, defaults to 2s
+	RetryPeriod time.Duration
+}
+
+type leaderElectedController struct {
+	ctrl     NotificationController
+	election LeaderElection
+}
+
+// NewLeaderElectedController returns a controller that runs the given controller while the replica is the leader, so
+// that several replicas can run without sending duplicate notifications. Once the controller is stopped the leader
+// finishes processing the resources in progress, see WithShutdownTimeout, before it releases the lock. Run returns
+// once the replica stopped leading, so that the replica restarts and runs for election again
+func NewLeaderElectedController(ctrl NotificationController, election LeaderElection) *leaderElectedController {
+	if election.LeaseDuration == 0 {
+		election.LeaseDuration = 15 * time.Second
+	}
+	if election.RenewDeadline == 0 {
+		election.RenewDeadline = 10 * time.Second
+	}
+	if election.RetryPeriod == 0 {
+		election.RetryPeriod = 2 * time.Second
+	}
+	return &leaderElectedController{ctrl: ctrl, election: election}
+}
+
+func (c *leaderElectedController) Run(threadiness int, stopCh <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var leading atomic.Bool
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-stopCh:
+			// the leader releases the lock once the controller stopped
+			if !leading.Load() {
+				cancel()
+			}
+		case <-ctx.Done():
+		}
+	}()
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            c.election.Lock,
+		LeaseDuration:   c.election.LeaseDuration,
+		RenewDeadline:   c.election.RenewDeadline,
+		RetryPeriod:     c.election.RetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				leading.Store(true)
+				defer close(stopped)
+				defer cancel()
+				log.Infof("Started leading as %s", c.election.Lock.Identity())
+
+				ctrlStopCh := make(chan struct{})
+				go func() {
+					select {
+					case <-stopCh:
+					case <-leaderCtx.Done():
+					}
+					close(ctrlStopCh)
+				}()
+				c.ctrl.Run(threadiness, ctrlStopCh)
+			},
+			OnStoppedLeading: func() {
+				log.Infof("Stopped leading as %s", c.election.Lock.Identity())
+			},
+		},
+	})
+	if err != nil {
+		log.Errorf("Failed to create the leader elector: %v", err)
+		return
+	}
+	elector.Run(ctx)
+	if leading.Load() {
+		<-stopped
+	}
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+type fakeController struct {
+	lock    *sync.Mutex
+	running *int
+	runs    int
+}
+
+func (c *fakeController) Run(_ int, stopCh <-chan struct{}) {
+	c.lock.Lock()
+	*c.running++
+	c.runs++
+	c.lock.Unlock()
+	<-stopCh
+	// processing of the resources in progress
+	time.Sleep(100 * time.Millisecond)
+	c.lock.Lock()
+	*c.running--
+	c.lock.Unlock()
+}
+
+func TestLeaderElectedController(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	var lock sync.Mutex
+	running := 0
+	newReplica := func(identity string) (*fakeController, chan struct{}, chan struct{}) {
+		ctrl := &fakeController{lock: &lock, running: &running}
+		elected := NewLeaderElectedController(ctrl, LeaderElection{
+			Lock: &resourcelock.LeaseLock{
+				LeaseMeta:  metav1.ObjectMeta{Name: "notifications-controller", Namespace: "default"},
+				Client:     client.CoordinationV1(),
+				LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+			},
+			LeaseDuration: time.Second,
+			RenewDeadline: 500 * time.Millisecond,
+			RetryPeriod:   100 * time.Millisecond,
+		})
+		stopCh := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			elected.Run(1, stopCh)
+			close(done)
+		}()
+		return ctrl, stopCh, done
+	}
+	isRunning := func(ctrl *fakeController) bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return ctrl.runs > 0
+	}
+
+	replica1, stop1, done1 := newReplica("replica-1")
+	assert.Eventually(t, func() bool { return isRunning(replica1) }, 5*time.Second, 10*time.Millisecond)
+	replica2, stop2, done2 := newReplica("replica-2")
+	time.Sleep(300 * time.Millisecond)
+	assert.False(t, isRunning(replica2))
+
+	close(stop1)
+	<-done1
+	assert.Eventually(t, func() bool { return isRunning(replica2) }, 5*time.Second, 10*time.Millisecond)
+	lock.Lock()
+	assert.Equal(t, 1, running)
+	lock.Unlock()
+
+	close(stop2)
+	<-done2
+	lease, err := client.CoordinationV1().Leases("default").Get(context.Background(), "notifications-controller", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, *lease.Spec.HolderIdentity)
+	lock.Lock()
+	assert.Equal(t, 0, running)
+	lock.Unlock()
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"sync"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/argoproj/notifications-engine/pkg/api"
+)
+
+// Cluster holds the client and the informer of the resources of a cluster served by a multi-cluster controller
+type Cluster struct {
+	// Name identifies the cluster in the logs and in the cluster variable of the templates
+	Name     string
+	Client   dynamic.NamespaceableResourceInterface
+	Informer cache.SharedIndexInformer
+	// Opts holds the options that only apply to the resources of the cluster, e.g. the kube client, the state store or
+	// the delivery queue of the cluster
+	Opts []Opts
+}
+
+type multiClusterController struct {
+	controllers []*notificationController
+}
+
+// NewMultiClusterController creates a controller that processes the resources of several clusters using the
+// configuration of the given factory, so that a single deployment serves a fleet of clusters. The state of the
+// resources is kept in the cluster of the resource. The options apply to every cluster, before the options of the cluster
+func NewMultiClusterController(clusters []Cluster, apiFactory api.Factory, opts ...Opts) *multiClusterController {
+	res := &multiClusterController{}
+	for _, cluster := range clusters {
+		clusterOpts := append(append([]Opts{WithCluster(cluster.Name)}, opts...), cluster.Opts...)
+		res.controllers = append(res.controllers, NewController(cluster.Client, cluster.Informer, apiFactory, clusterOpts...))
+	}
+	return res
+}
+
+// Run runs the controllers of all clusters using the given number of workers per cluster until the channel is closed
+func (c *multiClusterController) Run(threadiness int, stopCh <-chan struct{}) {
+	var wg sync.WaitGroup
+	for _, ctrl := range c.controllers {
+		ctrl := ctrl
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctrl.Run(threadiness, stopCh)
+		}()
+	}
+	wg.Wait()
+}
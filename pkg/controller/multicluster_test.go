@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	notificationApi "github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/mocks"
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+	"github.com/argoproj/notifications-engine/pkg/triggers"
+)
+
+func TestMultiClusterController(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	api := mocks.NewMockContextAPI(mockCtrl)
+
+	var clusters []Cluster
+	for _, name := range []string{"cluster-1", "cluster-2"} {
+		app := newResource("test", withAnnotations(map[string]string{
+			subscriptions.SubscribeAnnotationKey("my-trigger", "mock"): name,
+		}))
+		resourceClient := newFakeClient(app).Resource(testGVR)
+		informer := cache.NewSharedIndexInformer(
+			&cache.ListWatch{
+				ListFunc: func(options v1.ListOptions) (object runtime.Object, err error) {
+					return resourceClient.List(context.Background(), options)
+				},
+				WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+					return resourceClient.Watch(context.Background(), options)
+				},
+			},
+			&unstructured.Unstructured{},
+			time.Minute,
+			cache.Indexers{},
+		)
+		go informer.Run(ctx.Done())
+		clusters = append(clusters, Cluster{Name: name, Client: resourceClient, Informer: informer})
+	}
+
+	var lock sync.Mutex
+	var recipients []string
+	api.EXPECT().GetConfig().Return(notificationApi.Config{}).AnyTimes()
+	api.EXPECT().RunTriggerWithContext(gomock.Any(), "my-trigger", gomock.Any()).Return([]triggers.ConditionResult{{Triggered: true, Templates: []string{"test"}}}, nil).AnyTimes()
+	api.EXPECT().SendWithContext(gomock.Any(), gomock.Any(), []string{"test"}, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ map[string]interface{}, _ []string, dest services.Destination) error {
+			lock.Lock()
+			defer lock.Unlock()
+			recipients = append(recipients, dest.Recipient)
+			return nil
+		}).Times(2)
+
+	ctrl := NewMultiClusterController(clusters, &mocks.FakeFactory{Api: api})
+	assert.Len(t, ctrl.controllers, 2)
+	assert.Equal(t, "cluster-2", ctrl.controllers[1].cluster)
+	go ctrl.Run(1, ctx.Done())
+
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(recipients) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []string{"cluster-1", "cluster-2"}, recipients)
+
+	// the state is persisted in the cluster of the resource
+	for _, cluster := range clusters {
+		assert.Eventually(t, func() bool {
+			app, err := cluster.Client.Namespace(testNamespace).Get(context.Background(), "test", v1.GetOptions{})
+			return err == nil && app.GetAnnotations()[notifiedAnnotationKey] != ""
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+}
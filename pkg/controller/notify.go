@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/services"
+)
+
+// notification is the delivery of a notification about a condition of a resource to a destination. The deliveries
+// update the state, the retries, the history and the event sequence of the resource holding the lock of the pool
+type notification struct {
+	*pendingNotification
+	ctx           context.Context
+	api           api.API
+	pool          *deliveryPool
+	resource      v1.Object
+	un            *unstructured.Unstructured
+	history       *DeliveryHistory
+	eventSequence *NotificationEventSequence
+}
+
+// deliveryStep delivers the notification that passed the gates, it returns false to pass the notification to the next
+// step
+type deliveryStep func(c *notificationController, n *notification) bool
+
+// deliverySteps are the ways of delivering the notifications in the order they are tried
+var deliverySteps = []deliveryStep{
+	(*notificationController).collectNotification,
+	(*notificationController).queueNotification,
+	(*notificationController).sendNotification,
+}
+
+// notify decides about the notification using the gates and delivers it if it passed them
+func (c *notificationController) notify(n *notification) {
+	if v := decide(n.pendingNotification); v != nil {
+		c.skipNotification(n, v)
+		return
+	}
+	n.setNotified(true)
+	for _, step := range deliverySteps {
+		if step(c, n) {
+			return
+		}
+	}
+}
+
+func (n *notification) setNotified(notified bool) {
+	n.state.SetAlreadyNotified(n.isSelfConfig, n.cfg.Namespace, n.trigger, n.cr, n.to, notified)
+}
+
+// setReminded records the delivered reminder and processes the resource again once the next reminder is due
+func (n *notification) setReminded() {
+	if !n.remind {
+		return
+	}
+	n.state.setReminded(n.isSelfConfig, n.cfg.Namespace, n.trigger, n.cr, n.to)
+	n.requeue(time.Duration(n.cr.RepeatEvery) * time.Second)
+}
+
+func (n *notification) addDelivered(dest services.Destination, alreadyNotified bool) {
+	n.eventSequence.addDelivered(NotificationDelivery{
+		Trigger:         n.trigger,
+		Destination:     dest,
+		AlreadyNotified: alreadyNotified,
+	})
+}
+
+// skipNotification records the verdict of the gate that stopped the notification
+func (c *notificationController) skipNotification(n *notification, v *verdict) {
+	n.logEntry.Infof("Notification about condition '%s.%s' to '%v' is not sent: %s using the configuration in namespace %s", n.trigger, n.cr.Key, n.to, v.reason, n.cfg.Namespace)
+	if !v.until.IsZero() {
+		n.requeue(time.Until(v.until))
+	}
+	if v.alreadyNotified {
+		n.setNotified(true)
+		n.addDelivered(n.to, true)
+	}
+}
+
+// collectNotification collects the notification into the aggregated notification of the destination, if the
+// condition aggregates its notifications
+func (c *notificationController) collectNotification(n *notification) bool {
+	aggregated, err := c.aggregate(n.ctx, n.pool, n.api, n.cfg, n.trigger, n.cr, n.to, n.un, n.logEntry)
+	if err != nil {
+		n.logEntry.Errorf("Failed to collect notification about condition '%s.%s' to '%v': %v using the configuration in namespace %s", n.trigger, n.cr.Key, n.to, err, n.cfg.Namespace)
+		n.setNotified(false)
+		n.eventSequence.addError(fmt.Errorf("failed to collect notification %s to %s: %v using the configuration in namespace %s", n.trigger, n.to, err, n.cfg.Namespace))
+		return true
+	}
+	if !aggregated {
+		return false
+	}
+	n.logEntry.Infof("Collected notification about condition '%s.%s' to '%v' using the configuration in namespace %s", n.trigger, n.cr.Key, n.to, n.cfg.Namespace)
+	delete(n.retries, n.key())
+	n.setReminded()
+	n.addDelivered(n.to, false)
+	return true
+}
+
+// queueNotification stores the notification in the delivery queue of the controller, if configured
+func (c *notificationController) queueNotification(n *notification) bool {
+	if c.deliveryQueue == nil {
+		return false
+	}
+	if err := c.enqueue(n.ctx, n.pool, n.cfg.Namespace, n.trigger, n.cr, n.to, n.un); err != nil {
+		n.logEntry.Errorf("Failed to queue notification about condition '%s.%s' to '%v': %v using the configuration in namespace %s", n.trigger, n.cr.Key, n.to, err, n.cfg.Namespace)
+		n.setNotified(false)
+		n.eventSequence.addError(fmt.Errorf("failed to queue notification %s to %s: %v using the configuration in namespace %s", n.trigger, n.to, err, n.cfg.Namespace))
+		return true
+	}
+	n.logEntry.Infof("Queued notification about condition '%s.%s' to '%v' using the configuration in namespace %s", n.trigger, n.cr.Key, n.to, n.cfg.Namespace)
+	delete(n.retries, n.key())
+	n.setReminded()
+	n.addDelivered(n.to, false)
+	return true
+}
+
+// sendNotification sends the notification to the destination
+func (c *notificationController) sendNotification(n *notification) bool {
+	n.logEntry.Infof("Sending notification about condition '%s.%s' to '%v' using the configuration in namespace %s", n.trigger, n.cr.Key, n.to, n.cfg.Namespace)
+	start := time.Now()
+	err := c.sendUnlocked(withDeliveredRecipients(n.ctx, n.retries[n.key()]), n.pool, n.api, n.un, n.cr, n.to)
+	recordDeliveredRecipients(n.retries, n.key(), err)
+	if n.cfg.DeliveryHistory != nil {
+		n.history.Add(n.trigger, n.to, err)
+	}
+	switch {
+	case isDuplicate(err):
+		n.logEntry.Infof("Notification about condition '%s.%s' to '%v' is identical to a notification sent recently using the configuration in namespace %s", n.trigger, n.cr.Key, n.to, n.cfg.Namespace)
+		c.metrics.IncDuplicatesCounter(n.trigger, n.to.Service)
+		delete(n.retries, n.key())
+		n.setReminded()
+		n.addDelivered(n.to, true)
+	case isDryRun(err):
+		n.logEntry.Infof("Notification about condition '%s.%s' to '%v' was not sent because of the dry-run mode of the configuration in namespace %s", n.trigger, n.cr.Key, n.to, n.cfg.Namespace)
+		c.metrics.IncDryRunsCounter(n.trigger, n.to.Service)
+		delete(n.retries, n.key())
+		n.setReminded()
+		n.addDelivered(n.to, true)
+	case err != nil:
+		c.metrics.ObserveSendDuration(n.to.Service, false, time.Since(start))
+		c.handleSendFailure(n, err)
+	default:
+		c.metrics.ObserveSendDuration(n.to.Service, true, time.Since(start))
+		n.logEntry.Debugf("Notification %s was sent using the configuration in namespace %s", n.to.Recipient, n.cfg.Namespace)
+		delete(n.retries, n.key())
+		c.metrics.IncDeliveriesCounter(n.trigger, n.to.Service, true)
+		n.setReminded()
+		n.addDelivered(n.to, false)
+	}
+	return true
+}
+
+// handleSendFailure retries the failed notification according to the retry policy of the configuration, or gives it
+// up after a permanent failure
+func (c *notificationController) handleSendFailure(n *notification, err error) {
+	n.logEntry.Errorf("Failed to notify recipient %s defined in resource %s/%s: %v using the configuration in namespace %s",
+		n.to, n.resource.GetNamespace(), n.resource.GetName(), err, n.cfg.Namespace)
+	n.setNotified(false)
+	c.metrics.IncDeliveriesCounter(n.trigger, n.to.Service, false)
+	n.eventSequence.addError(fmt.Errorf("failed to deliver notification %s to %s: %v using the configuration in namespace %s", n.trigger, n.to, err, n.cfg.Namespace))
+	giveUp := func(attempts int) {
+		c.giveUp(n, err, attempts)
+	}
+	retryPolicy := n.cfg.RetryPolicy
+	var circuitOpenErr *services.CircuitOpenError
+	var rateLimitedErr *services.RateLimitedError
+	_, hasFallback := n.cfg.GetFallback(n.to)
+	if errors.As(err, &circuitOpenErr) {
+		// the delivery was not attempted, so it does not count against the retry policy
+		c.metrics.IncCircuitBreakerRejectionsCounter(n.to.Service)
+		if retryPolicy != nil {
+			n.requeue(time.Until(circuitOpenErr.RetryAfter))
+		} else if hasFallback {
+			giveUp(n.retries[n.key()].Failures)
+		}
+	} else if !services.IsRetryable(err) {
+		if errors.Is(err, services.ErrAuth) {
+			n.logEntry.Errorf("Service %s rejected the credentials, check the configuration of the service in namespace %s", n.to.Service, n.cfg.Namespace)
+		}
+		n.logEntry.Errorf("Giving up notification %s to '%v' after a permanent failure", n.trigger, n.to)
+		attempts := n.retries[n.key()].Failures + 1
+		delete(n.retries, n.key())
+		giveUp(attempts)
+	} else if retryPolicy != nil {
+		var retryAfter time.Time
+		if errors.As(err, &rateLimitedErr) {
+			retryAfter = rateLimitedErr.RetryAfter
+		}
+		c.retryDelivery(n.retries, n.key(), *retryPolicy, retryAfter, n.resource, n.logEntry, giveUp)
+	} else if hasFallback {
+		// without a retry policy the notification is sent to the fallback right away
+		n.logEntry.Errorf("Giving up notification %s to '%v' since the configuration has no retry policy", n.trigger, n.to)
+		attempts := n.retries[n.key()].Failures + 1
+		delete(n.retries, n.key())
+		giveUp(attempts)
+	}
+}
+
+// giveUp records the notification that is not attempted again in the dead-letter sink and sends it to the fallback of
+// the destination, if configured. The delivery is not attempted again until the condition is no longer triggered
+func (c *notificationController) giveUp(n *notification, sendErr error, attempts int) {
+	n.setNotified(true)
+	if n.cfg.DeadLetter != nil {
+		n.pool.Unlocked(func() {
+			c.addDeadLetter(n.api, *n.cfg.DeadLetter, n.cfg.Namespace, n.resource, n.trigger, n.to, sendErr, attempts, n.logEntry)
+		})
+	}
+	fallback, ok := n.cfg.GetFallback(n.to)
+	if !ok {
+		return
+	}
+	n.logEntry.Infof("Sending notification about condition '%s.%s' to the fallback '%v' of '%v' using the configuration in namespace %s", n.trigger, n.cr.Key, fallback, n.to, n.cfg.Namespace)
+	fallbackErr := c.sendUnlocked(n.ctx, n.pool, n.api, n.un, n.cr, fallback)
+	if n.cfg.DeliveryHistory != nil {
+		n.history.Add(n.trigger, fallback, fallbackErr)
+	}
+	c.metrics.IncDeliveriesCounter(n.trigger, fallback.Service, fallbackErr == nil)
+	if fallbackErr != nil {
+		n.logEntry.Errorf("Failed to notify fallback %s of recipient %s: %v using the configuration in namespace %s", fallback, n.to, fallbackErr, n.cfg.Namespace)
+		n.eventSequence.addError(fmt.Errorf("failed to deliver notification %s to fallback %s: %v using the configuration in namespace %s", n.trigger, fallback, fallbackErr, n.cfg.Namespace))
+		return
+	}
+	n.addDelivered(fallback, false)
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"encoding/json"
+	"runtime/debug"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+)
+
+// deliveryPool runs the deliveries of a resource using a bounded number of goroutines. Deliveries hold the lock while
+// they update the state of the resource and release it while they send the notification, so a slow service does not
+// delay the other destinations
+type deliveryPool struct {
+	sync.Mutex
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newDeliveryPool(parallelism int) *deliveryPool {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	return &deliveryPool{slots: make(chan struct{}, parallelism)}
+}
+
+// Go runs the delivery once a goroutine is available. The caller must hold the lock, which is released while waiting
+func (p *deliveryPool) Go(delivery func()) {
+	p.Unlock()
+	p.slots <- struct{}{}
+	p.Lock()
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.slots
+			p.wg.Done()
+		}()
+		p.Lock()
+		defer p.Unlock()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Errorf("Recovered from panic: %+v\n%s", r, debug.Stack())
+			}
+		}()
+		delivery()
+	}()
+}
+
+// Unlocked runs the function without holding the lock
+func (p *deliveryPool) Unlocked(f func()) {
+	p.Unlock()
+	defer p.Lock()
+	f()
+}
+
+// Wait waits for the deliveries to complete. The caller must not hold the lock
+func (p *deliveryPool) Wait() {
+	p.wg.Wait()
+}
+
+// getServiceState returns the state recorded by the notification services in the annotations of the resource
+func getServiceState(obj map[string]interface{}) services.State {
+	state := services.State{}
+	if val, ok, err := unstructured.NestedString(obj, "metadata", "annotations", subscriptions.StateAnnotationKey()); err == nil && ok {
+		_ = json.Unmarshal([]byte(val), &state)
+	}
+	return state
+}
+
+// mergeServiceState applies the changes between the given states to the state stored in the annotations of the
+// resource, so that concurrent deliveries don't discard the values recorded by each other
+func mergeServiceState(obj map[string]interface{}, before services.State, after services.State) {
+	state := getServiceState(obj)
+	changed := false
+	for k, v := range after {
+		if old, ok := before[k]; !ok || old != v {
+			state[k] = v
+			changed = true
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			delete(state, k)
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	if len(state) == 0 {
+		unstructured.RemoveNestedField(obj, "metadata", "annotations", subscriptions.StateAnnotationKey())
+		return
+	}
+	if val, err := json.Marshal(state); err == nil {
+		_ = unstructured.SetNestedField(obj, string(val), "metadata", "annotations", subscriptions.StateAnnotationKey())
+	}
+}
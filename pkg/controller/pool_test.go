@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/argoproj/notifications-engine/pkg/services"
+)
+
+func TestDeliveryPool(t *testing.T) {
+	pool := newDeliveryPool(2)
+	count := 0
+	pool.Lock()
+	for i := 0; i < 10; i++ {
+		pool.Go(func() {
+			pool.Unlocked(func() {})
+			count++
+		})
+	}
+	pool.Unlock()
+	pool.Wait()
+	assert.Equal(t, 10, count)
+}
+
+func TestMergeServiceState(t *testing.T) {
+	obj := map[string]interface{}{}
+	mergeServiceState(obj, services.State{}, services.State{"incident": "1", "thread": "2"})
+	assert.Equal(t, services.State{"incident": "1", "thread": "2"}, getServiceState(obj))
+
+	// the values recorded by other deliveries are kept
+	mergeServiceState(obj, services.State{"thread": "2"}, services.State{"message": "3"})
+	assert.Equal(t, services.State{"incident": "1", "message": "3"}, getServiceState(obj))
+
+	mergeServiceState(obj, services.State{"incident": "1", "message": "3"}, services.State{})
+	assert.Empty(t, getServiceState(obj))
+	assert.Empty(t, obj["metadata"].(map[string]interface{})["annotations"])
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"hash/fnv"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Shard selects the resources processed by a controller replica, so that the resources are distributed across
+// several replicas
+type Shard interface {
+	// Owns returns true if the resource is processed by the replica
+	Owns(obj v1.Object) bool
+}
+
+type hashShard struct {
+	index int
+	count int
+}
+
+// NewHashShard returns the shard with the given index of count shards, which owns the resources whose hash of the
+// namespace and name modulo the count equals the index. Every resource is owned by exactly one of the shards
+func NewHashShard(index int, count int) Shard {
+	return &hashShard{index: index, count: count}
+}
+
+func (s *hashShard) Owns(obj v1.Object) bool {
+	if s.count <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(obj.GetNamespace() + "/" + obj.GetName()))
+	return int(h.Sum32()%uint32(s.count)) == s.index
+}
+
+type labelShard struct {
+	label string
+	value string
+}
+
+// NewLabelShard returns the shard that owns the resources with the given value of the label. The shard owning the
+// resources without the label uses the empty value
+func NewLabelShard(label string, value string) Shard {
+	return &labelShard{label: label, value: value}
+}
+
+func (s *labelShard) Owns(obj v1.Object) bool {
+	return obj.GetLabels()[s.label] == s.value
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestHashShard(t *testing.T) {
+	shards := []Shard{NewHashShard(0, 3), NewHashShard(1, 3), NewHashShard(2, 3)}
+	owned := make([]int, len(shards))
+	for i := 0; i < 300; i++ {
+		app := newResource(fmt.Sprintf("app-%d", i))
+		owners := 0
+		for j, shard := range shards {
+			if shard.Owns(app) {
+				owners++
+				owned[j]++
+			}
+		}
+		assert.Equal(t, 1, owners)
+	}
+	for _, count := range owned {
+		assert.Greater(t, count, 50)
+	}
+	assert.True(t, NewHashShard(0, 1).Owns(newResource("test")))
+}
+
+func TestLabelShard(t *testing.T) {
+	shard := NewLabelShard("shard", "a")
+	assert.True(t, shard.Owns(newResource("test", func(app *unstructured.Unstructured) {
+		app.SetLabels(map[string]string{"shard": "a"})
+	})))
+	assert.False(t, shard.Owns(newResource("test", func(app *unstructured.Unstructured) {
+		app.SetLabels(map[string]string{"shard": "b"})
+	})))
+	assert.True(t, NewLabelShard("shard", "").Owns(newResource("test")))
+}
+
+func TestWithShard(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	owned := newResource("owned", func(app *unstructured.Unstructured) {
+		app.SetLabels(map[string]string{"shard": "a"})
+	})
+	other := newResource("other", func(app *unstructured.Unstructured) {
+		app.SetLabels(map[string]string{"shard": "b"})
+	})
+
+	ctrl, _, err := newContextController(t, ctx, newFakeClient(owned, other), WithShard(NewLabelShard("shard", "a")))
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool { return ctrl.queue.Len() == 1 }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, ctrl.queue.Len())
+	key, _ := ctrl.queue.Get()
+	assert.Equal(t, testNamespace+"/owned", key)
+}
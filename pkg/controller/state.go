@@ -1,12 +1,18 @@
 package controller
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"sort"
+	"strings"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 
 	"github.com/argoproj/notifications-engine/pkg/services"
 	"github.com/argoproj/notifications-engine/pkg/subscriptions"
@@ -68,10 +74,183 @@ func (s NotificationsState) SetAlreadyNotified(isSelfConfig bool, apiNamespace,
 	return true
 }
 
+const (
+	// pendingStatePrefix marks the entries that record when the condition of a delayed notification was first met
+	pendingStatePrefix = "pending:"
+	// remindedStatePrefix marks the entries that record when the last reminder of a notification was sent
+	remindedStatePrefix = "reminded:"
+	// cooldownStatePrefix marks the entries that record when a notification was sent after its condition stopped being
+	// met, the notification is not sent again during the cooldown of the condition
+	cooldownStatePrefix = "cooldown:"
+)
+
+// delayedUntil returns the time the delayed notification is due, the time the condition was first met is recorded in
+// the state. It returns the zero time if the notification is not delayed
+func (s NotificationsState) delayedUntil(isSelfConfig bool, apiNamespace, trigger string, result triggers.ConditionResult, dest services.Destination, delay time.Duration) time.Time {
+	if delay <= 0 {
+		return time.Time{}
+	}
+	key := pendingStatePrefix + StateItemKey(isSelfConfig, apiNamespace, trigger, result, dest)
+	since, ok := s[key]
+	if !ok {
+		since = time.Now().Unix()
+		s[key] = since
+	}
+	return time.Unix(since, 0).Add(delay)
+}
+
+// expireOncePer removes the entry of the oncePer value of the notification if the notification was sent longer than the
+// ttl ago, so that it is sent again. It returns true if the entry was removed
+func (s NotificationsState) expireOncePer(isSelfConfig bool, apiNamespace, trigger string, result triggers.ConditionResult, dest services.Destination, ttl time.Duration) bool {
+	key := StateItemKey(isSelfConfig, apiNamespace, trigger, result, dest)
+	notified, ok := s[key]
+	if !ok || time.Since(time.Unix(notified, 0)) < ttl {
+		return false
+	}
+	delete(s, key)
+	return true
+}
+
+// resetOncePer removes the entries of every oncePer value of the notifications of the condition to the destination
+func (s NotificationsState) resetOncePer(isSelfConfig bool, apiNamespace, trigger string, result triggers.ConditionResult, dest services.Destination) {
+	key := StateItemKey(isSelfConfig, apiNamespace, trigger, triggers.ConditionResult{Key: result.Key}, dest)
+	for k := range s {
+		if strings.HasSuffix(k, ":"+key) {
+			delete(s, k)
+		}
+	}
+}
+
+// startCooldown records when the notification was sent before it is removed from the state because the condition is no
+// longer met
+func (s NotificationsState) startCooldown(isSelfConfig bool, apiNamespace, trigger string, result triggers.ConditionResult, dest services.Destination) {
+	key := StateItemKey(isSelfConfig, apiNamespace, trigger, result, dest)
+	if notified, ok := s[key]; ok && result.Cooldown > 0 {
+		s[cooldownStatePrefix+key] = notified
+	}
+}
+
+// cooldownUntil returns the time the cooldown of the notification ends, the zero time if the notification is not in
+// cooldown. The entries of cooldowns that ended are removed
+func (s NotificationsState) cooldownUntil(isSelfConfig bool, apiNamespace, trigger string, result triggers.ConditionResult, dest services.Destination) time.Time {
+	key := cooldownStatePrefix + StateItemKey(isSelfConfig, apiNamespace, trigger, result, dest)
+	notified, ok := s[key]
+	if !ok {
+		return time.Time{}
+	}
+	until := time.Unix(notified, 0).Add(time.Duration(result.Cooldown) * time.Second)
+	if !time.Now().Before(until) {
+		delete(s, key)
+		return time.Time{}
+	}
+	return until
+}
+
+// nextReminder returns the time the next reminder of the notification is due, the zero time if the condition does not
+// repeat its notification or the notification was not sent
+func (s NotificationsState) nextReminder(isSelfConfig bool, apiNamespace, trigger string, result triggers.ConditionResult, dest services.Destination) time.Time {
+	key := StateItemKey(isSelfConfig, apiNamespace, trigger, result, dest)
+	notified, ok := s[key]
+	if result.RepeatEvery <= 0 || !ok {
+		return time.Time{}
+	}
+	if reminded := s[remindedStatePrefix+key]; reminded > notified {
+		notified = reminded
+	}
+	return time.Unix(notified, 0).Add(time.Duration(result.RepeatEvery) * time.Second)
+}
+
+// setReminded records that a reminder of the notification was sent, the time of the first notification is kept
+func (s NotificationsState) setReminded(isSelfConfig bool, apiNamespace, trigger string, result triggers.ConditionResult, dest services.Destination) {
+	s[remindedStatePrefix+StateItemKey(isSelfConfig, apiNamespace, trigger, result, dest)] = time.Now().Unix()
+}
+
+// clearTracked removes the entries that track the delay and the reminders of the notifications of the condition to the
+// destination, regardless of the oncePer value of the entries
+func (s NotificationsState) clearTracked(isSelfConfig bool, apiNamespace, trigger string, result triggers.ConditionResult, dest services.Destination) {
+	key := StateItemKey(isSelfConfig, apiNamespace, trigger, triggers.ConditionResult{Key: result.Key}, dest)
+	for k := range s {
+		for _, prefix := range []string{pendingStatePrefix, remindedStatePrefix} {
+			if k == prefix+key || (strings.HasPrefix(k, prefix) && strings.HasSuffix(k, ":"+key)) {
+				delete(s, k)
+			}
+		}
+	}
+}
+
+// prune removes the entries that are not about the given state item keys, the oncePer prefix of the entries is ignored
+func (s NotificationsState) prune(keys map[string]bool) {
+	for key := range s {
+		if !isLiveKey(key, keys) {
+			delete(s, key)
+		}
+	}
+}
+
+// isLiveKey returns true if the entry is about one of the given state item keys, the oncePer prefix of the entry is
+// ignored
+func isLiveKey(key string, keys map[string]bool) bool {
+	if keys[key] {
+		return true
+	}
+	for k := range keys {
+		if strings.HasSuffix(key, ":"+k) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressedStatePrefix marks the gzip compressed, base64 encoded values of the notified annotation
+const compressedStatePrefix = "gz:"
+
+// compressState returns the compressed value of the notified annotation
+func compressState(val string) (string, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(val)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return compressedStatePrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func decompressState(val string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(val, compressedStatePrefix))
+	if err != nil {
+		return "", err
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(decompressed), nil
+}
+
+// FirstNotified returns the earliest time the condition was notified to one of the destinations, the zero time if it
+// was not notified
+func (s NotificationsState) FirstNotified(isSelfConfig bool, apiNamespace, trigger string, result triggers.ConditionResult, destinations []services.Destination) time.Time {
+	var first int64
+	for _, dest := range destinations {
+		if notified, ok := s[StateItemKey(isSelfConfig, apiNamespace, trigger, result, dest)]; ok && (first == 0 || notified < first) {
+			first = notified
+		}
+	}
+	if first == 0 {
+		return time.Time{}
+	}
+	return time.Unix(first, 0)
+}
+
 func (s NotificationsState) Persist(res metav1.Object) (map[string]string, error) {
 	s.truncate(notifiedHistoryMaxSize)
-
-	notifiedAnnotationKey := subscriptions.NotifiedAnnotationKey()
 	annotations := map[string]string{}
 
 	if res.GetAnnotations() != nil {
@@ -80,23 +259,38 @@ func (s NotificationsState) Persist(res metav1.Object) (map[string]string, error
 		}
 	}
 
+	if err := s.persistAnnotations(annotations); err != nil {
+		return nil, err
+	}
+	return annotations, nil
+}
+
+// persistAnnotations stores the state in the given annotations
+func (s NotificationsState) persistAnnotations(annotations map[string]string) error {
+	notifiedAnnotationKey := subscriptions.NotifiedAnnotationKey()
 	if len(s) == 0 {
 		delete(annotations, notifiedAnnotationKey)
-	} else {
-		stateJson, err := json.Marshal(s)
-		if err != nil {
-			return nil, err
-		}
-		annotations[notifiedAnnotationKey] = string(stateJson)
+		return nil
 	}
-
-	return annotations, nil
+	stateJson, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	annotations[notifiedAnnotationKey] = string(stateJson)
+	return nil
 }
 
 func NewState(val string) NotificationsState {
 	if val == "" {
 		return NotificationsState{}
 	}
+	if strings.HasPrefix(val, compressedStatePrefix) {
+		decompressed, err := decompressState(val)
+		if err != nil {
+			return NotificationsState{}
+		}
+		val = decompressed
+	}
 	res := NotificationsState{}
 	if err := json.Unmarshal([]byte(val), &res); err != nil {
 		return NotificationsState{}
@@ -111,3 +305,67 @@ func NewStateFromRes(res metav1.Object) NotificationsState {
 	}
 	return NotificationsState{}
 }
+
+// DeliveryRetry tracks the failed attempts of a delivery. Times are unix timestamps
+type DeliveryRetry struct {
+	Failures     int   `json:"failures"`
+	FirstFailure int64 `json:"firstFailure"`
+	NextAttempt  int64 `json:"nextAttempt"`
+	// Delivered holds the resolved recipients of the destination that were already notified
+	Delivered []string `json:"delivered,omitempty"`
+}
+
+// DeliveryRetries holds the failed deliveries by state item key
+type DeliveryRetries map[string]DeliveryRetry
+
+// Failed records the failure of the delivery and returns the recorded retry
+func (r DeliveryRetries) Failed(key string, backoff func(failures int) time.Duration) DeliveryRetry {
+	now := time.Now()
+	retry, ok := r[key]
+	if !ok {
+		retry.FirstFailure = now.Unix()
+	}
+	retry.Failures++
+	retry.NextAttempt = now.Add(jitter(backoff(retry.Failures))).Unix()
+	r[key] = retry
+	return retry
+}
+
+// jitter randomizes the delay by up to 20% so the retries of a notification storm are spread
+var jitter = func(d time.Duration) time.Duration {
+	return wait.Jitter(d, 0.2)
+}
+
+// prune removes the retries of the deliveries that are not about the given state item keys, e.g. of removed triggers
+// or unsubscribed destinations, since they are never attempted again
+func (r DeliveryRetries) prune(keys map[string]bool) {
+	for key := range r {
+		if !isLiveKey(key, keys) {
+			delete(r, key)
+		}
+	}
+}
+
+func (r DeliveryRetries) Persist(annotations map[string]string) error {
+	retriesAnnotationKey := subscriptions.RetriesAnnotationKey()
+	if len(r) == 0 {
+		delete(annotations, retriesAnnotationKey)
+		return nil
+	}
+	retriesJson, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	annotations[retriesAnnotationKey] = string(retriesJson)
+	return nil
+}
+
+func NewRetriesFromRes(res metav1.Object) DeliveryRetries {
+	retries := DeliveryRetries{}
+	if val := res.GetAnnotations()[subscriptions.RetriesAnnotationKey()]; val != "" {
+		if err := json.Unmarshal([]byte(val), &retries); err != nil {
+			return DeliveryRetries{}
+		}
+	}
+	return retries
+}
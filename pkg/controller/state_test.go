@@ -3,10 +3,12 @@ package controller
 import (
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/argoproj/notifications-engine/pkg/triggers"
 
 	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -22,6 +24,42 @@ func TestNotificationState_Truncate(t *testing.T) {
 	assert.Equal(t, NotificationsState{"2": 2, "3": 3, "4": 4}, state)
 }
 
+func TestNotificationState_Prune(t *testing.T) {
+	state := NotificationsState{
+		"app-synced:0:slack:my-channel":            1,
+		"rev-1:app-synced:0:slack:my-channel":      2,
+		"app-synced:0:slack:removed-channel":       3,
+		"removed-trigger:0:slack:my-channel":       4,
+		"rev-1:removed-trigger:0:slack:my-channel": 5,
+	}
+
+	state.prune(map[string]bool{"app-synced:0:slack:my-channel": true})
+
+	assert.Equal(t, NotificationsState{"app-synced:0:slack:my-channel": 1, "rev-1:app-synced:0:slack:my-channel": 2}, state)
+}
+
+func TestDeliveryRetries_Prune(t *testing.T) {
+	retries := DeliveryRetries{
+		"app-synced:0:slack:my-channel":       {Failures: 1},
+		"rev-1:app-synced:0:slack:my-channel": {Failures: 2},
+		"app-synced:0:slack:removed-channel":  {Failures: 3},
+		"removed-trigger:0:slack:my-channel":  {Failures: 4},
+	}
+
+	retries.prune(map[string]bool{"app-synced:0:slack:my-channel": true})
+
+	assert.Equal(t, DeliveryRetries{"app-synced:0:slack:my-channel": {Failures: 1}, "rev-1:app-synced:0:slack:my-channel": {Failures: 2}}, retries)
+}
+
+func TestNewState_Compressed(t *testing.T) {
+	val, err := compressState(`{"app-synced:0:slack:my-channel":1}`)
+	assert.NoError(t, err)
+	assert.Contains(t, val, compressedStatePrefix)
+
+	assert.Equal(t, NotificationsState{"app-synced:0:slack:my-channel": 1}, NewState(val))
+	assert.Equal(t, NotificationsState{}, NewState(compressedStatePrefix+"invalid"))
+}
+
 func TestSetAlreadyNotified(t *testing.T) {
 	dest := services.Destination{Service: "slack", Recipient: "my-channel"}
 
@@ -56,3 +94,34 @@ func TestSetAlreadyNotified_OncePerItem(t *testing.T) {
 	_, ok = state["abc:app-synced:0:slack:my-channel"]
 	assert.True(t, ok)
 }
+
+func TestDeliveryRetries_Failed(t *testing.T) {
+	origJitter := jitter
+	jitter = func(d time.Duration) time.Duration { return d }
+	defer func() {
+		jitter = origJitter
+	}()
+	backoff := func(failures int) time.Duration { return time.Duration(failures) * time.Minute }
+
+	retries := DeliveryRetries{}
+	retry := retries.Failed("app-synced:0:slack:my-channel", backoff)
+	assert.Equal(t, 1, retry.Failures)
+	assert.InDelta(t, time.Now().Add(time.Minute).Unix(), retry.NextAttempt, 1)
+
+	retry = retries.Failed("app-synced:0:slack:my-channel", backoff)
+	assert.Equal(t, 2, retry.Failures)
+	assert.InDelta(t, time.Now().Add(2*time.Minute).Unix(), retry.NextAttempt, 1)
+	assert.Equal(t, retry, retries["app-synced:0:slack:my-channel"])
+}
+
+func TestDeliveryRetries_Persist(t *testing.T) {
+	annotations := map[string]string{}
+	retries := DeliveryRetries{"app-synced:0:slack:my-channel": {Failures: 1, FirstFailure: 1, NextAttempt: 11}}
+
+	assert.NoError(t, retries.Persist(annotations))
+	assert.Equal(t, `{"app-synced:0:slack:my-channel":{"failures":1,"firstFailure":1,"nextAttempt":11}}`, annotations[subscriptions.RetriesAnnotationKey()])
+
+	assert.NoError(t, DeliveryRetries{}.Persist(annotations))
+	_, ok := annotations[subscriptions.RetriesAnnotationKey()]
+	assert.False(t, ok)
+}
@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+)
+
+// StateStore persists the notification state of resources, i.e. which notifications were already sent
+type StateStore interface {
+	// Load returns the notification state of the resource
+	Load(ctx context.Context, resource metav1.Object) (NotificationsState, error)
+	// Save persists the notification state of the resource, which is truncated to the configured number of entries. The
+	// given annotations are patched into the resource after the state is saved, stores keeping the state outside of the
+	// resource remove the state annotation from them
+	Save(ctx context.Context, resource metav1.Object, state NotificationsState, annotations map[string]string) error
+}
+
+// StateDeleter is implemented by the stores that keep the state outside of the cluster, the controller deletes the
+// state of the resources once they are deleted
+type StateDeleter interface {
+	// Delete removes the notification state of the resource
+	Delete(ctx context.Context, resource metav1.Object) error
+}
+
+// annotationStateStore keeps the state in the notified annotation of the resource
+type annotationStateStore struct{}
+
+// NewAnnotationStateStore returns the store keeping the state in the annotations of the resource, which is the default
+func NewAnnotationStateStore() StateStore {
+	return annotationStateStore{}
+}
+
+func (annotationStateStore) Load(_ context.Context, resource metav1.Object) (NotificationsState, error) {
+	return NewStateFromRes(resource), nil
+}
+
+func (annotationStateStore) Save(_ context.Context, _ metav1.Object, state NotificationsState, annotations map[string]string) error {
+	return state.persistAnnotations(annotations)
+}
+
+const (
+	configMapStateKey = "notified"
+	// stateStoreLabel is the label of the ConfigMaps of the state store, its value is the prefix of the store
+	stateStoreLabel = "notifications.argoproj.io/state-store"
+)
+
+// configMapStateStore keeps the state of every resource in a companion ConfigMap in the namespace of the resource
+type configMapStateStore struct {
+	client   kubernetes.Interface
+	informer cache.SharedIndexInformer
+	prefix   string
+}
+
+// NewConfigMapStateInformer returns the informer of the ConfigMaps of the state store with the given prefix in all
+// namespaces, which the ConfigMap state store reads the state from
+func NewConfigMapStateInformer(client kubernetes.Interface, prefix string, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return coreinformers.NewFilteredConfigMapInformer(client, metav1.NamespaceAll, resyncPeriod, cache.Indexers{}, func(options *metav1.ListOptions) {
+		options.LabelSelector = stateStoreLabel + "=" + prefix
+	})
+}
+
+// NewConfigMapStateStore returns the store keeping the state of every resource in a ConfigMap named using the given
+// prefix and the UID of the resource. The ConfigMap is owned by the resource, so it is deleted together with the
+// resource if the resource is cluster scoped or in the same namespace. The state is read from the informer, see
+// NewConfigMapStateInformer, which the caller runs, and from the API server until the informer has synced
+func NewConfigMapStateStore(client kubernetes.Interface, informer cache.SharedIndexInformer, prefix string) StateStore {
+	return &configMapStateStore{client: client, informer: informer, prefix: prefix}
+}
+
+func (s *configMapStateStore) name(resource metav1.Object) string {
+	return fmt.Sprintf("%s-%s", s.prefix, resource.GetUID())
+}
+
+// get returns the ConfigMap of the resource from the informer, or from the API server if the informer has not synced
+// yet or the cached ConfigMap is outdated
+func (s *configMapStateStore) get(ctx context.Context, resource metav1.Object, live bool) (*corev1.ConfigMap, error) {
+	if live || !s.informer.HasSynced() {
+		return s.client.CoreV1().ConfigMaps(resource.GetNamespace()).Get(ctx, s.name(resource), metav1.GetOptions{})
+	}
+	obj, exists, err := s.informer.GetIndexer().GetByKey(resource.GetNamespace() + "/" + s.name(resource))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, apierrors.NewNotFound(corev1.Resource("configmaps"), s.name(resource))
+	}
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %T in the state store informer", obj)
+	}
+	return cm.DeepCopy(), nil
+}
+
+func (s *configMapStateStore) Load(ctx context.Context, resource metav1.Object) (NotificationsState, error) {
+	cm, err := s.get(ctx, resource, false)
+	if apierrors.IsNotFound(err) {
+		// the state recorded in the annotations before the store was configured
+		return NewStateFromRes(resource), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewState(cm.Data[configMapStateKey]), nil
+}
+
+func (s *configMapStateStore) Save(ctx context.Context, resource metav1.Object, state NotificationsState, annotations map[string]string) error {
+	delete(annotations, subscriptions.NotifiedAnnotationKey())
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	configMaps := s.client.CoreV1().ConfigMaps(resource.GetNamespace())
+	// the first attempt uses the cached ConfigMap, the attempts after a conflict read the current ConfigMap
+	live := false
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		cm, err := s.get(ctx, resource, live)
+		live = true
+		if apierrors.IsNotFound(err) {
+			if len(state) == 0 {
+				return nil
+			}
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            s.name(resource),
+					Namespace:       resource.GetNamespace(),
+					Labels:          map[string]string{stateStoreLabel: s.prefix},
+					OwnerReferences: ownerReferences(resource),
+				},
+				Data: map[string]string{configMapStateKey: string(data)},
+			}
+			cm, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			return s.cache(cm, err)
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data[configMapStateKey] == string(data) && cm.Labels[stateStoreLabel] == s.prefix {
+			return nil
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		if cm.Labels == nil {
+			cm.Labels = map[string]string{}
+		}
+		cm.Data[configMapStateKey] = string(data)
+		cm.Labels[stateStoreLabel] = s.prefix
+		cm, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return s.cache(cm, err)
+	})
+}
+
+// cache stores the saved ConfigMap in the informer, so that the state is not read from an outdated ConfigMap when the
+// resource is processed again before the informer observed the change
+func (s *configMapStateStore) cache(cm *corev1.ConfigMap, err error) error {
+	if err != nil {
+		return err
+	}
+	if err := s.informer.GetStore().Update(cm); err != nil {
+		log.Warnf("Failed to store the state ConfigMap %s/%s in the informer: %v", cm.Namespace, cm.Name, err)
+	}
+	return nil
+}
+
+// ownerReferences returns the reference to the resource if its kind is known
+func ownerReferences(resource metav1.Object) []metav1.OwnerReference {
+	typed, ok := resource.(interface {
+		GroupVersionKind() schema.GroupVersionKind
+	})
+	if !ok || typed.GroupVersionKind().Kind == "" {
+		return nil
+	}
+	apiVersion, kind := typed.GroupVersionKind().ToAPIVersionAndKind()
+	return []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: resource.GetName(), UID: resource.GetUID()}}
+}
+
+// redisStateStore keeps the state of every resource in a Redis key named using the UID of the resource
+type redisStateStore struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+// RedisStateStoreOption configures the Redis state store
+type RedisStateStoreOption func(*redisStateStore)
+
+// WithStateTTL sets the expiration of the state of a resource that is not saved again within the TTL, which removes
+// the state of the resources deleted while the controller was not running. The TTL must be longer than the time
+// between two notifications of a resource, otherwise the notifications that were already sent are sent again
+func WithStateTTL(ttl time.Duration) RedisStateStoreOption {
+	return func(s *redisStateStore) {
+		s.ttl = ttl
+	}
+}
+
+// NewRedisStateStore returns the store keeping the state of every resource in the Redis key named using the given
+// prefix and the UID of the resource. The key is deleted once the controller observes the deletion of the resource
+func NewRedisStateStore(client redis.UniversalClient, prefix string, opts ...RedisStateStoreOption) StateStore {
+	store := &redisStateStore{client: client, prefix: prefix}
+	for i := range opts {
+		opts[i](store)
+	}
+	return store
+}
+
+func (s *redisStateStore) key(resource metav1.Object) string {
+	return fmt.Sprintf("%s:%s", s.prefix, resource.GetUID())
+}
+
+func (s *redisStateStore) Load(ctx context.Context, resource metav1.Object) (NotificationsState, error) {
+	val, err := s.client.Get(ctx, s.key(resource)).Result()
+	if err == redis.Nil {
+		// the state recorded in the annotations before the store was configured
+		return NewStateFromRes(resource), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewState(val), nil
+}
+
+func (s *redisStateStore) Save(ctx context.Context, resource metav1.Object, state NotificationsState, annotations map[string]string) error {
+	delete(annotations, subscriptions.NotifiedAnnotationKey())
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.key(resource), data, s.ttl).Err()
+}
+
+func (s *redisStateStore) Delete(ctx context.Context, resource metav1.Object) error {
+	return s.client.Del(ctx, s.key(resource)).Err()
+}
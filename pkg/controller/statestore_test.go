@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newConfigMapStateStore returns the ConfigMap state store reading from the synced informer of the client
+func newConfigMapStateStore(t *testing.T, client kubernetes.Interface) StateStore {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	informer := NewConfigMapStateInformer(client, "notifications-state", time.Minute)
+	go informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		t.Fatal("failed to sync the state informer")
+	}
+	return NewConfigMapStateStore(client, informer, "notifications-state")
+}
+
+func TestStateStores(t *testing.T) {
+	server := miniredis.RunT(t)
+	stores := map[string]StateStore{
+		"ConfigMap": newConfigMapStateStore(t, fake.NewSimpleClientset()),
+		"Redis":     NewRedisStateStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "notifications-state"),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			app := newResource("test", withAnnotations(map[string]string{notifiedAnnotationKey: `{"my-trigger::mock:recipient":1}`}))
+			app.SetUID(types.UID("2f1d0c5e"))
+
+			// the state recorded in the annotations is used until the state is saved in the store
+			state, err := store.Load(ctx, app)
+			assert.NoError(t, err)
+			assert.Equal(t, NotificationsState{"my-trigger::mock:recipient": 1}, state)
+
+			state["other-trigger::mock:recipient"] = 2
+			annotations := map[string]string{notifiedAnnotationKey: "{}", "foo": "bar"}
+			assert.NoError(t, store.Save(ctx, app, state, annotations))
+			assert.Equal(t, map[string]string{"foo": "bar"}, annotations)
+
+			app.SetAnnotations(annotations)
+			state, err = store.Load(ctx, app)
+			assert.NoError(t, err)
+			assert.Equal(t, NotificationsState{"my-trigger::mock:recipient": 1, "other-trigger::mock:recipient": 2}, state)
+		})
+	}
+}
+
+func TestConfigMapStateStore_OwnerReferences(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	app := newResource("test")
+	app.SetUID(types.UID("2f1d0c5e"))
+
+	assert.NoError(t, newConfigMapStateStore(t, client).Save(context.Background(), app, NotificationsState{"key": 1}, map[string]string{}))
+
+	cm, err := client.CoreV1().ConfigMaps(app.GetNamespace()).Get(context.Background(), "notifications-state-2f1d0c5e", metav1.GetOptions{})
+	if assert.NoError(t, err) && assert.Len(t, cm.OwnerReferences, 1) {
+		assert.Equal(t, app.GetName(), cm.OwnerReferences[0].Name)
+		assert.Equal(t, app.GetKind(), cm.OwnerReferences[0].Kind)
+	}
+}
+
+func TestConfigMapStateStore_RetriesConflicts(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	app := newResource("test")
+	app.SetUID(types.UID("2f1d0c5e"))
+	store := newConfigMapStateStore(t, client)
+	ctx := context.Background()
+	assert.NoError(t, store.Save(ctx, app, NotificationsState{"key": 1}, map[string]string{}))
+
+	conflicts := 0
+	client.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			return false, nil, nil
+		}
+		conflicts++
+		return true, nil, apierrors.NewConflict(corev1.Resource("configmaps"), "notifications-state-2f1d0c5e", errors.New("outdated"))
+	})
+	assert.NoError(t, store.Save(ctx, app, NotificationsState{"key": 2}, map[string]string{}))
+	assert.Equal(t, 1, conflicts)
+
+	state, err := store.Load(ctx, app)
+	assert.NoError(t, err)
+	assert.Equal(t, NotificationsState{"key": 2}, state)
+	cm, err := client.CoreV1().ConfigMaps(app.GetNamespace()).Get(ctx, "notifications-state-2f1d0c5e", metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "notifications-state", cm.Labels[stateStoreLabel])
+	}
+}
+
+func TestRedisStateStore_ExpiresAndDeletesState(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := NewRedisStateStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "notifications-state", WithStateTTL(time.Hour))
+	app := newResource("test")
+	app.SetUID(types.UID("2f1d0c5e"))
+	ctx := context.Background()
+
+	assert.NoError(t, store.Save(ctx, app, NotificationsState{"key": 1}, map[string]string{}))
+	assert.Equal(t, time.Hour, server.TTL("notifications-state:2f1d0c5e"))
+
+	assert.NoError(t, store.(StateDeleter).Delete(ctx, app))
+	assert.False(t, server.Exists("notifications-state:2f1d0c5e"))
+}
+
+func TestDeletesStateOfDeletedResource(t *testing.T) {
+	server := miniredis.RunT(t)
+	app := newResource("test")
+	app.SetUID(types.UID("2f1d0c5e"))
+	client := newFakeClient(app)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := NewRedisStateStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "notifications-state")
+	ctrl, _, err := newContextController(t, ctx, client, WithStateStore(store))
+	assert.NoError(t, err)
+	assert.NoError(t, store.Save(ctx, app, NotificationsState{"key": 1}, map[string]string{}))
+
+	ctrl.deleteState(cache.DeletedFinalStateUnknown{Key: "default/test", Obj: app})
+	assert.False(t, server.Exists("notifications-state:2f1d0c5e"))
+}
@@ -0,0 +1,154 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const defaultMaxLetters = 100
+
+// maxConfigMapDataSize keeps the ConfigMap below the size limit of objects, the oldest letters are removed beyond it
+var maxConfigMapDataSize = 900 * 1024
+
+// configMapStore stores every letter as a JSON encoded value of the ConfigMap data, keyed by the letter id
+type configMapStore struct {
+	client     kubernetes.Interface
+	namespace  string
+	name       string
+	maxLetters int
+	maxAge     time.Duration
+}
+
+// ConfigMapStoreOption configures the ConfigMap store
+type ConfigMapStoreOption func(*configMapStore)
+
+// WithMaxLetters sets the number of letters the store keeps, the oldest letters are removed when a letter is added
+// beyond it. The store keeps 100 letters if the number is not positive
+func WithMaxLetters(maxLetters int) ConfigMapStoreOption {
+	return func(s *configMapStore) {
+		if maxLetters > 0 {
+			s.maxLetters = maxLetters
+		}
+	}
+}
+
+// WithMaxAge sets the age after which the letters are removed when a letter is added, letters don't expire if the age
+// is not positive
+func WithMaxAge(maxAge time.Duration) ConfigMapStoreOption {
+	return func(s *configMapStore) {
+		s.maxAge = maxAge
+	}
+}
+
+// NewConfigMapStore returns the store keeping the letters in the given ConfigMap, the ConfigMap is created if it does
+// not exist. The store keeps the latest letters within the configured number and age, and the size limit of ConfigMaps
+func NewConfigMapStore(client kubernetes.Interface, namespace string, name string, opts ...ConfigMapStoreOption) Store {
+	store := &configMapStore{client: client, namespace: namespace, name: name, maxLetters: defaultMaxLetters}
+	for i := range opts {
+		opts[i](store)
+	}
+	return store
+}
+
+func (s *configMapStore) Add(letter Letter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(context.Background(), s.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = configMaps.Create(context.Background(), &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace},
+				Data:       map[string]string{letter.ID: string(data)},
+			}, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// created concurrently, retry the update
+				return apierrors.NewConflict(v1.Resource("configmaps"), s.name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[letter.ID] = string(data)
+		s.prune(cm.Data)
+		_, err = configMaps.Update(context.Background(), cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// prune removes the expired letters and the oldest letters beyond the number of letters and the size limit
+func (s *configMapStore) prune(data map[string]string) {
+	var letters []Letter
+	size := 0
+	for id, value := range data {
+		var letter Letter
+		if err := json.Unmarshal([]byte(value), &letter); err != nil {
+			// the letter can't be listed either, so it is removed
+			delete(data, id)
+			continue
+		}
+		if s.maxAge > 0 && time.Since(letter.FailedAt) > s.maxAge {
+			delete(data, id)
+			continue
+		}
+		letter.ID = id
+		letters = append(letters, letter)
+		size += len(id) + len(value)
+	}
+	sortLetters(letters)
+	for i := 0; i < len(letters)-1 && (len(letters)-i > s.maxLetters || size > maxConfigMapDataSize); i++ {
+		size -= len(letters[i].ID) + len(data[letters[i].ID])
+		delete(data, letters[i].ID)
+	}
+}
+
+func (s *configMapStore) List() ([]Letter, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(context.Background(), s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var letters []Letter
+	for id, data := range cm.Data {
+		var letter Letter
+		if err := json.Unmarshal([]byte(data), &letter); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal dead letter '%s': %v", id, err)
+		}
+		letter.ID = id
+		letters = append(letters, letter)
+	}
+	sortLetters(letters)
+	return letters, nil
+}
+
+func (s *configMapStore) Remove(id string) error {
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(context.Background(), s.name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if _, ok := cm.Data[id]; !ok {
+			return nil
+		}
+		delete(cm.Data, id)
+		_, err = configMaps.Update(context.Background(), cm, metav1.UpdateOptions{})
+		return err
+	})
+}
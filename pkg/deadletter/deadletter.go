@@ -0,0 +1,143 @@
+package deadletter
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/services"
+)
+
+// Letter holds a notification that could not be delivered
+type Letter struct {
+	ID                string                `json:"id"`
+	ResourceNamespace string                `json:"resourceNamespace,omitempty"`
+	ResourceName      string                `json:"resourceName"`
+	Trigger           string                `json:"trigger"`
+	Destination       services.Destination  `json:"destination"`
+	Notification      services.Notification `json:"notification"`
+	Reason            string                `json:"reason"`
+	Attempts          int                   `json:"attempts"`
+	FailedAt          time.Time             `json:"failedAt"`
+	// State holds the state of the notification services at the time of the failed delivery, e.g. the thread of the
+	// notifications, which the replay sends the notification with
+	State services.State `json:"state,omitempty"`
+}
+
+// NewLetter returns the letter recording the failed delivery of the notification about the given resource
+func NewLetter(namespace, name, trigger string, dest services.Destination, notification services.Notification, reason string, attempts int) Letter {
+	failedAt := time.Now().UTC()
+	hash := sha1.Sum([]byte(fmt.Sprintf("%s/%s:%s:%s:%d", namespace, name, trigger, dest, failedAt.UnixNano())))
+	return Letter{
+		ID:                fmt.Sprintf("%s-%x", failedAt.Format("20060102150405"), hash[:4]),
+		ResourceNamespace: namespace,
+		ResourceName:      name,
+		Trigger:           trigger,
+		Destination:       dest,
+		Notification:      notification,
+		Reason:            reason,
+		Attempts:          attempts,
+		FailedAt:          failedAt,
+	}
+}
+
+// Sink records the notifications that could not be delivered
+type Sink interface {
+	Add(letter Letter) error
+}
+
+// Store is the sink that allows listing and removing the recorded notifications
+type Store interface {
+	Sink
+	List() ([]Letter, error)
+	Remove(id string) error
+}
+
+// NewSink returns the sink configured by the given settings. The client is used to store the notifications in a ConfigMap
+func NewSink(cfg api.DeadLetterConfig, namespace string, client kubernetes.Interface, notificationServices map[string]services.NotificationService) (Sink, error) {
+	var sinks multiSink
+	if cfg.ConfigMap != "" {
+		if client == nil {
+			return nil, errors.New("kubernetes client is required to store dead letters in a ConfigMap")
+		}
+		sinks = append(sinks, NewConfigMapStore(client, namespace, cfg.ConfigMap,
+			WithMaxLetters(cfg.MaxLetters), WithMaxAge(time.Duration(cfg.MaxAge)*time.Second)))
+	}
+	if cfg.Service != "" {
+		service, ok := notificationServices[cfg.Service]
+		if !ok {
+			return nil, fmt.Errorf("dead-letter notification service '%s' is not supported", cfg.Service)
+		}
+		sinks = append(sinks, NewServiceSink(service, services.Destination{Service: cfg.Service, Recipient: cfg.Recipient}))
+	}
+	return sinks, nil
+}
+
+type multiSink []Sink
+
+func (s multiSink) Add(letter Letter) error {
+	var errs []error
+	for _, sink := range s {
+		if err := sink.Add(letter); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Replay sends the notifications with the given ids again using the recorded state of the notification services and
+// removes the delivered notifications from the store
+func Replay(ctx context.Context, store Store, notificationServices map[string]services.NotificationService, ids ...string) ([]Letter, error) {
+	letters, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	byID := map[string]Letter{}
+	for _, letter := range letters {
+		byID[letter.ID] = letter
+	}
+
+	var replayed []Letter
+	var errs []error
+	for _, id := range ids {
+		letter, ok := byID[id]
+		if !ok {
+			errs = append(errs, fmt.Errorf("dead letter '%s' not found", id))
+			continue
+		}
+		service, ok := notificationServices[letter.Destination.Service]
+		if !ok {
+			errs = append(errs, fmt.Errorf("notification service '%s' of dead letter '%s' is not supported", letter.Destination.Service, id))
+			continue
+		}
+		state := letter.State
+		if state == nil {
+			state = services.State{}
+		}
+		if err := services.NewContextService(service).SendWithContext(ctx, letter.Notification, letter.Destination, state); err != nil {
+			errs = append(errs, fmt.Errorf("failed to replay dead letter '%s': %w", id, err))
+			continue
+		}
+		if err := store.Remove(id); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		replayed = append(replayed, letter)
+	}
+	return replayed, errors.Join(errs...)
+}
+
+func sortLetters(letters []Letter) {
+	sort.Slice(letters, func(i, j int) bool {
+		if letters[i].FailedAt.Equal(letters[j].FailedAt) {
+			return letters[i].ID < letters[j].ID
+		}
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+}
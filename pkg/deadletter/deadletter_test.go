@@ -0,0 +1,146 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/services/mocks"
+)
+
+var dest = services.Destination{Service: "slack", Recipient: "my-channel"}
+
+func TestConfigMapStore(t *testing.T) {
+	store := NewConfigMapStore(fake.NewSimpleClientset(), "default", "dead-letters")
+
+	letters, err := store.List()
+	assert.NoError(t, err)
+	assert.Empty(t, letters)
+
+	first := NewLetter("default", "guestbook", "on-sync-failed", dest, services.Notification{Message: "hello"}, "timeout", 3)
+	second := NewLetter("default", "guestbook", "on-sync-succeeded", dest, services.Notification{Message: "world"}, "timeout", 3)
+	assert.NoError(t, store.Add(first))
+	assert.NoError(t, store.Add(second))
+
+	letters, err = store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []Letter{first, second}, letters)
+
+	assert.NoError(t, store.Remove(first.ID))
+	letters, err = store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []Letter{second}, letters)
+}
+
+func TestReplay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	service := mocks.NewMockNotificationService(ctrl)
+	store := NewConfigMapStore(fake.NewSimpleClientset(), "default", "dead-letters")
+
+	delivered := NewLetter("default", "guestbook", "on-sync-failed", dest, services.Notification{Message: "hello"}, "timeout", 3)
+	failed := NewLetter("default", "guestbook", "on-sync-failed", dest, services.Notification{Message: "world"}, "timeout", 3)
+	assert.NoError(t, store.Add(delivered))
+	assert.NoError(t, store.Add(failed))
+
+	service.EXPECT().Send(delivered.Notification, dest).Return(nil)
+	service.EXPECT().Send(failed.Notification, dest).Return(errors.New("timeout"))
+
+	replayed, err := Replay(context.Background(), store, map[string]services.NotificationService{"slack": service}, delivered.ID, failed.ID, "unknown")
+	assert.Equal(t, []Letter{delivered}, replayed)
+	assert.ErrorContains(t, err, "failed to replay dead letter '"+failed.ID+"': timeout")
+	assert.ErrorContains(t, err, "dead letter 'unknown' not found")
+
+	letters, err := store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []Letter{failed}, letters)
+}
+
+func TestNewSink(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	service := mocks.NewMockNotificationService(ctrl)
+	client := fake.NewSimpleClientset()
+
+	sink, err := NewSink(api.DeadLetterConfig{ConfigMap: "dead-letters", Service: "ops", Recipient: "alerts"}, "default", client,
+		map[string]services.NotificationService{"ops": service})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	letter := NewLetter("default", "guestbook", "on-sync-failed", dest, services.Notification{Message: "hello"}, "timeout", 3)
+	service.EXPECT().Send(services.Notification{
+		Message: "Notification about on-sync-failed of default/guestbook could not be delivered to {slack my-channel} after 3 attempts: timeout\n\nhello",
+	}, services.Destination{Service: "ops", Recipient: "alerts"}).Return(nil)
+	assert.NoError(t, sink.Add(letter))
+
+	letters, err := NewConfigMapStore(client, "default", "dead-letters").List()
+	assert.NoError(t, err)
+	assert.Equal(t, []Letter{letter}, letters)
+}
+
+// statefulService records the state it is sent with
+type statefulService struct {
+	state services.State
+}
+
+func (s *statefulService) Send(services.Notification, services.Destination) error {
+	return nil
+}
+
+func (s *statefulService) SendWithContext(_ context.Context, _ services.Notification, _ services.Destination, state services.State) error {
+	s.state = state
+	return nil
+}
+
+func TestReplay_State(t *testing.T) {
+	store := NewConfigMapStore(fake.NewSimpleClientset(), "default", "dead-letters")
+	letter := NewLetter("default", "guestbook", "on-sync-failed", dest, services.Notification{Message: "hello"}, "timeout", 3)
+	letter.State = services.State{"slackThreadTs": "1234"}
+	assert.NoError(t, store.Add(letter))
+
+	service := &statefulService{}
+	_, err := Replay(context.Background(), store, map[string]services.NotificationService{"slack": service}, letter.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, services.State{"slackThreadTs": "1234"}, service.state)
+}
+
+func TestConfigMapStore_Prune(t *testing.T) {
+	store := NewConfigMapStore(fake.NewSimpleClientset(), "default", "dead-letters", WithMaxLetters(2), WithMaxAge(time.Hour))
+
+	expired := NewLetter("default", "guestbook", "on-sync-failed", dest, services.Notification{Message: "expired"}, "timeout", 3)
+	expired.FailedAt = time.Now().Add(-2 * time.Hour).UTC()
+	assert.NoError(t, store.Add(expired))
+	var added []Letter
+	for i := 0; i < 3; i++ {
+		letter := NewLetter("default", "guestbook", "on-sync-failed", dest, services.Notification{Message: "hello"}, "timeout", 3)
+		letter.FailedAt = letter.FailedAt.Add(time.Duration(i) * time.Second)
+		assert.NoError(t, store.Add(letter))
+		added = append(added, letter)
+	}
+
+	letters, err := store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, added[1:], letters)
+
+	maxConfigMapDataSize = 1
+	defer func() {
+		maxConfigMapDataSize = 900 * 1024
+	}()
+	latest := NewLetter("default", "guestbook", "on-sync-failed", dest, services.Notification{Message: "latest"}, "timeout", 3)
+	latest.FailedAt = latest.FailedAt.Add(time.Minute)
+	assert.NoError(t, store.Add(latest))
+	letters, err = store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []Letter{latest}, letters)
+}
+
+func TestNewSink_UnknownService(t *testing.T) {
+	_, err := NewSink(api.DeadLetterConfig{Service: "ops"}, "default", nil, map[string]services.NotificationService{})
+	assert.EqualError(t, err, "dead-letter notification service 'ops' is not supported")
+}
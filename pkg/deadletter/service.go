@@ -0,0 +1,34 @@
+package deadletter
+
+import (
+	"fmt"
+
+	"github.com/argoproj/notifications-engine/pkg/services"
+)
+
+// serviceSink notifies a secondary notification service about the letters
+type serviceSink struct {
+	service services.NotificationService
+	dest    services.Destination
+}
+
+// NewServiceSink returns the sink that sends a plain message about every letter to the given destination
+func NewServiceSink(service services.NotificationService, dest services.Destination) Sink {
+	return &serviceSink{service: service, dest: dest}
+}
+
+func (s *serviceSink) Add(letter Letter) error {
+	message := fmt.Sprintf("Notification about %s of %s could not be delivered to %s after %d attempts: %s",
+		letter.Trigger, resourceRef(letter), letter.Destination, letter.Attempts, letter.Reason)
+	if preview := letter.Notification.Preview(); preview != "" {
+		message = fmt.Sprintf("%s\n\n%s", message, preview)
+	}
+	return s.service.Send(services.Notification{Message: message}, s.dest)
+}
+
+func resourceRef(letter Letter) string {
+	if letter.ResourceNamespace == "" {
+		return letter.ResourceName
+	}
+	return fmt.Sprintf("%s/%s", letter.ResourceNamespace, letter.ResourceName)
+}
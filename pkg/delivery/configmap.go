@@ -0,0 +1,218 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+)
+
+// queueLabel is the label of the ConfigMaps of a queue, its value is the name of the queue
+const queueLabel = "notifications.argoproj.io/delivery-queue"
+
+// maxConfigMapDataSize is the size of the data of a ConfigMap above which no tasks are added, which keeps the
+// ConfigMap below the 1MiB limit of Kubernetes objects
+var maxConfigMapDataSize = 900 * 1024
+
+// configMapQueue stores every task as a JSON encoded value of the data of one of the ConfigMaps of the queue, keyed by
+// the task id. The tasks are distributed across the ConfigMaps by the hash of their id
+type configMapQueue struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	shards    int
+
+	lock sync.Mutex
+	// store is the cache of the informer of the ConfigMaps once the queue is watched
+	store cache.Store
+}
+
+// ConfigMapQueueOption configures the ConfigMap queue
+type ConfigMapQueueOption func(q *configMapQueue)
+
+// WithShards distributes the tasks across the given number of ConfigMaps, named <name>-<shard>, which raises the
+// number of notifications that can be queued
+func WithShards(shards int) ConfigMapQueueOption {
+	return func(q *configMapQueue) {
+		q.shards = shards
+	}
+}
+
+// NewConfigMapQueue returns the queue keeping the tasks in the given ConfigMap, the ConfigMap is created if it does
+// not exist. The size of ConfigMaps is limited to 1MiB, tasks are rejected with ErrQueueFull once the ConfigMap is
+// full, use WithShards to distribute the tasks across several ConfigMaps
+func NewConfigMapQueue(client kubernetes.Interface, namespace string, name string, opts ...ConfigMapQueueOption) Queue {
+	q := &configMapQueue{client: client, namespace: namespace, name: name, shards: 1}
+	for i := range opts {
+		opts[i](q)
+	}
+	return q
+}
+
+// configMapNames returns the names of the ConfigMaps of the queue
+func (q *configMapQueue) configMapNames() []string {
+	if q.shards <= 1 {
+		return []string{q.name}
+	}
+	names := make([]string, q.shards)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-%d", q.name, i)
+	}
+	return names
+}
+
+// configMapName returns the name of the ConfigMap that stores the task with the given id
+func (q *configMapQueue) configMapName(id string) string {
+	names := q.configMapNames()
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(id))
+	return names[hash.Sum32()%uint32(len(names))]
+}
+
+func dataSize(data map[string]string) int {
+	size := 0
+	for k, v := range data {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+func (q *configMapQueue) Add(ctx context.Context, task Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	name := q.configMapName(task.ID)
+	configMaps := q.client.CoreV1().ConfigMaps(q.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = configMaps.Create(ctx, &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: q.namespace, Labels: map[string]string{queueLabel: q.name}},
+				Data:       map[string]string{task.ID: string(data)},
+			}, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// created concurrently, retry the update
+				return apierrors.NewConflict(v1.Resource("configmaps"), name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		if _, ok := cm.Data[task.ID]; !ok && dataSize(cm.Data)+len(task.ID)+len(data) > maxConfigMapDataSize {
+			return ErrQueueFull
+		}
+		if cm.Labels == nil {
+			cm.Labels = map[string]string{}
+		}
+		cm.Labels[queueLabel] = q.name
+		cm.Data[task.ID] = string(data)
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// getConfigMap returns the ConfigMap with the given name from the cache of the informer once the queue is watched, or
+// from the API server otherwise. Nil is returned if the ConfigMap does not exist
+func (q *configMapQueue) getConfigMap(ctx context.Context, name string) (*v1.ConfigMap, error) {
+	q.lock.Lock()
+	store := q.store
+	q.lock.Unlock()
+	if store != nil {
+		obj, exists, err := store.GetByKey(q.namespace + "/" + name)
+		if err != nil || !exists {
+			return nil, err
+		}
+		cm, ok := obj.(*v1.ConfigMap)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object type %T", obj)
+		}
+		return cm, nil
+	}
+	cm, err := q.client.CoreV1().ConfigMaps(q.namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	return cm, err
+}
+
+func (q *configMapQueue) Pending(ctx context.Context) ([]Task, error) {
+	var tasks []Task
+	for _, name := range q.configMapNames() {
+		cm, err := q.getConfigMap(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if cm == nil {
+			continue
+		}
+		for id, data := range cm.Data {
+			var task Task
+			if err := json.Unmarshal([]byte(data), &task); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal delivery task '%s': %v", id, err)
+			}
+			task.ID = id
+			tasks = append(tasks, task)
+		}
+	}
+	sortTasks(tasks)
+	return tasks, nil
+}
+
+func (q *configMapQueue) Done(ctx context.Context, id string) error {
+	name := q.configMapName(id)
+	configMaps := q.client.CoreV1().ConfigMaps(q.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := cm.Data[id]; !ok {
+			return nil
+		}
+		delete(cm.Data, id)
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// Watch starts the informer of the ConfigMaps of the queue, the pending tasks are read from the cache of the informer
+// once it synced
+func (q *configMapQueue) Watch(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	informer := coreinformers.NewFilteredConfigMapInformer(q.client, q.namespace, 0, cache.Indexers{}, func(options *metav1.ListOptions) {
+		options.LabelSelector = queueLabel + "=" + q.name
+	})
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { notify(changes) },
+		UpdateFunc: func(old, new interface{}) { notify(changes) },
+		DeleteFunc: func(obj interface{}) { notify(changes) },
+	})
+	go informer.Run(ctx.Done())
+	go func() {
+		if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			return
+		}
+		q.lock.Lock()
+		q.store = informer.GetStore()
+		q.lock.Unlock()
+		notify(changes)
+	}()
+	return changes
+}
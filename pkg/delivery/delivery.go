@@ -0,0 +1,95 @@
+package delivery
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/argoproj/notifications-engine/pkg/services"
+)
+
+// Task holds a notification waiting to be delivered. The task references the resource, which is read again when the
+// notification is delivered, so that the notification is rendered using the latest resource and notification state
+type Task struct {
+	ID string `json:"id"`
+	// APINamespace is the namespace of the configuration used to send the notification
+	APINamespace      string               `json:"apiNamespace,omitempty"`
+	ResourceNamespace string               `json:"resourceNamespace,omitempty"`
+	ResourceName      string               `json:"resourceName"`
+	Trigger           string               `json:"trigger"`
+	Templates         []string             `json:"templates"`
+	Severity          string               `json:"severity,omitempty"`
+	Destination       services.Destination `json:"destination"`
+	CreatedAt         time.Time            `json:"createdAt"`
+	// Failures is the number of failed delivery attempts
+	Failures     int       `json:"failures,omitempty"`
+	FirstFailure time.Time `json:"firstFailure,omitempty"`
+	// NextAttempt is the time before which the delivery is not attempted again
+	NextAttempt time.Time `json:"nextAttempt,omitempty"`
+	// Aggregate is the key of the batch of the aggregated notification, the notifications of a batch are delivered in
+	// a single message once the first notification of the batch is due
+	Aggregate string `json:"aggregate,omitempty"`
+}
+
+// NewTask returns the task delivering the notification about the given resource
+func NewTask(apiNamespace, trigger string, templates []string, severity string, dest services.Destination, namespace, name string) Task {
+	createdAt := time.Now().UTC()
+	hash := sha1.Sum([]byte(fmt.Sprintf("%s/%s:%s:%s:%d", namespace, name, trigger, dest, createdAt.UnixNano())))
+	return Task{
+		ID:                fmt.Sprintf("%s-%x", createdAt.Format("20060102150405"), hash[:4]),
+		APINamespace:      apiNamespace,
+		ResourceNamespace: namespace,
+		ResourceName:      name,
+		Trigger:           trigger,
+		Templates:         templates,
+		Severity:          severity,
+		Destination:       dest,
+		CreatedAt:         createdAt,
+	}
+}
+
+// Due returns true if the delivery can be attempted at the given time
+func (t Task) Due(now time.Time) bool {
+	return !t.NextAttempt.After(now)
+}
+
+// Queue stores the notifications waiting to be delivered, so that they are not lost if the controller restarts
+type Queue interface {
+	// Add stores the task or replaces the stored task with the same id
+	Add(ctx context.Context, task Task) error
+	// Pending returns the stored tasks in the order they were created
+	Pending(ctx context.Context) ([]Task, error)
+	// Done removes the task with the given id
+	Done(ctx context.Context, id string) error
+}
+
+// Watcher is implemented by the queues that notify about the changes of the stored tasks, so that the pending tasks
+// don't have to be polled
+type Watcher interface {
+	// Watch returns the channel that receives a value whenever the stored tasks might have changed, until the context
+	// is done
+	Watch(ctx context.Context) <-chan struct{}
+}
+
+// ErrQueueFull is returned if the task cannot be added because the queue reached its capacity
+var ErrQueueFull = errors.New("delivery queue is full")
+
+// notify sends a value to the channel of a watcher without blocking, a pending value already notifies the watcher
+func notify(changes chan struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
+
+func sortTasks(tasks []Task) {
+	sort.Slice(tasks, func(i, j int) bool {
+		if !tasks[i].CreatedAt.Equal(tasks[j].CreatedAt) {
+			return tasks[i].CreatedAt.Before(tasks[j].CreatedAt)
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+}
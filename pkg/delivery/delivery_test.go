@@ -0,0 +1,110 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/argoproj/notifications-engine/pkg/services"
+)
+
+var dest = services.Destination{Service: "slack", Recipient: "my-channel"}
+
+func TestQueues(t *testing.T) {
+	server := miniredis.RunT(t)
+	queues := map[string]Queue{
+		"Memory":    NewMemoryQueue(),
+		"ConfigMap": NewConfigMapQueue(fake.NewSimpleClientset(), "default", "notifications-queue"),
+		"Sharded":   NewConfigMapQueue(fake.NewSimpleClientset(), "default", "notifications-queue", WithShards(3)),
+		"Redis":     NewRedisQueue(redis.NewClient(&redis.Options{Addr: server.Addr()}), "notifications-queue"),
+	}
+	for name, queue := range queues {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			tasks, err := queue.Pending(ctx)
+			assert.NoError(t, err)
+			assert.Empty(t, tasks)
+
+			first := NewTask("argocd", "on-sync-failed", []string{"app-sync-failed"}, "", dest, "default", "guestbook")
+			second := NewTask("argocd", "on-sync-succeeded", []string{"app-sync-succeeded"}, "info", dest, "default", "guestbook")
+			assert.NoError(t, queue.Add(ctx, first))
+			assert.NoError(t, queue.Add(ctx, second))
+
+			tasks, err = queue.Pending(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, []Task{first, second}, tasks)
+
+			first.Failures = 1
+			assert.NoError(t, queue.Add(ctx, first))
+			assert.NoError(t, queue.Done(ctx, second.ID))
+			tasks, err = queue.Pending(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, []Task{first}, tasks)
+		})
+	}
+}
+
+func TestTask_Due(t *testing.T) {
+	now := time.Now()
+	task := NewTask("", "on-sync-failed", nil, "", dest, "default", "guestbook")
+	assert.True(t, task.Due(now))
+	task.NextAttempt = now.Add(time.Minute)
+	assert.False(t, task.Due(now))
+}
+
+func TestConfigMapQueue_Watch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := fake.NewSimpleClientset()
+	queue := NewConfigMapQueue(client, "default", "notifications-queue", WithShards(2))
+	changes := queue.(Watcher).Watch(ctx)
+
+	task := NewTask("argocd", "on-sync-failed", nil, "", dest, "default", "guestbook")
+	assert.NoError(t, queue.Add(ctx, task))
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the watcher was not notified")
+	}
+	assert.Eventually(t, func() bool {
+		cmQueue := queue.(*configMapQueue)
+		cmQueue.lock.Lock()
+		defer cmQueue.lock.Unlock()
+		return cmQueue.store != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		tasks, err := queue.Pending(ctx)
+		return err == nil && len(tasks) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the pending tasks are read from the cache of the informer
+	client.ClearActions()
+	_, err := queue.Pending(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, client.Actions())
+}
+
+func TestConfigMapQueue_Full(t *testing.T) {
+	defer func(size int) { maxConfigMapDataSize = size }(maxConfigMapDataSize)
+	maxConfigMapDataSize = 1024
+	ctx := context.Background()
+	queue := NewConfigMapQueue(fake.NewSimpleClientset(), "default", "notifications-queue")
+
+	first := NewTask("argocd", "on-sync-failed", nil, "", dest, "default", "guestbook")
+	assert.NoError(t, queue.Add(ctx, first))
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = queue.Add(ctx, NewTask("argocd", "on-sync-failed", nil, "", dest, "default", fmt.Sprintf("app-%d", i)))
+	}
+	assert.ErrorIs(t, err, ErrQueueFull)
+
+	// the tasks already stored can be updated
+	first.Failures = 1
+	assert.NoError(t, queue.Add(ctx, first))
+}
@@ -0,0 +1,68 @@
+package delivery
+
+import (
+	"context"
+	"sync"
+)
+
+type memoryQueue struct {
+	lock     sync.Mutex
+	tasks    map[string]Task
+	watchers []chan struct{}
+}
+
+// NewMemoryQueue returns the queue keeping the tasks in memory, the tasks are lost if the controller restarts
+func NewMemoryQueue() Queue {
+	return &memoryQueue{tasks: map[string]Task{}}
+}
+
+func (q *memoryQueue) Add(_ context.Context, task Task) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.tasks[task.ID] = task
+	q.notifyWatchers()
+	return nil
+}
+
+func (q *memoryQueue) Pending(_ context.Context) ([]Task, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	tasks := make([]Task, 0, len(q.tasks))
+	for _, task := range q.tasks {
+		tasks = append(tasks, task)
+	}
+	sortTasks(tasks)
+	return tasks, nil
+}
+
+func (q *memoryQueue) Done(_ context.Context, id string) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	delete(q.tasks, id)
+	return nil
+}
+
+func (q *memoryQueue) Watch(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	q.lock.Lock()
+	q.watchers = append(q.watchers, changes)
+	q.lock.Unlock()
+	go func() {
+		<-ctx.Done()
+		q.lock.Lock()
+		defer q.lock.Unlock()
+		for i := range q.watchers {
+			if q.watchers[i] == changes {
+				q.watchers = append(q.watchers[:i], q.watchers[i+1:]...)
+				break
+			}
+		}
+	}()
+	return changes
+}
+
+func (q *memoryQueue) notifyWatchers() {
+	for _, changes := range q.watchers {
+		notify(changes)
+	}
+}
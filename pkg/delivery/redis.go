@@ -0,0 +1,50 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisQueue stores the tasks as JSON encoded fields of a Redis hash, keyed by the task id
+type redisQueue struct {
+	client redis.UniversalClient
+	key    string
+}
+
+// NewRedisQueue returns the queue keeping the tasks in the Redis hash with the given key
+func NewRedisQueue(client redis.UniversalClient, key string) Queue {
+	return &redisQueue{client: client, key: key}
+}
+
+func (q *redisQueue) Add(ctx context.Context, task Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	return q.client.HSet(ctx, q.key, task.ID, data).Err()
+}
+
+func (q *redisQueue) Pending(ctx context.Context) ([]Task, error) {
+	values, err := q.client.HGetAll(ctx, q.key).Result()
+	if err != nil {
+		return nil, err
+	}
+	var tasks []Task
+	for id, data := range values {
+		var task Task
+		if err := json.Unmarshal([]byte(data), &task); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal delivery task '%s': %v", id, err)
+		}
+		task.ID = id
+		tasks = append(tasks, task)
+	}
+	sortTasks(tasks)
+	return tasks, nil
+}
+
+func (q *redisQueue) Done(ctx context.Context, id string) error {
+	return q.client.HDel(ctx, q.key, id).Err()
+}
@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds the Prometheus metrics of notification deliveries and trigger evaluations. Metrics implements
+// prometheus.Collector so it can be registered into any registry
+type Metrics struct {
+	deliveriesCounter               *prometheus.CounterVec
+	triggerEvaluationsCounter       *prometheus.CounterVec
+	triggerEvaluationErrorsCounter  *prometheus.CounterVec
+	sendDuration                    *prometheus.HistogramVec
+	queueDepth                      prometheus.Gauge
+	circuitBreakerRejectionsCounter *prometheus.CounterVec
+	duplicatesCounter               *prometheus.CounterVec
+	dryRunsCounter                  *prometheus.CounterVec
+}
+
+// New returns the metrics with names starting with the given prefix
+func New(prefix string) *Metrics {
+	return &Metrics{
+		deliveriesCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: fmt.Sprintf("%s_notifications_deliveries_total", prefix),
+				Help: "Number of delivered notifications.",
+			},
+			[]string{"trigger", "service", "succeeded"},
+		),
+		triggerEvaluationsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: fmt.Sprintf("%s_notifications_trigger_eval_total", prefix),
+				Help: "Number of trigger evaluations.",
+			},
+			[]string{"name", "triggered"},
+		),
+		triggerEvaluationErrorsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: fmt.Sprintf("%s_notifications_trigger_eval_errors_total", prefix),
+				Help: "Number of trigger evaluations that failed.",
+			},
+			[]string{"name"},
+		),
+		sendDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    fmt.Sprintf("%s_notifications_send_duration_seconds", prefix),
+				Help:    "Duration of sending notifications.",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"service", "succeeded"},
+		),
+		queueDepth: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: fmt.Sprintf("%s_notifications_queue_depth", prefix),
+				Help: "Number of resources waiting to be processed.",
+			},
+		),
+		circuitBreakerRejectionsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: fmt.Sprintf("%s_notifications_circuit_breaker_rejections_total", prefix),
+				Help: "Number of notifications not sent because the circuit breaker of the service is open.",
+			},
+			[]string{"service"},
+		),
+		duplicatesCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: fmt.Sprintf("%s_notifications_duplicates_total", prefix),
+				Help: "Number of notifications suppressed because an identical notification was sent recently.",
+			},
+			[]string{"trigger", "service"},
+		),
+		dryRunsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: fmt.Sprintf("%s_notifications_dry_runs_total", prefix),
+				Help: "Number of notifications rendered but not sent because of the dry-run mode.",
+			},
+			[]string{"trigger", "service"},
+		),
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.deliveriesCounter,
+		m.triggerEvaluationsCounter,
+		m.triggerEvaluationErrorsCounter,
+		m.sendDuration,
+		m.queueDepth,
+		m.circuitBreakerRejectionsCounter,
+		m.duplicatesCounter,
+		m.dryRunsCounter,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+func (m *Metrics) IncDeliveriesCounter(trigger string, service string, succeeded bool) {
+	m.deliveriesCounter.WithLabelValues(trigger, service, strconv.FormatBool(succeeded)).Inc()
+}
+
+func (m *Metrics) IncTriggerEvaluationsCounter(name string, triggered bool) {
+	m.triggerEvaluationsCounter.WithLabelValues(name, strconv.FormatBool(triggered)).Inc()
+}
+
+func (m *Metrics) IncTriggerEvaluationErrorsCounter(name string) {
+	m.triggerEvaluationErrorsCounter.WithLabelValues(name).Inc()
+}
+
+func (m *Metrics) ObserveSendDuration(service string, succeeded bool, duration time.Duration) {
+	m.sendDuration.WithLabelValues(service, strconv.FormatBool(succeeded)).Observe(duration.Seconds())
+}
+
+func (m *Metrics) SetQueueDepth(depth int) {
+	m.queueDepth.Set(float64(depth))
+}
+
+func (m *Metrics) IncCircuitBreakerRejectionsCounter(service string) {
+	m.circuitBreakerRejectionsCounter.WithLabelValues(service).Inc()
+}
+
+func (m *Metrics) IncDuplicatesCounter(trigger string, service string) {
+	m.duplicatesCounter.WithLabelValues(trigger, service).Inc()
+}
+
+func (m *Metrics) IncDryRunsCounter(trigger string, service string) {
+	m.dryRunsCounter.WithLabelValues(trigger, service).Inc()
+}
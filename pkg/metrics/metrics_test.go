@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_Register(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := New("argocd")
+	assert.NoError(t, registry.Register(m))
+
+	m.IncDeliveriesCounter("on-sync-failed", "slack", true)
+	m.IncTriggerEvaluationsCounter("on-sync-failed", false)
+	m.IncTriggerEvaluationErrorsCounter("on-sync-failed")
+	m.ObserveSendDuration("slack", true, time.Second)
+	m.SetQueueDepth(3)
+	m.IncCircuitBreakerRejectionsCounter("slack")
+	m.IncDuplicatesCounter("on-sync-failed", "slack")
+	m.IncDryRunsCounter("on-sync-failed", "slack")
+
+	count, err := testutil.GatherAndCount(registry)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, count)
+
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP argocd_notifications_deliveries_total Number of delivered notifications.
+# TYPE argocd_notifications_deliveries_total counter
+argocd_notifications_deliveries_total{service="slack",succeeded="true",trigger="on-sync-failed"} 1
+# HELP argocd_notifications_queue_depth Number of resources waiting to be processed.
+# TYPE argocd_notifications_queue_depth gauge
+argocd_notifications_queue_depth 3
+`), "argocd_notifications_deliveries_total", "argocd_notifications_queue_depth"))
+}
@@ -1,10 +1,11 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/argoproj/notifications-engine/pkg/api (interfaces: API)
+// Source: github.com/argoproj/notifications-engine/pkg/api (interfaces: API,ContextAPI)
 
 // Package mocks is a generated GoMock package.
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 
 	api "github.com/argoproj/notifications-engine/pkg/api"
@@ -104,3 +105,153 @@ func (mr *MockAPIMockRecorder) Send(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockAPI)(nil).Send), arg0, arg1, arg2)
 }
+
+// MockContextAPI is a mock of ContextAPI interface.
+type MockContextAPI struct {
+	ctrl     *gomock.Controller
+	recorder *MockContextAPIMockRecorder
+}
+
+// MockContextAPIMockRecorder is the mock recorder for MockContextAPI.
+type MockContextAPIMockRecorder struct {
+	mock *MockContextAPI
+}
+
+// NewMockContextAPI creates a new mock instance.
+func NewMockContextAPI(ctrl *gomock.Controller) *MockContextAPI {
+	mock := &MockContextAPI{ctrl: ctrl}
+	mock.recorder = &MockContextAPIMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockContextAPI) EXPECT() *MockContextAPIMockRecorder {
+	return m.recorder
+}
+
+// AddNotificationService mocks base method.
+func (m *MockContextAPI) AddNotificationService(arg0 string, arg1 services.NotificationService) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "AddNotificationService", arg0, arg1)
+}
+
+// AddNotificationService indicates an expected call of AddNotificationService.
+func (mr *MockContextAPIMockRecorder) AddNotificationService(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddNotificationService", reflect.TypeOf((*MockContextAPI)(nil).AddNotificationService), arg0, arg1)
+}
+
+// GetConfig mocks base method.
+func (m *MockContextAPI) GetConfig() api.Config {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetConfig")
+	ret0, _ := ret[0].(api.Config)
+	return ret0
+}
+
+// GetConfig indicates an expected call of GetConfig.
+func (mr *MockContextAPIMockRecorder) GetConfig() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetConfig", reflect.TypeOf((*MockContextAPI)(nil).GetConfig))
+}
+
+// GetNotificationServices mocks base method.
+func (m *MockContextAPI) GetNotificationServices() map[string]services.NotificationService {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNotificationServices")
+	ret0, _ := ret[0].(map[string]services.NotificationService)
+	return ret0
+}
+
+// GetNotificationServices indicates an expected call of GetNotificationServices.
+func (mr *MockContextAPIMockRecorder) GetNotificationServices() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNotificationServices", reflect.TypeOf((*MockContextAPI)(nil).GetNotificationServices))
+}
+
+// MatchesSubscription mocks base method.
+func (m *MockContextAPI) MatchesSubscription(arg0 map[string]interface{}, arg1 services.Destination) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MatchesSubscription", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MatchesSubscription indicates an expected call of MatchesSubscription.
+func (mr *MockContextAPIMockRecorder) MatchesSubscription(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MatchesSubscription", reflect.TypeOf((*MockContextAPI)(nil).MatchesSubscription), arg0, arg1)
+}
+
+// RunTrigger mocks base method.
+func (m *MockContextAPI) RunTrigger(arg0 string, arg1 map[string]interface{}) ([]triggers.ConditionResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RunTrigger", arg0, arg1)
+	ret0, _ := ret[0].([]triggers.ConditionResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RunTrigger indicates an expected call of RunTrigger.
+func (mr *MockContextAPIMockRecorder) RunTrigger(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunTrigger", reflect.TypeOf((*MockContextAPI)(nil).RunTrigger), arg0, arg1)
+}
+
+// RunTriggerWithContext mocks base method.
+func (m *MockContextAPI) RunTriggerWithContext(arg0 context.Context, arg1 string, arg2 map[string]interface{}) ([]triggers.ConditionResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RunTriggerWithContext", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]triggers.ConditionResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RunTriggerWithContext indicates an expected call of RunTriggerWithContext.
+func (mr *MockContextAPIMockRecorder) RunTriggerWithContext(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunTriggerWithContext", reflect.TypeOf((*MockContextAPI)(nil).RunTriggerWithContext), arg0, arg1, arg2)
+}
+
+// Send mocks base method.
+func (m *MockContextAPI) Send(arg0 map[string]interface{}, arg1 []string, arg2 services.Destination) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Send", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Send indicates an expected call of Send.
+func (mr *MockContextAPIMockRecorder) Send(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockContextAPI)(nil).Send), arg0, arg1, arg2)
+}
+
+// SendAggregated mocks base method.
+func (m *MockContextAPI) SendAggregated(arg0 context.Context, arg1 []api.AggregatedEvent, arg2 []string, arg3 services.Destination) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendAggregated", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendAggregated indicates an expected call of SendAggregated.
+func (mr *MockContextAPIMockRecorder) SendAggregated(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendAggregated", reflect.TypeOf((*MockContextAPI)(nil).SendAggregated), arg0, arg1, arg2, arg3)
+}
+
+// SendWithContext mocks base method.
+func (m *MockContextAPI) SendWithContext(arg0 context.Context, arg1 map[string]interface{}, arg2 []string, arg3 services.Destination) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendWithContext", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendWithContext indicates an expected call of SendWithContext.
+func (mr *MockContextAPIMockRecorder) SendWithContext(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendWithContext", reflect.TypeOf((*MockContextAPI)(nil).SendWithContext), arg0, arg1, arg2, arg3)
+}
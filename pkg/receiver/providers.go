@@ -0,0 +1,190 @@
+package receiver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxRequestAge is the maximum age of signed requests, older requests are rejected to prevent replays
+	maxRequestAge = 5 * time.Minute
+
+	// GenericSignatureHeader is the header of the signature of generic callbacks
+	GenericSignatureHeader = "X-Notifications-Signature"
+	// GenericTimestampHeader is the header of the unix timestamp of generic callbacks, the timestamp is signed
+	GenericTimestampHeader = "X-Notifications-Timestamp"
+)
+
+// errEmptySecret is returned by the constructors of the providers if the secret that signs the callbacks is empty
+var errEmptySecret = errors.New("the secret of the callbacks must not be empty")
+
+func sign(secret string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func signatureMatches(expected string, signature string) bool {
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// isRecent returns true if the unix timestamp of the request is within the maximum age of the requests
+func isRecent(timestamp string) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	return err == nil && time.Since(time.Unix(seconds, 0)).Abs() <= maxRequestAge
+}
+
+type slackProvider struct {
+	signingSecret string
+}
+
+// NewSlackProvider returns the provider of Slack interactivity requests signed with the signing secret of the Slack
+// app. The action_id of buttons is the action and their value is the reference of the notifications, other actions
+// are ignored
+func NewSlackProvider(signingSecret string) (Provider, error) {
+	if signingSecret == "" {
+		return nil, errEmptySecret
+	}
+	return &slackProvider{signingSecret: signingSecret}, nil
+}
+
+func (p *slackProvider) Parse(r *http.Request, body []byte) ([]Callback, error) {
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	if !isRecent(timestamp) {
+		return nil, ErrInvalidSignature
+	}
+	expected := "v0=" + sign(p.signingSecret, []byte("v0:"+timestamp+":"+string(body)))
+	if !signatureMatches(expected, r.Header.Get("X-Slack-Signature")) {
+		return nil, ErrInvalidSignature
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	var payload struct {
+		Actions []struct {
+			ActionID string `json:"action_id"`
+			Value    string `json:"value"`
+		} `json:"actions"`
+	}
+	if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %v", err)
+	}
+	var callbacks []Callback
+	for _, action := range payload.Actions {
+		if action.ActionID != string(ActionAcknowledge) && action.ActionID != string(ActionResolve) {
+			continue
+		}
+		callback, err := parseReference(action.Value, Action(action.ActionID))
+		if err != nil {
+			return nil, err
+		}
+		callbacks = append(callbacks, callback)
+	}
+	return callbacks, nil
+}
+
+type pagerDutyProvider struct {
+	secret string
+}
+
+// NewPagerDutyProvider returns the provider of PagerDuty V3 webhooks signed with the secret of the webhook
+// subscription. Acknowledged and resolved incidents whose incident key is the reference of the notifications, i.e.
+// the dedup key of the event, acknowledge and resolve the notifications, other events are ignored
+func NewPagerDutyProvider(secret string) (Provider, error) {
+	if secret == "" {
+		return nil, errEmptySecret
+	}
+	return &pagerDutyProvider{secret: secret}, nil
+}
+
+func (p *pagerDutyProvider) Parse(r *http.Request, body []byte) ([]Callback, error) {
+	expected := "v1=" + sign(p.secret, body)
+	valid := false
+	// the header lists a signature per secret while the secret of the subscription is rotated
+	for _, signature := range strings.Split(r.Header.Get("X-PagerDuty-Signature"), ",") {
+		if signatureMatches(expected, strings.TrimSpace(signature)) {
+			valid = true
+		}
+	}
+	if !valid {
+		return nil, ErrInvalidSignature
+	}
+
+	var payload struct {
+		Event struct {
+			EventType string `json:"event_type"`
+			Data      struct {
+				IncidentKey string `json:"incident_key"`
+			} `json:"data"`
+		} `json:"event"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %v", err)
+	}
+	var action Action
+	switch payload.Event.EventType {
+	case "incident.acknowledged":
+		action = ActionAcknowledge
+	case "incident.resolved":
+		action = ActionResolve
+	default:
+		return nil, nil
+	}
+	callback, err := parseReference(payload.Event.Data.IncidentKey, action)
+	if err != nil {
+		// the incidents that were not created by notifications are not an error of the webhook
+		log.Debugf("Ignoring PagerDuty event %s: %v", payload.Event.EventType, err)
+		return nil, nil
+	}
+	return []Callback{callback}, nil
+}
+
+type genericProvider struct {
+	secret string
+}
+
+// NewGenericProvider returns the provider of callbacks with a JSON body holding the reference and the action, e.g.
+// {"reference": "default/guestbook/on-sync-failed", "action": "acknowledge"}. The GenericTimestampHeader holds the
+// unix timestamp of the request and the GenericSignatureHeader holds the hex encoded HMAC-SHA256 of the timestamp and
+// the body joined by a dot using the secret, prefixed with "sha256=". Requests older than 5 minutes are rejected
+func NewGenericProvider(secret string) (Provider, error) {
+	if secret == "" {
+		return nil, errEmptySecret
+	}
+	return &genericProvider{secret: secret}, nil
+}
+
+func (p *genericProvider) Parse(r *http.Request, body []byte) ([]Callback, error) {
+	timestamp := r.Header.Get(GenericTimestampHeader)
+	if !isRecent(timestamp) {
+		return nil, ErrInvalidSignature
+	}
+	if !signatureMatches("sha256="+sign(p.secret, []byte(timestamp+"."+string(body))), r.Header.Get(GenericSignatureHeader)) {
+		return nil, ErrInvalidSignature
+	}
+	var payload struct {
+		Reference string `json:"reference"`
+		Action    Action `json:"action"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %v", err)
+	}
+	callback, err := parseReference(payload.Reference, payload.Action)
+	if err != nil {
+		return nil, err
+	}
+	return []Callback{callback}, nil
+}
@@ -0,0 +1,129 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+)
+
+// maxBodySize is the maximum size of the body of the callbacks
+const maxBodySize = 1 << 20
+
+// Action is the change of the notification state requested by a callback
+type Action string
+
+const (
+	// ActionAcknowledge stops the escalation of the notifications of the trigger
+	ActionAcknowledge Action = "acknowledge"
+	// ActionResolve stops the escalation and any further notification of the trigger while its condition is met
+	ActionResolve Action = "resolve"
+)
+
+// ErrInvalidSignature is returned by providers if the signature of the callback does not match
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Callback is the request of a provider to update the notification state of the trigger about the resource
+type Callback struct {
+	Namespace string
+	Name      string
+	Trigger   string
+	Action    Action
+}
+
+// Provider verifies the signature of the callback requests of a provider and parses the callbacks they hold
+type Provider interface {
+	Parse(r *http.Request, body []byte) ([]Callback, error)
+}
+
+// Reference returns the reference of the notifications of the trigger about the resource. Templates embed the
+// reference in the notification, e.g. as the value of a Slack button or the dedup key of a PagerDuty event, so that
+// the callbacks of the provider identify the resource and the trigger
+func Reference(namespace string, name string, trigger string) string {
+	return fmt.Sprintf("%s/%s/%s", namespace, name, trigger)
+}
+
+// parseReference returns the callback of the action on the notifications identified by the reference
+func parseReference(reference string, action Action) (Callback, error) {
+	parts := strings.Split(reference, "/")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return Callback{}, fmt.Errorf("invalid reference '%s', expected namespace/name/trigger", reference)
+	}
+	switch action {
+	case ActionAcknowledge, ActionResolve:
+	default:
+		return Callback{}, fmt.Errorf("unsupported action '%s'", action)
+	}
+	return Callback{Namespace: parts[0], Name: parts[1], Trigger: parts[2], Action: action}, nil
+}
+
+type handler struct {
+	client   dynamic.NamespaceableResourceInterface
+	provider Provider
+}
+
+// NewHandler returns the handler of the callbacks of the provider, which records the acknowledgements and resolutions
+// in the annotations of the resources of the client. The controller processes the updated resources and stops the
+// escalation of acknowledged notifications and the notifications of resolved triggers
+func NewHandler(client dynamic.NamespaceableResourceInterface, provider Provider) http.Handler {
+	return &handler{client: client, provider: provider}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	callbacks, err := h.provider.Parse(r, body)
+	if errors.Is(err, ErrInvalidSignature) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, callback := range callbacks {
+		if err := h.apply(r.Context(), callback); err != nil {
+			log.Errorf("Failed to %s notifications of trigger %s about %s/%s: %v", callback.Action, callback.Trigger, callback.Namespace, callback.Name, err)
+			http.Error(w, "failed to update the notification state", http.StatusInternalServerError)
+			return
+		}
+		log.Infof("Recorded %s of the notifications of trigger %s about %s/%s", callback.Action, callback.Trigger, callback.Namespace, callback.Name)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// apply records the action of the callback in the annotations of the resource
+func (h *handler) apply(ctx context.Context, callback Callback) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, err := h.client.Namespace(callback.Namespace).Get(ctx, callback.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		annotations := subscriptions.NewAnnotations(obj.GetAnnotations())
+		if annotations.Acknowledged(callback.Trigger) && (callback.Action != ActionResolve || annotations.Resolved(callback.Trigger)) {
+			return nil
+		}
+		annotations.Acknowledge(callback.Trigger)
+		if callback.Action == ActionResolve {
+			annotations.Resolve(callback.Trigger)
+		}
+		obj.SetAnnotations(annotations)
+		_, err = h.client.Namespace(callback.Namespace).Update(ctx, obj, metav1.UpdateOptions{})
+		return err
+	})
+}
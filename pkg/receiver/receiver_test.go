@@ -0,0 +1,152 @@
+package receiver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/argoproj/notifications-engine/pkg/subscriptions"
+)
+
+var testGVR = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
+
+func newTestClient() dynamic.NamespaceableResourceInterface {
+	app := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Application",
+		"metadata":   map[string]interface{}{"name": "guestbook", "namespace": "default"},
+	}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		testGVR: "List",
+	}, app)
+	return client.Resource(testGVR)
+}
+
+func getAnnotations(t *testing.T, client dynamic.NamespaceableResourceInterface) subscriptions.Annotations {
+	obj, err := client.Namespace("default").Get(context.Background(), "guestbook", metav1.GetOptions{})
+	require.NoError(t, err)
+	return subscriptions.NewAnnotations(obj.GetAnnotations())
+}
+
+func TestHandler_Generic(t *testing.T) {
+	client := newTestClient()
+	provider, err := NewGenericProvider("my-secret")
+	require.NoError(t, err)
+	handler := NewHandler(client, provider)
+
+	send := func(body string, secret string, timestamp time.Time) int {
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, "/generic", strings.NewReader(body))
+		req.Header.Set(GenericTimestampHeader, ts)
+		req.Header.Set(GenericSignatureHeader, "sha256="+sign(secret, []byte(ts+"."+body)))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	body := `{"reference": "default/guestbook/on-sync-failed", "action": "resolve"}`
+	assert.Equal(t, http.StatusUnauthorized, send(body, "my-secret", time.Now().Add(-time.Hour)))
+	assert.False(t, getAnnotations(t, client).Acknowledged("on-sync-failed"))
+	assert.Equal(t, http.StatusUnauthorized, send(body, "other-secret", time.Now()))
+
+	assert.Equal(t, http.StatusOK, send(body, "my-secret", time.Now()))
+	annotations := getAnnotations(t, client)
+	assert.True(t, annotations.Acknowledged("on-sync-failed"))
+	assert.True(t, annotations.Resolved("on-sync-failed"))
+
+	// the signature of the body alone does not sign the timestamp
+	req := httptest.NewRequest(http.MethodPost, "/generic", strings.NewReader(body))
+	req.Header.Set(GenericTimestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set(GenericSignatureHeader, "sha256="+sign("my-secret", []byte(body)))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	assert.Equal(t, http.StatusBadRequest, send(`{"reference": "guestbook", "action": "resolve"}`, "my-secret", time.Now()))
+}
+
+func TestProviders_EmptySecret(t *testing.T) {
+	_, err := NewGenericProvider("")
+	assert.Error(t, err)
+	_, err = NewSlackProvider("")
+	assert.Error(t, err)
+	_, err = NewPagerDutyProvider("")
+	assert.Error(t, err)
+}
+
+func TestHandler_Slack(t *testing.T) {
+	client := newTestClient()
+	provider, err := NewSlackProvider("signing-secret")
+	require.NoError(t, err)
+	handler := NewHandler(client, provider)
+
+	newRequest := func(timestamp time.Time) *http.Request {
+		body := url.Values{"payload": []string{`{"type": "block_actions", "actions": [
+			{"action_id": "open", "value": "https://example.com"},
+			{"action_id": "acknowledge", "value": "default/guestbook/on-sync-failed"}]}`}}.Encode()
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(body))
+		req.Header.Set("X-Slack-Request-Timestamp", ts)
+		req.Header.Set("X-Slack-Signature", "v0="+sign("signing-secret", []byte("v0:"+ts+":"+body)))
+		return req
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest(time.Now().Add(-time.Hour)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.False(t, getAnnotations(t, client).Acknowledged("on-sync-failed"))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest(time.Now()))
+	assert.Equal(t, http.StatusOK, w.Code)
+	annotations := getAnnotations(t, client)
+	assert.True(t, annotations.Acknowledged("on-sync-failed"))
+	assert.False(t, annotations.Resolved("on-sync-failed"))
+}
+
+func TestHandler_PagerDuty(t *testing.T) {
+	client := newTestClient()
+	provider, err := NewPagerDutyProvider("webhook-secret")
+	require.NoError(t, err)
+	handler := NewHandler(client, provider)
+
+	send := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/pagerduty", strings.NewReader(body))
+		req.Header.Set("X-PagerDuty-Signature", "v1=0123,v1="+sign("webhook-secret", []byte(body)))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send(`{"event": {"event_type": "incident.resolved", "data": {"incident_key": "unrelated"}}}`))
+	assert.Equal(t, http.StatusOK, send(`{"event": {"event_type": "incident.acknowledged", "data": {"incident_key": "default/guestbook/on-sync-failed"}}}`))
+	annotations := getAnnotations(t, client)
+	assert.True(t, annotations.Acknowledged("on-sync-failed"))
+	assert.False(t, annotations.Resolved("on-sync-failed"))
+
+	assert.Equal(t, http.StatusOK, send(`{"event": {"event_type": "incident.resolved", "data": {"incident_key": "default/guestbook/on-sync-failed"}}}`))
+	assert.True(t, getAnnotations(t, client).Resolved("on-sync-failed"))
+}
+
+func TestReference(t *testing.T) {
+	callback, err := parseReference(Reference("default", "guestbook", "on-sync-failed"), ActionAcknowledge)
+	require.NoError(t, err)
+	assert.Equal(t, Callback{Namespace: "default", Name: "guestbook", Trigger: "on-sync-failed", Action: ActionAcknowledge}, callback)
+
+	_, err = parseReference("default/guestbook/on-sync-failed", "retry")
+	assert.EqualError(t, err, "unsupported action 'retry'")
+}
@@ -29,6 +29,17 @@ type AlertmanagerNotification struct {
 	Annotations  map[string]string `json:"annotations"`
 	GeneratorURL string            `json:"generatorURL"`
 	StartsAt     time.Time         `json:"startsAt"`
+	// Resolved sends the alert as resolved, labels must match the labels of the firing alert
+	Resolved bool `json:"resolved,omitempty"`
+}
+
+// alertmanagerAlert is the postableAlert model of the alertmanager API
+type alertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+	StartsAt     *time.Time        `json:"startsAt,omitempty"`
+	EndsAt       *time.Time        `json:"endsAt,omitempty"`
 }
 
 // AlertmanagerOptions cluster configuration
@@ -40,6 +51,7 @@ type AlertmanagerOptions struct {
 	BearerToken        string     `json:"bearerToken"`
 	InsecureSkipVerify bool       `json:"insecureSkipVerify"`
 	Timeout            int        `json:"timeout"`
+	Proxy              string     `json:"proxy"`
 }
 
 // NewAlertmanagerService new service
@@ -100,12 +112,13 @@ func (n AlertmanagerNotification) GetTemplater(name string, f texttemplate.FuncM
 			return fmt.Errorf("at least one label pair required")
 		}
 
-		notification.Alertmanager.Labels = n.Labels
+		notification.Alertmanager.Resolved = n.Resolved
+		notification.Alertmanager.Labels = copyStringMap(n.Labels)
 		if err := notification.Alertmanager.parseLabels(name, f, vars); err != nil {
 			return err
 		}
 		if len(n.Annotations) > 0 {
-			notification.Alertmanager.Annotations = n.Annotations
+			notification.Alertmanager.Annotations = copyStringMap(n.Annotations)
 			if err := notification.Alertmanager.parseAnnotations(name, f, vars); err != nil {
 				return err
 			}
@@ -115,6 +128,14 @@ func (n AlertmanagerNotification) GetTemplater(name string, f texttemplate.FuncM
 	}, nil
 }
 
+func copyStringMap(m map[string]string) map[string]string {
+	res := make(map[string]string, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
+
 func (n *AlertmanagerNotification) parseAnnotations(name string, f texttemplate.FuncMap, vars map[string]interface{}) error {
 	for k, v := range n.Annotations {
 		var tempData bytes.Buffer
@@ -163,6 +184,11 @@ func (n *AlertmanagerNotification) parseLabels(name string, f texttemplate.FuncM
 
 // Send using create alertmanager events
 func (s alertmanagerService) Send(notification Notification, dest Destination) error {
+	return s.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+// SendWithContext sends the notification using the given context
+func (s alertmanagerService) SendWithContext(ctx context.Context, notification Notification, dest Destination, _ State) error {
 	if notification.Alertmanager == nil {
 		return fmt.Errorf("notification alertmanager no config")
 	}
@@ -170,7 +196,7 @@ func (s alertmanagerService) Send(notification Notification, dest Destination) e
 		return fmt.Errorf("alertmanager at least one label pair required")
 	}
 
-	rawBody, err := json.Marshal([]*AlertmanagerNotification{notification.Alertmanager})
+	rawBody, err := json.Marshal([]alertmanagerAlert{newAlertmanagerAlert(*notification.Alertmanager)})
 	if err != nil {
 		return err
 	}
@@ -181,7 +207,7 @@ func (s alertmanagerService) Send(notification Notification, dest Destination) e
 	for _, target := range s.opts.Targets {
 		wg.Add(1)
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.opts.Timeout)*time.Second)
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(s.opts.Timeout)*time.Second)
 		defer cancel()
 
 		go func(target string) {
@@ -204,10 +230,31 @@ func (s alertmanagerService) Send(notification Notification, dest Destination) e
 	return nil
 }
 
+// newAlertmanagerAlert converts the notification into an alert. Resolved alerts end now and keep the start time of the
+// firing alert known to alertmanager.
+func newAlertmanagerAlert(n AlertmanagerNotification) alertmanagerAlert {
+	alert := alertmanagerAlert{
+		Labels:       n.Labels,
+		Annotations:  n.Annotations,
+		GeneratorURL: n.GeneratorURL,
+	}
+	if n.Resolved {
+		endsAt := time.Now()
+		alert.EndsAt = &endsAt
+	} else if !n.StartsAt.IsZero() {
+		startsAt := n.StartsAt
+		alert.StartsAt = &startsAt
+	}
+	return alert
+}
+
 func (s alertmanagerService) sendOneTarget(ctx context.Context, target string, rawBody []byte) error {
 	rawURL := fmt.Sprintf("%v://%v%v", s.opts.Scheme, target, s.opts.APIPath)
 
 	transport := httputil.NewTransport(rawURL, s.opts.InsecureSkipVerify)
+	if err := httputil.WithProxy(transport, s.opts.Proxy); err != nil {
+		return err
+	}
 	client := &http.Client{
 		Transport: httputil.NewLoggingRoundTripper(transport, s.entry),
 	}
@@ -238,7 +285,7 @@ func (s alertmanagerService) sendOneTarget(ctx context.Context, target string, r
 	}
 
 	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("request to %s has failed with error code %d : %s", rawURL, response.StatusCode, string(data))
+		return NewHTTPError(response, fmt.Errorf("request to %s has failed with error code %d : %s", rawURL, response.StatusCode, string(data)))
 	}
 
 	return nil
@@ -1,6 +1,10 @@
 package services
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"text/template"
 
@@ -159,3 +163,59 @@ func Test_AlertManagerNoLabels(t *testing.T) {
 	err := svc.Send(n, Destination{})
 	assert.EqualError(t, err, "alertmanager at least one label pair required")
 }
+
+func TestGetTemplater_AlertmanagerPerNotification(t *testing.T) {
+	n := Notification{
+		Alertmanager: &AlertmanagerNotification{
+			Labels:       map[string]string{"app": "{{.app}}"},
+			Annotations:  map[string]string{"summary": "{{.app}} is degraded"},
+			GeneratorURL: "https://argocd.example.com/applications/{{.app}}",
+		},
+	}
+	templater, err := n.GetTemplater("app-degraded", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var first, second Notification
+	assert.NoError(t, templater(&first, map[string]interface{}{"app": "guestbook"}))
+	assert.NoError(t, templater(&second, map[string]interface{}{"app": "helm-guestbook"}))
+
+	assert.Equal(t, map[string]string{"alertname": "app-degraded", "app": "guestbook"}, first.Alertmanager.Labels)
+	assert.Equal(t, map[string]string{"alertname": "app-degraded", "app": "helm-guestbook"}, second.Alertmanager.Labels)
+	assert.Equal(t, "helm-guestbook is degraded", second.Alertmanager.Annotations["summary"])
+	assert.Equal(t, map[string]string{"app": "{{.app}}"}, n.Alertmanager.Labels)
+}
+
+func TestSend_AlertmanagerResolved(t *testing.T) {
+	var alerts []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alerts = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&alerts))
+	}))
+	defer server.Close()
+
+	s := NewAlertmanagerService(AlertmanagerOptions{Targets: []string{strings.TrimPrefix(server.URL, "http://")}})
+
+	templater, err := (&AlertmanagerNotification{Labels: map[string]string{"alertname": "app-degraded"}, GeneratorURL: "https://argocd.example.com"}).GetTemplater("", template.FuncMap{})
+	assert.NoError(t, err)
+	var firing Notification
+	assert.NoError(t, templater(&firing, map[string]interface{}{}))
+	assert.NoError(t, s.Send(firing, Destination{}))
+	if assert.Len(t, alerts, 1) {
+		assert.Contains(t, alerts[0], "startsAt")
+		assert.NotContains(t, alerts[0], "endsAt")
+		assert.NotContains(t, alerts[0], "resolved")
+	}
+
+	templater, err = (&AlertmanagerNotification{Labels: map[string]string{"alertname": "app-degraded"}, GeneratorURL: "https://argocd.example.com", Resolved: true}).GetTemplater("", template.FuncMap{})
+	assert.NoError(t, err)
+	var resolved Notification
+	assert.NoError(t, templater(&resolved, map[string]interface{}{}))
+	assert.NoError(t, s.Send(resolved, Destination{}))
+	if assert.Len(t, alerts, 1) {
+		assert.NotContains(t, alerts[0], "startsAt")
+		assert.Contains(t, alerts[0], "endsAt")
+		assert.Equal(t, map[string]interface{}{"alertname": "app-degraded"}, alerts[0]["labels"])
+	}
+}
@@ -3,7 +3,10 @@ package services
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"os"
+	"strings"
+	"sync"
 	texttemplate "text/template"
 
 	log "github.com/sirupsen/logrus"
@@ -11,11 +14,17 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
 type AwsSqsNotification struct {
 	MessageAttributes map[string]string `json:"messageAttributes"`
+	// MessageGroupId is required by FIFO queues, messages of the same group are delivered in order
+	MessageGroupId string `json:"messageGroupId,omitempty"`
+	// MessageDeduplicationId is required by FIFO queues without content-based deduplication
+	MessageDeduplicationId string `json:"messageDeduplicationId,omitempty"`
 }
 
 type AwsSqsOptions struct {
@@ -24,6 +33,16 @@ type AwsSqsOptions struct {
 	Region      string `json:"region"`
 	EndpointUrl string `json:"endpointUrl,omitempty"`
 	AwsAccess
+	AwsRole
+}
+
+// AwsRole configures the role assumed to access the queue, e.g. a role of the account owning the queue
+type AwsRole struct {
+	RoleArn     string `json:"roleArn,omitempty"`
+	ExternalID  string `json:"externalId,omitempty"`
+	SessionName string `json:"sessionName,omitempty"`
+	// WebIdentityTokenFile assumes the role using the web identity token of the file, e.g. the token of an IRSA service account
+	WebIdentityTokenFile string `json:"webIdentityTokenFile,omitempty"`
 }
 
 type AwsAccess struct {
@@ -37,24 +56,33 @@ func NewAwsSqsService(opts AwsSqsOptions) NotificationService {
 
 type awsSqsService struct {
 	opts AwsSqsOptions
+	// roleCredentials caches the credentials of the assumed role across the deliveries, it is created by the first
+	// delivery
+	roleCredentials     *aws.CredentialsCache
+	roleCredentialsOnce sync.Once
+}
+
+func (s *awsSqsService) Send(notif Notification, dest Destination) error {
+	return s.SendWithContext(context.Background(), notif, dest, State{})
 }
 
-func (s awsSqsService) Send(notif Notification, dest Destination) error {
+func (s *awsSqsService) SendWithContext(ctx context.Context, notif Notification, dest Destination, _ State) error {
 	options := s.setOptions()
-	cfg, err := config.LoadDefaultConfig(context.TODO(), options...)
+	cfg, err := config.LoadDefaultConfig(ctx, options...)
 	if err != nil {
 		log.Fatalf("failed to load configuration, %v", err)
 	}
+	s.assumeRole(&cfg)
 
 	client := sqs.NewFromConfig(cfg)
 
-	queueUrl, err := GetQueueURL(context.TODO(), client, s.getQueueInput(dest))
+	queueUrl, err := GetQueueURL(ctx, client, s.getQueueInput(dest))
 	if err != nil {
 		log.Error("Got an error getting the queue URL: ", err)
 		return err
 	}
 
-	sendMessage, err := SendMsg(context.TODO(), client, s.sendMessageInput(queueUrl.QueueUrl, notif))
+	sendMessage, err := SendMsg(ctx, client, s.sendMessageInput(queueUrl.QueueUrl, notif))
 	if err != nil {
 		log.Error("Got an error sending the message: ", err)
 		return err
@@ -64,15 +92,28 @@ func (s awsSqsService) Send(notif Notification, dest Destination) error {
 	return nil
 }
 
-func (s awsSqsService) sendMessageInput(queueUrl *string, notif Notification) *sqs.SendMessageInput {
-	return &sqs.SendMessageInput{
+func (s *awsSqsService) sendMessageInput(queueUrl *string, notif Notification) *sqs.SendMessageInput {
+	input := &sqs.SendMessageInput{
 		QueueUrl:     queueUrl,
 		MessageBody:  aws.String(notif.Message),
 		DelaySeconds: 10,
 	}
-
+	// FIFO queues do not support per-message delays
+	if queueUrl != nil && strings.HasSuffix(*queueUrl, ".fifo") {
+		input.DelaySeconds = 0
+	}
+	if notif.AwsSqs != nil {
+		if notif.AwsSqs.MessageGroupId != "" {
+			input.DelaySeconds = 0
+			input.MessageGroupId = aws.String(notif.AwsSqs.MessageGroupId)
+		}
+		if notif.AwsSqs.MessageDeduplicationId != "" {
+			input.MessageDeduplicationId = aws.String(notif.AwsSqs.MessageDeduplicationId)
+		}
+	}
+	return input
 }
-func (s awsSqsService) getQueueInput(dest Destination) *sqs.GetQueueUrlInput {
+func (s *awsSqsService) getQueueInput(dest Destination) *sqs.GetQueueUrlInput {
 	result := &sqs.GetQueueUrlInput{}
 	result.QueueName = &s.opts.Queue
 
@@ -88,7 +129,7 @@ func (s awsSqsService) getQueueInput(dest Destination) *sqs.GetQueueUrlInput {
 	return result
 }
 
-func (s awsSqsService) setOptions() []func(*config.LoadOptions) error {
+func (s *awsSqsService) setOptions() []func(*config.LoadOptions) error {
 	// Slice for AWS config options
 	var options []func(*config.LoadOptions) error
 
@@ -124,12 +165,57 @@ func (s awsSqsService) setOptions() []func(*config.LoadOptions) error {
 	return options
 }
 
+// assumeRole replaces the credentials of the configuration with the credentials of the configured role, the provider
+// of the credentials is created once using the configuration of the first delivery
+func (s *awsSqsService) assumeRole(cfg *aws.Config) {
+	if s.opts.RoleArn == "" {
+		return
+	}
+	s.roleCredentialsOnce.Do(func() {
+		client := sts.NewFromConfig(*cfg)
+		if s.opts.WebIdentityTokenFile != "" {
+			s.roleCredentials = aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(client, s.opts.RoleArn, stscreds.IdentityTokenFile(s.opts.WebIdentityTokenFile), func(o *stscreds.WebIdentityRoleOptions) {
+				o.RoleSessionName = s.opts.SessionName
+			}))
+			return
+		}
+		s.roleCredentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(client, s.opts.RoleArn, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = s.opts.SessionName
+			if s.opts.ExternalID != "" {
+				o.ExternalID = aws.String(s.opts.ExternalID)
+			}
+		}))
+	})
+	cfg.Credentials = s.roleCredentials
+}
+
 func (n *AwsSqsNotification) GetTemplater(name string, f texttemplate.FuncMap) (Templater, error) {
+	messageGroupId, err := texttemplate.New(name).Funcs(f).Parse(n.MessageGroupId)
+	if err != nil {
+		return nil, fmt.Errorf("error in '%s' awssqs.messageGroupId : %w", name, err)
+	}
+	messageDeduplicationId, err := texttemplate.New(name).Funcs(f).Parse(n.MessageDeduplicationId)
+	if err != nil {
+		return nil, fmt.Errorf("error in '%s' awssqs.messageDeduplicationId : %w", name, err)
+	}
+
 	return func(notification *Notification, vars map[string]interface{}) error {
 		if notification.AwsSqs == nil {
 			notification.AwsSqs = &AwsSqsNotification{}
 		}
 
+		var messageGroupIdData bytes.Buffer
+		if err := messageGroupId.Execute(&messageGroupIdData, vars); err != nil {
+			return err
+		}
+		notification.AwsSqs.MessageGroupId = messageGroupIdData.String()
+
+		var messageDeduplicationIdData bytes.Buffer
+		if err := messageDeduplicationId.Execute(&messageDeduplicationIdData, vars); err != nil {
+			return err
+		}
+		notification.AwsSqs.MessageDeduplicationId = messageDeduplicationIdData.String()
+
 		if len(n.MessageAttributes) > 0 {
 			notification.AwsSqs.MessageAttributes = n.MessageAttributes
 			if err := notification.AwsSqs.parseMessageAttributes(name, f, vars); err != nil {
@@ -9,6 +9,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/stretchr/testify/assert"
 )
@@ -200,6 +201,55 @@ func TestSetOptionsCustomEndpointUrl_AwsSqs(t *testing.T) {
 
 }
 
+func TestSendMessageInput_AwsSqsFifo(t *testing.T) {
+	n := Notification{
+		Message: "{{.message}}",
+		AwsSqs: &AwsSqsNotification{
+			MessageGroupId:         "{{.app}}",
+			MessageDeduplicationId: "{{.app}}-{{.revision}}",
+		},
+	}
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var notification Notification
+	assert.NoError(t, templater(&notification, map[string]interface{}{"message": "synced", "app": "guestbook", "revision": "abc"}))
+
+	s := NewTypedAwsSqsService(AwsSqsOptions{})
+	input := SendMessageInput(s, aws.String("https://sqs.us-east-1.amazonaws.com/123/myqueue.fifo"), notification)
+	assert.Equal(t, "guestbook", aws.ToString(input.MessageGroupId))
+	assert.Equal(t, "guestbook-abc", aws.ToString(input.MessageDeduplicationId))
+	assert.Equal(t, int32(0), input.DelaySeconds)
+
+	input = SendMessageInput(s, aws.String("https://sqs.us-east-1.amazonaws.com/123/myqueue"), Notification{Message: "synced"})
+	assert.Nil(t, input.MessageGroupId)
+	assert.Nil(t, input.MessageDeduplicationId)
+	assert.Equal(t, int32(10), input.DelaySeconds)
+}
+
+func TestAssumeRole_AwsSqs(t *testing.T) {
+	cfg := aws.Config{Region: "us-east-1"}
+	NewTypedAwsSqsService(AwsSqsOptions{}).assumeRole(&cfg)
+	assert.Nil(t, cfg.Credentials)
+
+	NewTypedAwsSqsService(AwsSqsOptions{AwsRole: AwsRole{RoleArn: "arn:aws:iam::123:role/notifications", ExternalID: "id"}}).assumeRole(&cfg)
+	assert.IsType(t, &aws.CredentialsCache{}, cfg.Credentials)
+	assert.True(t, cfg.Credentials.(*aws.CredentialsCache).IsCredentialsProvider(&stscreds.AssumeRoleProvider{}))
+
+	cfg = aws.Config{Region: "us-east-1"}
+	NewTypedAwsSqsService(AwsSqsOptions{AwsRole: AwsRole{RoleArn: "arn:aws:iam::123:role/notifications", WebIdentityTokenFile: "/var/run/secrets/token"}}).assumeRole(&cfg)
+	assert.True(t, cfg.Credentials.(*aws.CredentialsCache).IsCredentialsProvider(&stscreds.WebIdentityRoleProvider{}))
+
+	// the credentials are cached across the deliveries
+	service := NewTypedAwsSqsService(AwsSqsOptions{AwsRole: AwsRole{RoleArn: "arn:aws:iam::123:role/notifications"}})
+	first := aws.Config{Region: "us-east-1"}
+	service.assumeRole(&first)
+	second := aws.Config{Region: "us-east-1"}
+	service.assumeRole(&second)
+	assert.Same(t, first.Credentials, second.Credentials)
+}
+
 // Helpers
 var SetOptions = (*awsSqsService).setOptions
 var SendMessageInput = (*awsSqsService).sendMessageInput
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultCircuitBreakerOpenDuration = 60
+
+// CircuitBreaker configures the circuit breaker of a service instance. Durations are in seconds
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures that open the circuit
+	FailureThreshold int `json:"failureThreshold"`
+	// OpenDuration is the duration the circuit stays open before a notification probes the service, defaults to 60 seconds
+	OpenDuration int `json:"openDuration,omitempty"`
+}
+
+// CircuitOpenError is returned instead of sending the notification while the circuit of the service is open
+type CircuitOpenError struct {
+	// RetryAfter is the time after which the next notification probes the service
+	RetryAfter time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker is open until %s", e.RetryAfter.Format(time.RFC3339))
+}
+
+type circuitBreakerService struct {
+	service      ContextNotificationService
+	threshold    int
+	openDuration time.Duration
+
+	lock     sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreakerService returns the service that stops sending notifications using the given service after
+// consecutive failures, and probes the service once the open duration elapsed
+func NewCircuitBreakerService(service NotificationService, cb CircuitBreaker) (NotificationService, error) {
+	if cb.FailureThreshold <= 0 {
+		return nil, fmt.Errorf("circuit breaker failureThreshold must be greater than 0")
+	}
+	openDuration := cb.OpenDuration
+	if openDuration <= 0 {
+		openDuration = defaultCircuitBreakerOpenDuration
+	}
+	return &circuitBreakerService{
+		service:      NewContextService(service),
+		threshold:    cb.FailureThreshold,
+		openDuration: time.Duration(openDuration) * time.Second,
+	}, nil
+}
+
+func (s *circuitBreakerService) Send(notification Notification, dest Destination) error {
+	return s.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+func (s *circuitBreakerService) SendWithContext(ctx context.Context, notification Notification, dest Destination, state State) error {
+	if err := s.allow(dest); err != nil {
+		return err
+	}
+	err := s.service.SendWithContext(ctx, notification, dest, state)
+	s.record(dest, err)
+	return err
+}
+
+// allow returns an error if the circuit is open. A single notification probes the service once the open duration elapsed
+func (s *circuitBreakerService) allow(dest Destination) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.failures < s.threshold {
+		return nil
+	}
+	retryAfter := s.openedAt.Add(s.openDuration)
+	if s.probing || time.Now().Before(retryAfter) {
+		return &CircuitOpenError{RetryAfter: retryAfter}
+	}
+	log.Infof("Circuit breaker of service %s is half-open, probing the service", dest.Service)
+	s.probing = true
+	return nil
+}
+
+func (s *circuitBreakerService) record(dest Destination, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	probing := s.probing
+	s.probing = false
+	// the service responded to notifications it rejected because of their content, so the failure does not open the circuit
+	if err == nil || (errors.Is(err, ErrPermanent) && !errors.Is(err, ErrAuth)) {
+		if s.failures >= s.threshold {
+			log.Infof("Circuit breaker of service %s is closed", dest.Service)
+		}
+		s.failures = 0
+		return
+	}
+	s.failures++
+	if probing || s.failures == s.threshold {
+		log.Warnf("Circuit breaker of service %s is open for %s after %d consecutive failures: %v", dest.Service, s.openDuration, s.failures, err)
+		s.openedAt = time.Now()
+	}
+}
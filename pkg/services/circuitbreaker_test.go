@@ -0,0 +1,95 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCircuitBreakerService_Invalid(t *testing.T) {
+	_, err := NewCircuitBreakerService(&fakeService{}, CircuitBreaker{})
+	assert.EqualError(t, err, "circuit breaker failureThreshold must be greater than 0")
+}
+
+func TestCircuitBreakerService_Opens(t *testing.T) {
+	fake := &fakeService{err: errors.New("service unavailable")}
+	service, err := NewCircuitBreakerService(fake, CircuitBreaker{FailureThreshold: 2, OpenDuration: 30})
+	if !assert.NoError(t, err) {
+		return
+	}
+	dest := Destination{Service: "fake", Recipient: "test"}
+
+	assert.EqualError(t, service.Send(Notification{}, dest), "service unavailable")
+	assert.EqualError(t, service.Send(Notification{}, dest), "service unavailable")
+
+	err = service.Send(Notification{}, dest)
+	var circuitOpenErr *CircuitOpenError
+	if assert.ErrorAs(t, err, &circuitOpenErr) {
+		assert.WithinDuration(t, time.Now().Add(30*time.Second), circuitOpenErr.RetryAfter, time.Second)
+	}
+	assert.Len(t, fake.sent, 2)
+}
+
+func TestCircuitBreakerService_Probes(t *testing.T) {
+	fake := &fakeService{err: errors.New("service unavailable")}
+	service, err := NewCircuitBreakerService(fake, CircuitBreaker{FailureThreshold: 1})
+	if !assert.NoError(t, err) {
+		return
+	}
+	cb := service.(*circuitBreakerService)
+	dest := Destination{Service: "fake", Recipient: "test"}
+
+	assert.Error(t, service.Send(Notification{}, dest))
+	assert.IsType(t, &CircuitOpenError{}, service.Send(Notification{}, dest))
+
+	// the failed probe opens the circuit again
+	cb.openedAt = time.Now().Add(-time.Hour)
+	assert.EqualError(t, service.Send(Notification{}, dest), "service unavailable")
+	assert.IsType(t, &CircuitOpenError{}, service.Send(Notification{}, dest))
+
+	// the successful probe closes the circuit
+	cb.openedAt = time.Now().Add(-time.Hour)
+	fake.err = nil
+	assert.NoError(t, service.Send(Notification{}, dest))
+	assert.NoError(t, service.Send(Notification{}, dest))
+	assert.Len(t, fake.sent, 4)
+}
+
+func TestNewService_CircuitBreaker(t *testing.T) {
+	service, err := NewService("webhook", []byte(`
+url: https://example.com
+rateLimit:
+  requestsPerSecond: 2
+circuitBreaker:
+  failureThreshold: 5
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cb, ok := service.(*circuitBreakerService)
+	if assert.True(t, ok) {
+		assert.Equal(t, 5, cb.threshold)
+		assert.Equal(t, time.Minute, cb.openDuration)
+		assert.IsType(t, &rateLimitedService{}, cb.service)
+	}
+}
+
+func TestCircuitBreakerService_IgnoresPermanentErrors(t *testing.T) {
+	fake := &fakeService{err: &PermanentError{Err: errors.New("invalid payload")}}
+	service, err := NewCircuitBreakerService(fake, CircuitBreaker{FailureThreshold: 1})
+	if !assert.NoError(t, err) {
+		return
+	}
+	dest := Destination{Service: "fake", Recipient: "test"}
+
+	assert.EqualError(t, service.Send(Notification{}, dest), "invalid payload")
+	assert.EqualError(t, service.Send(Notification{}, dest), "invalid payload")
+
+	fake.err = &AuthError{Err: errors.New("invalid token")}
+	assert.EqualError(t, service.Send(Notification{}, dest), "invalid token")
+	assert.ErrorAs(t, service.Send(Notification{}, dest), new(*CircuitOpenError))
+	assert.Len(t, fake.sent, 3)
+}
@@ -2,18 +2,57 @@ package services
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"regexp"
 	"strings"
+	"sync"
 	texttemplate "text/template"
+	"time"
 
-	"gomodules.xyz/notify"
-	"gomodules.xyz/notify/smtp"
+	"golang.org/x/time/rate"
+	gomail "gopkg.in/gomail.v2"
 
 	"github.com/argoproj/notifications-engine/pkg/util/text"
 )
 
+const (
+	defaultEmailIdleTimeout = 30
+)
+
 type EmailNotification struct {
-	Subject string `json:"subject,omitempty"`
-	Body    string `json:"body,omitempty"`
+	Subject string       `json:"subject,omitempty"`
+	Body    string       `json:"body,omitempty"`
+	Images  []EmailImage `json:"images,omitempty"`
+	// Headers holds additional message headers such as X-Priority or In-Reply-To. Headers with empty values are omitted
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// reservedEmailHeaders are managed by the email service and cannot be overridden by templates
+var reservedEmailHeaders = map[string]bool{"From": true, "To": true, "Subject": true}
+
+// emailHeaderNamePattern matches the header field names of RFC 5322, printable US-ASCII characters except the colon
+var emailHeaderNamePattern = regexp.MustCompile(`^[!-9;-~]+$`)
+
+// EmailImage is an image embedded into the message and referenced from the HTML body using "cid:<name>"
+type EmailImage struct {
+	// Name is the image file name which is also used as the Content-ID
+	Name string `json:"name"`
+	// Data holds the base64 encoded image content
+	Data string `json:"data"`
+	// ContentType optionally overrides the content type detected from the file name extension
+	ContentType string `json:"contentType,omitempty"`
+}
+
+type compiledEmailImage struct {
+	name        *texttemplate.Template
+	data        *texttemplate.Template
+	contentType string
 }
 
 func (n *EmailNotification) GetTemplater(name string, f texttemplate.FuncMap) (Templater, error) {
@@ -25,6 +64,32 @@ func (n *EmailNotification) GetTemplater(name string, f texttemplate.FuncMap) (T
 	if err != nil {
 		return nil, err
 	}
+	var images []compiledEmailImage
+	for i := range n.Images {
+		imageName, err := texttemplate.New(name).Funcs(f).Parse(n.Images[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		imageData, err := texttemplate.New(name).Funcs(f).Parse(n.Images[i].Data)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, compiledEmailImage{name: imageName, data: imageData, contentType: n.Images[i].ContentType})
+	}
+	headers := map[string]*texttemplate.Template{}
+	for k, v := range n.Headers {
+		if !emailHeaderNamePattern.MatchString(k) {
+			return nil, fmt.Errorf("email header %q is not a valid header name", k)
+		}
+		if reservedEmailHeaders[textproto.CanonicalMIMEHeaderKey(k)] {
+			return nil, fmt.Errorf("email header %s cannot be set by template", k)
+		}
+		header, err := texttemplate.New(name + k).Funcs(f).Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		headers[k] = header
+	}
 
 	return func(notification *Notification, vars map[string]interface{}) error {
 		if notification.Email == nil {
@@ -47,6 +112,33 @@ func (n *EmailNotification) GetTemplater(name string, f texttemplate.FuncMap) (T
 			notification.Email.Body = val
 		}
 
+		for _, image := range images {
+			var nameData bytes.Buffer
+			if err := image.name.Execute(&nameData, vars); err != nil {
+				return err
+			}
+			var imageData bytes.Buffer
+			if err := image.data.Execute(&imageData, vars); err != nil {
+				return err
+			}
+			notification.Email.Images = append(notification.Email.Images, EmailImage{
+				Name:        nameData.String(),
+				Data:        imageData.String(),
+				ContentType: image.contentType,
+			})
+		}
+
+		for k, header := range headers {
+			var headerData bytes.Buffer
+			if err := header.Execute(&headerData, vars); err != nil {
+				return err
+			}
+			if notification.Email.Headers == nil {
+				notification.Email.Headers = map[string]string{}
+			}
+			notification.Email.Headers[k] = headerData.String()
+		}
+
 		return nil
 	}, nil
 }
@@ -59,28 +151,60 @@ type EmailOptions struct {
 	Password           string `json:"password"`
 	From               string `json:"from"`
 	Html               bool   `json:"html"`
+	// MaxIdleConnections is the number of authenticated SMTP connections that are kept open and reused across sends.
+	// Zero disables pooling and opens a new connection for every message.
+	MaxIdleConnections int `json:"max_idle_connections"`
+	// IdleTimeout is the number of seconds after which an unused pooled connection is closed
+	IdleTimeout int `json:"idle_timeout"`
+	// MaxMessagesPerMinute limits the rate of sent messages; zero means unlimited
+	MaxMessagesPerMinute int `json:"max_messages_per_minute"`
+}
+
+// emailSender delivers a fully composed message to the SMTP server
+type emailSender interface {
+	Send(msg *gomail.Message) error
 }
 
 type emailService struct {
-	client notify.ByEmail
-	html   bool
+	sender  emailSender
+	from    string
+	html    bool
+	limiter *rate.Limiter
 }
 
 func NewEmailService(opts EmailOptions) *emailService {
+	var dialer *gomail.Dialer
+	if opts.Username != "" && opts.Password != "" {
+		dialer = gomail.NewDialer(opts.Host, opts.Port, opts.Username, opts.Password)
+	} else {
+		dialer = &gomail.Dialer{Host: opts.Host, Port: opts.Port}
+	}
+	if opts.InsecureSkipVerify {
+		dialer.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	if opts.IdleTimeout == 0 {
+		opts.IdleTimeout = defaultEmailIdleTimeout
+	}
+
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if opts.MaxMessagesPerMinute > 0 {
+		limiter = rate.NewLimiter(rate.Every(time.Minute/time.Duration(opts.MaxMessagesPerMinute)), 1)
+	}
+
 	return &emailService{
-		client: smtp.New(smtp.Options{
-			From:               opts.From,
-			Host:               opts.Host,
-			Port:               opts.Port,
-			InsecureSkipVerify: opts.InsecureSkipVerify,
-			Password:           opts.Password,
-			Username:           opts.Username,
-		}),
-		html: opts.Html,
+		sender:  newSMTPPool(dialer, opts.MaxIdleConnections, time.Duration(opts.IdleTimeout)*time.Second),
+		from:    opts.From,
+		html:    opts.Html,
+		limiter: limiter,
 	}
 }
 
 func (s *emailService) Send(notification Notification, dest Destination) error {
+	return s.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+// SendWithContext sends the email, the context cancels waiting for the rate limit
+func (s *emailService) SendWithContext(ctx context.Context, notification Notification, dest Destination, _ State) error {
 	subject := ""
 	body := notification.Message
 	to := s.parseTo(dest.Recipient)
@@ -88,14 +212,63 @@ func (s *emailService) Send(notification Notification, dest Destination) error {
 		subject = notification.Email.Subject
 		body = text.Coalesce(notification.Email.Body, body)
 	}
+	if len(to) == 0 || to[0] == "" {
+		return errors.New("email recipient is not specified")
+	}
 
-	email := s.client.WithSubject(subject).WithBody(body).To(to[0], to[1:]...)
-
+	msg := gomail.NewMessage()
+	msg.SetHeader("From", s.from)
+	msg.SetHeader("To", to...)
+	msg.SetHeader("Subject", subject)
 	if s.html {
-		return email.SendHtml()
+		msg.SetBody("text/html", body)
 	} else {
-		return email.Send()
+		msg.SetBody("text/plain", body)
 	}
+	if notification.Email != nil {
+		for k, v := range notification.Email.Headers {
+			v = strings.TrimSpace(v)
+			if v == "" || reservedEmailHeaders[textproto.CanonicalMIMEHeaderKey(k)] {
+				continue
+			}
+			// line breaks would start other headers, e.g. Bcc, using the templated values
+			if strings.ContainsAny(v, "\r\n") {
+				return &PermanentError{Err: fmt.Errorf("email header %s must not contain line breaks", k)}
+			}
+			msg.SetHeader(k, v)
+		}
+		if err := embedImages(msg, notification.Email.Images); err != nil {
+			return err
+		}
+	}
+
+	if s.limiter != nil {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return s.sender.Send(msg)
+}
+
+func embedImages(msg *gomail.Message, images []EmailImage) error {
+	for _, image := range images {
+		if image.Name == "" {
+			return errors.New("email image name is not specified")
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(image.Data), ""))
+		if err != nil {
+			return fmt.Errorf("failed to decode email image %s: %v", image.Name, err)
+		}
+		settings := []gomail.FileSetting{gomail.SetCopyFunc(func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		})}
+		if image.ContentType != "" {
+			settings = append(settings, gomail.SetHeader(map[string][]string{"Content-Type": {image.ContentType}}))
+		}
+		msg.Embed(image.Name, settings...)
+	}
+	return nil
 }
 
 func (s *emailService) parseTo(recipient string) []string {
@@ -105,3 +278,110 @@ func (s *emailService) parseTo(recipient string) []string {
 	}
 	return to
 }
+
+type smtpDialer interface {
+	Dial() (gomail.SendCloser, error)
+}
+
+// dataTrackingSender records whether the server accepted the DATA command of the message, the content of the message
+// is only written once it did
+type dataTrackingSender struct {
+	gomail.SendCloser
+	dataStarted bool
+}
+
+func (s *dataTrackingSender) Send(from string, to []string, msg io.WriterTo) error {
+	return s.SendCloser.Send(from, to, writerToFunc(func(w io.Writer) (int64, error) {
+		s.dataStarted = true
+		return msg.WriteTo(w)
+	}))
+}
+
+type writerToFunc func(w io.Writer) (int64, error)
+
+func (f writerToFunc) WriteTo(w io.Writer) (int64, error) {
+	return f(w)
+}
+
+type pooledSMTPConnection struct {
+	gomail.SendCloser
+	lastUsed time.Time
+}
+
+// smtpPool keeps authenticated SMTP connections open so that subsequent messages don't have to
+// go through the TLS handshake and authentication again
+type smtpPool struct {
+	dialer      smtpDialer
+	maxIdle     int
+	idleTimeout time.Duration
+	lock        sync.Mutex
+	idle        []*pooledSMTPConnection
+}
+
+func newSMTPPool(dialer smtpDialer, maxIdle int, idleTimeout time.Duration) *smtpPool {
+	return &smtpPool{dialer: dialer, maxIdle: maxIdle, idleTimeout: idleTimeout}
+}
+
+func (p *smtpPool) Send(msg *gomail.Message) error {
+	conn, reused, err := p.get()
+	if err != nil {
+		return err
+	}
+	sender := &dataTrackingSender{SendCloser: conn}
+	err = gomail.Send(sender, msg)
+	if err != nil && reused && !sender.dataStarted {
+		// pooled connection might have been closed by the server, retry using a fresh one. The message is not sent
+		// again once the server accepted its content, since the server might have delivered it despite the error
+		_ = conn.Close()
+		conn, err = p.dial()
+		if err != nil {
+			return err
+		}
+		err = gomail.Send(conn, msg)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	p.put(conn)
+	return nil
+}
+
+func (p *smtpPool) dial() (*pooledSMTPConnection, error) {
+	conn, err := p.dialer.Dial()
+	if err != nil {
+		return nil, err
+	}
+	return &pooledSMTPConnection{SendCloser: conn}, nil
+}
+
+// get returns an idle connection if available or dials a new one
+func (p *smtpPool) get() (*pooledSMTPConnection, bool, error) {
+	p.lock.Lock()
+	now := time.Now()
+	for len(p.idle) > 0 {
+		conn := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if now.Sub(conn.lastUsed) < p.idleTimeout {
+			p.lock.Unlock()
+			return conn, true, nil
+		}
+		_ = conn.Close()
+	}
+	p.lock.Unlock()
+
+	conn, err := p.dial()
+	return conn, false, err
+}
+
+// put returns the connection into the pool or closes it if the pool is full
+func (p *smtpPool) put(conn *pooledSMTPConnection) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.idle) >= p.maxIdle {
+		_ = conn.Close()
+		return
+	}
+	conn.lastUsed = time.Now()
+	p.idle = append(p.idle, conn)
+}
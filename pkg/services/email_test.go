@@ -1,11 +1,16 @@
 package services
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/stretchr/testify/assert"
-	"gomodules.xyz/notify"
+	"golang.org/x/time/rate"
+	gomail "gopkg.in/gomail.v2"
 	"k8s.io/utils/strings/slices"
 )
 
@@ -36,40 +41,99 @@ func TestGetTemplater_Email(t *testing.T) {
 	assert.Equal(t, "world", notification.Email.Body)
 }
 
-type mockClient struct {
-	notify.ByEmail
+func TestGetTemplater_EmailImages(t *testing.T) {
+	n := Notification{
+		Email: &EmailNotification{
+			Body: `<img src="cid:{{.name}}.png">`,
+			Images: []EmailImage{{
+				Name: "{{.name}}.png", Data: "{{.data}}", ContentType: "image/png",
+			}},
+		},
+	}
+
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var notification Notification
+	err = templater(&notification, map[string]interface{}{
+		"name": "logo",
+		"data": "aGVsbG8=",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []EmailImage{{Name: "logo.png", Data: "aGVsbG8=", ContentType: "image/png"}}, notification.Email.Images)
 }
 
-func (c *mockClient) Send() error {
-	return nil
+func TestGetTemplater_EmailHeaders(t *testing.T) {
+	n := Notification{
+		Email: &EmailNotification{
+			Headers: map[string]string{
+				"In-Reply-To": "<{{.name}}@notifications>",
+				"X-Priority":  "1",
+			},
+		},
+	}
+
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var notification Notification
+	err = templater(&notification, map[string]interface{}{"name": "guestbook"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, map[string]string{"In-Reply-To": "<guestbook@notifications>", "X-Priority": "1"}, notification.Email.Headers)
 }
 
-func (c *mockClient) SendHtml() error {
-	return nil
+func TestGetTemplater_EmailReservedHeader(t *testing.T) {
+	n := Notification{
+		Email: &EmailNotification{Headers: map[string]string{"to": "someone@email.com"}},
+	}
+
+	_, err := n.GetTemplater("", template.FuncMap{})
+	assert.Error(t, err)
 }
 
-func (c *mockClient) WithSubject(string) notify.ByEmail {
-	return c
+func TestGetTemplater_EmailInvalidHeaderName(t *testing.T) {
+	for _, name := range []string{"X-Priority:", "X Priority", "X-Prïority", ""} {
+		n := Notification{
+			Email: &EmailNotification{Headers: map[string]string{name: "1"}},
+		}
+
+		_, err := n.GetTemplater("", template.FuncMap{})
+		assert.Error(t, err, name)
+	}
 }
 
-func (c *mockClient) WithBody(string) notify.ByEmail {
-	return c
+type mockSender struct {
+	messages []*gomail.Message
 }
 
-func (c *mockClient) To(string, ...string) notify.ByEmail {
-	return c
+func (s *mockSender) Send(msg *gomail.Message) error {
+	s.messages = append(s.messages, msg)
+	return nil
 }
 
 func TestSend_SingleRecepient(t *testing.T) {
-	es := emailService{&mockClient{}, false}
+	sender := &mockSender{}
+	es := emailService{sender: sender}
 	err := es.Send(Notification{}, Destination{Recipient: "test@email.com"})
 	if err != nil {
 		t.Error("Error while sending email")
 	}
+	assert.Equal(t, []string{"test@email.com"}, sender.messages[0].GetHeader("To"))
 }
 
 func TestSend_MultipleRecepient(t *testing.T) {
-	es := emailService{&mockClient{}, true}
+	sender := &mockSender{}
+	es := emailService{sender: sender, html: true}
 	// two email addresses
 	err := es.Send(Notification{}, Destination{Recipient: "test1@email.com,test2@email.com"})
 	if err != nil {
@@ -80,6 +144,175 @@ func TestSend_MultipleRecepient(t *testing.T) {
 	if err != nil {
 		t.Error("Error while sending email")
 	}
+	assert.Equal(t, []string{"test1@email.com", "test2@email.com", "test3@email.com"}, sender.messages[1].GetHeader("To"))
+}
+
+func TestSend_NoRecipient(t *testing.T) {
+	es := emailService{sender: &mockSender{}}
+	err := es.Send(Notification{}, Destination{Recipient: ""})
+	assert.Error(t, err)
+}
+
+func TestSend_InlineImages(t *testing.T) {
+	sender := &mockSender{}
+	es := emailService{sender: sender, html: true}
+	err := es.Send(Notification{
+		Email: &EmailNotification{
+			Body:   `<img src="cid:logo.png">`,
+			Images: []EmailImage{{Name: "logo.png", Data: "aGVs\nbG8="}},
+		},
+	}, Destination{Recipient: "test@email.com"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var data bytes.Buffer
+	_, err = sender.messages[0].WriteTo(&data)
+	assert.NoError(t, err)
+	assert.Contains(t, data.String(), "Content-ID: <logo.png>")
+	assert.Contains(t, data.String(), "Content-Type: image/png")
+	assert.Contains(t, data.String(), "aGVsbG8=")
+}
+
+func TestSend_CustomHeaders(t *testing.T) {
+	sender := &mockSender{}
+	es := emailService{sender: sender}
+	err := es.Send(Notification{
+		Email: &EmailNotification{Headers: map[string]string{
+			"Auto-Submitted": "auto-generated",
+			"In-Reply-To":    "",
+		}},
+	}, Destination{Recipient: "test@email.com"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{"auto-generated"}, sender.messages[0].GetHeader("Auto-Submitted"))
+	assert.Empty(t, sender.messages[0].GetHeader("In-Reply-To"))
+}
+
+func TestSend_HeaderInjection(t *testing.T) {
+	sender := &mockSender{}
+	es := emailService{sender: sender}
+	err := es.Send(Notification{
+		Email: &EmailNotification{Headers: map[string]string{
+			"In-Reply-To": "<1234@example.com>\r\nBcc: attacker@example.com",
+		}},
+	}, Destination{Recipient: "test@email.com"})
+	assert.EqualError(t, err, "email header In-Reply-To must not contain line breaks")
+	assert.False(t, IsRetryable(err))
+	assert.Empty(t, sender.messages)
+}
+
+func TestSend_InvalidInlineImage(t *testing.T) {
+	es := emailService{sender: &mockSender{}, html: true}
+	err := es.Send(Notification{
+		Email: &EmailNotification{Images: []EmailImage{{Name: "logo.png", Data: "not base64!"}}},
+	}, Destination{Recipient: "test@email.com"})
+	assert.Error(t, err)
+}
+
+type mockSMTPConnection struct {
+	sent   int
+	closed bool
+	err    error
+	// dataErr fails the delivery after the content of the message was written
+	dataErr error
+}
+
+func (c *mockSMTPConnection) Send(_ string, _ []string, msg io.WriterTo) error {
+	c.sent++
+	if c.err != nil {
+		return c.err
+	}
+	if c.dataErr != nil {
+		_, _ = msg.WriteTo(io.Discard)
+		return c.dataErr
+	}
+	return nil
+}
+
+func (c *mockSMTPConnection) Close() error {
+	c.closed = true
+	return nil
+}
+
+type mockSMTPDialer struct {
+	connections []*mockSMTPConnection
+}
+
+func (d *mockSMTPDialer) Dial() (gomail.SendCloser, error) {
+	conn := &mockSMTPConnection{}
+	d.connections = append(d.connections, conn)
+	return conn, nil
+}
+
+func newTestMessage() *gomail.Message {
+	msg := gomail.NewMessage()
+	msg.SetHeader("From", "from@email.com")
+	msg.SetHeader("To", "to@email.com")
+	return msg
+}
+
+func TestSMTPPool_ReusesConnection(t *testing.T) {
+	dialer := &mockSMTPDialer{}
+	pool := newSMTPPool(dialer, 1, time.Minute)
+
+	assert.NoError(t, pool.Send(newTestMessage()))
+	assert.NoError(t, pool.Send(newTestMessage()))
+
+	assert.Len(t, dialer.connections, 1)
+	assert.Equal(t, 2, dialer.connections[0].sent)
+	assert.False(t, dialer.connections[0].closed)
+}
+
+func TestSMTPPool_PoolingDisabled(t *testing.T) {
+	dialer := &mockSMTPDialer{}
+	pool := newSMTPPool(dialer, 0, time.Minute)
+
+	assert.NoError(t, pool.Send(newTestMessage()))
+	assert.NoError(t, pool.Send(newTestMessage()))
+
+	assert.Len(t, dialer.connections, 2)
+	assert.True(t, dialer.connections[0].closed)
+	assert.True(t, dialer.connections[1].closed)
+}
+
+func TestSMTPPool_ExpiredConnection(t *testing.T) {
+	dialer := &mockSMTPDialer{}
+	pool := newSMTPPool(dialer, 1, time.Minute)
+
+	assert.NoError(t, pool.Send(newTestMessage()))
+	pool.idle[0].lastUsed = time.Now().Add(-2 * time.Minute)
+	assert.NoError(t, pool.Send(newTestMessage()))
+
+	assert.Len(t, dialer.connections, 2)
+	assert.True(t, dialer.connections[0].closed)
+}
+
+func TestSMTPPool_RetriesBrokenConnection(t *testing.T) {
+	dialer := &mockSMTPDialer{}
+	pool := newSMTPPool(dialer, 1, time.Minute)
+
+	assert.NoError(t, pool.Send(newTestMessage()))
+	dialer.connections[0].err = errors.New("connection reset")
+	assert.NoError(t, pool.Send(newTestMessage()))
+
+	assert.Len(t, dialer.connections, 2)
+	assert.True(t, dialer.connections[0].closed)
+	assert.Equal(t, 1, dialer.connections[1].sent)
+}
+
+func TestSMTPPool_DoesNotRetryAfterData(t *testing.T) {
+	dialer := &mockSMTPDialer{}
+	pool := newSMTPPool(dialer, 1, time.Minute)
+
+	assert.NoError(t, pool.Send(newTestMessage()))
+	dialer.connections[0].dataErr = errors.New("connection reset")
+	assert.Error(t, pool.Send(newTestMessage()))
+
+	assert.Len(t, dialer.connections, 1)
+	assert.True(t, dialer.connections[0].closed)
 }
 
 func TestNewEmailService(t *testing.T) {
@@ -87,6 +320,12 @@ func TestNewEmailService(t *testing.T) {
 	if es.html != true {
 		t.Error("Html set incorrectly")
 	}
+	assert.Equal(t, rate.Inf, es.limiter.Limit())
+}
+
+func TestNewEmailService_RateLimit(t *testing.T) {
+	es := NewEmailService(EmailOptions{MaxMessagesPerMinute: 60})
+	assert.Equal(t, rate.Limit(1), es.limiter.Limit())
 }
 
 func TestParseTo(t *testing.T) {
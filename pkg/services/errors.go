@@ -0,0 +1,110 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrRateLimited matches the errors of notifications rejected because the service rate limit was exceeded
+	ErrRateLimited = errors.New("rate limited")
+	// ErrPermanent matches the errors of notifications that cannot be delivered by sending them again
+	ErrPermanent = errors.New("permanent failure")
+	// ErrAuth matches the errors of notifications rejected because the service credentials are invalid
+	ErrAuth = errors.New("authentication failed")
+)
+
+// RateLimitedError is returned if the service rejected the notification because its rate limit was exceeded
+type RateLimitedError struct {
+	// RetryAfter is the time after which the service accepts notifications again, zero if the service did not tell
+	RetryAfter time.Time
+	Err        error
+}
+
+func (e *RateLimitedError) Error() string {
+	if e.RetryAfter.IsZero() {
+		return fmt.Sprintf("rate limited: %v", e.Err)
+	}
+	return fmt.Sprintf("rate limited until %s: %v", e.RetryAfter.Format(time.RFC3339), e.Err)
+}
+
+func (e *RateLimitedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RateLimitedError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// PermanentError is returned if the service rejected the notification, e.g. because the payload or the recipient is invalid
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+func (e *PermanentError) Is(target error) bool {
+	return target == ErrPermanent
+}
+
+// AuthError is returned if the service rejected the credentials. Authentication errors are permanent
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+func (e *AuthError) Is(target error) bool {
+	return target == ErrAuth || target == ErrPermanent
+}
+
+// IsRetryable returns false if sending the notification again cannot succeed without changing the configuration
+func IsRetryable(err error) bool {
+	return err != nil && !errors.Is(err, ErrPermanent)
+}
+
+// NewHTTPError classifies the error of the request that failed with the given response. Server errors, request
+// timeouts and conflicts are returned as is, rate limited, unauthorized and other client errors are wrapped
+func NewHTTPError(response *http.Response, err error) error {
+	switch code := response.StatusCode; {
+	case code == http.StatusTooManyRequests:
+		return &RateLimitedError{RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")), Err: err}
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return &AuthError{Err: err}
+	case code == http.StatusRequestTimeout || code == http.StatusConflict:
+		return err
+	case code >= 400 && code < 500:
+		return &PermanentError{Err: err}
+	default:
+		return err
+	}
+}
+
+// parseRetryAfter parses the value of the Retry-After header, which is either the number of seconds or an HTTP date
+func parseRetryAfter(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date
+	}
+	return time.Time{}
+}
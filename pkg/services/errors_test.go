@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHTTPError(t *testing.T) {
+	cause := errors.New("request failed")
+	newResponse := func(code int, retryAfter string) *http.Response {
+		header := http.Header{}
+		if retryAfter != "" {
+			header.Set("Retry-After", retryAfter)
+		}
+		return &http.Response{StatusCode: code, Header: header}
+	}
+
+	err := NewHTTPError(newResponse(http.StatusTooManyRequests, "30"), cause)
+	var rateLimitedErr *RateLimitedError
+	if assert.ErrorAs(t, err, &rateLimitedErr) {
+		assert.WithinDuration(t, time.Now().Add(30*time.Second), rateLimitedErr.RetryAfter, time.Second)
+	}
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.ErrorIs(t, err, cause)
+	assert.True(t, IsRetryable(err))
+
+	retryAfter := time.Now().Add(time.Minute).UTC().Truncate(time.Second)
+	err = NewHTTPError(newResponse(http.StatusTooManyRequests, retryAfter.Format(http.TimeFormat)), cause)
+	if assert.ErrorAs(t, err, &rateLimitedErr) {
+		assert.Equal(t, retryAfter, rateLimitedErr.RetryAfter)
+	}
+
+	err = NewHTTPError(newResponse(http.StatusUnauthorized, ""), cause)
+	assert.ErrorIs(t, err, ErrAuth)
+	assert.ErrorIs(t, err, ErrPermanent)
+	assert.False(t, IsRetryable(err))
+
+	err = NewHTTPError(newResponse(http.StatusBadRequest, ""), cause)
+	assert.ErrorIs(t, err, ErrPermanent)
+	assert.NotErrorIs(t, err, ErrAuth)
+	assert.False(t, IsRetryable(err))
+	assert.EqualError(t, err, "request failed")
+
+	for _, code := range []int{http.StatusRequestTimeout, http.StatusConflict, http.StatusInternalServerError, http.StatusBadGateway} {
+		err = NewHTTPError(newResponse(code, ""), cause)
+		assert.Equal(t, cause, err)
+		assert.True(t, IsRetryable(err))
+	}
+}
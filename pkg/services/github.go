@@ -3,11 +3,14 @@ package services
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	texttemplate "text/template"
+	"time"
 	"unicode/utf8"
 
 	"github.com/bradleyfalzon/ghinstallation/v2"
@@ -29,6 +32,7 @@ type GitHubOptions struct {
 	InstallationID    interface{} `json:"installationID"`
 	PrivateKey        string      `json:"privateKey"`
 	EnterpriseBaseURL string      `json:"enterpriseBaseURL"`
+	Proxy             string      `json:"proxy"`
 }
 
 type GitHubNotification struct {
@@ -37,6 +41,8 @@ type GitHubNotification struct {
 	Status             *GitHubStatus             `json:"status,omitempty"`
 	Deployment         *GitHubDeployment         `json:"deployment,omitempty"`
 	PullRequestComment *GitHubPullRequestComment `json:"pullRequestComment,omitempty"`
+	CheckRun           *GitHubCheckRun           `json:"checkRun,omitempty"`
+	RepositoryDispatch *GitHubRepositoryDispatch `json:"repositoryDispatch,omitempty"`
 	RepoURLPath        string                    `json:"repoURLPath,omitempty"`
 	RevisionPath       string                    `json:"revisionPath,omitempty"`
 }
@@ -54,12 +60,60 @@ type GitHubDeployment struct {
 	LogURL           string   `json:"logURL,omitempty"`
 	RequiredContexts []string `json:"requiredContexts"`
 	AutoMerge        *bool    `json:"autoMerge,omitempty"`
+	// TransientEnvironment marks environments that are destroyed later, e.g. preview environments
+	TransientEnvironment  *bool `json:"transientEnvironment,omitempty"`
+	ProductionEnvironment *bool `json:"productionEnvironment,omitempty"`
+	// AutoInactive marks the previous successful deployments to the environment inactive. GitHub defaults to true
+	AutoInactive *bool `json:"autoInactive,omitempty"`
 }
 
 type GitHubPullRequestComment struct {
 	Content string `json:"content,omitempty"`
+	// Identifier makes the comment sticky: comments are identified by a hidden marker with the identifier and
+	// updated in place by later notifications with the same identifier
+	Identifier string `json:"identifier,omitempty"`
+	// CommitComment comments the revision if no pull request contains it
+	CommitComment bool `json:"commitComment,omitempty"`
+}
+
+// GitHubCheckRun is a check run of the revision. Notifications with the same check run name update the same check run
+type GitHubCheckRun struct {
+	Name       string `json:"name,omitempty"`
+	DetailsURL string `json:"detailsURL,omitempty"`
+	ExternalID string `json:"externalID,omitempty"`
+	// Status is one of queued, in_progress or completed. The check run is completed if the conclusion is set
+	Status string `json:"status,omitempty"`
+	// Conclusion is one of action_required, cancelled, failure, neutral, success, skipped or timed_out
+	Conclusion string `json:"conclusion,omitempty"`
+	// Title defaults to the check run name
+	Title string `json:"title,omitempty"`
+	// Summary is markdown and defaults to the notification message
+	Summary string `json:"summary,omitempty"`
+	Text    string `json:"text,omitempty"`
+	// Annotations is the JSON array of the check run annotations in the format of the GitHub API
+	Annotations string `json:"annotations,omitempty"`
+}
+
+// GitHubRepositoryDispatch is a repository_dispatch event, which triggers the GitHub Actions workflows listening to its event type
+type GitHubRepositoryDispatch struct {
+	EventType string `json:"eventType,omitempty"`
+	// ClientPayload is the JSON object passed to the workflows as github.event.client_payload
+	ClientPayload string `json:"clientPayload,omitempty"`
+	// Repository is the owner/name of the repository receiving the event. Defaults to the repository of the repo URL
+	Repository string `json:"repository,omitempty"`
 }
 
+const (
+	// gitHubCheckRunStateKeyPrefix prefixes the notification state keys holding the revision and the ID of
+	// the check run with the given name, e.g. githubCheckRun.argocd = <sha>/<id>
+	gitHubCheckRunStateKeyPrefix = "githubCheckRun."
+	// gitHubDeploymentStateKeyPrefix prefixes the notification state keys holding the revision and the ID of
+	// the deployment to the given environment
+	gitHubDeploymentStateKeyPrefix = "githubDeployment."
+	// gitHubMaxCheckRunAnnotations is the number of annotations GitHub accepts per request
+	gitHubMaxCheckRunAnnotations = 50
+)
+
 const (
 	repoURLtemplate  = "{{.app.spec.source.repoURL}}"
 	revisionTemplate = "{{.app.status.operationState.syncResult.revision}}"
@@ -124,12 +178,59 @@ func (g *GitHubNotification) GetTemplater(name string, f texttemplate.FuncMap) (
 		}
 	}
 
-	var pullRequestCommentContent *texttemplate.Template
+	var pullRequestCommentContent, pullRequestCommentIdentifier *texttemplate.Template
 	if g.PullRequestComment != nil {
 		pullRequestCommentContent, err = texttemplate.New(name).Funcs(f).Parse(g.PullRequestComment.Content)
 		if err != nil {
 			return nil, err
 		}
+
+		pullRequestCommentIdentifier, err = texttemplate.New(name).Funcs(f).Parse(g.PullRequestComment.Identifier)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var checkRunTemplates map[string]*texttemplate.Template
+	if g.CheckRun != nil {
+		if g.CheckRun.Name == "" {
+			return nil, fmt.Errorf("github.checkRun.name is required")
+		}
+		checkRunTemplates = map[string]*texttemplate.Template{}
+		for field, value := range map[string]string{
+			"name":        g.CheckRun.Name,
+			"detailsURL":  g.CheckRun.DetailsURL,
+			"externalID":  g.CheckRun.ExternalID,
+			"status":      g.CheckRun.Status,
+			"conclusion":  g.CheckRun.Conclusion,
+			"title":       g.CheckRun.Title,
+			"summary":     g.CheckRun.Summary,
+			"text":        g.CheckRun.Text,
+			"annotations": g.CheckRun.Annotations,
+		} {
+			checkRunTemplates[field], err = texttemplate.New(name).Funcs(f).Parse(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var dispatchEventType, dispatchClientPayload, dispatchRepository *texttemplate.Template
+	if g.RepositoryDispatch != nil {
+		dispatchEventType, err = texttemplate.New(name).Funcs(f).Parse(g.RepositoryDispatch.EventType)
+		if err != nil {
+			return nil, err
+		}
+
+		dispatchClientPayload, err = texttemplate.New(name).Funcs(f).Parse(g.RepositoryDispatch.ClientPayload)
+		if err != nil {
+			return nil, err
+		}
+
+		dispatchRepository, err = texttemplate.New(name).Funcs(f).Parse(g.RepositoryDispatch.Repository)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return func(notification *Notification, vars map[string]interface{}) error {
@@ -212,6 +313,9 @@ func (g *GitHubNotification) GetTemplater(name string, f texttemplate.FuncMap) (
 				notification.GitHub.Deployment.AutoMerge = g.Deployment.AutoMerge
 			}
 			notification.GitHub.Deployment.RequiredContexts = g.Deployment.RequiredContexts
+			notification.GitHub.Deployment.TransientEnvironment = g.Deployment.TransientEnvironment
+			notification.GitHub.Deployment.ProductionEnvironment = g.Deployment.ProductionEnvironment
+			notification.GitHub.Deployment.AutoInactive = g.Deployment.AutoInactive
 		}
 
 		if g.PullRequestComment != nil {
@@ -224,6 +328,61 @@ func (g *GitHubNotification) GetTemplater(name string, f texttemplate.FuncMap) (
 				return err
 			}
 			notification.GitHub.PullRequestComment.Content = contentData.String()
+
+			var identifierData bytes.Buffer
+			if err := pullRequestCommentIdentifier.Execute(&identifierData, vars); err != nil {
+				return err
+			}
+			notification.GitHub.PullRequestComment.Identifier = identifierData.String()
+			notification.GitHub.PullRequestComment.CommitComment = g.PullRequestComment.CommitComment
+		}
+
+		if g.RepositoryDispatch != nil {
+			if notification.GitHub.RepositoryDispatch == nil {
+				notification.GitHub.RepositoryDispatch = &GitHubRepositoryDispatch{}
+			}
+
+			var eventTypeData bytes.Buffer
+			if err := dispatchEventType.Execute(&eventTypeData, vars); err != nil {
+				return err
+			}
+			notification.GitHub.RepositoryDispatch.EventType = eventTypeData.String()
+
+			var clientPayloadData bytes.Buffer
+			if err := dispatchClientPayload.Execute(&clientPayloadData, vars); err != nil {
+				return err
+			}
+			notification.GitHub.RepositoryDispatch.ClientPayload = clientPayloadData.String()
+
+			var repositoryData bytes.Buffer
+			if err := dispatchRepository.Execute(&repositoryData, vars); err != nil {
+				return err
+			}
+			notification.GitHub.RepositoryDispatch.Repository = repositoryData.String()
+		}
+
+		if g.CheckRun != nil {
+			if notification.GitHub.CheckRun == nil {
+				notification.GitHub.CheckRun = &GitHubCheckRun{}
+			}
+			checkRun := notification.GitHub.CheckRun
+			for field, value := range map[string]*string{
+				"name":        &checkRun.Name,
+				"detailsURL":  &checkRun.DetailsURL,
+				"externalID":  &checkRun.ExternalID,
+				"status":      &checkRun.Status,
+				"conclusion":  &checkRun.Conclusion,
+				"title":       &checkRun.Title,
+				"summary":     &checkRun.Summary,
+				"text":        &checkRun.Text,
+				"annotations": &checkRun.Annotations,
+			} {
+				var data bytes.Buffer
+				if err := checkRunTemplates[field].Execute(&data, vars); err != nil {
+					return err
+				}
+				*value = data.String()
+			}
 		}
 
 		return nil
@@ -246,8 +405,11 @@ func NewGitHubService(opts GitHubOptions) (NotificationService, error) {
 		return nil, err
 	}
 
-	tr := httputil.NewLoggingRoundTripper(
-		httputil.NewTransport(url, false), log.WithField("service", "github"))
+	transport := httputil.NewTransport(url, false)
+	if err := httputil.WithProxy(transport, opts.Proxy); err != nil {
+		return nil, err
+	}
+	tr := httputil.NewLoggingRoundTripper(transport, log.WithField("service", "github"))
 	itr, err := ghinstallation.New(tr, appID, installationID, []byte(opts.PrivateKey))
 	if err != nil {
 		return nil, err
@@ -297,7 +459,13 @@ func fullNameByRepoURL(rawURL string) string {
 	return path
 }
 
-func (g gitHubService) Send(notification Notification, _ Destination) error {
+func (g gitHubService) Send(notification Notification, dest Destination) error {
+	return g.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+// SendWithContext records the IDs of created check runs in the state, so that later notifications update the check run
+// of the same revision instead of creating a new one
+func (g gitHubService) SendWithContext(ctx context.Context, notification Notification, _ Destination, state State) error {
 	if notification.GitHub == nil {
 		return fmt.Errorf("config is empty")
 	}
@@ -310,7 +478,7 @@ func (g gitHubService) Send(notification Notification, _ Destination) error {
 		// maximum is 140 characters
 		description := trunc(notification.Message, 140)
 		_, _, err := g.client.Repositories.CreateStatus(
-			context.Background(),
+			ctx,
 			u[0],
 			u[1],
 			notification.GitHub.revision,
@@ -329,31 +497,42 @@ func (g gitHubService) Send(notification Notification, _ Destination) error {
 	if notification.GitHub.Deployment != nil {
 		// maximum is 140 characters
 		description := trunc(notification.Message, 140)
-		deployment, _, err := g.client.Repositories.CreateDeployment(
-			context.Background(),
-			u[0],
-			u[1],
-			&github.DeploymentRequest{
-				Ref:              &notification.GitHub.revision,
-				Environment:      &notification.GitHub.Deployment.Environment,
-				RequiredContexts: &notification.GitHub.Deployment.RequiredContexts,
-				AutoMerge:        notification.GitHub.Deployment.AutoMerge,
-			},
-		)
-		if err != nil {
-			return err
+		// statuses of the same revision and environment are posted to the same deployment
+		stateKey := gitHubDeploymentStateKeyPrefix + notification.GitHub.Deployment.Environment
+		deploymentID := gitHubStateID(state, stateKey, notification.GitHub.revision)
+		if deploymentID == 0 {
+			deployment, _, err := g.client.Repositories.CreateDeployment(
+				ctx,
+				u[0],
+				u[1],
+				&github.DeploymentRequest{
+					Ref:                   &notification.GitHub.revision,
+					Environment:           &notification.GitHub.Deployment.Environment,
+					RequiredContexts:      &notification.GitHub.Deployment.RequiredContexts,
+					AutoMerge:             notification.GitHub.Deployment.AutoMerge,
+					TransientEnvironment:  notification.GitHub.Deployment.TransientEnvironment,
+					ProductionEnvironment: notification.GitHub.Deployment.ProductionEnvironment,
+					Description:           &description,
+				},
+			)
+			if err != nil {
+				return err
+			}
+			deploymentID = deployment.GetID()
+			setGitHubStateID(state, stateKey, notification.GitHub.revision, deploymentID)
 		}
-		_, _, err = g.client.Repositories.CreateDeploymentStatus(
-			context.Background(),
+		_, _, err := g.client.Repositories.CreateDeploymentStatus(
+			ctx,
 			u[0],
 			u[1],
-			*deployment.ID,
+			deploymentID,
 			&github.DeploymentStatusRequest{
 				State:          &notification.GitHub.Deployment.State,
 				LogURL:         &notification.GitHub.Deployment.LogURL,
 				Description:    &description,
 				Environment:    &notification.GitHub.Deployment.Environment,
 				EnvironmentURL: &notification.GitHub.Deployment.EnvironmentURL,
+				AutoInactive:   notification.GitHub.Deployment.AutoInactive,
 			},
 		)
 		if err != nil {
@@ -361,15 +540,28 @@ func (g gitHubService) Send(notification Notification, _ Destination) error {
 		}
 	}
 
+	if notification.GitHub.CheckRun != nil {
+		if err := g.sendCheckRun(ctx, u[0], u[1], notification, state); err != nil {
+			return err
+		}
+	}
+
+	if notification.GitHub.RepositoryDispatch != nil {
+		if err := g.sendRepositoryDispatch(ctx, u[0], u[1], notification.GitHub.RepositoryDispatch); err != nil {
+			return err
+		}
+	}
+
 	if notification.GitHub.PullRequestComment != nil {
-		// maximum is 65536 characters
-		body := trunc(notification.GitHub.PullRequestComment.Content, 65536)
-		comment := &github.IssueComment{
-			Body: &body,
+		marker := ""
+		if notification.GitHub.PullRequestComment.Identifier != "" {
+			marker = gitHubCommentMarker(notification.GitHub.PullRequestComment.Identifier)
 		}
+		// maximum is 65536 characters
+		body := trunc(notification.GitHub.PullRequestComment.Content, 65536-utf8.RuneCountInString(marker)) + marker
 
 		prs, _, err := g.client.PullRequests.ListPullRequestsWithCommit(
-			context.Background(),
+			ctx,
 			u[0],
 			u[1],
 			notification.GitHub.revision,
@@ -380,18 +572,188 @@ func (g gitHubService) Send(notification Notification, _ Destination) error {
 		}
 
 		for _, pr := range prs {
-			_, _, err = g.client.Issues.CreateComment(
-				context.Background(),
-				u[0],
-				u[1],
-				pr.GetNumber(),
-				comment,
-			)
+			if err := g.commentPullRequest(ctx, u[0], u[1], pr.GetNumber(), body, marker); err != nil {
+				return err
+			}
+		}
+
+		if len(prs) == 0 && notification.GitHub.PullRequestComment.CommitComment {
+			if err := g.commentCommit(ctx, u[0], u[1], notification.GitHub.revision, body, marker); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// gitHubCommentMarker returns the hidden marker identifying sticky comments
+func gitHubCommentMarker(identifier string) string {
+	return fmt.Sprintf("\n<!-- notifications-engine: %s -->", identifier)
+}
+
+// commentPullRequest comments the pull request. Sticky comments, which have a marker, update the existing comment with the same marker
+func (g gitHubService) commentPullRequest(ctx context.Context, owner string, repo string, number int, body string, marker string) error {
+	if marker != "" {
+		opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			comments, response, err := g.client.Issues.ListComments(ctx, owner, repo, number, opts)
 			if err != nil {
 				return err
 			}
+			for _, comment := range comments {
+				if strings.Contains(comment.GetBody(), marker) {
+					_, _, err := g.client.Issues.EditComment(ctx, owner, repo, comment.GetID(), &github.IssueComment{Body: &body})
+					return err
+				}
+			}
+			if response.NextPage == 0 {
+				break
+			}
+			opts.Page = response.NextPage
 		}
 	}
+	_, _, err := g.client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: &body})
+	return err
+}
+
+// commentCommit comments the commit, updating the existing comment with the same marker for sticky comments
+func (g gitHubService) commentCommit(ctx context.Context, owner string, repo string, sha string, body string, marker string) error {
+	if marker != "" {
+		opts := &github.ListOptions{PerPage: 100}
+		for {
+			comments, response, err := g.client.Repositories.ListCommitComments(ctx, owner, repo, sha, opts)
+			if err != nil {
+				return err
+			}
+			for _, comment := range comments {
+				if strings.Contains(comment.GetBody(), marker) {
+					_, _, err := g.client.Repositories.UpdateComment(ctx, owner, repo, comment.GetID(), &github.RepositoryComment{Body: &body})
+					return err
+				}
+			}
+			if response.NextPage == 0 {
+				break
+			}
+			opts.Page = response.NextPage
+		}
+	}
+	_, _, err := g.client.Repositories.CreateComment(ctx, owner, repo, sha, &github.RepositoryComment{Body: &body})
+	return err
+}
 
+func (g gitHubService) sendRepositoryDispatch(ctx context.Context, owner string, repo string, dispatch *GitHubRepositoryDispatch) error {
+	if dispatch.EventType == "" {
+		return fmt.Errorf("github repository dispatch event type is required")
+	}
+	if dispatch.Repository != "" {
+		parts := strings.Split(dispatch.Repository, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("github repository dispatch repository (%s) must have the owner/name format", dispatch.Repository)
+		}
+		owner, repo = parts[0], parts[1]
+	}
+	opts := github.DispatchRequestOptions{EventType: dispatch.EventType}
+	if dispatch.ClientPayload != "" {
+		payload := json.RawMessage(dispatch.ClientPayload)
+		var object map[string]interface{}
+		if err := json.Unmarshal(payload, &object); err != nil {
+			return fmt.Errorf("github repository dispatch client payload must be a JSON object: %w", err)
+		}
+		opts.ClientPayload = &payload
+	}
+	_, _, err := g.client.Repositories.Dispatch(ctx, owner, repo, opts)
+	return err
+}
+
+// gitHubStateID returns the ID stored in the state with the given key if it was recorded for the same revision, otherwise 0
+func gitHubStateID(state State, key string, revision string) int64 {
+	storedRevision, storedID, ok := strings.Cut(state[key], "/")
+	if !ok || storedRevision != revision {
+		return 0
+	}
+	id, _ := strconv.ParseInt(storedID, 10, 64)
+	return id
+}
+
+func setGitHubStateID(state State, key string, revision string, id int64) {
+	state[key] = fmt.Sprintf("%s/%d", revision, id)
+}
+
+func (g gitHubService) sendCheckRun(ctx context.Context, owner string, repo string, notification Notification, state State) error {
+	checkRun := notification.GitHub.CheckRun
+	var annotations []*github.CheckRunAnnotation
+	if checkRun.Annotations != "" {
+		if err := json.Unmarshal([]byte(checkRun.Annotations), &annotations); err != nil {
+			return fmt.Errorf("failed to parse github check run annotations: %w", err)
+		}
+	}
+
+	output := &github.CheckRunOutput{
+		Title:   github.String(text.Coalesce(checkRun.Title, checkRun.Name)),
+		Summary: github.String(text.Coalesce(checkRun.Summary, notification.Message)),
+	}
+	if checkRun.Text != "" {
+		output.Text = &checkRun.Text
+	}
+	if len(annotations) > gitHubMaxCheckRunAnnotations {
+		output.Annotations = annotations[:gitHubMaxCheckRunAnnotations]
+		annotations = annotations[gitHubMaxCheckRunAnnotations:]
+	} else {
+		output.Annotations = annotations
+		annotations = nil
+	}
+
+	update := github.UpdateCheckRunOptions{Name: checkRun.Name, Output: output}
+	if checkRun.DetailsURL != "" {
+		update.DetailsURL = &checkRun.DetailsURL
+	}
+	if checkRun.ExternalID != "" {
+		update.ExternalID = &checkRun.ExternalID
+	}
+	if checkRun.Status != "" {
+		update.Status = &checkRun.Status
+	}
+	if checkRun.Conclusion != "" {
+		update.Conclusion = &checkRun.Conclusion
+		update.CompletedAt = &github.Timestamp{Time: time.Now()}
+	}
+
+	stateKey := gitHubCheckRunStateKeyPrefix + checkRun.Name
+	id := gitHubStateID(state, stateKey, notification.GitHub.revision)
+	if id == 0 {
+		created, _, err := g.client.Checks.CreateCheckRun(ctx, owner, repo, github.CreateCheckRunOptions{
+			Name:        update.Name,
+			HeadSHA:     notification.GitHub.revision,
+			DetailsURL:  update.DetailsURL,
+			ExternalID:  update.ExternalID,
+			Status:      update.Status,
+			Conclusion:  update.Conclusion,
+			CompletedAt: update.CompletedAt,
+			Output:      update.Output,
+		})
+		if err != nil {
+			return err
+		}
+		id = created.GetID()
+		setGitHubStateID(state, stateKey, notification.GitHub.revision, id)
+	} else if _, _, err := g.client.Checks.UpdateCheckRun(ctx, owner, repo, id, update); err != nil {
+		return err
+	}
+
+	// remaining annotations are added in batches, GitHub appends the annotations of every update
+	for len(annotations) > 0 {
+		batch := annotations
+		if len(batch) > gitHubMaxCheckRunAnnotations {
+			batch = batch[:gitHubMaxCheckRunAnnotations]
+		}
+		annotations = annotations[len(batch):]
+		if _, _, err := g.client.Checks.UpdateCheckRun(ctx, owner, repo, id, github.UpdateCheckRunOptions{
+			Name:   checkRun.Name,
+			Output: &github.CheckRunOutput{Title: output.Title, Summary: output.Summary, Annotations: batch},
+		}); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -1,9 +1,15 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 	"text/template"
 
+	"github.com/google/go-github/v41/github"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -256,3 +262,226 @@ func TestGetTemplater_Github_PullRequestComment(t *testing.T) {
 	assert.Equal(t, "0123456789", notification.GitHub.revision)
 	assert.Equal(t, "This is a comment", notification.GitHub.PullRequestComment.Content)
 }
+
+func newTestGitHubService(t *testing.T, handler http.HandlerFunc) *gitHubService {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	client.BaseURL = baseURL
+	return &gitHubService{client: client}
+}
+
+func TestSend_GitHubService_CheckRun(t *testing.T) {
+	var requests []string
+	var bodies []map[string]interface{}
+	service := newTestGitHubService(t, func(writer http.ResponseWriter, request *http.Request) {
+		requests = append(requests, request.Method+" "+request.URL.Path)
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(request.Body).Decode(&body))
+		bodies = append(bodies, body)
+		_, _ = writer.Write([]byte(`{"id": 42}`))
+	})
+
+	n := Notification{
+		Message: "Application guestbook is syncing",
+		GitHub: &GitHubNotification{
+			RepoURLPath:  "{{.repo}}",
+			RevisionPath: "{{.revision}}",
+			CheckRun: &GitHubCheckRun{
+				Name:        "argocd/{{.app}}",
+				Status:      "{{.status}}",
+				Conclusion:  "{{.conclusion}}",
+				Annotations: `{{if .conclusion}}[{"path": "guestbook.yaml", "start_line": 1, "end_line": 1, "annotation_level": "failure", "message": "invalid"}]{{end}}`,
+			},
+		},
+	}
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	vars := map[string]interface{}{
+		"repo":     "https://github.com/argoproj/argo-cd.git",
+		"revision": "abc123",
+		"app":      "guestbook",
+		"status":   "in_progress",
+	}
+	var notification Notification
+	assert.NoError(t, templater(&notification, vars))
+	notification.Message = n.Message
+
+	state := State{}
+	assert.NoError(t, service.SendWithContext(context.Background(), notification, Destination{}, state))
+	assert.Equal(t, State{"githubCheckRun.argocd/guestbook": "abc123/42"}, state)
+
+	vars["status"] = ""
+	vars["conclusion"] = "failure"
+	notification = Notification{Message: "Application guestbook failed to sync"}
+	assert.NoError(t, templater(&notification, vars))
+	assert.NoError(t, service.SendWithContext(context.Background(), notification, Destination{}, state))
+
+	assert.Equal(t, []string{"POST /repos/argoproj/argo-cd/check-runs", "PATCH /repos/argoproj/argo-cd/check-runs/42"}, requests)
+	assert.Equal(t, "abc123", bodies[0]["head_sha"])
+	assert.Equal(t, "in_progress", bodies[0]["status"])
+	assert.Equal(t, map[string]interface{}{"title": "argocd/guestbook", "summary": "Application guestbook is syncing"}, bodies[0]["output"])
+	assert.Equal(t, "failure", bodies[1]["conclusion"])
+	assert.NotEmpty(t, bodies[1]["completed_at"])
+	assert.Len(t, bodies[1]["output"].(map[string]interface{})["annotations"], 1)
+}
+
+func TestGetTemplater_GitHub_CheckRunWithoutName(t *testing.T) {
+	_, err := (&GitHubNotification{CheckRun: &GitHubCheckRun{Status: "queued"}}).GetTemplater("", template.FuncMap{})
+	assert.EqualError(t, err, "github.checkRun.name is required")
+}
+
+func TestSend_GitHubService_DeploymentStatus(t *testing.T) {
+	var requests []string
+	var bodies []map[string]interface{}
+	service := newTestGitHubService(t, func(writer http.ResponseWriter, request *http.Request) {
+		requests = append(requests, request.Method+" "+request.URL.Path)
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(request.Body).Decode(&body))
+		bodies = append(bodies, body)
+		writer.WriteHeader(http.StatusCreated)
+		_, _ = writer.Write([]byte(`{"id": 7}`))
+	})
+
+	transient := true
+	n := func(state string) Notification {
+		return Notification{
+			Message: "Application guestbook is " + state,
+			GitHub: &GitHubNotification{
+				repoURL:  "https://github.com/argoproj/argo-cd.git",
+				revision: "abc123",
+				Deployment: &GitHubDeployment{
+					State:                state,
+					Environment:          "preview",
+					LogURL:               "https://argocd.example.com/applications/guestbook",
+					TransientEnvironment: &transient,
+				},
+			},
+		}
+	}
+
+	state := State{}
+	assert.NoError(t, service.SendWithContext(context.Background(), n("in_progress"), Destination{}, state))
+	assert.Equal(t, State{"githubDeployment.preview": "abc123/7"}, state)
+	assert.NoError(t, service.SendWithContext(context.Background(), n("success"), Destination{}, state))
+
+	assert.Equal(t, []string{
+		"POST /repos/argoproj/argo-cd/deployments",
+		"POST /repos/argoproj/argo-cd/deployments/7/statuses",
+		"POST /repos/argoproj/argo-cd/deployments/7/statuses",
+	}, requests)
+	assert.Equal(t, true, bodies[0]["transient_environment"])
+	assert.Equal(t, "in_progress", bodies[1]["state"])
+	assert.Equal(t, "success", bodies[2]["state"])
+	assert.Equal(t, "https://argocd.example.com/applications/guestbook", bodies[2]["log_url"])
+}
+
+func TestSend_GitHubService_StickyPullRequestComment(t *testing.T) {
+	var requests []string
+	var edited map[string]interface{}
+	service := newTestGitHubService(t, func(writer http.ResponseWriter, request *http.Request) {
+		requests = append(requests, request.Method+" "+request.URL.Path)
+		switch request.URL.Path {
+		case "/repos/argoproj/argo-cd/commits/abc123/pulls":
+			_, _ = writer.Write([]byte(`[{"number": 1}]`))
+		case "/repos/argoproj/argo-cd/issues/1/comments":
+			_, _ = writer.Write([]byte(`[
+				{"id": 10, "body": "unrelated"},
+				{"id": 11, "body": "old status\n<!-- notifications-engine: guestbook -->"}
+			]`))
+		default:
+			assert.NoError(t, json.NewDecoder(request.Body).Decode(&edited))
+			_, _ = writer.Write([]byte(`{"id": 11}`))
+		}
+	})
+
+	err := service.Send(Notification{
+		GitHub: &GitHubNotification{
+			repoURL:            "https://github.com/argoproj/argo-cd.git",
+			revision:           "abc123",
+			PullRequestComment: &GitHubPullRequestComment{Content: "new status", Identifier: "guestbook"},
+		},
+	}, Destination{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"GET /repos/argoproj/argo-cd/commits/abc123/pulls",
+		"GET /repos/argoproj/argo-cd/issues/1/comments",
+		"PATCH /repos/argoproj/argo-cd/issues/comments/11",
+	}, requests)
+	assert.Equal(t, "new status\n<!-- notifications-engine: guestbook -->", edited["body"])
+}
+
+func TestSend_GitHubService_CommitComment(t *testing.T) {
+	var requests []string
+	service := newTestGitHubService(t, func(writer http.ResponseWriter, request *http.Request) {
+		requests = append(requests, request.Method+" "+request.URL.Path)
+		if request.Method == http.MethodGet {
+			_, _ = writer.Write([]byte(`[]`))
+			return
+		}
+		writer.WriteHeader(http.StatusCreated)
+		_, _ = writer.Write([]byte(`{"id": 1}`))
+	})
+
+	err := service.Send(Notification{
+		GitHub: &GitHubNotification{
+			repoURL:            "https://github.com/argoproj/argo-cd.git",
+			revision:           "abc123",
+			PullRequestComment: &GitHubPullRequestComment{Content: "deployed", Identifier: "guestbook", CommitComment: true},
+		},
+	}, Destination{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"GET /repos/argoproj/argo-cd/commits/abc123/pulls",
+		"GET /repos/argoproj/argo-cd/commits/abc123/comments",
+		"POST /repos/argoproj/argo-cd/commits/abc123/comments",
+	}, requests)
+}
+
+func TestSend_GitHubService_RepositoryDispatch(t *testing.T) {
+	var path string
+	var body map[string]interface{}
+	service := newTestGitHubService(t, func(writer http.ResponseWriter, request *http.Request) {
+		path = request.URL.Path
+		assert.NoError(t, json.NewDecoder(request.Body).Decode(&body))
+		writer.WriteHeader(http.StatusNoContent)
+	})
+
+	n := Notification{
+		GitHub: &GitHubNotification{
+			RepoURLPath:  "{{.repo}}",
+			RevisionPath: "{{.revision}}",
+			RepositoryDispatch: &GitHubRepositoryDispatch{
+				EventType:     "argocd-{{.app}}-synced",
+				ClientPayload: `{"app": "{{.app}}", "revision": "{{.revision}}"}`,
+				Repository:    "argoproj/e2e-tests",
+			},
+		},
+	}
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var notification Notification
+	assert.NoError(t, templater(&notification, map[string]interface{}{
+		"repo":     "https://github.com/argoproj/argo-cd.git",
+		"revision": "abc123",
+		"app":      "guestbook",
+	}))
+
+	assert.NoError(t, service.Send(notification, Destination{}))
+	assert.Equal(t, "/repos/argoproj/e2e-tests/dispatches", path)
+	assert.Equal(t, map[string]interface{}{
+		"event_type":     "argocd-guestbook-synced",
+		"client_payload": map[string]interface{}{"app": "guestbook", "revision": "abc123"},
+	}, body)
+
+	notification.GitHub.RepositoryDispatch.ClientPayload = `["guestbook"]`
+	assert.ErrorContains(t, service.Send(notification, Destination{}), "github repository dispatch client payload must be a JSON object")
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -25,6 +26,9 @@ type GoogleChatNotification struct {
 	ThreadKey string `json:"threadKey,omitempty"`
 }
 
+// googleChatMessageReplyOption replies to the thread with the given key, or starts it if there is no such thread yet
+const googleChatMessageReplyOption = "REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD"
+
 type googleChatMessage struct {
 	Text    string            `json:"text"`
 	Cards   []chat.Card       `json:"cards,omitempty"`
@@ -81,6 +85,7 @@ func (n *GoogleChatNotification) GetTemplater(name string, f texttemplate.FuncMa
 
 type GoogleChatOptions struct {
 	WebhookUrls map[string]string `json:"webhooks"`
+	Proxy       string            `json:"proxy"`
 }
 
 type googleChatService struct {
@@ -107,6 +112,9 @@ func (s googleChatService) getClient(recipient string) (*googlechatClient, error
 		return nil, fmt.Errorf("no Google chat webhook configured for recipient %s", recipient)
 	}
 	transport := httputil.NewTransport(webhookUrl, false)
+	if err := httputil.WithProxy(transport, s.opts.Proxy); err != nil {
+		return nil, err
+	}
 	client := &http.Client{
 		Transport: httputil.NewLoggingRoundTripper(transport, log.WithField("service", "googlechat")),
 	}
@@ -118,7 +126,7 @@ type googlechatClient struct {
 	url        string
 }
 
-func (c *googlechatClient) sendMessage(message *googleChatMessage, threadKey string) (*webhookReturn, error) {
+func (c *googlechatClient) sendMessage(ctx context.Context, message *googleChatMessage, threadKey string) (*webhookReturn, error) {
 	jsonMessage, err := json.Marshal(message)
 	if err != nil {
 		return nil, err
@@ -131,9 +139,16 @@ func (c *googlechatClient) sendMessage(message *googleChatMessage, threadKey str
 	if threadKey != "" {
 		q := u.Query()
 		q.Add("threadKey", threadKey)
+		// without a reply option Google Chat starts a new thread for every message
+		q.Set("messageReplyOption", googleChatMessageReplyOption)
 		u.RawQuery = q.Encode()
 	}
-	response, err := c.httpClient.Post(u.String(), "application/json", bytes.NewReader(jsonMessage))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(jsonMessage))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	response, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -156,6 +171,11 @@ func (c *googlechatClient) sendMessage(message *googleChatMessage, threadKey str
 }
 
 func (s googleChatService) Send(notification Notification, dest Destination) error {
+	return s.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+// SendWithContext sends the notification using the given context
+func (s googleChatService) SendWithContext(ctx context.Context, notification Notification, dest Destination, _ State) error {
 	client, err := s.getClient(dest.Recipient)
 	if err != nil {
 		return fmt.Errorf("error creating client to webhook: %w", err)
@@ -170,7 +190,7 @@ func (s googleChatService) Send(notification Notification, dest Destination) err
 		threadKey = notification.GoogleChat.ThreadKey
 	}
 
-	body, err := client.sendMessage(message, threadKey)
+	body, err := client.sendMessage(ctx, message, threadKey)
 	if err != nil {
 		return fmt.Errorf("cannot send message: %w", err)
 	}
@@ -194,10 +214,10 @@ func googleChatNotificationToMessage(n Notification) (*googleChatMessage, error)
 
 			message.CardsV2 = make([]chat.CardWithId, len(cardData))
 
-			for i, datum := range cardData {
+			for i := range cardData {
 				message.CardsV2[i] = chat.CardWithId{
 					CardId: uuid.New().String(),
-					Card:   &datum,
+					Card:   &cardData[i],
 				}
 			}
 		}
@@ -296,6 +296,7 @@ func TestSendMessage_NoError(t *testing.T) {
 			t.Fatal("error on parse form")
 		}
 		assert.False(t, req.Form.Has("threadKey"), "threadKey query param should not be set")
+		assert.False(t, req.Form.Has("messageReplyOption"), "messageReplyOption query param should not be set")
 
 		res.WriteHeader(http.StatusOK)
 		_, err := res.Write([]byte("{}"))
@@ -323,6 +324,7 @@ func TestSendMessageWithThreadKey_NoError(t *testing.T) {
 			t.Fatal("error on parse form")
 		}
 		assert.Equal(t, "testThreadKey", req.Form.Get("threadKey"), "threadKey query param should be set")
+		assert.Equal(t, "REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD", req.Form.Get("messageReplyOption"))
 
 		res.WriteHeader(http.StatusOK)
 		_, err := res.Write([]byte("{}"))
@@ -340,3 +342,33 @@ func TestSendMessageWithThreadKey_NoError(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, called)
 }
+
+func TestMultipleCardsV2Message_GoogleChat(t *testing.T) {
+	message, err := googleChatNotificationToMessage(Notification{
+		GoogleChat: &GoogleChatNotification{
+			CardsV2: `
+- header:
+    title: Sync succeeded
+- header:
+    title: Health
+  sections:
+    - widgets:
+        - buttonList:
+            buttons:
+              - text: Open
+                onClick:
+                  openLink:
+                    url: https://argocd.example.com`,
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if assert.Len(t, message.CardsV2, 2) {
+		assert.Equal(t, "Sync succeeded", message.CardsV2[0].Card.Header.Title)
+		assert.Equal(t, "Health", message.CardsV2[1].Card.Header.Title)
+		assert.Equal(t, "https://argocd.example.com", message.CardsV2[1].Card.Sections[0].Widgets[0].ButtonList.Buttons[0].OnClick.OpenLink.Url)
+		assert.NotEqual(t, message.CardsV2[0].CardId, message.CardsV2[1].CardId)
+	}
+}
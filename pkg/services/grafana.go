@@ -2,24 +2,142 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
+	texttemplate "text/template"
 	"time"
 
+	"github.com/hashicorp/go-retryablehttp"
+
 	httputil "github.com/argoproj/notifications-engine/pkg/util/http"
+	"github.com/argoproj/notifications-engine/pkg/util/text"
 
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	grafanaRegionStart = "start"
+	grafanaRegionEnd   = "end"
+
+	// grafanaDefaultStateKey is the notification state key holding the ID of the last created annotation
+	grafanaDefaultStateKey = "grafanaAnnotationId"
+)
+
 type GrafanaOptions struct {
-	ApiUrl             string `json:"apiUrl"`
-	ApiKey             string `json:"apiKey"`
+	ApiUrl string `json:"apiUrl"`
+	// ApiKey is the legacy Grafana API key. Deprecated: use ServiceAccountToken
+	ApiKey string `json:"apiKey"`
+	// ServiceAccountToken is the token of the Grafana service account used to create annotations. Takes precedence over ApiKey
+	ServiceAccountToken string `json:"serviceAccountToken"`
+	// OrgID selects the Grafana organization using the X-Grafana-Org-Id header. Defaults to the organization of the token
+	OrgID              int64  `json:"orgId"`
 	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	Proxy              string `json:"proxy"`
+	// Timeout is the number of seconds to wait for the response of a single request attempt. Defaults to 10 seconds
+	Timeout      int           `json:"timeout"`
+	RetryWaitMin time.Duration `json:"retryWaitMin"`
+	RetryWaitMax time.Duration `json:"retryWaitMax"`
+	RetryMax     int           `json:"retryMax"`
+}
+
+type GrafanaNotification struct {
+	// Region is either "start" to open a region annotation or "end" to close the region opened by a previous notification
+	Region string `json:"region,omitempty"`
+	// StateKey is the notification state key holding the ID of the created annotation. Defaults to grafanaAnnotationId
+	StateKey string `json:"stateKey,omitempty"`
+	// Update replaces the text and tags of the annotation created by a previous notification instead of creating a new one
+	Update bool `json:"update,omitempty"`
+	// DashboardUID and PanelID attach the annotation to the given dashboard panel instead of creating an organization wide annotation
+	DashboardUID string `json:"dashboardUID,omitempty"`
+	PanelID      int64  `json:"panelId,omitempty"`
+	// Tags are added to the tags listed in the destination recipient. Tags rendering to an empty string are skipped
+	Tags []string `json:"tags,omitempty"`
+	// Text overrides the notification message as the annotation text
+	Text string `json:"text,omitempty"`
+	// Delete removes the annotation created by a previous notification, e.g. when the resource has recovered
+	Delete bool `json:"delete,omitempty"`
+}
+
+func (n *GrafanaNotification) GetTemplater(name string, f texttemplate.FuncMap) (Templater, error) {
+	switch n.Region {
+	case "", grafanaRegionStart, grafanaRegionEnd:
+	default:
+		return nil, fmt.Errorf("error in '%s' grafana.region : unsupported value '%s', must be '%s' or '%s'", name, n.Region, grafanaRegionStart, grafanaRegionEnd)
+	}
+	if n.Delete && (n.Region != "" || n.Update) {
+		return nil, fmt.Errorf("error in '%s' grafana.delete : cannot be combined with region or update", name)
+	}
+	if n.DashboardUID == "" && n.PanelID != 0 {
+		return nil, fmt.Errorf("error in '%s' grafana.panelId : dashboardUID is required", name)
+	}
+	dashboardUID, err := texttemplate.New(name).Funcs(f).Parse(n.DashboardUID)
+	if err != nil {
+		return nil, fmt.Errorf("error in '%s' grafana.dashboardUID : %w", name, err)
+	}
+	annotationText, err := texttemplate.New(name).Funcs(f).Parse(n.Text)
+	if err != nil {
+		return nil, fmt.Errorf("error in '%s' grafana.text : %w", name, err)
+	}
+	var tags []*texttemplate.Template
+	for _, tag := range n.Tags {
+		tagTemplate, err := texttemplate.New(name).Funcs(f).Parse(tag)
+		if err != nil {
+			return nil, fmt.Errorf("error in '%s' grafana.tags : %w", name, err)
+		}
+		tags = append(tags, tagTemplate)
+	}
+	return func(notification *Notification, vars map[string]interface{}) error {
+		var dashboardUIDData bytes.Buffer
+		if err := dashboardUID.Execute(&dashboardUIDData, vars); err != nil {
+			return err
+		}
+		var textData bytes.Buffer
+		if err := annotationText.Execute(&textData, vars); err != nil {
+			return err
+		}
+		var tagValues []string
+		for _, tag := range tags {
+			var tagData bytes.Buffer
+			if err := tag.Execute(&tagData, vars); err != nil {
+				return err
+			}
+			if tagData.Len() > 0 {
+				tagValues = append(tagValues, tagData.String())
+			}
+		}
+		notification.Grafana = &GrafanaNotification{
+			Region:       n.Region,
+			StateKey:     n.StateKey,
+			Update:       n.Update,
+			Delete:       n.Delete,
+			DashboardUID: dashboardUIDData.String(),
+			PanelID:      n.PanelID,
+			Tags:         tagValues,
+			Text:         textData.String(),
+		}
+		return nil
+	}, nil
+}
+
+// tags returns the pipe separated tags of the recipient followed by the tags of the notification without duplicates
+func (n *GrafanaNotification) tags(recipient string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, tag := range append(strings.Split(recipient, "|"), n.Tags...) {
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
 }
 
 type grafanaService struct {
@@ -27,49 +145,171 @@ type grafanaService struct {
 }
 
 func NewGrafanaService(opts GrafanaOptions) NotificationService {
+	if opts.Timeout == 0 {
+		opts.Timeout = 10
+	}
+	if opts.RetryWaitMin == 0 {
+		opts.RetryWaitMin = 1 * time.Second
+	}
+	if opts.RetryWaitMax == 0 {
+		opts.RetryWaitMax = 5 * time.Second
+	}
+	if opts.RetryMax == 0 {
+		opts.RetryMax = 3
+	} else if opts.RetryMax < 0 {
+		opts.RetryMax = 0
+	}
 	return &grafanaService{opts: opts}
 }
 
 type GrafanaAnnotation struct {
-	Time     int64    `json:"time"` // unix ts in ms
-	IsRegion bool     `json:"isRegion"`
-	Tags     []string `json:"tags"`
-	Text     string   `json:"text"`
+	Time         int64    `json:"time"` // unix ts in ms
+	TimeEnd      int64    `json:"timeEnd,omitempty"`
+	IsRegion     bool     `json:"isRegion"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	PanelID      int64    `json:"panelId,omitempty"`
+}
+
+// grafanaAnnotationPatch holds the annotation fields updated by a PATCH request; empty fields are left unchanged
+type grafanaAnnotationPatch struct {
+	TimeEnd int64    `json:"timeEnd,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Text    string   `json:"text,omitempty"`
+}
+
+// grafanaRequestError is returned if Grafana responds with an unexpected status code
+type grafanaRequestError struct {
+	url        string
+	statusCode int
+	data       string
+}
+
+func (e *grafanaRequestError) Error() string {
+	return fmt.Sprintf("request to %s has failed with error code %d : %s", e.url, e.statusCode, e.data)
+}
+
+type grafanaAnnotationResponse struct {
+	ID int64 `json:"id"`
 }
 
 func (s *grafanaService) Send(notification Notification, dest Destination) error {
+	return s.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+// SendWithContext creates or updates the annotation and records the ID of the created annotation in the notification
+// state
+func (s *grafanaService) SendWithContext(ctx context.Context, notification Notification, dest Destination, state State) error {
+	grafanaNotification := notification.Grafana
+	if grafanaNotification == nil {
+		grafanaNotification = &GrafanaNotification{}
+	}
+	stateKey := grafanaNotification.StateKey
+	if stateKey == "" {
+		stateKey = grafanaDefaultStateKey
+	}
+
+	transport := httputil.NewTransport(s.opts.ApiUrl, s.opts.InsecureSkipVerify)
+	if err := httputil.WithProxy(transport, s.opts.Proxy); err != nil {
+		return err
+	}
+	client := retryablehttp.NewClient()
+	client.HTTPClient = &http.Client{
+		Transport: httputil.NewLoggingRoundTripper(transport, log.WithField("service", "grafana")),
+		Timeout:   time.Duration(s.opts.Timeout) * time.Second,
+	}
+	client.RetryWaitMin = s.opts.RetryWaitMin
+	client.RetryWaitMax = s.opts.RetryWaitMax
+	client.RetryMax = s.opts.RetryMax
+	// the last response is returned once retries are exhausted to report the Grafana error
+	client.ErrorHandler = retryablehttp.PassthroughErrorHandler
+
+	if grafanaNotification.Delete {
+		id := state[stateKey]
+		if id == "" {
+			log.Warnf("Grafana annotation is not deleted since the notification state has no %s", stateKey)
+			return nil
+		}
+		err := s.request(ctx, client, http.MethodDelete, path.Join("annotations", id), nil, nil)
+		var requestErr *grafanaRequestError
+		if errors.As(err, &requestErr) && requestErr.statusCode == http.StatusNotFound {
+			// the annotation has been deleted already
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		delete(state, stateKey)
+		return nil
+	}
+
+	if grafanaNotification.Region == grafanaRegionEnd {
+		id := state[stateKey]
+		if id == "" {
+			log.Warnf("Grafana region annotation is not closed since the notification state has no %s", stateKey)
+			return nil
+		}
+		// Grafana treats the annotation as a region once the end time differs from the start time
+		if err := s.request(ctx, client, http.MethodPatch, path.Join("annotations", id), grafanaAnnotationPatch{TimeEnd: time.Now().Unix() * 1000}, nil); err != nil {
+			return err
+		}
+		delete(state, stateKey)
+		return nil
+	}
+
 	ga := GrafanaAnnotation{
-		Time:     time.Now().Unix() * 1000, // unix ts in ms
-		IsRegion: false,
-		Tags:     strings.Split(dest.Recipient, "|"),
-		Text:     notification.Message,
+		Time:         time.Now().Unix() * 1000, // unix ts in ms
+		IsRegion:     false,
+		Tags:         grafanaNotification.tags(dest.Recipient),
+		Text:         text.Coalesce(grafanaNotification.Text, notification.Message),
+		DashboardUID: grafanaNotification.DashboardUID,
+		PanelID:      grafanaNotification.PanelID,
 	}
 
-	if notification.Message == "" {
+	if ga.Text == "" {
 		log.Warnf("Message is an empty string or not provided in the notifications template")
 	}
 
-	client := &http.Client{
-		Transport: httputil.NewLoggingRoundTripper(
-			httputil.NewTransport(s.opts.ApiUrl, s.opts.InsecureSkipVerify), log.WithField("service", "grafana")),
+	if id := state[stateKey]; grafanaNotification.Update && id != "" {
+		return s.request(ctx, client, http.MethodPatch, path.Join("annotations", id), grafanaAnnotationPatch{Tags: ga.Tags, Text: ga.Text}, nil)
 	}
 
-	jsonValue, _ := json.Marshal(ga)
+	var response grafanaAnnotationResponse
+	if err := s.request(ctx, client, http.MethodPost, "annotations", ga, &response); err != nil {
+		return err
+	}
+	if state != nil && response.ID != 0 {
+		state[stateKey] = strconv.FormatInt(response.ID, 10)
+	}
+	return nil
+}
+
+// request sends the body, if not nil, to the given path of the Grafana API and decodes the response into the result if it is not nil
+func (s *grafanaService) request(ctx context.Context, client *retryablehttp.Client, method string, apiPath string, body interface{}, result interface{}) error {
+	var jsonValue []byte
+	if body != nil {
+		jsonValue, _ = json.Marshal(body)
+	}
 	apiUrl, err := url.Parse(s.opts.ApiUrl)
 
 	if err != nil {
 		return err
 	}
 	annotationApi := *apiUrl
-	annotationApi.Path = path.Join(apiUrl.Path, "annotations")
-	req, err := http.NewRequest("POST", annotationApi.String(), bytes.NewBuffer(jsonValue))
+	annotationApi.Path = path.Join(apiUrl.Path, apiPath)
+	req, err := retryablehttp.NewRequest(method, annotationApi.String(), bytes.NewBuffer(jsonValue))
 	if err != nil {
 		log.Errorf("Failed to create grafana annotation request: %s", err)
 		return err
 	}
+	req = req.WithContext(ctx)
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.opts.ApiKey))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", text.Coalesce(s.opts.ServiceAccountToken, s.opts.ApiKey)))
+	if s.opts.OrgID != 0 {
+		req.Header.Set("X-Grafana-Org-Id", strconv.FormatInt(s.opts.OrgID, 10))
+	}
 
 	response, err := client.Do(req)
 	if err != nil {
@@ -85,8 +325,13 @@ func (s *grafanaService) Send(notification Notification, dest Destination) error
 	}
 
 	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("request to %s has failed with error code %d : %s", s.opts.ApiUrl, response.StatusCode, string(data))
+		return NewHTTPError(response, &grafanaRequestError{url: s.opts.ApiUrl, statusCode: response.StatusCode, data: string(data)})
 	}
 
-	return err
+	if result != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("unable to parse Grafana response: %v", err)
+		}
+	}
+	return nil
 }
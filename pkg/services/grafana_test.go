@@ -1,10 +1,14 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"text/template"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -54,3 +58,249 @@ func TestGrafana_UnSuccessfullySendsNotification(t *testing.T) {
 		Notification{}, Destination{Recipient: "tag1|tag2", Service: "test-service"})
 	assert.Error(t, err)
 }
+
+func TestGrafana_RegionAnnotation(t *testing.T) {
+	var requests []string
+	var patchBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests = append(requests, request.Method+" "+request.URL.Path)
+		if request.Method == http.MethodPatch {
+			assert.NoError(t, json.NewDecoder(request.Body).Decode(&patchBody))
+		}
+		_, _ = writer.Write([]byte(`{"message": "Annotation added", "id": 42}`))
+	}))
+	defer server.Close()
+
+	service := NewGrafanaService(GrafanaOptions{ApiUrl: server.URL + "/api", ApiKey: "secret"}).(ContextNotificationService)
+	state := State{}
+	dest := Destination{Recipient: "tag1", Service: "grafana"}
+
+	err := service.SendWithContext(context.Background(), Notification{Message: "degraded", Grafana: &GrafanaNotification{Region: "start"}}, dest, state)
+	assert.NoError(t, err)
+	assert.Equal(t, State{"grafanaAnnotationId": "42"}, state)
+
+	err = service.SendWithContext(context.Background(), Notification{Grafana: &GrafanaNotification{Region: "end"}}, dest, state)
+	assert.NoError(t, err)
+	assert.Empty(t, state)
+
+	assert.Equal(t, []string{"POST /api/annotations", "PATCH /api/annotations/42"}, requests)
+	assert.NotZero(t, patchBody["timeEnd"])
+	assert.NotContains(t, patchBody, "text")
+}
+
+func TestGrafana_RegionEndWithoutStart(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	service := NewGrafanaService(GrafanaOptions{ApiUrl: server.URL}).(ContextNotificationService)
+	err := service.SendWithContext(context.Background(), Notification{Grafana: &GrafanaNotification{Region: "end"}}, Destination{Recipient: "tag1", Service: "grafana"}, State{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, requests)
+}
+
+func TestGetTemplater_Grafana(t *testing.T) {
+	_, err := (&GrafanaNotification{Region: "middle"}).GetTemplater("test", template.FuncMap{})
+	assert.EqualError(t, err, "error in 'test' grafana.region : unsupported value 'middle', must be 'start' or 'end'")
+
+	templater, err := (&GrafanaNotification{Region: "start", StateKey: "degradedSince"}).GetTemplater("test", template.FuncMap{})
+	assert.NoError(t, err)
+	notification := Notification{}
+	assert.NoError(t, templater(&notification, map[string]interface{}{}))
+	assert.Equal(t, &GrafanaNotification{Region: "start", StateKey: "degradedSince"}, notification.Grafana)
+}
+
+func TestGrafana_DashboardPanelAnnotation(t *testing.T) {
+	var annotation GrafanaAnnotation
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.NoError(t, json.NewDecoder(request.Body).Decode(&annotation))
+	}))
+	defer server.Close()
+
+	templater, err := (&GrafanaNotification{DashboardUID: "{{.dashboard}}", PanelID: 4}).GetTemplater("test", template.FuncMap{})
+	assert.NoError(t, err)
+	notification := Notification{Message: "deployed"}
+	assert.NoError(t, templater(&notification, map[string]interface{}{"dashboard": "cIBgcSjkk"}))
+
+	service := NewGrafanaService(GrafanaOptions{ApiUrl: server.URL})
+	err = service.Send(notification, Destination{Recipient: "tag1", Service: "grafana"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "cIBgcSjkk", annotation.DashboardUID)
+	assert.Equal(t, int64(4), annotation.PanelID)
+}
+
+func TestGetTemplater_GrafanaPanelWithoutDashboard(t *testing.T) {
+	_, err := (&GrafanaNotification{PanelID: 4}).GetTemplater("test", template.FuncMap{})
+	assert.EqualError(t, err, "error in 'test' grafana.panelId : dashboardUID is required")
+}
+
+func TestGrafana_TemplatedTagsAndText(t *testing.T) {
+	var annotation GrafanaAnnotation
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.NoError(t, json.NewDecoder(request.Body).Decode(&annotation))
+	}))
+	defer server.Close()
+
+	templater, err := (&GrafanaNotification{
+		Tags: []string{"app:{{.app}}", "{{.revision}}", "{{.missing}}", "argocd"},
+		Text: "{{.app}} synced to {{.revision}}",
+	}).GetTemplater("test", template.FuncMap{})
+	assert.NoError(t, err)
+	notification := Notification{Message: "ignored"}
+	assert.NoError(t, templater(&notification, map[string]interface{}{"app": "guestbook", "revision": "abc123", "missing": ""}))
+
+	service := NewGrafanaService(GrafanaOptions{ApiUrl: server.URL})
+	err = service.Send(notification, Destination{Recipient: "argocd|deploy", Service: "grafana"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"argocd", "deploy", "app:guestbook", "abc123"}, annotation.Tags)
+	assert.Equal(t, "guestbook synced to abc123", annotation.Text)
+}
+
+func TestGrafana_PersistsAndUpdatesAnnotation(t *testing.T) {
+	var requests []string
+	var patch map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests = append(requests, request.Method+" "+request.URL.Path)
+		if request.Method == http.MethodPatch {
+			assert.NoError(t, json.NewDecoder(request.Body).Decode(&patch))
+		}
+		_, _ = writer.Write([]byte(`{"message": "Annotation added", "id": 7}`))
+	}))
+	defer server.Close()
+
+	service := NewGrafanaService(GrafanaOptions{ApiUrl: server.URL}).(ContextNotificationService)
+	state := State{}
+	dest := Destination{Recipient: "deploy", Service: "grafana"}
+
+	err := service.SendWithContext(context.Background(), Notification{Message: "sync started", Grafana: &GrafanaNotification{StateKey: "syncAnnotation"}}, dest, state)
+	assert.NoError(t, err)
+	assert.Equal(t, State{"syncAnnotation": "7"}, state)
+
+	err = service.SendWithContext(context.Background(), Notification{Message: "sync succeeded", Grafana: &GrafanaNotification{StateKey: "syncAnnotation", Update: true}}, dest, state)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"POST /annotations", "PATCH /annotations/7"}, requests)
+	assert.Equal(t, map[string]interface{}{"text": "sync succeeded", "tags": []interface{}{"deploy"}}, patch)
+	assert.Equal(t, State{"syncAnnotation": "7"}, state)
+}
+
+func TestGrafana_UpdateWithoutAnnotationCreatesNew(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests = append(requests, request.Method+" "+request.URL.Path)
+		_, _ = writer.Write([]byte(`{"id": 8}`))
+	}))
+	defer server.Close()
+
+	service := NewGrafanaService(GrafanaOptions{ApiUrl: server.URL}).(ContextNotificationService)
+	state := State{}
+	err := service.SendWithContext(context.Background(), Notification{Message: "sync succeeded", Grafana: &GrafanaNotification{Update: true}}, Destination{Recipient: "deploy", Service: "grafana"}, state)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"POST /annotations"}, requests)
+	assert.Equal(t, State{"grafanaAnnotationId": "8"}, state)
+}
+
+func TestGrafana_RetriesServerErrors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		attempts++
+		if attempts < 3 {
+			writer.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = writer.Write([]byte(`{"id": 1}`))
+	}))
+	defer server.Close()
+
+	service := NewGrafanaService(GrafanaOptions{ApiUrl: server.URL, RetryWaitMin: time.Millisecond, RetryWaitMax: time.Millisecond})
+	err := service.Send(Notification{Message: "deployed"}, Destination{Recipient: "tag1", Service: "grafana"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestGrafana_Timeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	service := NewGrafanaService(GrafanaOptions{ApiUrl: server.URL, Timeout: 1, RetryMax: -1})
+	start := time.Now()
+	err := service.Send(Notification{Message: "deployed"}, Destination{Recipient: "tag1", Service: "grafana"})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 3*time.Second)
+}
+
+func TestGrafana_ContextCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		t.Fatal("request must not be sent")
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	service := NewGrafanaService(GrafanaOptions{ApiUrl: server.URL})
+	err := service.(*grafanaService).SendWithContext(ctx, Notification{Message: "deployed"}, Destination{Recipient: "tag1", Service: "grafana"}, State{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestGrafana_ServiceAccountTokenAndOrg(t *testing.T) {
+	var receivedHeaders http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		receivedHeaders = request.Header
+	}))
+	defer server.Close()
+
+	service := NewGrafanaService(GrafanaOptions{
+		ApiUrl:              server.URL,
+		ApiKey:              "legacy-key",
+		ServiceAccountToken: "glsa_token",
+		OrgID:               2,
+	})
+	err := service.Send(Notification{Message: "deployed"}, Destination{Recipient: "tag1", Service: "grafana"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Bearer glsa_token", receivedHeaders.Get("Authorization"))
+	assert.Equal(t, "2", receivedHeaders.Get("X-Grafana-Org-Id"))
+}
+
+func TestGrafana_DeleteAnnotation(t *testing.T) {
+	var requests []string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests = append(requests, request.Method+" "+request.URL.Path)
+		writer.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	service := NewGrafanaService(GrafanaOptions{ApiUrl: server.URL}).(ContextNotificationService)
+	dest := Destination{Recipient: "tag1", Service: "grafana"}
+	notification := Notification{Grafana: &GrafanaNotification{Delete: true}}
+
+	state := State{"grafanaAnnotationId": "5"}
+	assert.NoError(t, service.SendWithContext(context.Background(), notification, dest, state))
+	assert.Empty(t, state)
+
+	status = http.StatusNotFound
+	state = State{"grafanaAnnotationId": "6"}
+	assert.NoError(t, service.SendWithContext(context.Background(), notification, dest, state))
+	assert.Empty(t, state)
+
+	assert.NoError(t, service.SendWithContext(context.Background(), notification, dest, State{}))
+	assert.Equal(t, []string{"DELETE /annotations/5", "DELETE /annotations/6"}, requests)
+}
+
+func TestGetTemplater_GrafanaDeleteWithUpdate(t *testing.T) {
+	_, err := (&GrafanaNotification{Delete: true, Update: true}).GetTemplater("test", template.FuncMap{})
+	assert.EqualError(t, err, "error in 'test' grafana.delete : cannot be combined with region or update")
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,13 +16,28 @@ import (
 
 type MattermostNotification struct {
 	Attachments string `json:"attachments,omitempty"`
+	// Props is the JSON object of the post properties. The attachments replace the attachments property
+	Props string `json:"props,omitempty"`
+	// GroupingKey replies to the thread started by the first post with the same key about the resource
+	GroupingKey string `json:"groupingKey,omitempty"`
 }
 
+// mattermostRootIDStateKeyPrefix prefixes the notification state keys holding the IDs of the root posts of threads
+const mattermostRootIDStateKeyPrefix = "mattermostRootId."
+
 func (n *MattermostNotification) GetTemplater(name string, f texttemplate.FuncMap) (Templater, error) {
 	mattermostAttachments, err := texttemplate.New(name).Funcs(f).Parse(n.Attachments)
 	if err != nil {
 		return nil, err
 	}
+	mattermostProps, err := texttemplate.New(name).Funcs(f).Parse(n.Props)
+	if err != nil {
+		return nil, err
+	}
+	groupingKey, err := texttemplate.New(name).Funcs(f).Parse(n.GroupingKey)
+	if err != nil {
+		return nil, err
+	}
 	return func(notification *Notification, vars map[string]interface{}) error {
 		if notification.Mattermost == nil {
 			notification.Mattermost = &MattermostNotification{}
@@ -32,6 +48,18 @@ func (n *MattermostNotification) GetTemplater(name string, f texttemplate.FuncMa
 		}
 
 		notification.Mattermost.Attachments = mattermostAttachmentsData.String()
+
+		var mattermostPropsData bytes.Buffer
+		if err := mattermostProps.Execute(&mattermostPropsData, vars); err != nil {
+			return err
+		}
+		notification.Mattermost.Props = mattermostPropsData.String()
+
+		var groupingKeyData bytes.Buffer
+		if err := groupingKey.Execute(&groupingKeyData, vars); err != nil {
+			return err
+		}
+		notification.Mattermost.GroupingKey = groupingKeyData.String()
 		return nil
 	}, nil
 }
@@ -40,6 +68,7 @@ type MattermostOptions struct {
 	ApiURL             string `json:"apiURL"`
 	Token              string `json:"token"`
 	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	Proxy              string `json:"proxy"`
 }
 
 type mattermostService struct {
@@ -51,30 +80,53 @@ func NewMattermostService(opts MattermostOptions) NotificationService {
 }
 
 func (m *mattermostService) Send(notification Notification, dest Destination) error {
+	return m.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+// SendWithContext records the ID of the first post with a grouping key in the state, so that later posts with the
+// same grouping key reply in its thread
+func (m *mattermostService) SendWithContext(ctx context.Context, notification Notification, dest Destination, state State) error {
 	transport := httputil.NewTransport(m.opts.ApiURL, m.opts.InsecureSkipVerify)
+	if err := httputil.WithProxy(transport, m.opts.Proxy); err != nil {
+		return err
+	}
 	client := &http.Client{
 		Transport: httputil.NewLoggingRoundTripper(transport, log.WithField("service", "mattermost")),
 	}
 
 	attachments := []interface{}{}
+	props := map[string]interface{}{}
+	rootIDStateKey := ""
 	if notification.Mattermost != nil {
 		if notification.Mattermost.Attachments != "" {
 			if err := json.Unmarshal([]byte(notification.Mattermost.Attachments), &attachments); err != nil {
 				return fmt.Errorf("failed to unmarshal attachments '%s' : %v", notification.Mattermost.Attachments, err)
 			}
 		}
+		if notification.Mattermost.Props != "" {
+			if err := json.Unmarshal([]byte(notification.Mattermost.Props), &props); err != nil {
+				return fmt.Errorf("failed to unmarshal props '%s' : %v", notification.Mattermost.Props, err)
+			}
+		}
+		if notification.Mattermost.GroupingKey != "" {
+			rootIDStateKey = mattermostRootIDStateKeyPrefix + dest.Recipient + "." + notification.Mattermost.GroupingKey
+		}
+	}
+	if _, ok := props["attachments"]; !ok || len(attachments) > 0 {
+		props["attachments"] = attachments
 	}
 
 	body := map[string]interface{}{
 		"channel_id": dest.Recipient,
 		"message":    notification.Message,
-		"props": map[string]interface{}{
-			"attachments": attachments,
-		},
+		"props":      props,
+	}
+	if rootID := state[rootIDStateKey]; rootIDStateKey != "" && rootID != "" {
+		body["root_id"] = rootID
 	}
 	b, _ := json.Marshal(body)
 
-	req, err := http.NewRequest(http.MethodPost, m.opts.ApiURL+"/api/v4/posts", bytes.NewReader(b))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.opts.ApiURL+"/api/v4/posts", bytes.NewReader(b))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
@@ -93,7 +145,17 @@ func (m *mattermostService) Send(notification Notification, dest Destination) er
 	}
 
 	if res.StatusCode/100 != 2 {
-		return fmt.Errorf("request to %s has failed with error code %d : %s", body, res.StatusCode, string(data))
+		return NewHTTPError(res, fmt.Errorf("request to %s has failed with error code %d : %s", body, res.StatusCode, string(data)))
+	}
+
+	if rootIDStateKey != "" && state[rootIDStateKey] == "" {
+		var post struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(data, &post); err != nil {
+			return fmt.Errorf("failed to unmarshal post: %v", err)
+		}
+		state[rootIDStateKey] = post.ID
 	}
 
 	return nil
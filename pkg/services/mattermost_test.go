@@ -1,6 +1,8 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -95,3 +97,38 @@ func TestGetTemplater_Mattermost(t *testing.T) {
 
 	assert.Equal(t, "hello", notification.Mattermost.Attachments)
 }
+
+func TestSendWithContext_MattermostThread(t *testing.T) {
+	var bodies []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		bodies = append(bodies, body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": "post1"}`))
+	}))
+	defer ts.Close()
+
+	service := NewMattermostService(MattermostOptions{ApiURL: ts.URL, Token: "token"}).(*mattermostService)
+	state := State{}
+	dest := Destination{Service: "mattermost", Recipient: "channel"}
+	n := Notification{
+		Message: "syncing",
+		Mattermost: &MattermostNotification{
+			Props:       `{"from_webhook": "true", "card": "details"}`,
+			GroupingKey: "guestbook",
+		},
+	}
+
+	assert.NoError(t, service.SendWithContext(context.Background(), n, dest, state))
+	assert.Equal(t, State{"mattermostRootId.channel.guestbook": "post1"}, state)
+	n.Message = "synced"
+	assert.NoError(t, service.SendWithContext(context.Background(), n, dest, state))
+
+	if assert.Len(t, bodies, 2) {
+		assert.Nil(t, bodies[0]["root_id"])
+		assert.Equal(t, map[string]interface{}{"from_webhook": "true", "card": "details", "attachments": []interface{}{}}, bodies[0]["props"])
+		assert.Equal(t, "post1", bodies[1]["root_id"])
+		assert.Equal(t, "synced", bodies[1]["message"])
+	}
+}
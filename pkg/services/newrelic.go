@@ -2,11 +2,16 @@ package services
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	texttemplate "text/template"
 
 	log "github.com/sirupsen/logrus"
@@ -17,6 +22,9 @@ import (
 type NewrelicOptions struct {
 	ApiKey string `json:"apiKey"`
 	ApiURL string `json:"apiURL"`
+	// AccountID is used to derive the entity guid of recipients that are APM application ids
+	AccountID int    `json:"accountId,omitempty"`
+	Proxy     string `json:"proxy"`
 }
 
 type NewrelicNotification struct {
@@ -24,6 +32,7 @@ type NewrelicNotification struct {
 	Changelog   string `json:"changelog,omitempty"`
 	Description string `json:"description,omitempty"`
 	User        string `json:"user,omitempty"`
+	DeepLink    string `json:"deepLink,omitempty"`
 }
 
 var (
@@ -61,6 +70,11 @@ func (n *NewrelicNotification) GetTemplater(name string, f texttemplate.FuncMap)
 		return nil, err
 	}
 
+	deepLink, err := texttemplate.New(name).Funcs(f).Parse(n.DeepLink)
+	if err != nil {
+		return nil, err
+	}
+
 	return func(notification *Notification, vars map[string]interface{}) error {
 		if notification.Newrelic == nil {
 			notification.Newrelic = &NewrelicNotification{}
@@ -89,6 +103,12 @@ func (n *NewrelicNotification) GetTemplater(name string, f texttemplate.FuncMap)
 		}
 		notification.Newrelic.User = userData.String()
 
+		var deepLinkData bytes.Buffer
+		if err := deepLink.Execute(&deepLinkData, vars); err != nil {
+			return err
+		}
+		notification.Newrelic.DeepLink = deepLinkData.String()
+
 		return nil
 	}, nil
 }
@@ -100,17 +120,53 @@ func NewNewrelicService(opts NewrelicOptions) NotificationService {
 		opts.ApiURL = strings.TrimSuffix(opts.ApiURL, "/")
 	}
 
-	return &newrelicService{opts: opts}
+	return &newrelicService{opts: opts, entityGUIDs: map[string]string{}}
 }
 
 type newrelicService struct {
 	opts NewrelicOptions
+
+	lock sync.Mutex
+	// entityGUIDs caches the entity guids of application names
+	entityGUIDs map[string]string
+}
+
+type newrelicDeploymentMarker struct {
+	Revision    string `json:"revision"`
+	Changelog   string `json:"changelog,omitempty"`
+	Description string `json:"description,omitempty"`
+	User        string `json:"user,omitempty"`
 }
+
 type newrelicDeploymentMarkerRequest struct {
-	Deployment NewrelicNotification `json:"deployment"`
+	Deployment newrelicDeploymentMarker `json:"deployment"`
+}
+
+type newrelicChangeTrackingDeployment struct {
+	EntityGUID  string `json:"entityGuid"`
+	Version     string `json:"version"`
+	Changelog   string `json:"changelog,omitempty"`
+	Commit      string `json:"commit,omitempty"`
+	DeepLink    string `json:"deepLink,omitempty"`
+	Description string `json:"description,omitempty"`
+	User        string `json:"user,omitempty"`
 }
 
-func (s newrelicService) Send(notification Notification, dest Destination) error {
+const (
+	newrelicCreateDeploymentMutation = `mutation($deployment: ChangeTrackingDeploymentInput!) {
+  changeTrackingCreateDeployment(deployment: $deployment) { deploymentId }
+}`
+	newrelicEntitySearchQuery = `query($query: String!) {
+  actor { entitySearch(query: $query) { results { entities { guid name } } } }
+}`
+)
+
+func (s *newrelicService) Send(notification Notification, dest Destination) error {
+	return s.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+// SendWithContext sends the notification using the given context
+func (s *newrelicService) SendWithContext(ctx context.Context, notification Notification, dest Destination, _ State) error {
 	if s.opts.ApiKey == "" {
 		return ErrMissingApiKey
 	}
@@ -123,18 +179,143 @@ func (s newrelicService) Send(notification Notification, dest Destination) error
 		notification.Newrelic.Description = notification.Message
 	}
 
-	deploymentMarker := newrelicDeploymentMarkerRequest{
-		Deployment: NewrelicNotification{
-			notification.Newrelic.Revision,
-			notification.Newrelic.Changelog,
-			notification.Newrelic.Description,
-			notification.Newrelic.User,
-		},
+	transport := httputil.NewTransport(s.opts.ApiURL, false)
+	if err := httputil.WithProxy(transport, s.opts.Proxy); err != nil {
+		return err
 	}
-
 	client := &http.Client{
-		Transport: httputil.NewLoggingRoundTripper(
-			httputil.NewTransport(s.opts.ApiURL, false), log.WithField("service", dest.Service)),
+		Transport: httputil.NewLoggingRoundTripper(transport, log.WithField("service", dest.Service)),
+	}
+
+	entityGUID, err := s.getEntityGUID(ctx, client, dest.Recipient)
+	if err != nil {
+		return err
+	}
+	if entityGUID == "" {
+		log.Warnf("Recording deployment of newrelic application %s using the deprecated deployments API, configure the accountId to use change tracking", dest.Recipient)
+		return s.sendDeploymentMarker(ctx, client, *notification.Newrelic, dest.Recipient)
+	}
+
+	deployment := newrelicChangeTrackingDeployment{
+		EntityGUID:  entityGUID,
+		Version:     notification.Newrelic.Revision,
+		Changelog:   notification.Newrelic.Changelog,
+		Commit:      notification.Newrelic.Revision,
+		DeepLink:    notification.Newrelic.DeepLink,
+		Description: notification.Newrelic.Description,
+		User:        notification.Newrelic.User,
+	}
+	return s.graphql(ctx, client, newrelicCreateDeploymentMutation, map[string]interface{}{"deployment": deployment}, nil)
+}
+
+// getEntityGUID returns the entity guid of the recipient, which is either an entity guid, an APM application id or the
+// name of an APM application. An empty guid is returned for application ids if the account id is not configured.
+func (s *newrelicService) getEntityGUID(ctx context.Context, client *http.Client, recipient string) (string, error) {
+	if _, err := strconv.Atoi(recipient); err == nil {
+		if s.opts.AccountID == 0 {
+			return "", nil
+		}
+		return base64.RawStdEncoding.EncodeToString([]byte(fmt.Sprintf("%d|APM|APPLICATION|%s", s.opts.AccountID, recipient))), nil
+	}
+	if isNewrelicEntityGUID(recipient) {
+		return recipient, nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if guid, ok := s.entityGUIDs[recipient]; ok {
+		return guid, nil
+	}
+
+	var res struct {
+		Actor struct {
+			EntitySearch struct {
+				Results struct {
+					Entities []struct {
+						GUID string `json:"guid"`
+						Name string `json:"name"`
+					} `json:"entities"`
+				} `json:"results"`
+			} `json:"entitySearch"`
+		} `json:"actor"`
+	}
+	query := fmt.Sprintf("domain = 'APM' AND type = 'APPLICATION' AND name = '%s'", strings.ReplaceAll(recipient, "'", "\\'"))
+	if err := s.graphql(ctx, client, newrelicEntitySearchQuery, map[string]interface{}{"query": query}, &res); err != nil {
+		return "", err
+	}
+	for _, entity := range res.Actor.EntitySearch.Results.Entities {
+		if entity.Name == recipient {
+			s.entityGUIDs[recipient] = entity.GUID
+			return entity.GUID, nil
+		}
+	}
+	return "", fmt.Errorf("newrelic application '%s' not found", recipient)
+}
+
+// isNewrelicEntityGUID reports whether the value is an entity guid, e.g. the base64 encoding of 1|APM|APPLICATION|2
+func isNewrelicEntityGUID(value string) bool {
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+	return err == nil && strings.Count(string(data), "|") == 3
+}
+
+func (s *newrelicService) graphql(ctx context.Context, client *http.Client, query string, variables map[string]interface{}, data interface{}) error {
+	jsonValue, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.opts.ApiURL+"/graphql", bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("API-Key", s.opts.ApiKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return NewHTTPError(resp, fmt.Errorf("newrelic graphql request failed with status %d: %s", resp.StatusCode, string(body)))
+	}
+
+	var res struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return fmt.Errorf("failed to parse newrelic graphql response: %w", err)
+	}
+	if len(res.Errors) > 0 {
+		messages := make([]string, len(res.Errors))
+		for i := range res.Errors {
+			messages[i] = res.Errors[i].Message
+		}
+		return fmt.Errorf("newrelic graphql request failed: %s", strings.Join(messages, ", "))
+	}
+	if data == nil {
+		return nil
+	}
+	return json.Unmarshal(res.Data, data)
+}
+
+// sendDeploymentMarker records the deployment using the deprecated REST API v2
+func (s *newrelicService) sendDeploymentMarker(ctx context.Context, client *http.Client, notification NewrelicNotification, applicationID string) error {
+	deploymentMarker := newrelicDeploymentMarkerRequest{
+		Deployment: newrelicDeploymentMarker{
+			Revision:    notification.Revision,
+			Changelog:   notification.Changelog,
+			Description: notification.Description,
+			User:        notification.User,
+		},
 	}
 
 	jsonValue, err := json.Marshal(deploymentMarker)
@@ -142,8 +323,8 @@ func (s newrelicService) Send(notification Notification, dest Destination) error
 		return err
 	}
 
-	markerApi := fmt.Sprintf(s.opts.ApiURL+"/v2/applications/%s/deployments.json", dest.Recipient)
-	req, err := http.NewRequest(http.MethodPost, markerApi, bytes.NewBuffer(jsonValue))
+	markerApi := fmt.Sprintf(s.opts.ApiURL+"/v2/applications/%s/deployments.json", applicationID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, markerApi, bytes.NewBuffer(jsonValue))
 	if err != nil {
 		log.Errorf("Failed to create deployment marker request: %s", err)
 		return err
@@ -1,9 +1,11 @@
 package services
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"text/template"
 
@@ -171,3 +173,71 @@ func TestSend_Newrelic(t *testing.T) {
 		}
 	})
 }
+
+func TestSend_NewrelicChangeTracking(t *testing.T) {
+	var requests []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/graphql", r.URL.Path)
+		assert.Equal(t, "NRAK-5F2FIVA5UTA4FFDD11XCXVA7WPJ", r.Header.Get("API-Key"))
+		var request map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests = append(requests, request)
+		if strings.Contains(request["query"].(string), "entitySearch") {
+			_, _ = w.Write([]byte(`{"data": {"actor": {"entitySearch": {"results": {"entities": [
+				{"guid": "MXxBUE18QVBQTElDQVRJT058Mg", "name": "guestbook-staging"},
+				{"guid": "MXxBUE18QVBQTElDQVRJT058Mw", "name": "guestbook"}
+			]}}}}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data": {"changeTrackingCreateDeployment": {"deploymentId": "1"}}}`))
+	}))
+	defer ts.Close()
+
+	service := NewNewrelicService(NewrelicOptions{
+		ApiKey:    "NRAK-5F2FIVA5UTA4FFDD11XCXVA7WPJ",
+		ApiURL:    ts.URL,
+		AccountID: 1,
+	})
+	notification := Notification{
+		Message:  "message",
+		Newrelic: &NewrelicNotification{Revision: "2027ed5", User: "datanerd@example.com", DeepLink: "https://argocd.example.com"},
+	}
+
+	assert.NoError(t, service.Send(notification, Destination{Service: "newrelic", Recipient: "123456789"}))
+	if assert.Len(t, requests, 1) {
+		assert.Equal(t, map[string]interface{}{"deployment": map[string]interface{}{
+			"entityGuid":  "MXxBUE18QVBQTElDQVRJT058MTIzNDU2Nzg5",
+			"version":     "2027ed5",
+			"commit":      "2027ed5",
+			"deepLink":    "https://argocd.example.com",
+			"description": "message",
+			"user":        "datanerd@example.com",
+		}}, requests[0]["variables"])
+	}
+
+	requests = nil
+	assert.NoError(t, service.Send(notification, Destination{Service: "newrelic", Recipient: "guestbook"}))
+	assert.NoError(t, service.Send(notification, Destination{Service: "newrelic", Recipient: "guestbook"}))
+	if assert.Len(t, requests, 3) {
+		assert.Equal(t, map[string]interface{}{"query": "domain = 'APM' AND type = 'APPLICATION' AND name = 'guestbook'"}, requests[0]["variables"])
+		assert.Equal(t, "MXxBUE18QVBQTElDQVRJT058Mw", requests[1]["variables"].(map[string]interface{})["deployment"].(map[string]interface{})["entityGuid"])
+		assert.Equal(t, "MXxBUE18QVBQTElDQVRJT058Mw", requests[2]["variables"].(map[string]interface{})["deployment"].(map[string]interface{})["entityGuid"])
+	}
+
+	requests = nil
+	assert.NoError(t, service.Send(notification, Destination{Service: "newrelic", Recipient: "MXxBUE18QVBQTElDQVRJT058NA"}))
+	if assert.Len(t, requests, 1) {
+		assert.Equal(t, "MXxBUE18QVBQTElDQVRJT058NA", requests[0]["variables"].(map[string]interface{})["deployment"].(map[string]interface{})["entityGuid"])
+	}
+}
+
+func TestSend_NewrelicGraphqlError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data": null, "errors": [{"message": "Not authorized"}]}`))
+	}))
+	defer ts.Close()
+
+	service := NewNewrelicService(NewrelicOptions{ApiKey: "key", ApiURL: ts.URL})
+	err := service.Send(Notification{Newrelic: &NewrelicNotification{Revision: "2027ed5"}}, Destination{Recipient: "MXxBUE18QVBQTElDQVRJT058NA"})
+	assert.EqualError(t, err, "newrelic graphql request failed: Not authorized")
+}
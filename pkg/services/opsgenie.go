@@ -17,17 +17,99 @@ import (
 type OpsgenieOptions struct {
 	ApiUrl  string            `json:"apiUrl"`
 	ApiKeys map[string]string `json:"apiKeys"`
+	Proxy   string            `json:"proxy"`
 }
 
 type OpsgenieNotification struct {
 	Description string `json:"description"`
+	// Priority is the priority of the alert, P1 to P5. Opsgenie defaults to P3
+	Priority string `json:"priority,omitempty"`
+	// Responders replace the team of the recipient as responders of the alert
+	Responders []OpsgenieResponder `json:"responders,omitempty"`
+	Tags       []string            `json:"tags,omitempty"`
+	// Details are the custom properties of the alert
+	Details map[string]string `json:"details,omitempty"`
+	// Alias identifies the alert. Opsgenie deduplicates open alerts with the same alias
+	Alias string `json:"alias,omitempty"`
+	// Action is either create (default), acknowledge or close. Acknowledge and close require the alias of the alert
+	Action string `json:"action,omitempty"`
+}
+
+const (
+	opsgenieActionCreate      = "create"
+	opsgenieActionAcknowledge = "acknowledge"
+	opsgenieActionClose       = "close"
+)
+
+// OpsgenieResponder is a team, user, schedule or escalation identified by either id, name or username (users only)
+type OpsgenieResponder struct {
+	Type     string `json:"type"`
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Username string `json:"username,omitempty"`
 }
 
 func (n *OpsgenieNotification) GetTemplater(name string, f texttemplate.FuncMap) (Templater, error) {
+	switch n.Action {
+	case "", opsgenieActionCreate:
+	case opsgenieActionAcknowledge, opsgenieActionClose:
+		if n.Alias == "" {
+			return nil, fmt.Errorf("opsgenie alias is required to %s alerts", n.Action)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported opsgenie action '%s'", n.Action)
+	}
 	desc, err := texttemplate.New(name).Funcs(f).Parse(n.Description)
 	if err != nil {
 		return nil, err
 	}
+	priority, err := texttemplate.New(name).Funcs(f).Parse(n.Priority)
+	if err != nil {
+		return nil, err
+	}
+	alias, err := texttemplate.New(name).Funcs(f).Parse(n.Alias)
+	if err != nil {
+		return nil, err
+	}
+
+	var responders []compiledOpsgenieResponder
+	for _, responder := range n.Responders {
+		switch alert.ResponderType(responder.Type) {
+		case alert.TeamResponder, alert.UserResponder, alert.ScheduleResponder, alert.EscalationResponder:
+		default:
+			return nil, fmt.Errorf("unsupported opsgenie responder type '%s'", responder.Type)
+		}
+		compiled := compiledOpsgenieResponder{responderType: alert.ResponderType(responder.Type)}
+		if compiled.id, err = texttemplate.New(name).Funcs(f).Parse(responder.ID); err != nil {
+			return nil, err
+		}
+		if compiled.name, err = texttemplate.New(name).Funcs(f).Parse(responder.Name); err != nil {
+			return nil, err
+		}
+		if compiled.username, err = texttemplate.New(name).Funcs(f).Parse(responder.Username); err != nil {
+			return nil, err
+		}
+		responders = append(responders, compiled)
+	}
+
+	var tags []*texttemplate.Template
+	for _, tag := range n.Tags {
+		compiled, err := texttemplate.New(name).Funcs(f).Parse(tag)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, compiled)
+	}
+
+	details := map[string]*texttemplate.Template{}
+	for key, value := range n.Details {
+		compiled, err := texttemplate.New(name).Funcs(f).Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		details[key] = compiled
+	}
+
 	return func(notification *Notification, vars map[string]interface{}) error {
 		if notification.Opsgenie == nil {
 			notification.Opsgenie = &OpsgenieNotification{}
@@ -37,10 +119,79 @@ func (n *OpsgenieNotification) GetTemplater(name string, f texttemplate.FuncMap)
 			return err
 		}
 		notification.Opsgenie.Description = descData.String()
+
+		var aliasData bytes.Buffer
+		if err := alias.Execute(&aliasData, vars); err != nil {
+			return err
+		}
+		notification.Opsgenie.Alias = aliasData.String()
+		notification.Opsgenie.Action = n.Action
+
+		var priorityData bytes.Buffer
+		if err := priority.Execute(&priorityData, vars); err != nil {
+			return err
+		}
+		switch alert.Priority(priorityData.String()) {
+		case "", alert.P1, alert.P2, alert.P3, alert.P4, alert.P5:
+			notification.Opsgenie.Priority = priorityData.String()
+		default:
+			return fmt.Errorf("unsupported opsgenie priority '%s'", priorityData.String())
+		}
+
+		for _, responder := range responders {
+			var idData, nameData, usernameData bytes.Buffer
+			if err := responder.id.Execute(&idData, vars); err != nil {
+				return err
+			}
+			if err := responder.name.Execute(&nameData, vars); err != nil {
+				return err
+			}
+			if err := responder.username.Execute(&usernameData, vars); err != nil {
+				return err
+			}
+			// responders that are not resolved, e.g. an optional owner annotation, are skipped
+			if idData.Len() == 0 && nameData.Len() == 0 && usernameData.Len() == 0 {
+				continue
+			}
+			notification.Opsgenie.Responders = append(notification.Opsgenie.Responders, OpsgenieResponder{
+				Type:     string(responder.responderType),
+				ID:       idData.String(),
+				Name:     nameData.String(),
+				Username: usernameData.String(),
+			})
+		}
+
+		for _, tag := range tags {
+			var tagData bytes.Buffer
+			if err := tag.Execute(&tagData, vars); err != nil {
+				return err
+			}
+			if tagData.Len() > 0 {
+				notification.Opsgenie.Tags = append(notification.Opsgenie.Tags, tagData.String())
+			}
+		}
+
+		if len(details) > 0 {
+			notification.Opsgenie.Details = map[string]string{}
+		}
+		for key, value := range details {
+			var valueData bytes.Buffer
+			if err := value.Execute(&valueData, vars); err != nil {
+				return err
+			}
+			notification.Opsgenie.Details[key] = valueData.String()
+		}
 		return nil
 	}, nil
 }
 
+type compiledOpsgenieResponder struct {
+	responderType alert.ResponderType
+	id            *texttemplate.Template
+	name          *texttemplate.Template
+	username      *texttemplate.Template
+}
+
 type opsgenieService struct {
 	opts OpsgenieOptions
 }
@@ -50,26 +201,58 @@ func NewOpsgenieService(opts OpsgenieOptions) NotificationService {
 }
 
 func (s *opsgenieService) Send(notification Notification, dest Destination) error {
+	return s.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+func (s *opsgenieService) SendWithContext(ctx context.Context, notification Notification, dest Destination, _ State) error {
 	apiKey, ok := s.opts.ApiKeys[dest.Recipient]
 	if !ok {
 		return fmt.Errorf("no API key configured for recipient %s", dest.Recipient)
 	}
+	transport := httputil.NewTransport(s.opts.ApiUrl, false)
+	if err := httputil.WithProxy(transport, s.opts.Proxy); err != nil {
+		return err
+	}
 	alertClient, _ := alert.NewClient(&client.Config{
 		ApiKey:         apiKey,
 		OpsGenieAPIURL: client.ApiUrl(s.opts.ApiUrl),
 		HttpClient: &http.Client{
-			Transport: httputil.NewLoggingRoundTripper(
-				httputil.NewTransport(s.opts.ApiUrl, false), log.WithField("service", "opsgenie")),
+			Transport: httputil.NewLoggingRoundTripper(transport, log.WithField("service", "opsgenie")),
 		},
 	})
-	description := ""
+
 	if notification.Opsgenie != nil {
-		description = notification.Opsgenie.Description
+		action := notification.Opsgenie.Action
+		if (action == opsgenieActionAcknowledge || action == opsgenieActionClose) && notification.Opsgenie.Alias == "" {
+			return fmt.Errorf("opsgenie alias is required to %s alerts", action)
+		}
+		switch action {
+		case opsgenieActionAcknowledge:
+			_, err := alertClient.Acknowledge(ctx, &alert.AcknowledgeAlertRequest{
+				IdentifierType:  alert.ALIAS,
+				IdentifierValue: notification.Opsgenie.Alias,
+				Source:          "Argo CD",
+				Note:            notification.Message,
+			})
+			return err
+		case opsgenieActionClose:
+			_, err := alertClient.Close(ctx, &alert.CloseAlertRequest{
+				IdentifierType:  alert.ALIAS,
+				IdentifierValue: notification.Opsgenie.Alias,
+				Source:          "Argo CD",
+				Note:            notification.Message,
+			})
+			return err
+		}
 	}
 
-	_, err := alertClient.Create(context.TODO(), &alert.CreateAlertRequest{
-		Message:     notification.Message,
-		Description: description,
+	_, err := alertClient.Create(ctx, buildOpsgenieCreateAlertRequest(notification, dest))
+	return err
+}
+
+func buildOpsgenieCreateAlertRequest(notification Notification, dest Destination) *alert.CreateAlertRequest {
+	request := &alert.CreateAlertRequest{
+		Message: notification.Message,
 		Responders: []alert.Responder{
 			{
 				Type: "team",
@@ -77,6 +260,26 @@ func (s *opsgenieService) Send(notification Notification, dest Destination) erro
 			},
 		},
 		Source: "Argo CD",
-	})
-	return err
+	}
+	if notification.Opsgenie == nil {
+		return request
+	}
+
+	request.Description = notification.Opsgenie.Description
+	request.Alias = notification.Opsgenie.Alias
+	request.Priority = alert.Priority(notification.Opsgenie.Priority)
+	request.Tags = notification.Opsgenie.Tags
+	request.Details = notification.Opsgenie.Details
+	if len(notification.Opsgenie.Responders) > 0 {
+		request.Responders = nil
+		for _, responder := range notification.Opsgenie.Responders {
+			request.Responders = append(request.Responders, alert.Responder{
+				Type:     alert.ResponderType(responder.Type),
+				Id:       responder.ID,
+				Name:     responder.Name,
+				Username: responder.Username,
+			})
+		}
+	}
+	return request
 }
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/opsgenie/opsgenie-go-sdk-v2/alert"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTemplater_Opsgenie(t *testing.T) {
+	n := Notification{
+		Opsgenie: &OpsgenieNotification{
+			Description: "{{.app}} is degraded",
+			Priority:    "{{.priority}}",
+			Responders: []OpsgenieResponder{
+				{Type: "team", Name: "{{.team}}"},
+				{Type: "user", Username: "{{.owner}}"},
+			},
+			Tags:    []string{"argocd", "{{.env}}"},
+			Details: map[string]string{"revision": "{{.revision}}"},
+		},
+	}
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var notification Notification
+	err = templater(&notification, map[string]interface{}{
+		"app":      "guestbook",
+		"priority": "P1",
+		"team":     "platform",
+		"owner":    "",
+		"env":      "production",
+		"revision": "abc123",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &OpsgenieNotification{
+		Description: "guestbook is degraded",
+		Priority:    "P1",
+		Responders:  []OpsgenieResponder{{Type: "team", Name: "platform"}},
+		Tags:        []string{"argocd", "production"},
+		Details:     map[string]string{"revision": "abc123"},
+	}, notification.Opsgenie)
+
+	err = templater(&Notification{}, map[string]interface{}{"priority": "urgent"})
+	assert.EqualError(t, err, "unsupported opsgenie priority 'urgent'")
+}
+
+func TestGetTemplater_OpsgenieInvalidResponder(t *testing.T) {
+	_, err := (&OpsgenieNotification{Responders: []OpsgenieResponder{{Type: "group", Name: "ops"}}}).GetTemplater("", template.FuncMap{})
+	assert.EqualError(t, err, "unsupported opsgenie responder type 'group'")
+}
+
+func TestSend_Opsgenie(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.Equal(t, "/v2/alerts", request.URL.Path)
+		assert.Equal(t, "GenieKey key", request.Header.Get("Authorization"))
+		assert.NoError(t, json.NewDecoder(request.Body).Decode(&body))
+		writer.WriteHeader(http.StatusAccepted)
+		_, _ = writer.Write([]byte(`{"result": "Request will be processed", "requestId": "id"}`))
+	}))
+	defer server.Close()
+
+	service := NewOpsgenieService(OpsgenieOptions{
+		ApiUrl:  strings.TrimPrefix(server.URL, "http://"),
+		ApiKeys: map[string]string{"my-team": "key"},
+	})
+	err := service.Send(Notification{
+		Message: "guestbook is degraded",
+		Opsgenie: &OpsgenieNotification{
+			Priority:   "P2",
+			Responders: []OpsgenieResponder{{Type: "schedule", Name: "on-call"}},
+			Tags:       []string{"argocd"},
+			Details:    map[string]string{"revision": "abc123"},
+		},
+	}, Destination{Service: "opsgenie", Recipient: "my-team"})
+	assert.NoError(t, err)
+	assert.Equal(t, "P2", body["priority"])
+	assert.Equal(t, []interface{}{"argocd"}, body["tags"])
+	assert.Equal(t, map[string]interface{}{"revision": "abc123"}, body["details"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"type": "schedule", "name": "on-call", "username": ""}}, body["responders"])
+}
+
+func TestBuildOpsgenieCreateAlertRequest_DefaultResponder(t *testing.T) {
+	request := buildOpsgenieCreateAlertRequest(Notification{Message: "hello"}, Destination{Service: "opsgenie", Recipient: "my-team"})
+	assert.Equal(t, []alert.Responder{{Type: alert.TeamResponder, Id: "my-team"}}, request.Responders)
+	assert.Equal(t, "hello", request.Message)
+}
+
+func TestSend_OpsgenieCloseAlert(t *testing.T) {
+	var requests []string
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests = append(requests, request.URL.Path+"?"+request.URL.RawQuery)
+		assert.NoError(t, json.NewDecoder(request.Body).Decode(&body))
+		writer.WriteHeader(http.StatusAccepted)
+		_, _ = writer.Write([]byte(`{"result": "Request will be processed", "requestId": "id"}`))
+	}))
+	defer server.Close()
+
+	service := NewOpsgenieService(OpsgenieOptions{
+		ApiUrl:  strings.TrimPrefix(server.URL, "http://"),
+		ApiKeys: map[string]string{"my-team": "key"},
+	})
+	n := Notification{
+		Message:  "guestbook is healthy",
+		Opsgenie: &OpsgenieNotification{Action: "close", Alias: "{{.app}}-health"},
+	}
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var notification Notification
+	assert.NoError(t, templater(&notification, map[string]interface{}{"app": "guestbook"}))
+	notification.Message = n.Message
+
+	err = service.Send(notification, Destination{Service: "opsgenie", Recipient: "my-team"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/v2/alerts/guestbook-health/close?identifierType=alias"}, requests)
+	assert.Equal(t, "guestbook is healthy", body["note"])
+
+	err = service.Send(Notification{Opsgenie: &OpsgenieNotification{Action: "acknowledge"}}, Destination{Service: "opsgenie", Recipient: "my-team"})
+	assert.EqualError(t, err, "opsgenie alias is required to acknowledge alerts")
+}
+
+func TestGetTemplater_OpsgenieInvalidAction(t *testing.T) {
+	_, err := (&OpsgenieNotification{Action: "resolve"}).GetTemplater("", template.FuncMap{})
+	assert.EqualError(t, err, "unsupported opsgenie action 'resolve'")
+
+	_, err = (&OpsgenieNotification{Action: "close"}).GetTemplater("", template.FuncMap{})
+	assert.EqualError(t, err, "opsgenie alias is required to close alerts")
+}
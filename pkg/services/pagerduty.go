@@ -14,8 +14,18 @@ type PagerDutyNotification struct {
 	Body       string `json:"body,omitempty"`
 	Urgency    string `json:"urgency,omitempty"`
 	PriorityId string `json:"priorityId,omitempty"`
+	// Action is either trigger (default) to create an incident, acknowledge or resolve
+	Action string `json:"action,omitempty"`
+	// StateKey is the notification state key holding the ID of the created incident.
+	// Defaults to pagerdutyIncidentId; templates that create and resolve the same incident must use the same key
+	StateKey string `json:"stateKey,omitempty"`
 }
 
+const (
+	pagerdutyDefaultStateKey = "pagerdutyIncidentId"
+	pagerdutyDefaultAPIURL   = "https://api.pagerduty.com"
+)
+
 type PagerdutyOptions struct {
 	Token     string `json:"token"`
 	From      string `json:"from,omitempty"`
@@ -23,6 +33,9 @@ type PagerdutyOptions struct {
 }
 
 func (p *PagerDutyNotification) GetTemplater(name string, f texttemplate.FuncMap) (Templater, error) {
+	if err := validatePagerdutyAction(p.Action); err != nil {
+		return nil, err
+	}
 	title, err := texttemplate.New(name).Funcs(f).Parse(p.Title)
 	if err != nil {
 		return nil, err
@@ -67,26 +80,61 @@ func (p *PagerDutyNotification) GetTemplater(name string, f texttemplate.FuncMap
 			return err
 		}
 		notification.Pagerduty.PriorityId = pdPriorityIDData.String()
+		notification.Pagerduty.Action = p.Action
+		notification.Pagerduty.StateKey = p.StateKey
 
 		return nil
 	}, nil
 }
 
 func NewPagerdutyService(opts PagerdutyOptions) NotificationService {
-	return &pagerdutyService{opts: opts}
+	return &pagerdutyService{opts: opts, apiURL: pagerdutyDefaultAPIURL}
 }
 
 type pagerdutyService struct {
-	opts PagerdutyOptions
+	opts   PagerdutyOptions
+	apiURL string
 }
 
 func (p pagerdutyService) Send(notification Notification, dest Destination) error {
+	return p.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+// SendWithContext creates an incident and records its ID in the state, so that a later acknowledge
+// or resolve notification of the same resource updates the same incident
+func (p pagerdutyService) SendWithContext(ctx context.Context, notification Notification, dest Destination, state State) error {
+	pagerDutyClient := pagerduty.NewClient(p.opts.Token, pagerduty.WithAPIEndpoint(p.apiURL))
+	stateKey := pagerdutyStateKey(ctx, notification.Pagerduty.StateKey, pagerdutyDefaultStateKey, dest.Recipient)
+	if action := notification.Pagerduty.Action; action == pagerdutyEventActionAcknowledge || action == pagerdutyEventActionResolve {
+		id := state[stateKey]
+		if id == "" {
+			log.Debugf("No PagerDuty incident to %s for service %s", action, dest.Recipient)
+			return nil
+		}
+		status := "acknowledged"
+		if action == pagerdutyEventActionResolve {
+			status = "resolved"
+		}
+		if _, err := pagerDutyClient.ManageIncidentsWithContext(ctx, p.opts.From, []pagerduty.ManageIncidentsOptions{{
+			ID:     id,
+			Type:   "incident",
+			Status: status,
+		}}); err != nil {
+			log.Errorf("Error: %v", err)
+			return err
+		}
+		if action == pagerdutyEventActionResolve {
+			delete(state, stateKey)
+		}
+		log.Debugf("Incident %s successfully. incident.ID: %v", status, id)
+		return nil
+	}
+
 	title := notification.Pagerduty.Title
 	body := notification.Pagerduty.Body
 	urgency := notification.Pagerduty.Urgency
 	priorityID := notification.Pagerduty.PriorityId
 
-	pagerDutyClient := pagerduty.NewClient(p.opts.Token)
 	input := &pagerduty.CreateIncidentOptions{
 		Type:     "incident",
 		Service:  &pagerduty.APIReference{ID: dest.Recipient, Type: "service_reference"},
@@ -95,11 +143,12 @@ func (p pagerdutyService) Send(notification Notification, dest Destination) erro
 		Urgency:  urgency,
 		Body:     &pagerduty.APIDetails{Type: "incident_details	", Details: body},
 	}
-	incident, err := pagerDutyClient.CreateIncidentWithContext(context.TODO(), p.opts.From, input)
+	incident, err := pagerDutyClient.CreateIncidentWithContext(ctx, p.opts.From, input)
 	if err != nil {
 		log.Errorf("Error: %v", err)
 		return err
 	}
+	state[stateKey] = incident.ID
 	log.Debugf("Incident created Successfully. Incident Number: %v, IncidentKey:%v, incident.ID: %v, incident.Title: %v", incident.IncidentNumber, incident.IncidentKey, incident.ID, incident.Title)
 	return nil
 }
@@ -1,6 +1,10 @@
 package services
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"text/template"
 
@@ -37,3 +41,34 @@ func TestGetTemplater_PagerDuty(t *testing.T) {
 	assert.Equal(t, "high", notification.Pagerduty.Urgency)
 	assert.Equal(t, "PE456Y", notification.Pagerduty.PriorityId)
 }
+
+func TestSendWithContext_PagerDuty(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests = append(requests, request.Method+" "+request.URL.Path)
+		assert.Equal(t, "argocd@example.com", request.Header.Get("From"))
+		writer.Header().Set("Content-Type", "application/json")
+		if request.Method == http.MethodPost {
+			_, _ = writer.Write([]byte(`{"incident": {"id": "PINC123"}}`))
+			return
+		}
+		body, err := io.ReadAll(request.Body)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"incidents": [{"id": "PINC123", "type": "incident", "status": "resolved"}]}`, string(body))
+		_, _ = writer.Write([]byte(`{"incidents": []}`))
+	}))
+	defer server.Close()
+
+	service := &pagerdutyService{opts: PagerdutyOptions{Token: "token", From: "argocd@example.com"}, apiURL: server.URL}
+	state := State{}
+	dest := Destination{Service: "pagerduty", Recipient: "PSERVICE"}
+
+	err := service.SendWithContext(context.Background(), Notification{Pagerduty: &PagerDutyNotification{Title: "degraded", StateKey: "health"}}, dest, state)
+	assert.NoError(t, err)
+	assert.Equal(t, State{"health.PSERVICE": "PINC123"}, state)
+
+	err = service.SendWithContext(context.Background(), Notification{Pagerduty: &PagerDutyNotification{Action: "resolve", StateKey: "health"}}, dest, state)
+	assert.NoError(t, err)
+	assert.Empty(t, state)
+	assert.Equal(t, []string{"POST /incidents", "PUT /incidents"}, requests)
+}
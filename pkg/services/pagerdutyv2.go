@@ -8,6 +8,8 @@ import (
 
 	"github.com/PagerDuty/go-pagerduty"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/argoproj/notifications-engine/pkg/util/text"
 )
 
 type PagerDutyV2Notification struct {
@@ -18,6 +20,55 @@ type PagerDutyV2Notification struct {
 	Group     string `json:"group,omitempty"`
 	Class     string `json:"class,omitempty"`
 	URL       string `json:"url"`
+	// Action is the event action: trigger (default), acknowledge, resolve or change
+	Action string `json:"action,omitempty"`
+	// DedupKey identifies the alert of the event. Defaults to the key of the alert triggered by the same template
+	DedupKey string `json:"dedupKey,omitempty"`
+	// StateKey is the notification state key holding the dedup key of the triggered alert.
+	// Defaults to pagerdutyv2DedupKey; templates that trigger and resolve the same alert must use the same key
+	StateKey string `json:"stateKey,omitempty"`
+}
+
+const (
+	pagerdutyEventActionTrigger     = "trigger"
+	pagerdutyEventActionAcknowledge = "acknowledge"
+	pagerdutyEventActionResolve     = "resolve"
+	// pagerdutyEventActionChange sends a change event, which is recorded as context on the service without opening an alert
+	pagerdutyEventActionChange = "change"
+
+	pagerdutyV2DefaultStateKey = "pagerdutyv2DedupKey"
+	pagerdutyDefaultEventsURL  = "https://events.pagerduty.com"
+)
+
+func validatePagerdutyAction(action string) error {
+	switch action {
+	case "", pagerdutyEventActionTrigger, pagerdutyEventActionAcknowledge, pagerdutyEventActionResolve:
+		return nil
+	}
+	return fmt.Errorf("unsupported pagerduty action '%s'", action)
+}
+
+// validatePagerdutyV2Action validates the action of an Events API v2 notification, which sends change events besides
+// the alert events
+func validatePagerdutyV2Action(action string) error {
+	switch action {
+	case "", pagerdutyEventActionTrigger, pagerdutyEventActionAcknowledge, pagerdutyEventActionResolve, pagerdutyEventActionChange:
+		return nil
+	}
+	return fmt.Errorf("unsupported pagerduty action '%s'", action)
+}
+
+// pagerdutyStateKey returns the state key of the given recipient, so that alerts of different services are tracked
+// separately. The default key is scoped to the trigger of the notification, so that the alerts of different triggers
+// are tracked separately too, templates of different triggers share the alert using the same stateKey
+func pagerdutyStateKey(ctx context.Context, stateKey string, defaultKey string, recipient string) string {
+	if stateKey == "" {
+		stateKey = defaultKey
+		if trigger := TriggerOf(ctx); trigger != "" {
+			stateKey += "." + trigger
+		}
+	}
+	return stateKey + "." + recipient
 }
 
 type PagerdutyV2Options struct {
@@ -25,6 +76,9 @@ type PagerdutyV2Options struct {
 }
 
 func (p *PagerDutyV2Notification) GetTemplater(name string, f texttemplate.FuncMap) (Templater, error) {
+	if err := validatePagerdutyV2Action(p.Action); err != nil {
+		return nil, err
+	}
 	summary, err := texttemplate.New(name).Funcs(f).Parse(p.Summary)
 	if err != nil {
 		return nil, err
@@ -53,6 +107,10 @@ func (p *PagerDutyV2Notification) GetTemplater(name string, f texttemplate.FuncM
 	if err != nil {
 		return nil, err
 	}
+	dedupKey, err := texttemplate.New(name).Funcs(f).Parse(p.DedupKey)
+	if err != nil {
+		return nil, err
+	}
 
 	return func(notification *Notification, vars map[string]interface{}) error {
 		if notification.PagerdutyV2 == nil {
@@ -100,19 +158,34 @@ func (p *PagerDutyV2Notification) GetTemplater(name string, f texttemplate.FuncM
 		}
 		notification.PagerdutyV2.URL = urlData.String()
 
+		var dedupKeyData bytes.Buffer
+		if err := dedupKey.Execute(&dedupKeyData, vars); err != nil {
+			return err
+		}
+		notification.PagerdutyV2.DedupKey = dedupKeyData.String()
+		notification.PagerdutyV2.Action = p.Action
+		notification.PagerdutyV2.StateKey = p.StateKey
+
 		return nil
 	}, nil
 }
 
 func NewPagerdutyV2Service(opts PagerdutyV2Options) NotificationService {
-	return &pagerdutyV2Service{opts: opts}
+	return &pagerdutyV2Service{opts: opts, eventsURL: pagerdutyDefaultEventsURL}
 }
 
 type pagerdutyV2Service struct {
-	opts PagerdutyV2Options
+	opts      PagerdutyV2Options
+	eventsURL string
 }
 
 func (p pagerdutyV2Service) Send(notification Notification, dest Destination) error {
+	return p.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+// SendWithContext sends the event and records the dedup key of triggered alerts in the state,
+// so that a later acknowledge or resolve event of the same resource targets the same alert
+func (p pagerdutyV2Service) SendWithContext(ctx context.Context, notification Notification, dest Destination, state State) error {
 	routingKey, ok := p.opts.ServiceKeys[dest.Recipient]
 	if !ok {
 		return fmt.Errorf("no API key configured for recipient %s", dest.Recipient)
@@ -122,18 +195,48 @@ func (p pagerdutyV2Service) Send(notification Notification, dest Destination) er
 		return fmt.Errorf("no config found for pagerdutyv2")
 	}
 
+	if notification.PagerdutyV2.Action == pagerdutyEventActionChange {
+		return p.sendChangeEvent(ctx, routingKey, notification)
+	}
+
+	stateKey := pagerdutyStateKey(ctx, notification.PagerdutyV2.StateKey, pagerdutyV2DefaultStateKey, dest.Recipient)
 	event := buildEvent(routingKey, notification)
+	if event.DedupKey == "" {
+		event.DedupKey = state[stateKey]
+	}
+	if event.Action != pagerdutyEventActionTrigger && event.DedupKey == "" {
+		log.Debugf("No PagerDuty alert to %s for recipient %s", event.Action, dest.Recipient)
+		return nil
+	}
 
-	response, err := pagerduty.ManageEventWithContext(context.TODO(), event)
+	client := pagerduty.NewClient("", pagerduty.WithV2EventsAPIEndpoint(p.eventsURL))
+	response, err := client.ManageEventWithContext(ctx, &event)
 	if err != nil {
 		log.Errorf("Error: %v", err)
 		return err
 	}
-	log.Debugf("PagerDuty event triggered successfully. Status: %v, Message: %v", response.Status, response.Message)
+	switch event.Action {
+	case pagerdutyEventActionTrigger:
+		state[stateKey] = text.Coalesce(response.DedupKey, event.DedupKey)
+	case pagerdutyEventActionResolve:
+		delete(state, stateKey)
+	}
+	log.Debugf("PagerDuty event sent successfully. Action: %v, Status: %v, Message: %v", event.Action, response.Status, response.Message)
 	return nil
 }
 
 func buildEvent(routingKey string, notification Notification) pagerduty.V2Event {
+	action := text.Coalesce(notification.PagerdutyV2.Action, pagerdutyEventActionTrigger)
+	if action != pagerdutyEventActionTrigger {
+		// acknowledge and resolve events reference the alert by the dedup key only
+		return pagerduty.V2Event{
+			RoutingKey: routingKey,
+			Action:     action,
+			DedupKey:   notification.PagerdutyV2.DedupKey,
+			Client:     "ArgoCD",
+		}
+	}
+
 	payload := pagerduty.V2Payload{
 		Summary:  notification.PagerdutyV2.Summary,
 		Severity: notification.PagerdutyV2.Severity,
@@ -152,7 +255,8 @@ func buildEvent(routingKey string, notification Notification) pagerduty.V2Event
 
 	event := pagerduty.V2Event{
 		RoutingKey: routingKey,
-		Action:     "trigger",
+		Action:     action,
+		DedupKey:   notification.PagerdutyV2.DedupKey,
 		Payload:    &payload,
 		Client:     "ArgoCD",
 	}
@@ -163,3 +267,29 @@ func buildEvent(routingKey string, notification Notification) pagerduty.V2Event
 
 	return event
 }
+
+func (p pagerdutyV2Service) sendChangeEvent(ctx context.Context, routingKey string, notification Notification) error {
+	event := buildChangeEvent(routingKey, notification)
+	client := pagerduty.NewClient("", pagerduty.WithV2EventsAPIEndpoint(p.eventsURL))
+	response, err := client.CreateChangeEventWithContext(ctx, event)
+	if err != nil {
+		log.Errorf("Error: %v", err)
+		return err
+	}
+	log.Debugf("PagerDuty change event sent successfully. Status: %v, Message: %v", response.Status, response.Message)
+	return nil
+}
+
+func buildChangeEvent(routingKey string, notification Notification) pagerduty.ChangeEvent {
+	event := pagerduty.ChangeEvent{
+		RoutingKey: routingKey,
+		Payload: pagerduty.ChangeEventPayload{
+			Summary: notification.PagerdutyV2.Summary,
+			Source:  notification.PagerdutyV2.Source,
+		},
+	}
+	if len(notification.PagerdutyV2.URL) > 0 {
+		event.Links = []pagerduty.ChangeEventLink{{Href: notification.PagerdutyV2.URL, Text: "View in ArgoCD"}}
+	}
+	return event
+}
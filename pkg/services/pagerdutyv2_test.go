@@ -1,7 +1,11 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"text/template"
 
@@ -270,3 +274,84 @@ func TestSend_PagerDuty(t *testing.T) {
 		}
 	})
 }
+
+func TestSendWithContext_PagerDutyV2(t *testing.T) {
+	var events []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.Equal(t, "/v2/enqueue", request.URL.Path)
+		var event map[string]interface{}
+		assert.NoError(t, json.NewDecoder(request.Body).Decode(&event))
+		events = append(events, event)
+		writer.WriteHeader(http.StatusAccepted)
+		_, _ = writer.Write([]byte(`{"status": "success", "dedup_key": "generated-key"}`))
+	}))
+	defer server.Close()
+
+	service := &pagerdutyV2Service{opts: PagerdutyV2Options{ServiceKeys: map[string]string{"my-service": "routing-key"}}, eventsURL: server.URL}
+	state := State{}
+	dest := Destination{Service: "pagerdutyv2", Recipient: "my-service"}
+
+	err := service.SendWithContext(context.Background(), Notification{PagerdutyV2: &PagerDutyV2Notification{Summary: "degraded", Severity: "error", Source: "app"}}, dest, state)
+	assert.NoError(t, err)
+	assert.Equal(t, State{"pagerdutyv2DedupKey.my-service": "generated-key"}, state)
+
+	err = service.SendWithContext(context.Background(), Notification{PagerdutyV2: &PagerDutyV2Notification{Action: "resolve"}}, dest, state)
+	assert.NoError(t, err)
+	assert.Empty(t, state)
+
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "trigger", events[0]["event_action"])
+		assert.Nil(t, events[0]["dedup_key"])
+		assert.Equal(t, map[string]interface{}{"event_action": "resolve", "routing_key": "routing-key", "dedup_key": "generated-key", "client": "ArgoCD"}, events[1])
+	}
+
+	// nothing to resolve
+	err = service.SendWithContext(context.Background(), Notification{PagerdutyV2: &PagerDutyV2Notification{Action: "resolve"}}, dest, state)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	// the alerts of different triggers are tracked separately unless the templates share the state key
+	for _, trigger := range []string{"on-degraded", "on-sync-failed"} {
+		err = service.SendWithContext(WithTrigger(context.Background(), trigger), Notification{PagerdutyV2: &PagerDutyV2Notification{Summary: trigger, Severity: "error", Source: "app"}}, dest, state)
+		assert.NoError(t, err)
+	}
+	err = service.SendWithContext(WithTrigger(context.Background(), "on-sync-failed"), Notification{PagerdutyV2: &PagerDutyV2Notification{Summary: "shared", Severity: "error", Source: "app", StateKey: "app-health"}}, dest, state)
+	assert.NoError(t, err)
+	assert.Equal(t, State{
+		"pagerdutyv2DedupKey.on-degraded.my-service":    "generated-key",
+		"pagerdutyv2DedupKey.on-sync-failed.my-service": "generated-key",
+		"app-health.my-service":                         "generated-key",
+	}, state)
+}
+
+func TestGetTemplater_PagerDutyV2InvalidAction(t *testing.T) {
+	_, err := (&PagerDutyV2Notification{Action: "close"}).GetTemplater("", template.FuncMap{})
+	assert.EqualError(t, err, "unsupported pagerduty action 'close'")
+}
+
+func TestSend_PagerDutyV2ChangeEvent(t *testing.T) {
+	var event map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.Equal(t, "/v2/change/enqueue", request.URL.Path)
+		assert.NoError(t, json.NewDecoder(request.Body).Decode(&event))
+		writer.WriteHeader(http.StatusAccepted)
+		_, _ = writer.Write([]byte(`{"status": "success"}`))
+	}))
+	defer server.Close()
+
+	service := &pagerdutyV2Service{opts: PagerdutyV2Options{ServiceKeys: map[string]string{"my-service": "routing-key"}}, eventsURL: server.URL}
+	state := State{}
+	err := service.SendWithContext(context.Background(), Notification{PagerdutyV2: &PagerDutyV2Notification{
+		Action:  "change",
+		Summary: "guestbook synced to abc123",
+		Source:  "guestbook",
+		URL:     "https://argocd.example.com/applications/guestbook",
+	}}, Destination{Service: "pagerdutyv2", Recipient: "my-service"}, state)
+	assert.NoError(t, err)
+	assert.Empty(t, state)
+	assert.Equal(t, map[string]interface{}{
+		"routing_key": "routing-key",
+		"payload":     map[string]interface{}{"summary": "guestbook synced to abc123", "source": "guestbook"},
+		"links":       []interface{}{map[string]interface{}{"href": "https://argocd.example.com/applications/guestbook", "text": "View in ArgoCD"}},
+	}, event)
+}
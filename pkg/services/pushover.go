@@ -1,6 +1,13 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	texttemplate "text/template"
+	"time"
+
 	"github.com/gregdel/pushover"
 )
 
@@ -8,6 +15,75 @@ type PushoverOptions struct {
 	Token string `json:"token"`
 }
 
+type PushoverNotification struct {
+	Title string `json:"title,omitempty"`
+	// Priority is -2 (lowest) to 2 (emergency). Emergency notifications repeat until they are acknowledged
+	Priority string `json:"priority,omitempty"`
+	// Retry is the number of seconds between retries of emergency notifications, at least 30. Defaults to 60
+	Retry int `json:"retry,omitempty"`
+	// Expire is the number of seconds emergency notifications are retried, at most 10800. Defaults to 3600
+	Expire   int    `json:"expire,omitempty"`
+	Sound    string `json:"sound,omitempty"`
+	URL      string `json:"url,omitempty"`
+	URLTitle string `json:"urlTitle,omitempty"`
+	// Device is the name of the device receiving the notification instead of all devices of the user
+	Device string `json:"device,omitempty"`
+	HTML   bool   `json:"html,omitempty"`
+}
+
+const (
+	pushoverDefaultRetry  = 60
+	pushoverDefaultExpire = 3600
+)
+
+func (n *PushoverNotification) GetTemplater(name string, f texttemplate.FuncMap) (Templater, error) {
+	if n.Retry != 0 && n.Retry < 30 {
+		return nil, fmt.Errorf("error in '%s' pushover.retry : must be at least 30 seconds", name)
+	}
+	if n.Expire > 10800 {
+		return nil, fmt.Errorf("error in '%s' pushover.expire : must be at most 10800 seconds", name)
+	}
+	templates := map[string]*texttemplate.Template{}
+	for field, value := range map[string]string{
+		"title":    n.Title,
+		"priority": n.Priority,
+		"sound":    n.Sound,
+		"url":      n.URL,
+		"urlTitle": n.URLTitle,
+		"device":   n.Device,
+	} {
+		tmpl, err := texttemplate.New(name).Funcs(f).Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("error in '%s' pushover.%s : %w", name, field, err)
+		}
+		templates[field] = tmpl
+	}
+
+	return func(notification *Notification, vars map[string]interface{}) error {
+		if notification.Pushover == nil {
+			notification.Pushover = &PushoverNotification{}
+		}
+		for field, value := range map[string]*string{
+			"title":    &notification.Pushover.Title,
+			"priority": &notification.Pushover.Priority,
+			"sound":    &notification.Pushover.Sound,
+			"url":      &notification.Pushover.URL,
+			"urlTitle": &notification.Pushover.URLTitle,
+			"device":   &notification.Pushover.Device,
+		} {
+			var data bytes.Buffer
+			if err := templates[field].Execute(&data, vars); err != nil {
+				return err
+			}
+			*value = data.String()
+		}
+		notification.Pushover.Retry = n.Retry
+		notification.Pushover.Expire = n.Expire
+		notification.Pushover.HTML = n.HTML
+		return nil
+	}, nil
+}
+
 type pushoverService struct {
 	opts PushoverOptions
 }
@@ -17,13 +93,58 @@ func NewPushoverService(opts PushoverOptions) NotificationService {
 }
 
 func (s *pushoverService) Send(notification Notification, dest Destination) error {
+	return s.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+// SendWithContext sends the notification unless the context is done, the pushover client does not accept a context
+func (s *pushoverService) SendWithContext(ctx context.Context, notification Notification, dest Destination, _ State) error {
 	app := pushover.New(s.opts.Token)
 
 	recipient := pushover.NewRecipient(dest.Recipient)
 
-	message := pushover.NewMessage(notification.Message)
+	message, err := newPushoverMessage(notification)
+	if err != nil {
+		return err
+	}
 
-	_, err := app.SendMessage(message, recipient)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err = app.SendMessage(message, recipient)
 
 	return err
 }
+
+func newPushoverMessage(notification Notification) (*pushover.Message, error) {
+	message := pushover.NewMessage(notification.Message)
+	n := notification.Pushover
+	if n == nil {
+		return message, nil
+	}
+
+	if n.Priority != "" {
+		priority, err := strconv.Atoi(n.Priority)
+		if err != nil || priority < pushover.PriorityLowest || priority > pushover.PriorityEmergency {
+			return nil, fmt.Errorf("invalid pushover priority '%s', must be between -2 and 2", n.Priority)
+		}
+		message.Priority = priority
+	}
+	if message.Priority == pushover.PriorityEmergency {
+		retry, expire := n.Retry, n.Expire
+		if retry == 0 {
+			retry = pushoverDefaultRetry
+		}
+		if expire == 0 {
+			expire = pushoverDefaultExpire
+		}
+		message.Retry = time.Duration(retry) * time.Second
+		message.Expire = time.Duration(expire) * time.Second
+	}
+	message.Title = n.Title
+	message.Sound = n.Sound
+	message.URL = n.URL
+	message.URLTitle = n.URLTitle
+	message.DeviceName = n.Device
+	message.HTML = n.HTML
+	return message, nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTemplater_Pushover(t *testing.T) {
+	n := Notification{
+		Pushover: &PushoverNotification{
+			Title:    "{{.app}} is degraded",
+			Priority: `{{if eq .env "production"}}2{{else}}0{{end}}`,
+			Sound:    "siren",
+			URL:      "https://argocd.example.com/applications/{{.app}}",
+			URLTitle: "Open {{.app}}",
+			Device:   "{{.device}}",
+			Retry:    120,
+		},
+	}
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	notification := Notification{Message: "health degraded"}
+	assert.NoError(t, templater(&notification, map[string]interface{}{"app": "guestbook", "env": "production", "device": "phone"}))
+
+	message, err := newPushoverMessage(notification)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "health degraded", message.Message)
+	assert.Equal(t, "guestbook is degraded", message.Title)
+	assert.Equal(t, 2, message.Priority)
+	assert.Equal(t, 120*time.Second, message.Retry)
+	assert.Equal(t, time.Hour, message.Expire)
+	assert.Equal(t, "siren", message.Sound)
+	assert.Equal(t, "https://argocd.example.com/applications/guestbook", message.URL)
+	assert.Equal(t, "Open guestbook", message.URLTitle)
+	assert.Equal(t, "phone", message.DeviceName)
+}
+
+func TestNewPushoverMessage_InvalidPriority(t *testing.T) {
+	_, err := newPushoverMessage(Notification{Message: "hello", Pushover: &PushoverNotification{Priority: "3"}})
+	assert.EqualError(t, err, "invalid pushover priority '3', must be between -2 and 2")
+
+	_, err = (&PushoverNotification{Retry: 10}).GetTemplater("test", template.FuncMap{})
+	assert.EqualError(t, err, "error in 'test' pushover.retry : must be at least 30 seconds")
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimit configures the maximum rate of notifications sent by a service instance
+type RateLimit struct {
+	// RequestsPerSecond is the sustained rate of notifications, e.g. 0.5 for one notification every two seconds
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	// Burst is the number of notifications that can be sent at once, defaults to 1
+	Burst int `json:"burst,omitempty"`
+}
+
+// rateLimitedService delays the notifications sent by the wrapped service to respect the rate limit
+type rateLimitedService struct {
+	service ContextNotificationService
+	limiter *rate.Limiter
+}
+
+// NewRateLimitedService returns the service that waits for the rate limiter before every notification sent by the given service
+func NewRateLimitedService(service NotificationService, limit RateLimit) (NotificationService, error) {
+	if limit.RequestsPerSecond <= 0 {
+		return nil, fmt.Errorf("rate limit requestsPerSecond must be greater than 0")
+	}
+	burst := limit.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+	return &rateLimitedService{service: NewContextService(service), limiter: rate.NewLimiter(rate.Limit(limit.RequestsPerSecond), burst)}, nil
+}
+
+func (s *rateLimitedService) Send(notification Notification, dest Destination) error {
+	return s.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+func (s *rateLimitedService) SendWithContext(ctx context.Context, notification Notification, dest Destination, state State) error {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	return s.service.SendWithContext(ctx, notification, dest, state)
+}
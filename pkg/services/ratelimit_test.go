@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeService struct {
+	sent  []Destination
+	state State
+	err   error
+}
+
+func (s *fakeService) Send(_ Notification, dest Destination) error {
+	s.sent = append(s.sent, dest)
+	return s.err
+}
+
+type fakeContextService struct {
+	fakeService
+	ctx context.Context
+}
+
+func (s *fakeContextService) SendWithContext(ctx context.Context, notification Notification, dest Destination, state State) error {
+	s.ctx = ctx
+	s.state = state
+	return s.Send(notification, dest)
+}
+
+func TestNewRateLimitedService_Invalid(t *testing.T) {
+	_, err := NewRateLimitedService(&fakeService{}, RateLimit{})
+	assert.EqualError(t, err, "rate limit requestsPerSecond must be greater than 0")
+}
+
+func TestRateLimitedService_Send(t *testing.T) {
+	fake := &fakeService{}
+	service, err := NewRateLimitedService(fake, RateLimit{RequestsPerSecond: 10, Burst: 2})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, service.Send(Notification{}, Destination{Service: "fake", Recipient: "test"}))
+	}
+
+	assert.Len(t, fake.sent, 4)
+	// the burst is sent immediately, the remaining notifications wait 100ms each
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+}
+
+func TestRateLimitedService_SendWithContext_State(t *testing.T) {
+	fake := &fakeContextService{}
+	service, err := NewRateLimitedService(fake, RateLimit{RequestsPerSecond: 1})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	state := State{"key": "value"}
+	assert.NoError(t, service.(ContextNotificationService).SendWithContext(context.Background(), Notification{}, Destination{Service: "fake", Recipient: "test"}, state))
+	assert.Equal(t, state, fake.state)
+}
+
+func TestRateLimitedService_SendWithContext_Cancelled(t *testing.T) {
+	fake := &fakeService{}
+	service, err := NewRateLimitedService(fake, RateLimit{RequestsPerSecond: 0.1})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	dest := Destination{Service: "fake", Recipient: "test"}
+	assert.NoError(t, service.Send(Notification{}, dest))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, service.(ContextNotificationService).SendWithContext(ctx, Notification{}, dest, nil))
+	assert.Len(t, fake.sent, 1)
+}
+
+func TestNewService_RateLimit(t *testing.T) {
+	service, err := NewService("webhook", []byte(`
+url: https://example.com
+rateLimit:
+  requestsPerSecond: 2
+  burst: 5
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	limited, ok := service.(*rateLimitedService)
+	if assert.True(t, ok) {
+		assert.Equal(t, 5, limited.limiter.Burst())
+		assert.IsType(t, &webhookService{}, limited.service)
+	}
+}
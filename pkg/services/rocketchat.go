@@ -2,6 +2,7 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -12,10 +13,25 @@ import (
 	"github.com/RocketChat/Rocket.Chat.Go.SDK/models"
 	"github.com/RocketChat/Rocket.Chat.Go.SDK/rest"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/argoproj/notifications-engine/pkg/util/text"
 )
 
 type RocketChatNotification struct {
 	Attachments string `json:"attachments,omitempty"`
+	// ThreadMessageID replies in the thread of the message with the given ID
+	ThreadMessageID string `json:"threadMessageID,omitempty"`
+	// GroupingKey replies in the thread started by the first message with the same key about the resource
+	GroupingKey string `json:"groupingKey,omitempty"`
+}
+
+// rocketChatThreadIDStateKeyPrefix prefixes the notification state keys holding the IDs of the messages starting threads
+const rocketChatThreadIDStateKeyPrefix = "rocketchatThreadId."
+
+// rocketChatPostMessage adds the thread message ID missing in the SDK to the message
+type rocketChatPostMessage struct {
+	models.PostMessage
+	ThreadMessageID string `json:"tmid,omitempty"`
 }
 
 func (n *RocketChatNotification) GetTemplater(name string, f texttemplate.FuncMap) (Templater, error) {
@@ -23,6 +39,14 @@ func (n *RocketChatNotification) GetTemplater(name string, f texttemplate.FuncMa
 	if err != nil {
 		return nil, err
 	}
+	threadMessageID, err := texttemplate.New(name).Funcs(f).Parse(n.ThreadMessageID)
+	if err != nil {
+		return nil, err
+	}
+	groupingKey, err := texttemplate.New(name).Funcs(f).Parse(n.GroupingKey)
+	if err != nil {
+		return nil, err
+	}
 	return func(notification *Notification, vars map[string]interface{}) error {
 		if notification.RocketChat == nil {
 			notification.RocketChat = &RocketChatNotification{}
@@ -34,6 +58,18 @@ func (n *RocketChatNotification) GetTemplater(name string, f texttemplate.FuncMa
 
 		notification.RocketChat.Attachments = rocketChatAttachmentsData.String()
 
+		var threadMessageIDData bytes.Buffer
+		if err := threadMessageID.Execute(&threadMessageIDData, vars); err != nil {
+			return err
+		}
+		notification.RocketChat.ThreadMessageID = threadMessageIDData.String()
+
+		var groupingKeyData bytes.Buffer
+		if err := groupingKey.Execute(&groupingKeyData, vars); err != nil {
+			return err
+		}
+		notification.RocketChat.GroupingKey = groupingKeyData.String()
+
 		return nil
 	}, nil
 }
@@ -58,12 +94,22 @@ func NewRocketChatService(opts RocketChatOptions) NotificationService {
 }
 
 func (r *rocketChatService) Send(notification Notification, dest Destination) error {
+	return r.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+// SendWithContext records the ID of the first message with a grouping key in the state, so that later messages with
+// the same grouping key reply in its thread. The Rocket.Chat client does not accept a context, so the context is only
+// checked before each request
+func (r *rocketChatService) SendWithContext(ctx context.Context, notification Notification, dest Destination, state State) error {
 	serverUrl, err := url.Parse(r.opts.ServerUrl)
 	if err != nil {
 		return err
 	}
 
 	rl := rest.NewClient(serverUrl, false)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	credentials := models.UserCredentials{Email: r.opts.Email, Password: r.opts.Password}
 	err = rl.Login(&credentials)
@@ -71,7 +117,7 @@ func (r *rocketChatService) Send(notification Notification, dest Destination) er
 		return err
 	}
 
-	message := models.PostMessage{Alias: r.opts.Alias, Text: notification.Message}
+	message := rocketChatPostMessage{PostMessage: models.PostMessage{Alias: r.opts.Alias, Text: notification.Message}}
 	// It's a channel
 	if strings.HasPrefix(dest.Recipient, "#") || strings.HasPrefix(dest.Recipient, "@") {
 		message.Channel = dest.Recipient
@@ -93,7 +139,13 @@ func (r *rocketChatService) Send(notification Notification, dest Destination) er
 		}
 	}
 
+	threadIDStateKey := ""
 	if notification.RocketChat != nil {
+		if notification.RocketChat.GroupingKey != "" {
+			threadIDStateKey = rocketChatThreadIDStateKeyPrefix + dest.Recipient + "." + notification.RocketChat.GroupingKey
+		}
+		message.ThreadMessageID = text.Coalesce(notification.RocketChat.ThreadMessageID, state[threadIDStateKey])
+
 		attachments := make([]models.Attachment, 0)
 		if notification.RocketChat.Attachments != "" {
 			if err := json.Unmarshal([]byte(notification.RocketChat.Attachments), &attachments); err != nil {
@@ -104,13 +156,23 @@ func (r *rocketChatService) Send(notification Notification, dest Destination) er
 		message.Attachments = attachments
 	}
 
-	postMessage, err := rl.PostMessage(&message)
+	body, err := json.Marshal(message)
 	if err != nil {
 		return err
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	postMessage := new(rest.MessageResponse)
+	if err := rl.Post("chat.postMessage", bytes.NewBuffer(body), postMessage); err != nil {
+		return err
+	}
 	if !postMessage.Success {
 		return fmt.Errorf(postMessage.Error)
 	}
+	if threadIDStateKey != "" && message.ThreadMessageID == "" {
+		state[threadIDStateKey] = postMessage.Message.ID
+	}
 
 	return err
 }
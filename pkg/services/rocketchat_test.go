@@ -1,6 +1,10 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"text/template"
 
@@ -44,3 +48,42 @@ func TestGetTemplater_RocketChat(t *testing.T) {
 
 	assert.Equal(t, "hello", notification.RocketChat.Attachments)
 }
+
+func TestSendWithContext_RocketChatThread(t *testing.T) {
+	var messages []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/api/v1/login" {
+			_, _ = writer.Write([]byte(`{"status": "success", "data": {"authToken": "token", "userID": "user"}}`))
+			return
+		}
+		assert.Equal(t, "/api/v1/chat.postMessage", request.URL.Path)
+		assert.Equal(t, "token", request.Header.Get("X-Auth-Token"))
+		var message map[string]interface{}
+		assert.NoError(t, json.NewDecoder(request.Body).Decode(&message))
+		messages = append(messages, message)
+		_, _ = writer.Write([]byte(`{"success": true, "message": {"_id": "msg1"}}`))
+	}))
+	defer server.Close()
+
+	service := NewRocketChatService(RocketChatOptions{ServerUrl: server.URL, Email: "bot@example.com", Password: "password"}).(*rocketChatService)
+	state := State{}
+	dest := Destination{Service: "rocketchat", Recipient: "#argocd"}
+	n := Notification{Message: "syncing", RocketChat: &RocketChatNotification{
+		GroupingKey: "guestbook",
+		Attachments: `[{"color": "#18be52", "image_url": "https://example.com/status.png", "fields": [{"title": "Status", "value": "Synced", "short": true}]}]`,
+	}}
+
+	assert.NoError(t, service.SendWithContext(context.Background(), n, dest, state))
+	assert.Equal(t, State{"rocketchatThreadId.#argocd.guestbook": "msg1"}, state)
+	n.Message = "synced"
+	assert.NoError(t, service.SendWithContext(context.Background(), n, dest, state))
+
+	if assert.Len(t, messages, 2) {
+		assert.Nil(t, messages[0]["tmid"])
+		assert.Equal(t, "#argocd", messages[0]["channel"])
+		attachment := messages[0]["attachments"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "#18be52", attachment["color"])
+		assert.Equal(t, "https://example.com/status.png", attachment["image_url"])
+		assert.Equal(t, "msg1", messages[1]["tmid"])
+	}
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -27,6 +28,14 @@ type Notification struct {
 	Pagerduty    *PagerDutyNotification    `json:"pagerduty,omitempty"`
 	PagerdutyV2  *PagerDutyV2Notification  `json:"pagerdutyv2,omitempty"`
 	Newrelic     *NewrelicNotification     `json:"newrelic,omitempty"`
+	Grafana      *GrafanaNotification      `json:"grafana,omitempty"`
+	Telegram     *TelegramNotification     `json:"telegram,omitempty"`
+	Webex        *WebexNotification        `json:"webex,omitempty"`
+	Pushover     *PushoverNotification     `json:"pushover,omitempty"`
+	// Actions are the names of the actions whose links are available to the template as the actions variable
+	Actions []string `json:"actions,omitempty"`
+	// Engine is the name of the template engine that renders the fields of the template, Go text/template by default
+	Engine string `json:"engine,omitempty"`
 }
 
 // Destinations holds notification destinations group by trigger
@@ -40,11 +49,11 @@ func (s Destinations) Merge(other Destinations) {
 
 func (s Destinations) Dedup() Destinations {
 	for k, v := range s {
-		set := map[Destination]bool{}
+		set := map[string]bool{}
 		var dedup []Destination
 		for _, dest := range v {
-			if !set[dest] {
-				set[dest] = true
+			if key := dest.key(); !set[key] {
+				set[key] = true
 				dedup = append(dedup, dest)
 			}
 		}
@@ -57,6 +66,20 @@ func (s Destinations) Dedup() Destinations {
 type Destination struct {
 	Service   string `json:"service"`
 	Recipient string `json:"recipient"`
+	// Parameters holds service specific settings of the subscription, e.g. the topic of a Telegram recipient
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+func (d Destination) String() string {
+	if len(d.Parameters) == 0 {
+		return fmt.Sprintf("{%s %s}", d.Service, d.Recipient)
+	}
+	return fmt.Sprintf("{%s %s %v}", d.Service, d.Recipient, d.Parameters)
+}
+
+// key returns the string identifying the destination, parameters are printed in key order
+func (d Destination) key() string {
+	return fmt.Sprintf("%s:%s:%v", d.Service, d.Recipient, d.Parameters)
 }
 
 func (n *Notification) GetTemplater(name string, f texttemplate.FuncMap) (Templater, error) {
@@ -103,6 +126,18 @@ func (n *Notification) GetTemplater(name string, f texttemplate.FuncMap) (Templa
 	if n.Newrelic != nil {
 		sources = append(sources, n.Newrelic)
 	}
+	if n.Grafana != nil {
+		sources = append(sources, n.Grafana)
+	}
+	if n.Telegram != nil {
+		sources = append(sources, n.Telegram)
+	}
+	if n.Webex != nil {
+		sources = append(sources, n.Webex)
+	}
+	if n.Pushover != nil {
+		sources = append(sources, n.Pushover)
+	}
 	return n.getTemplater(name, f, sources)
 }
 
@@ -113,7 +148,80 @@ type NotificationService interface {
 	Send(notification Notification, dest Destination) error
 }
 
+// State holds values recorded by notification services that are shared between notifications about the same resource,
+// e.g. the ID of an incident created by a previous notification
+type State map[string]string
+
+// serviceOptions holds the settings supported by every service type
+type serviceOptions struct {
+	RateLimit      *RateLimit      `json:"rateLimit,omitempty"`
+	CircuitBreaker *CircuitBreaker `json:"circuitBreaker,omitempty"`
+}
+
+// ContextNotificationService is implemented by services that use the context of the delivery, e.g. to cancel requests
+// on shutdown, enforce timeouts and propagate the trace context, or that read or record values in the notification
+// state. The Send method of the services sends the notification using the background context and an empty state
+type ContextNotificationService interface {
+	NotificationService
+	SendWithContext(ctx context.Context, notification Notification, dest Destination, state State) error
+}
+
+// NewContextService returns the given service as a ContextNotificationService, the services that only implement
+// NotificationService ignore the context and the state
+func NewContextService(service NotificationService) ContextNotificationService {
+	if svc, ok := service.(ContextNotificationService); ok {
+		return svc
+	}
+	return &legacyService{service}
+}
+
+// legacyService adapts the services that only implement NotificationService
+type legacyService struct {
+	NotificationService
+}
+
+func (s *legacyService) SendWithContext(_ context.Context, notification Notification, dest Destination, _ State) error {
+	return s.Send(notification, dest)
+}
+
+type triggerKey struct{}
+
+// WithTrigger returns the context of the delivery of a notification of the given trigger, stateful services scope the
+// values they record by default to the trigger, so that the notifications of different triggers don't overwrite them
+func WithTrigger(ctx context.Context, trigger string) context.Context {
+	return context.WithValue(ctx, triggerKey{}, trigger)
+}
+
+// TriggerOf returns the trigger of the notification delivered using the context, or an empty string if it is unknown
+func TriggerOf(ctx context.Context) string {
+	trigger, _ := ctx.Value(triggerKey{}).(string)
+	return trigger
+}
+
 func NewService(serviceType string, optsData []byte) (NotificationService, error) {
+	service, err := newService(serviceType, optsData)
+	if err != nil {
+		return nil, err
+	}
+	var opts serviceOptions
+	if err := yaml.Unmarshal(optsData, &opts); err != nil {
+		return nil, err
+	}
+	if opts.RateLimit != nil {
+		if service, err = NewRateLimitedService(service, *opts.RateLimit); err != nil {
+			return nil, err
+		}
+	}
+	// the circuit breaker wraps the rate limiter so rejected notifications don't wait for it
+	if opts.CircuitBreaker != nil {
+		if service, err = NewCircuitBreakerService(service, *opts.CircuitBreaker); err != nil {
+			return nil, err
+		}
+	}
+	return service, nil
+}
+
+func newService(serviceType string, optsData []byte) (NotificationService, error) {
 	switch serviceType {
 	case "awssqs":
 		var opts AwsSqsOptions
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"testing"
 	"text/template"
 
@@ -27,3 +28,37 @@ func TestGetTemplater(t *testing.T) {
 
 	assert.Equal(t, "hello", notification.Message)
 }
+
+func TestDestinations_Dedup(t *testing.T) {
+	dests := Destinations{"on-sync-succeeded": {
+		{Service: "telegram", Recipient: "-100123", Parameters: map[string]string{"topic": "42"}},
+		{Service: "telegram", Recipient: "-100123", Parameters: map[string]string{"topic": "42"}},
+		{Service: "telegram", Recipient: "-100123", Parameters: map[string]string{"topic": "7"}},
+		{Service: "telegram", Recipient: "-100123"},
+	}}
+	assert.Equal(t, Destinations{"on-sync-succeeded": {
+		{Service: "telegram", Recipient: "-100123", Parameters: map[string]string{"topic": "42"}},
+		{Service: "telegram", Recipient: "-100123", Parameters: map[string]string{"topic": "7"}},
+		{Service: "telegram", Recipient: "-100123"},
+	}}, dests.Dedup())
+}
+
+type fakeContextKey struct{}
+
+func TestNewContextService(t *testing.T) {
+	dest := Destination{Service: "fake", Recipient: "test"}
+	state := State{"key": "value"}
+	ctx := context.WithValue(context.Background(), fakeContextKey{}, "value")
+
+	plain := &fakeService{}
+	assert.NoError(t, NewContextService(plain).SendWithContext(ctx, Notification{}, dest, state))
+	assert.Equal(t, []Destination{dest}, plain.sent)
+	assert.Nil(t, plain.state)
+
+	withContext := &fakeContextService{}
+	service := NewContextService(withContext)
+	assert.Same(t, withContext, service)
+	assert.NoError(t, service.SendWithContext(ctx, Notification{}, dest, state))
+	assert.Equal(t, state, withContext.state)
+	assert.Equal(t, ctx, withContext.ctx)
+}
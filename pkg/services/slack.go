@@ -4,17 +4,22 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strings"
+	"sync"
 	texttemplate "text/template"
+	"time"
 
 	httputil "github.com/argoproj/notifications-engine/pkg/util/http"
 	slackutil "github.com/argoproj/notifications-engine/pkg/util/slack"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/slack-go/slack"
+	"golang.org/x/sync/singleflight"
 	"golang.org/x/time/rate"
 )
 
@@ -79,16 +84,37 @@ type SlackOptions struct {
 	Channels           []string `json:"channels"`
 	InsecureSkipVerify bool     `json:"insecureSkipVerify"`
 	ApiURL             string   `json:"apiURL"`
+	Proxy              string   `json:"proxy"`
 }
 
 type slackService struct {
-	opts SlackOptions
+	opts     SlackOptions
+	channels *slackChannelCache
 }
 
 var validIconEmoji = regexp.MustCompile(`^:.+:$`)
 
+// slackConversationIDPattern matches the IDs of channels, private channels, direct messages and users
+var slackConversationIDPattern = regexp.MustCompile(`^[CGDUW][A-Z0-9]{6,}$`)
+
+const (
+	// slackChannelCacheTTL is the duration the channel IDs are cached, so renamed channels are eventually resolved
+	slackChannelCacheTTL = 10 * time.Minute
+	// slackChannelRefreshInterval is the minimal interval between listing the channels to resolve unknown names
+	slackChannelRefreshInterval = time.Minute
+)
+
+// slackChannelCache holds the IDs of the public channels and the private channels of the bot by channel name
+type slackChannelCache struct {
+	lock        sync.Mutex
+	ids         map[string]string
+	refreshedAt time.Time
+	// listing shares the listing of the channels between the concurrent deliveries, the lock is not held while listing
+	listing singleflight.Group
+}
+
 func NewSlackService(opts SlackOptions) NotificationService {
-	return &slackService{opts: opts}
+	return &slackService{opts: opts, channels: &slackChannelCache{}}
 }
 
 func buildMessageOptions(notification Notification, dest Destination, opts SlackOptions) (*SlackNotification, []slack.MsgOption, error) {
@@ -129,21 +155,124 @@ func buildMessageOptions(notification Notification, dest Destination, opts Slack
 }
 
 func (s *slackService) Send(notification Notification, dest Destination) error {
+	return s.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+func (s *slackService) SendWithContext(ctx context.Context, notification Notification, dest Destination, _ State) error {
 	slackNotification, msgOptions, err := buildMessageOptions(notification, dest, s.opts)
 	if err != nil {
 		return err
 	}
-	return slackutil.NewThreadedClient(
-		newSlackClient(s.opts),
+	client, err := newSlackClient(s.opts)
+	if err != nil {
+		return err
+	}
+	// the threads are recorded by configured recipient, so that they are kept if the channel is resolved differently
+	err = slackutil.NewThreadedClient(
+		client,
 		slackState,
-	).SendMessage(
-		context.TODO(),
+	).SendMessageToChannel(
+		ctx,
 		dest.Recipient,
+		s.channels.resolve(ctx, client, dest.Recipient),
 		slackNotification.GroupingKey,
 		slackNotification.NotifyBroadcast,
 		slackNotification.DeliveryPolicy,
 		msgOptions,
 	)
+	var responseErr slack.SlackErrorResponse
+	if errors.As(err, &responseErr) && responseErr.Err == "channel_not_found" {
+		// the channel might have been renamed since the IDs were cached
+		s.channels.invalidate()
+	}
+	return slackError(err)
+}
+
+// slackError classifies the errors returned by the Slack API
+func slackError(err error) error {
+	var rateLimitedErr *slack.RateLimitedError
+	var responseErr slack.SlackErrorResponse
+	switch {
+	case errors.As(err, &rateLimitedErr):
+		return &RateLimitedError{RetryAfter: time.Now().Add(rateLimitedErr.RetryAfter), Err: err}
+	case errors.As(err, &responseErr):
+		switch responseErr.Err {
+		case "invalid_auth", "not_authed", "account_inactive", "token_revoked", "token_expired", "missing_scope":
+			return &AuthError{Err: err}
+		case "not_in_channel", "is_archived", "invalid_blocks", "invalid_attachments", "msg_too_long", "no_text":
+			return &PermanentError{Err: err}
+		}
+	}
+	return err
+}
+
+// resolve returns the ID of the channel named by the recipient, which might be prefixed with #. IDs and recipients
+// that are not channels of the bot, e.g. users, are returned as is
+func (c *slackChannelCache) resolve(ctx context.Context, client *slack.Client, recipient string) string {
+	if slackConversationIDPattern.MatchString(recipient) {
+		return recipient
+	}
+	name := strings.TrimPrefix(recipient, "#")
+
+	c.lock.Lock()
+	id, ok := c.ids[name]
+	age := time.Since(c.refreshedAt)
+	c.lock.Unlock()
+	if ok && age < slackChannelCacheTTL {
+		return id
+	}
+	if age < slackChannelRefreshInterval {
+		return recipient
+	}
+
+	ids, err, _ := c.listing.Do("", func() (interface{}, error) {
+		ids, err := listSlackChannels(ctx, client)
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		c.refreshedAt = time.Now()
+		if err == nil {
+			c.ids = ids
+		}
+		return ids, err
+	})
+	if err != nil {
+		log.Warnf("Failed to list slack channels, sending to channel '%s' by name: %v", recipient, err)
+		return recipient
+	}
+	if id, ok := ids.(map[string]string)[name]; ok {
+		return id
+	}
+	return recipient
+}
+
+func (c *slackChannelCache) invalidate() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.ids = nil
+	c.refreshedAt = time.Time{}
+}
+
+// listSlackChannels returns the IDs of the public channels and the private channels of the bot by name
+func listSlackChannels(ctx context.Context, client *slack.Client) (map[string]string, error) {
+	ids := map[string]string{}
+	params := &slack.GetConversationsParameters{
+		Types:           []string{"public_channel", "private_channel"},
+		ExcludeArchived: true,
+		Limit:           1000,
+	}
+	for {
+		channels, cursor, err := client.GetConversationsContext(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, channel := range channels {
+			ids[channel.Name] = channel.ID
+		}
+		if cursor == "" {
+			return ids, nil
+		}
+		params.Cursor = cursor
+	}
 }
 
 // GetSigningSecret exposes signing secret for slack bot
@@ -151,16 +280,19 @@ func (s *slackService) GetSigningSecret() string {
 	return s.opts.SigningSecret
 }
 
-func newSlackClient(opts SlackOptions) *slack.Client {
+func newSlackClient(opts SlackOptions) (*slack.Client, error) {
 	apiURL := slack.APIURL
 	if opts.ApiURL != "" {
 		apiURL = opts.ApiURL
 	}
 	transport := httputil.NewTransport(apiURL, opts.InsecureSkipVerify)
+	if err := httputil.WithProxy(transport, opts.Proxy); err != nil {
+		return nil, err
+	}
 	client := &http.Client{
 		Transport: httputil.NewLoggingRoundTripper(transport, log.WithField("service", "slack")),
 	}
-	return slack.New(opts.Token, slack.OptionHTTPClient(client), slack.OptionAPIURL(apiURL))
+	return slack.New(opts.Token, slack.OptionHTTPClient(client), slack.OptionAPIURL(apiURL)), nil
 }
 
 func isValidIconURL(iconURL string) bool {
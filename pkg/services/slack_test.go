@@ -1,11 +1,18 @@
 package services
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"text/template"
+	"time"
 
 	slackutil "github.com/argoproj/notifications-engine/pkg/util/slack"
 
+	"github.com/slack-go/slack"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -63,3 +70,112 @@ func TestBuildMessageOptionsWithNonExistTemplate(t *testing.T) {
 	assert.Empty(t, sn.GroupingKey)
 	assert.Equal(t, slackutil.Post, sn.DeliveryPolicy)
 }
+
+func TestSend_SlackChannelResolution(t *testing.T) {
+	var listed int
+	var channels []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/conversations.list":
+			listed++
+			assert.Equal(t, "public_channel,private_channel", r.Form.Get("types"))
+			if r.Form.Get("cursor") == "" {
+				_, _ = w.Write([]byte(`{"ok": true, "channels": [{"id": "C0000000001", "name": "general"}], "response_metadata": {"next_cursor": "page2"}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"ok": true, "channels": [{"id": "G0000000002", "name": "deployments", "is_private": true}]}`))
+		case "/chat.postMessage":
+			channels = append(channels, r.Form.Get("channel"))
+			_, _ = w.Write([]byte(`{"ok": true, "channel": "` + r.Form.Get("channel") + `", "ts": "1"}`))
+		}
+	}))
+	defer server.Close()
+
+	service := NewSlackService(SlackOptions{Token: "token", ApiURL: server.URL + "/"})
+	for _, recipient := range []string{"deployments", "#general", "C0000000003", "deployments", "unknown"} {
+		assert.NoError(t, service.Send(Notification{Message: "hello"}, Destination{Service: "slack", Recipient: recipient}))
+	}
+	assert.Equal(t, []string{"G0000000002", "C0000000001", "C0000000003", "G0000000002", "unknown"}, channels)
+	// unknown channels are not looked up again until the refresh interval elapsed
+	assert.Equal(t, 2, listed)
+}
+
+func TestSend_SlackChannelNotFound(t *testing.T) {
+	var listed int
+	var channels []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/conversations.list":
+			listed++
+			// the channel is renamed after the first listing
+			if listed == 1 {
+				_, _ = w.Write([]byte(`{"ok": true, "channels": [{"id": "C0000000001", "name": "general"}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"ok": true, "channels": [{"id": "C0000000002", "name": "general"}]}`))
+		case "/chat.postMessage":
+			channels = append(channels, r.Form.Get("channel"))
+			if r.Form.Get("channel") == "C0000000001" {
+				_, _ = w.Write([]byte(`{"ok": false, "error": "channel_not_found"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"ok": true, "channel": "` + r.Form.Get("channel") + `", "ts": "1"}`))
+		}
+	}))
+	defer server.Close()
+
+	service := NewSlackService(SlackOptions{Token: "token", ApiURL: server.URL + "/"})
+	notification := Notification{Message: "hello", Slack: &SlackNotification{GroupingKey: "channel-not-found"}}
+	dest := Destination{Service: "slack", Recipient: "#general"}
+	assert.Error(t, service.Send(notification, dest))
+	assert.NoError(t, service.Send(notification, dest))
+
+	assert.Equal(t, []string{"C0000000001", "C0000000002"}, channels)
+	assert.Equal(t, 2, listed)
+	// the thread is recorded by configured recipient rather than by the resolved channel
+	assert.Equal(t, "1", slackState.ThreadTSs["#general"]["channel-not-found"])
+}
+
+func TestSlackChannelCache_ConcurrentResolve(t *testing.T) {
+	var listed int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&listed, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok": true, "channels": [{"id": "C0000000001", "name": "general"}]}`))
+	}))
+	defer server.Close()
+
+	client := slack.New("token", slack.OptionAPIURL(server.URL+"/"))
+	cache := &slackChannelCache{}
+	var wg sync.WaitGroup
+	ids := make([]string, 5)
+	for i := range ids {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids[i] = cache.resolve(context.Background(), client, "general")
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, []string{"C0000000001", "C0000000001", "C0000000001", "C0000000001", "C0000000001"}, ids)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&listed))
+}
+
+func TestSlackError(t *testing.T) {
+	err := slackError(&slack.RateLimitedError{RetryAfter: 30 * time.Second})
+	var rateLimitedErr *RateLimitedError
+	if assert.ErrorAs(t, err, &rateLimitedErr) {
+		assert.WithinDuration(t, time.Now().Add(30*time.Second), rateLimitedErr.RetryAfter, time.Second)
+	}
+	assert.ErrorIs(t, slackError(slack.SlackErrorResponse{Err: "invalid_auth"}), ErrAuth)
+	assert.ErrorIs(t, slackError(slack.SlackErrorResponse{Err: "is_archived"}), ErrPermanent)
+	assert.True(t, IsRetryable(slackError(slack.SlackErrorResponse{Err: "channel_not_found"})))
+	assert.NoError(t, slackError(nil))
+}
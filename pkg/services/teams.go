@@ -2,15 +2,21 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	texttemplate "text/template"
 
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
 
 	httputil "github.com/argoproj/notifications-engine/pkg/util/http"
+	"github.com/argoproj/notifications-engine/pkg/util/text"
 )
 
 type TeamsNotification struct {
@@ -22,8 +28,27 @@ type TeamsNotification struct {
 	Facts           string `json:"facts,omitempty"`
 	Sections        string `json:"sections,omitempty"`
 	PotentialAction string `json:"potentialAction,omitempty"`
+	// AdaptiveCard is the JSON of the Adaptive Card sent instead of the legacy MessageCard
+	AdaptiveCard string `json:"adaptiveCard,omitempty"`
+	// Mentions lists the users and tags mentioned in bot messages and Workflows webhook messages. Mentions missing
+	// from the text as <at>name</at> are appended
+	Mentions []TeamsMention `json:"mentions,omitempty"`
 }
 
+// TeamsMention is a user or a tag mentioned in the message
+type TeamsMention struct {
+	// ID is the Teams user ID, the Microsoft Entra object ID or the UPN of the user, or the ID of the tag
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Type is person (default) or tag. Tags can be mentioned in bot messages of channels only
+	Type string `json:"type,omitempty"`
+}
+
+const (
+	teamsMentionTypePerson = "person"
+	teamsMentionTypeTag    = "tag"
+)
+
 func (n *TeamsNotification) GetTemplater(name string, f texttemplate.FuncMap) (Templater, error) {
 	template, err := texttemplate.New(name).Funcs(f).Parse(n.Template)
 	if err != nil {
@@ -65,6 +90,27 @@ func (n *TeamsNotification) GetTemplater(name string, f texttemplate.FuncMap) (T
 		return nil, fmt.Errorf("error in '%s' teams.potentialAction: %w", name, err)
 	}
 
+	adaptiveCard, err := texttemplate.New(name).Funcs(f).Parse(n.AdaptiveCard)
+	if err != nil {
+		return nil, fmt.Errorf("error in '%s' teams.adaptiveCard : %w", name, err)
+	}
+
+	var mentions []compiledTeamsMention
+	for _, mention := range n.Mentions {
+		if mention.Type != "" && mention.Type != teamsMentionTypePerson && mention.Type != teamsMentionTypeTag {
+			return nil, fmt.Errorf("error in '%s' teams.mentions : unsupported type '%s'", name, mention.Type)
+		}
+		id, err := texttemplate.New(name).Funcs(f).Parse(mention.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error in '%s' teams.mentions : %w", name, err)
+		}
+		mentionName, err := texttemplate.New(name).Funcs(f).Parse(mention.Name)
+		if err != nil {
+			return nil, fmt.Errorf("error in '%s' teams.mentions : %w", name, err)
+		}
+		mentions = append(mentions, compiledTeamsMention{id: id, name: mentionName, mentionType: mention.Type})
+	}
+
 	return func(notification *Notification, vars map[string]interface{}) error {
 		if notification.Teams == nil {
 			notification.Teams = &TeamsNotification{}
@@ -134,38 +180,120 @@ func (n *TeamsNotification) GetTemplater(name string, f texttemplate.FuncMap) (T
 			notification.Teams.PotentialAction = val
 		}
 
+		var adaptiveCardData bytes.Buffer
+		if err := adaptiveCard.Execute(&adaptiveCardData, vars); err != nil {
+			return err
+		}
+		if val := adaptiveCardData.String(); val != "" {
+			notification.Teams.AdaptiveCard = val
+		}
+
+		for _, mention := range mentions {
+			var idData, nameData bytes.Buffer
+			if err := mention.id.Execute(&idData, vars); err != nil {
+				return err
+			}
+			if err := mention.name.Execute(&nameData, vars); err != nil {
+				return err
+			}
+			// mentions of users that are not resolved, e.g. optional owners, are skipped
+			if idData.Len() > 0 {
+				notification.Teams.Mentions = append(notification.Teams.Mentions, TeamsMention{ID: idData.String(), Name: nameData.String(), Type: mention.mentionType})
+			}
+		}
+
 		return nil
 	}, nil
 }
 
+type compiledTeamsMention struct {
+	id          *texttemplate.Template
+	name        *texttemplate.Template
+	mentionType string
+}
+
+const (
+	teamsWebhookTypeConnector = "connector"
+	teamsWebhookTypeWorkflows = "workflows"
+)
+
 type TeamsOptions struct {
 	RecipientUrls map[string]string `json:"recipientUrls"`
+	Proxy         string            `json:"proxy"`
+	// WebhookType is either connector (default) for Office 365 connector webhooks or workflows for Power Automate Workflows webhooks
+	WebhookType string `json:"webhookType"`
+	// Bot sends proactive messages using the Bot Framework instead of incoming webhooks
+	Bot *TeamsBotOptions `json:"bot"`
+}
+
+// TeamsBotOptions holds the credentials of the Azure bot used to send proactive messages to channels and user chats
+type TeamsBotOptions struct {
+	AppID       string `json:"appID"`
+	AppPassword string `json:"appPassword"`
+	// TenantID is required for single tenant bots. Multi tenant bots get tokens from the botframework.com tenant
+	TenantID string `json:"tenantID"`
+	// ServiceURL is the Bot Connector endpoint. Defaults to https://smba.trafficmanager.net/teams/
+	ServiceURL string `json:"serviceURL"`
+	// TokenURL overrides the token endpoint derived from the tenant ID
+	TokenURL string `json:"tokenURL"`
+	// Conversations maps recipient names to conversation IDs. Recipients not listed are used as conversation IDs
+	Conversations map[string]string `json:"conversations"`
 }
 
 type teamsService struct {
-	opts TeamsOptions
+	opts           TeamsOptions
+	botTokenSource oauth2.TokenSource
 }
 
 func NewTeamsService(opts TeamsOptions) NotificationService {
-	return &teamsService{opts: opts}
+	service := &teamsService{opts: opts}
+	if opts.Bot != nil {
+		service.botTokenSource = opts.Bot.tokenSource(opts.Proxy)
+	}
+	return service
 }
 
 func (s teamsService) Send(notification Notification, dest Destination) error {
+	return s.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+// SendWithContext sends the notification using the given context
+func (s teamsService) SendWithContext(ctx context.Context, notification Notification, dest Destination, _ State) error {
+	if s.opts.Bot != nil {
+		return s.sendBotMessage(ctx, notification, dest)
+	}
 	webhookUrl, ok := s.opts.RecipientUrls[dest.Recipient]
 	if !ok {
 		return fmt.Errorf("no teams webhook configured for recipient %s", dest.Recipient)
 	}
 	transport := httputil.NewTransport(webhookUrl, false)
+	if err := httputil.WithProxy(transport, s.opts.Proxy); err != nil {
+		return err
+	}
 	client := &http.Client{
 		Transport: httputil.NewLoggingRoundTripper(transport, log.WithField("service", "teams")),
 	}
 
-	message, err := teamsNotificationToReader(notification)
+	var message []byte
+	var err error
+	switch s.opts.WebhookType {
+	case "", teamsWebhookTypeConnector:
+		message, err = teamsNotificationToReader(notification)
+	case teamsWebhookTypeWorkflows:
+		message, err = teamsNotificationToWorkflowsReader(notification)
+	default:
+		return fmt.Errorf("unsupported teams webhook type '%s'", s.opts.WebhookType)
+	}
 	if err != nil {
 		return err
 	}
 
-	response, err := client.Post(webhookUrl, "application/json", bytes.NewReader(message))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookUrl, bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	response, err := client.Do(req)
 
 	if err != nil {
 		return err
@@ -180,6 +308,14 @@ func (s teamsService) Send(notification Notification, dest Destination) error {
 		return err
 	}
 
+	if s.opts.WebhookType == teamsWebhookTypeWorkflows {
+		// workflows accept the request asynchronously and respond with an empty body
+		if response.StatusCode < 200 || response.StatusCode >= 300 {
+			return NewHTTPError(response, fmt.Errorf("teams workflows webhook post error %d: %s", response.StatusCode, bodyBytes))
+		}
+		return nil
+	}
+
 	if string(bodyBytes) != "1" {
 		return fmt.Errorf("teams webhook post error: %s", bodyBytes)
 	}
@@ -251,6 +387,14 @@ func teamsNotificationToReader(n Notification) ([]byte, error) {
 		return []byte(n.Teams.Template), nil
 	}
 
+	if n.Teams != nil && n.Teams.AdaptiveCard != "" {
+		card, err := parseTeamsAdaptiveCard(n.Teams.AdaptiveCard)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(teamsAdaptiveCardMessage(card))
+	}
+
 	message, err := teamsNotificationToMessage(n)
 
 	if err != nil {
@@ -279,3 +423,337 @@ type teamsMessage struct {
 
 type teamsSection = map[string]interface{}
 type teamsAction map[string]interface{}
+
+const teamsAdaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+
+// parseTeamsAdaptiveCard parses the card and validates the structure required by the Adaptive Card schema
+func parseTeamsAdaptiveCard(data string) (map[string]interface{}, error) {
+	var card map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &card); err != nil {
+		return nil, fmt.Errorf("teams adaptive card unmarshalling error %w", err)
+	}
+	if card["type"] != "AdaptiveCard" {
+		return nil, fmt.Errorf("teams adaptive card is invalid: type must be 'AdaptiveCard' but got '%v'", card["type"])
+	}
+	if version, ok := card["version"].(string); !ok || version == "" {
+		return nil, fmt.Errorf("teams adaptive card is invalid: version is required")
+	}
+	for _, field := range []string{"body", "actions"} {
+		value, ok := card[field]
+		if !ok {
+			continue
+		}
+		elements, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("teams adaptive card is invalid: %s must be an array", field)
+		}
+		for i, element := range elements {
+			object, _ := element.(map[string]interface{})
+			if elementType, _ := object["type"].(string); elementType == "" {
+				return nil, fmt.Errorf("teams adaptive card is invalid: %s[%d] has no type", field, i)
+			}
+		}
+	}
+	return card, nil
+}
+
+// teamsAdaptiveCardMessage wraps the card into the message envelope accepted by Teams webhooks
+func teamsAdaptiveCardMessage(card map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{{
+			"contentType": teamsAdaptiveCardContentType,
+			"contentUrl":  nil,
+			"content":     card,
+		}},
+	}
+}
+
+// teamsNotificationToWorkflowsReader returns the request body for Workflows webhooks, which accept Adaptive Cards only.
+// Notifications without an adaptive card are converted into a card with the title, text, facts and open URI actions of the message
+func teamsNotificationToWorkflowsReader(n Notification) ([]byte, error) {
+	if n.Teams != nil && n.Teams.Template != "" {
+		return []byte(n.Teams.Template), nil
+	}
+
+	var card map[string]interface{}
+	if n.Teams != nil && n.Teams.AdaptiveCard != "" {
+		var err error
+		if card, err = parseTeamsAdaptiveCard(n.Teams.AdaptiveCard); err != nil {
+			return nil, err
+		}
+	} else {
+		message, err := teamsNotificationToMessage(n)
+		if err != nil {
+			return nil, err
+		}
+		card = teamsMessageToAdaptiveCard(message)
+	}
+	if n.Teams != nil && len(n.Teams.Mentions) > 0 {
+		if err := addTeamsAdaptiveCardMentions(card, n.Teams.Mentions); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(teamsAdaptiveCardMessage(card))
+}
+
+// addTeamsAdaptiveCardMentions adds the mention entities of the users to the card. Mentions that are not referenced by
+// the card are appended to the body as a text block
+func addTeamsAdaptiveCardMentions(card map[string]interface{}, mentions []TeamsMention) error {
+	texts := strings.Join(teamsAdaptiveCardTexts(card["body"]), "\n")
+	var entities []interface{}
+	var missing []string
+	for _, entity := range teamsMentionEntities(mentions) {
+		if entity.Mentioned.Type == teamsMentionTypeTag {
+			// adaptive cards do not support tag mentions
+			continue
+		}
+		if !strings.Contains(texts, entity.Text) {
+			missing = append(missing, entity.Text)
+		}
+		entities = append(entities, entity)
+	}
+	if len(missing) > 0 {
+		body, _ := card["body"].([]interface{})
+		card["body"] = append(body, map[string]interface{}{"type": "TextBlock", "text": strings.Join(missing, " "), "wrap": true})
+	}
+	if len(entities) > 0 {
+		msteams, _ := card["msteams"].(map[string]interface{})
+		if msteams == nil {
+			msteams = map[string]interface{}{}
+			card["msteams"] = msteams
+		}
+		existing, _ := msteams["entities"].([]interface{})
+		msteams["entities"] = append(existing, entities...)
+	}
+	return nil
+}
+
+// teamsAdaptiveCardTexts returns the text properties of the elements of the card
+func teamsAdaptiveCardTexts(element interface{}) []string {
+	var texts []string
+	switch element := element.(type) {
+	case map[string]interface{}:
+		for k, v := range element {
+			if text, ok := v.(string); ok && k == "text" {
+				texts = append(texts, text)
+				continue
+			}
+			texts = append(texts, teamsAdaptiveCardTexts(v)...)
+		}
+	case []interface{}:
+		for _, v := range element {
+			texts = append(texts, teamsAdaptiveCardTexts(v)...)
+		}
+	}
+	return texts
+}
+
+func teamsMessageToAdaptiveCard(message *teamsMessage) map[string]interface{} {
+	body := []interface{}{}
+	if message.Title != "" {
+		body = append(body, map[string]interface{}{"type": "TextBlock", "text": message.Title, "size": "Medium", "weight": "Bolder", "wrap": true})
+	}
+	if message.Text != "" {
+		body = append(body, map[string]interface{}{"type": "TextBlock", "text": message.Text, "wrap": true})
+	}
+	for _, section := range message.Sections {
+		var facts []map[string]interface{}
+		switch sectionFacts := section["facts"].(type) {
+		case []map[string]interface{}:
+			facts = sectionFacts
+		case []interface{}:
+			for _, fact := range sectionFacts {
+				if fact, ok := fact.(map[string]interface{}); ok {
+					facts = append(facts, fact)
+				}
+			}
+		}
+		var factSet []interface{}
+		for _, fact := range facts {
+			factSet = append(factSet, map[string]interface{}{"title": fact["name"], "value": fact["value"]})
+		}
+		if len(factSet) > 0 {
+			body = append(body, map[string]interface{}{"type": "FactSet", "facts": factSet})
+		}
+	}
+
+	var actions []interface{}
+	for _, action := range message.PotentialAction {
+		targets, _ := action["targets"].([]interface{})
+		for _, target := range targets {
+			if target, ok := target.(map[string]interface{}); ok && target["uri"] != nil {
+				actions = append(actions, map[string]interface{}{"type": "Action.OpenUrl", "title": action["name"], "url": target["uri"]})
+				break
+			}
+		}
+	}
+
+	card := map[string]interface{}{
+		"type":    "AdaptiveCard",
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"version": "1.4",
+		"body":    body,
+	}
+	if len(actions) > 0 {
+		card["actions"] = actions
+	}
+	return card
+}
+
+const teamsBotDefaultServiceURL = "https://smba.trafficmanager.net/teams/"
+
+func (o *TeamsBotOptions) tokenSource(proxy string) oauth2.TokenSource {
+	tokenURL := o.TokenURL
+	if tokenURL == "" {
+		tokenURL = fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", text.Coalesce(o.TenantID, "botframework.com"))
+	}
+	cfg := clientcredentials.Config{
+		ClientID:     o.AppID,
+		ClientSecret: o.AppPassword,
+		TokenURL:     tokenURL,
+		Scopes:       []string{"https://api.botframework.com/.default"},
+	}
+	transport := httputil.NewTransport(tokenURL, false)
+	// invalid proxy url is reported by Send before the token is requested
+	_ = httputil.WithProxy(transport, proxy)
+	client := &http.Client{
+		Transport: httputil.NewLoggingRoundTripper(transport, log.WithField("service", "teams-bot-token")),
+	}
+	return cfg.TokenSource(context.WithValue(context.Background(), oauth2.HTTPClient, client))
+}
+
+type teamsActivity struct {
+	Type        string                   `json:"type"`
+	Text        string                   `json:"text,omitempty"`
+	TextFormat  string                   `json:"textFormat,omitempty"`
+	Attachments []map[string]interface{} `json:"attachments,omitempty"`
+	Entities    []teamsMentionEntity     `json:"entities,omitempty"`
+}
+
+type teamsMentionEntity struct {
+	Type      string `json:"type"`
+	Text      string `json:"text"`
+	Mentioned struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		Type string `json:"type,omitempty"`
+	} `json:"mentioned"`
+}
+
+func teamsMentionEntities(mentions []TeamsMention) []teamsMentionEntity {
+	var entities []teamsMentionEntity
+	for _, mention := range mentions {
+		entity := teamsMentionEntity{Type: "mention", Text: fmt.Sprintf("<at>%s</at>", mention.Name)}
+		entity.Mentioned.ID = mention.ID
+		entity.Mentioned.Name = mention.Name
+		if mention.Type == teamsMentionTypeTag {
+			entity.Mentioned.Type = teamsMentionTypeTag
+		}
+		entities = append(entities, entity)
+	}
+	return entities
+}
+
+// teamsNotificationToActivity converts the notification into a Bot Framework message activity
+func teamsNotificationToActivity(n Notification) (*teamsActivity, error) {
+	activity := &teamsActivity{Type: "message", Text: n.Message, TextFormat: "markdown"}
+	if n.Teams == nil {
+		return activity, nil
+	}
+	if n.Teams.Text != "" {
+		activity.Text = n.Teams.Text
+	}
+	if n.Teams.AdaptiveCard != "" {
+		card, err := parseTeamsAdaptiveCard(n.Teams.AdaptiveCard)
+		if err != nil {
+			return nil, err
+		}
+		activity.Attachments = teamsAdaptiveCardMessage(card)["attachments"].([]map[string]interface{})
+	}
+	for _, entity := range teamsMentionEntities(n.Teams.Mentions) {
+		if !strings.Contains(activity.Text, entity.Text) {
+			activity.Text = strings.TrimSpace(activity.Text + " " + entity.Text)
+		}
+		activity.Entities = append(activity.Entities, entity)
+	}
+	if len(activity.Entities) > 0 {
+		// Teams resolves mentions in xml formatted messages only
+		activity.TextFormat = "xml"
+	}
+	return activity, nil
+}
+
+// sendBotMessage sends the message to the conversation of the recipient. Recipients in the user:<id> format
+// receive the message in the personal chat with the bot, which is created if necessary
+func (s teamsService) sendBotMessage(ctx context.Context, notification Notification, dest Destination) error {
+	serviceURL := strings.TrimRight(text.Coalesce(s.opts.Bot.ServiceURL, teamsBotDefaultServiceURL), "/")
+	transport := httputil.NewTransport(serviceURL, false)
+	if err := httputil.WithProxy(transport, s.opts.Proxy); err != nil {
+		return err
+	}
+	client := &http.Client{
+		Transport: &oauth2.Transport{
+			Source: s.botTokenSource,
+			Base:   httputil.NewLoggingRoundTripper(transport, log.WithField("service", "teams")),
+		},
+	}
+
+	activity, err := teamsNotificationToActivity(notification)
+	if err != nil {
+		return err
+	}
+
+	conversationID := dest.Recipient
+	if id, ok := s.opts.Bot.Conversations[dest.Recipient]; ok {
+		conversationID = id
+	}
+	if userID, ok := strings.CutPrefix(conversationID, "user:"); ok {
+		var conversation struct {
+			ID string `json:"id"`
+		}
+		err := teamsBotRequest(ctx, client, serviceURL+"/v3/conversations", map[string]interface{}{
+			"isGroup":     false,
+			"bot":         map[string]string{"id": s.opts.Bot.AppID},
+			"members":     []map[string]string{{"id": userID}},
+			"channelData": map[string]interface{}{"tenant": map[string]string{"id": s.opts.Bot.TenantID}},
+		}, &conversation)
+		if err != nil {
+			return fmt.Errorf("failed to create teams conversation with user %s: %w", userID, err)
+		}
+		conversationID = conversation.ID
+	}
+
+	return teamsBotRequest(ctx, client, fmt.Sprintf("%s/v3/conversations/%s/activities", serviceURL, url.PathEscape(conversationID)), activity, nil)
+}
+
+func teamsBotRequest(ctx context.Context, client *http.Client, requestURL string, body interface{}, result interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	response, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	responseData, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return NewHTTPError(response, fmt.Errorf("teams bot request error %d: %s", response.StatusCode, responseData))
+	}
+	if result != nil {
+		return json.Unmarshal(responseData, result)
+	}
+	return nil
+}
@@ -181,3 +181,250 @@ func TestTeams_MessageFields(t *testing.T) {
 			},
 		})
 }
+
+func TestTeams_AdaptiveCard(t *testing.T) {
+	var receivedBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.NoError(t, json.NewDecoder(request.Body).Decode(&receivedBody))
+		_, err := writer.Write([]byte("1"))
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+
+	service := NewTeamsService(TeamsOptions{
+		RecipientUrls: map[string]string{
+			"test": server.URL,
+		},
+	})
+
+	err := service.Send(Notification{
+		Teams: &TeamsNotification{
+			AdaptiveCard: `{
+				"type": "AdaptiveCard",
+				"version": "1.4",
+				"body": [{"type": "TextBlock", "text": "Application synced"}],
+				"actions": [{"type": "Action.OpenUrl", "title": "Open", "url": "https://argocd.example.com"}]
+			}`,
+		},
+	}, Destination{Recipient: "test", Service: "test"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "message", receivedBody["type"])
+	attachment := receivedBody["attachments"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "application/vnd.microsoft.card.adaptive", attachment["contentType"])
+	assert.Equal(t, "1.4", attachment["content"].(map[string]interface{})["version"])
+}
+
+func TestTeams_InvalidAdaptiveCard(t *testing.T) {
+	for card, expectedErr := range map[string]string{
+		`{"type": "MessageCard"}`:                                      "type must be 'AdaptiveCard' but got 'MessageCard'",
+		`{"type": "AdaptiveCard"}`:                                     "version is required",
+		`{"type": "AdaptiveCard", "version": "1.4", "body": {}}`:       "body must be an array",
+		`{"type": "AdaptiveCard", "version": "1.4", "body": ["text"]}`: "body[0] has no type",
+		`not json`: "teams adaptive card unmarshalling error",
+	} {
+		_, err := teamsNotificationToReader(Notification{Teams: &TeamsNotification{AdaptiveCard: card}})
+		assert.ErrorContains(t, err, expectedErr)
+	}
+}
+
+func TestTeams_WorkflowsWebhook(t *testing.T) {
+	var receivedBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.NoError(t, json.NewDecoder(request.Body).Decode(&receivedBody))
+		writer.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	service := NewTeamsService(TeamsOptions{
+		RecipientUrls: map[string]string{
+			"test": server.URL,
+		},
+		WebhookType: "workflows",
+	})
+
+	err := service.Send(Notification{
+		Message: "message",
+		Teams: &TeamsNotification{
+			Title:           "Application synced",
+			Facts:           `[{"name": "Sync Status", "value": "Synced"}]`,
+			PotentialAction: `[{"@type": "OpenUri", "name": "Open", "targets": [{"os": "default", "uri": "https://argocd.example.com"}]}]`,
+		},
+	}, Destination{Recipient: "test", Service: "test"})
+	assert.NoError(t, err)
+
+	attachment := receivedBody["attachments"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "application/vnd.microsoft.card.adaptive", attachment["contentType"])
+	card, err := json.Marshal(attachment["content"])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "AdaptiveCard",
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"version": "1.4",
+		"body": [
+			{"type": "TextBlock", "text": "Application synced", "size": "Medium", "weight": "Bolder", "wrap": true},
+			{"type": "TextBlock", "text": "message", "wrap": true},
+			{"type": "FactSet", "facts": [{"title": "Sync Status", "value": "Synced"}]}
+		],
+		"actions": [{"type": "Action.OpenUrl", "title": "Open", "url": "https://argocd.example.com"}]
+	}`, string(card))
+}
+
+func TestTeams_WorkflowsWebhookError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte("invalid card"))
+	}))
+	defer server.Close()
+
+	service := NewTeamsService(TeamsOptions{
+		RecipientUrls: map[string]string{
+			"test": server.URL,
+		},
+		WebhookType: "workflows",
+	})
+	err := service.Send(Notification{Message: "message"}, Destination{Recipient: "test", Service: "test"})
+	assert.EqualError(t, err, "teams workflows webhook post error 400: invalid card")
+}
+
+func TestTeams_BotMessage(t *testing.T) {
+	var activity map[string]interface{}
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests = append(requests, request.URL.Path)
+		switch request.URL.Path {
+		case "/token":
+			writer.Header().Set("Content-Type", "application/json")
+			_, _ = writer.Write([]byte(`{"access_token": "bot-token", "token_type": "Bearer", "expires_in": 3600}`))
+		case "/v3/conversations":
+			assert.Equal(t, "Bearer bot-token", request.Header.Get("Authorization"))
+			var body map[string]interface{}
+			assert.NoError(t, json.NewDecoder(request.Body).Decode(&body))
+			assert.Equal(t, []interface{}{map[string]interface{}{"id": "29:user"}}, body["members"])
+			_, _ = writer.Write([]byte(`{"id": "a:personal"}`))
+		default:
+			assert.Equal(t, "Bearer bot-token", request.Header.Get("Authorization"))
+			assert.NoError(t, json.NewDecoder(request.Body).Decode(&activity))
+			writer.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	service := NewTeamsService(TeamsOptions{
+		Bot: &TeamsBotOptions{
+			AppID:         "app",
+			AppPassword:   "password",
+			TenantID:      "tenant",
+			ServiceURL:    server.URL,
+			TokenURL:      server.URL + "/token",
+			Conversations: map[string]string{"ops": "19:ops@thread.tacv2"},
+		},
+	})
+
+	n := Notification{
+		Message: "Application synced",
+		Teams:   &TeamsNotification{Mentions: []TeamsMention{{ID: "{{.owner.id}}", Name: "{{.owner.name}}"}}},
+	}
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var notification Notification
+	assert.NoError(t, templater(&notification, map[string]interface{}{"owner": map[string]string{"id": "29:owner", "name": "Jane"}}))
+
+	assert.NoError(t, service.Send(notification, Destination{Recipient: "ops", Service: "teams"}))
+	assert.Equal(t, []string{"/token", "/v3/conversations/19:ops@thread.tacv2/activities"}, requests)
+	assert.Equal(t, "Application synced <at>Jane</at>", activity["text"])
+	assert.Equal(t, "xml", activity["textFormat"])
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"type":      "mention",
+		"text":      "<at>Jane</at>",
+		"mentioned": map[string]interface{}{"id": "29:owner", "name": "Jane"},
+	}}, activity["entities"])
+
+	requests, activity = nil, nil
+	assert.NoError(t, service.Send(Notification{Message: "hello"}, Destination{Recipient: "user:29:user", Service: "teams"}))
+	assert.Equal(t, []string{"/v3/conversations", "/v3/conversations/a:personal/activities"}, requests)
+	assert.Equal(t, "hello", activity["text"])
+	assert.Nil(t, activity["entities"])
+}
+
+func TestTeams_BotMessageError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/token" {
+			writer.Header().Set("Content-Type", "application/json")
+			_, _ = writer.Write([]byte(`{"access_token": "bot-token", "token_type": "Bearer"}`))
+			return
+		}
+		writer.WriteHeader(http.StatusForbidden)
+		_, _ = writer.Write([]byte("bot is not installed"))
+	}))
+	defer server.Close()
+
+	service := NewTeamsService(TeamsOptions{
+		Bot: &TeamsBotOptions{ServiceURL: server.URL, TokenURL: server.URL + "/token"},
+	})
+	err := service.Send(Notification{Message: "hello"}, Destination{Recipient: "19:ops@thread.tacv2", Service: "teams"})
+	assert.EqualError(t, err, "teams bot request error 403: bot is not installed")
+}
+
+func TestTeams_WorkflowsMentions(t *testing.T) {
+	n := Notification{
+		Message: "Application degraded",
+		Teams: &TeamsNotification{Mentions: []TeamsMention{
+			{ID: "{{.owner}}", Name: "Jane"},
+			{ID: "tag-id", Name: "oncall", Type: "tag"},
+		}},
+	}
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var notification Notification
+	assert.NoError(t, templater(&notification, map[string]interface{}{"owner": "jane@example.com"}))
+
+	data, err := teamsNotificationToWorkflowsReader(notification)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var message map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &message))
+	card := message["attachments"].([]interface{})[0].(map[string]interface{})["content"].(map[string]interface{})
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "TextBlock", "text": "Application degraded", "wrap": true},
+		map[string]interface{}{"type": "TextBlock", "text": "<at>Jane</at>", "wrap": true},
+	}, card["body"])
+	assert.Equal(t, map[string]interface{}{"entities": []interface{}{map[string]interface{}{
+		"type":      "mention",
+		"text":      "<at>Jane</at>",
+		"mentioned": map[string]interface{}{"id": "jane@example.com", "name": "Jane"},
+	}}}, card["msteams"])
+
+	activity, err := teamsNotificationToActivity(notification)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Application degraded <at>Jane</at> <at>oncall</at>", activity.Text)
+	assert.Equal(t, "tag", activity.Entities[1].Mentioned.Type)
+
+	_, err = (&TeamsNotification{Mentions: []TeamsMention{{ID: "id", Name: "ops", Type: "channel"}}}).GetTemplater("test", template.FuncMap{})
+	assert.EqualError(t, err, "error in 'test' teams.mentions : unsupported type 'channel'")
+}
+
+func TestTeams_WorkflowsMentionsReferencedByCard(t *testing.T) {
+	n := Notification{Teams: &TeamsNotification{
+		AdaptiveCard: `{"type": "AdaptiveCard", "version": "1.4", "body": [
+			{"type": "Container", "items": [{"type": "TextBlock", "text": "<at>Jane</at>, application degraded"}]}]}`,
+		Mentions: []TeamsMention{{ID: "jane@example.com", Name: "Jane"}},
+	}}
+
+	data, err := teamsNotificationToWorkflowsReader(n)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var message map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &message))
+	card := message["attachments"].([]interface{})[0].(map[string]interface{})["content"].(map[string]interface{})
+	assert.Len(t, card["body"], 1)
+	assert.Len(t, card["msteams"].(map[string]interface{})["entities"], 1)
+}
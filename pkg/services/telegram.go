@@ -1,54 +1,472 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
+	texttemplate "text/template"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/argoproj/notifications-engine/pkg/util/text"
+)
+
+// telegramParseModeNone sends the message as plain text
+const telegramParseModeNone = "None"
+
+// telegramMessageIDStateKeyPrefix prefixes the notification state keys holding the IDs of the messages updated by later notifications
+const telegramMessageIDStateKeyPrefix = "telegramMessageId."
+
+// Delivery policies of messages with a grouping key
+const (
+	telegramDeliveryPolicyPost          = "Post"
+	telegramDeliveryPolicyPostAndUpdate = "PostAndUpdate"
+	telegramDeliveryPolicyUpdate        = "Update"
 )
 
 type TelegramOptions struct {
 	Token string `json:"token"`
+	// DisableNotification sends messages silently unless the template overrides it
+	DisableNotification bool `json:"disableNotification"`
+}
+
+type TelegramNotification struct {
+	// ParseMode is the formatting of the message: Markdown (default), MarkdownV2, HTML or None
+	ParseMode string `json:"parseMode,omitempty"`
+	// Message overrides the notification message. The escape function escapes values according to the parse mode
+	Message string `json:"message,omitempty"`
+	// InlineKeyboard is the list of button rows attached to the message
+	InlineKeyboard [][]TelegramButton `json:"inlineKeyboard,omitempty"`
+	// Photo and Document send the message as the caption of the attached file. Only one of them can be set
+	Photo    *TelegramFile `json:"photo,omitempty"`
+	Document *TelegramFile `json:"document,omitempty"`
+	// DisableNotification sends the message silently, overriding the service configuration
+	DisableNotification *bool `json:"disableNotification,omitempty"`
+	// GroupingKey identifies the message updated by the notifications of the PostAndUpdate and Update delivery policies
+	GroupingKey string `json:"groupingKey,omitempty"`
+	// DeliveryPolicy is Post (default), PostAndUpdate or Update
+	DeliveryPolicy string `json:"deliveryPolicy,omitempty"`
+}
+
+// TelegramFile is a file attached to the message, either downloaded by Telegram from the URL or uploaded from the base64 encoded data
+type TelegramFile struct {
+	URL  string `json:"url,omitempty"`
+	Data string `json:"data,omitempty"`
+	// Name is the name of the uploaded file
+	Name string `json:"name,omitempty"`
+}
+
+// TelegramButton is an inline keyboard button that either opens the URL or sends the callback data to the bot
+type TelegramButton struct {
+	Text         string `json:"text"`
+	URL          string `json:"url,omitempty"`
+	CallbackData string `json:"callbackData,omitempty"`
+}
+
+// telegramMaxCallbackDataLength is the maximum size of the button callback data in bytes accepted by Telegram
+const telegramMaxCallbackDataLength = 64
+
+func (n *TelegramNotification) GetTemplater(name string, f texttemplate.FuncMap) (Templater, error) {
+	parseMode := n.ParseMode
+	switch parseMode {
+	case "":
+		parseMode = tgbotapi.ModeMarkdown
+	case tgbotapi.ModeMarkdown, tgbotapi.ModeMarkdownV2, tgbotapi.ModeHTML, telegramParseModeNone:
+	default:
+		return nil, fmt.Errorf("error in '%s' telegram.parseMode : unsupported value '%s'", name, n.ParseMode)
+	}
+
+	funcs := texttemplate.FuncMap{}
+	for k, v := range f {
+		funcs[k] = v
+	}
+	funcs["escape"] = func(value string) string {
+		if parseMode == telegramParseModeNone {
+			return value
+		}
+		return tgbotapi.EscapeText(parseMode, value)
+	}
+	message, err := texttemplate.New(name).Funcs(funcs).Parse(n.Message)
+	if err != nil {
+		return nil, fmt.Errorf("error in '%s' telegram.message : %w", name, err)
+	}
+
+	switch n.DeliveryPolicy {
+	case "", telegramDeliveryPolicyPost:
+	case telegramDeliveryPolicyPostAndUpdate, telegramDeliveryPolicyUpdate:
+		if n.GroupingKey == "" {
+			return nil, fmt.Errorf("error in '%s' telegram.deliveryPolicy : %s requires groupingKey", name, n.DeliveryPolicy)
+		}
+	default:
+		return nil, fmt.Errorf("error in '%s' telegram.deliveryPolicy : unsupported value '%s'", name, n.DeliveryPolicy)
+	}
+	groupingKey, err := texttemplate.New(name).Funcs(f).Parse(n.GroupingKey)
+	if err != nil {
+		return nil, fmt.Errorf("error in '%s' telegram.groupingKey : %w", name, err)
+	}
+
+	if n.Photo != nil && n.Document != nil {
+		return nil, fmt.Errorf("error in '%s' telegram : photo and document cannot be combined", name)
+	}
+	photo, err := n.Photo.compile(name, f)
+	if err != nil {
+		return nil, fmt.Errorf("error in '%s' telegram.photo : %w", name, err)
+	}
+	document, err := n.Document.compile(name, f)
+	if err != nil {
+		return nil, fmt.Errorf("error in '%s' telegram.document : %w", name, err)
+	}
+
+	var keyboard [][]compiledTelegramButton
+	for _, row := range n.InlineKeyboard {
+		var buttons []compiledTelegramButton
+		for _, button := range row {
+			if (button.URL == "") == (button.CallbackData == "") {
+				return nil, fmt.Errorf("error in '%s' telegram.inlineKeyboard : button '%s' must define either url or callbackData", name, button.Text)
+			}
+			compiled, err := button.compile(name, f)
+			if err != nil {
+				return nil, fmt.Errorf("error in '%s' telegram.inlineKeyboard : %w", name, err)
+			}
+			buttons = append(buttons, compiled)
+		}
+		keyboard = append(keyboard, buttons)
+	}
+
+	return func(notification *Notification, vars map[string]interface{}) error {
+		if notification.Telegram == nil {
+			notification.Telegram = &TelegramNotification{}
+		}
+		notification.Telegram.ParseMode = n.ParseMode
+		notification.Telegram.DisableNotification = n.DisableNotification
+		notification.Telegram.DeliveryPolicy = n.DeliveryPolicy
+
+		var groupingKeyData bytes.Buffer
+		if err := groupingKey.Execute(&groupingKeyData, vars); err != nil {
+			return err
+		}
+		notification.Telegram.GroupingKey = groupingKeyData.String()
+
+		var messageData bytes.Buffer
+		if err := message.Execute(&messageData, vars); err != nil {
+			return err
+		}
+		if val := messageData.String(); val != "" {
+			notification.Telegram.Message = val
+		}
+
+		var inlineKeyboard [][]TelegramButton
+		for _, row := range keyboard {
+			var buttons []TelegramButton
+			for _, button := range row {
+				rendered, err := button.execute(vars)
+				if err != nil {
+					return err
+				}
+				if len(rendered.CallbackData) > telegramMaxCallbackDataLength {
+					return fmt.Errorf("telegram callback data of button '%s' exceeds %d bytes", rendered.Text, telegramMaxCallbackDataLength)
+				}
+				buttons = append(buttons, rendered)
+			}
+			inlineKeyboard = append(inlineKeyboard, buttons)
+		}
+		notification.Telegram.InlineKeyboard = inlineKeyboard
+
+		if notification.Telegram.Photo, err = photo.execute(vars); err != nil {
+			return err
+		}
+		if notification.Telegram.Document, err = document.execute(vars); err != nil {
+			return err
+		}
+		return nil
+	}, nil
+}
+
+type compiledTelegramButton struct {
+	text         *texttemplate.Template
+	url          *texttemplate.Template
+	callbackData *texttemplate.Template
+}
+
+func (b TelegramButton) compile(name string, f texttemplate.FuncMap) (compiledTelegramButton, error) {
+	var compiled compiledTelegramButton
+	var err error
+	if compiled.text, err = texttemplate.New(name).Funcs(f).Parse(b.Text); err != nil {
+		return compiled, err
+	}
+	if compiled.url, err = texttemplate.New(name).Funcs(f).Parse(b.URL); err != nil {
+		return compiled, err
+	}
+	compiled.callbackData, err = texttemplate.New(name).Funcs(f).Parse(b.CallbackData)
+	return compiled, err
+}
+
+func (b compiledTelegramButton) execute(vars map[string]interface{}) (TelegramButton, error) {
+	var text, url, callbackData bytes.Buffer
+	if err := b.text.Execute(&text, vars); err != nil {
+		return TelegramButton{}, err
+	}
+	if err := b.url.Execute(&url, vars); err != nil {
+		return TelegramButton{}, err
+	}
+	if err := b.callbackData.Execute(&callbackData, vars); err != nil {
+		return TelegramButton{}, err
+	}
+	return TelegramButton{Text: text.String(), URL: url.String(), CallbackData: callbackData.String()}, nil
+}
+
+type compiledTelegramFile struct {
+	url  *texttemplate.Template
+	data *texttemplate.Template
+	name *texttemplate.Template
+}
+
+func (f *TelegramFile) compile(name string, funcs texttemplate.FuncMap) (*compiledTelegramFile, error) {
+	if f == nil {
+		return nil, nil
+	}
+	if (f.URL == "") == (f.Data == "") {
+		return nil, fmt.Errorf("either url or data must be set")
+	}
+	var compiled compiledTelegramFile
+	var err error
+	if compiled.url, err = texttemplate.New(name).Funcs(funcs).Parse(f.URL); err != nil {
+		return nil, err
+	}
+	if compiled.data, err = texttemplate.New(name).Funcs(funcs).Parse(f.Data); err != nil {
+		return nil, err
+	}
+	if compiled.name, err = texttemplate.New(name).Funcs(funcs).Parse(f.Name); err != nil {
+		return nil, err
+	}
+	return &compiled, nil
+}
+
+func (f *compiledTelegramFile) execute(vars map[string]interface{}) (*TelegramFile, error) {
+	if f == nil {
+		return nil, nil
+	}
+	var url, data, name bytes.Buffer
+	if err := f.url.Execute(&url, vars); err != nil {
+		return nil, err
+	}
+	if err := f.data.Execute(&data, vars); err != nil {
+		return nil, err
+	}
+	if err := f.name.Execute(&name, vars); err != nil {
+		return nil, err
+	}
+	return &TelegramFile{URL: url.String(), Data: data.String(), Name: name.String()}, nil
+}
+
+// requestFile returns the file downloaded by Telegram from the URL or the decoded file data
+func (f *TelegramFile) requestFile() (tgbotapi.RequestFileData, error) {
+	if f.URL != "" {
+		return tgbotapi.FileURL(f.URL), nil
+	}
+	data, err := base64.StdEncoding.DecodeString(f.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode telegram file data: %v", err)
+	}
+	return tgbotapi.FileBytes{Name: text.Coalesce(f.Name, "file"), Bytes: data}, nil
 }
 
 func NewTelegramService(opts TelegramOptions) NotificationService {
-	return &telegramService{opts: opts}
+	return &telegramService{opts: opts, apiEndpoint: tgbotapi.APIEndpoint}
 }
 
 type telegramService struct {
-	opts TelegramOptions
+	opts        TelegramOptions
+	apiEndpoint string
+}
+
+// telegramClient sends the requests of the bot using the context of the delivery
+type telegramClient struct {
+	ctx    context.Context
+	client *http.Client
+}
+
+func (c telegramClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req.WithContext(c.ctx))
 }
 
 func (s telegramService) Send(notification Notification, dest Destination) error {
-	bot, err := tgbotapi.NewBotAPI(s.opts.Token)
+	return s.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+func (s telegramService) SendWithContext(ctx context.Context, notification Notification, dest Destination, state State) error {
+	bot, err := tgbotapi.NewBotAPIWithClient(s.opts.Token, s.apiEndpoint, telegramClient{ctx: ctx, client: &http.Client{}})
 	if err != nil {
 		return err
 	}
 
-	if strings.HasPrefix(dest.Recipient, "-") {
-		chatID, err := strconv.ParseInt(dest.Recipient, 10, 64)
-		if err != nil {
-			return err
-		}
+	request, err := newTelegramRequest(notification, dest, s.opts.DisableNotification)
+	if err != nil {
+		return err
+	}
 
-		// Init message with ParseMode is 'Markdown'
-		msg := tgbotapi.NewMessage(chatID, notification.Message)
-		msg.ParseMode = "Markdown"
+	policy, messageIDStateKey := telegramDeliveryPolicyPost, ""
+	if n := notification.Telegram; n != nil && n.GroupingKey != "" && n.DeliveryPolicy != "" && n.DeliveryPolicy != telegramDeliveryPolicyPost {
+		policy = n.DeliveryPolicy
+		messageIDStateKey = telegramMessageIDStateKeyPrefix + dest.Recipient + "." + n.GroupingKey
+	}
 
-		_, err = bot.Send(msg)
-		if err != nil {
+	if messageID := state[messageIDStateKey]; messageIDStateKey != "" && messageID != "" {
+		_, err := bot.MakeRequest(newTelegramEditRequest(request, messageID))
+		var apiErr *tgbotapi.Error
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &apiErr) && strings.Contains(apiErr.Message, "message is not modified"):
+			return nil
+		case errors.As(err, &apiErr) && strings.Contains(apiErr.Message, "message to edit not found"):
+			delete(state, messageIDStateKey)
+		default:
 			return err
 		}
+	}
+	if policy == telegramDeliveryPolicyUpdate {
+		return nil
+	}
+
+	var resp *tgbotapi.APIResponse
+	if len(request.files) > 0 {
+		resp, err = bot.UploadFiles(request.method, request.params, request.files)
 	} else {
-		// Init message with ParseMode is 'Markdown'
-		msg := tgbotapi.NewMessageToChannel("@"+dest.Recipient, notification.Message)
-		msg.ParseMode = "Markdown"
+		resp, err = bot.MakeRequest(request.method, request.params)
+	}
+	if err != nil || messageIDStateKey == "" {
+		return err
+	}
 
-		_, err := bot.Send(msg)
-		if err != nil {
-			return err
+	var message tgbotapi.Message
+	if err := json.Unmarshal(resp.Result, &message); err != nil {
+		return fmt.Errorf("failed to parse telegram message: %v", err)
+	}
+	state[messageIDStateKey] = strconv.Itoa(message.MessageID)
+	return nil
+}
+
+// newTelegramEditRequest returns the method and parameters replacing the text or the caption and the inline keyboard of the message
+func newTelegramEditRequest(request *telegramRequest, messageID string) (string, tgbotapi.Params) {
+	method := "editMessageText"
+	params := tgbotapi.Params{"chat_id": request.params["chat_id"], "message_id": messageID}
+	if text, ok := request.params["text"]; ok {
+		params["text"] = text
+	} else {
+		method = "editMessageCaption"
+		params.AddNonEmpty("caption", request.params["caption"])
+	}
+	params.AddNonEmpty("parse_mode", request.params["parse_mode"])
+	params.AddNonEmpty("reply_markup", request.params["reply_markup"])
+	return method, params
+}
+
+// telegramRequest is a Bot API request. The request parameters are built manually since the Bot API
+// client does not support all parameters, e.g. message_thread_id
+type telegramRequest struct {
+	method string
+	params tgbotapi.Params
+	files  []tgbotapi.RequestFile
+}
+
+// parseTelegramRecipient parses the recipient in the <chat ID or channel username>[|<topic ID>] format
+func parseTelegramRecipient(recipient string) (chat string, topicID int64, err error) {
+	chat, topic, hasTopic := strings.Cut(recipient, "|")
+	if hasTopic {
+		if topicID, err = strconv.ParseInt(topic, 10, 64); err != nil {
+			return "", 0, fmt.Errorf("invalid telegram topic id '%s': %v", topic, err)
+		}
+	}
+	if strings.HasPrefix(chat, "-") {
+		if _, err := strconv.ParseInt(chat, 10, 64); err != nil {
+			return "", 0, err
 		}
+		return chat, topicID, nil
 	}
+	return "@" + chat, topicID, nil
+}
 
-	return nil
+// newTelegramRequest builds the request sending the message to the chat ID or the public channel username of the recipient
+func newTelegramRequest(notification Notification, dest Destination, disableNotification bool) (*telegramRequest, error) {
+	message := notification.Message
+	parseMode := tgbotapi.ModeMarkdown
+	telegramNotification := notification.Telegram
+	if telegramNotification == nil {
+		telegramNotification = &TelegramNotification{}
+	}
+	if telegramNotification.Message != "" {
+		message = telegramNotification.Message
+	}
+	switch telegramNotification.ParseMode {
+	case "":
+	case telegramParseModeNone:
+		parseMode = ""
+	default:
+		parseMode = telegramNotification.ParseMode
+	}
+
+	chat, topicID, err := parseTelegramRecipient(dest.Recipient)
+	if err != nil {
+		return nil, err
+	}
+	if topic := dest.Parameters["topic"]; topic != "" {
+		if topicID, err = strconv.ParseInt(topic, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid telegram topic id '%s': %v", topic, err)
+		}
+	}
+	request := &telegramRequest{method: "sendMessage", params: tgbotapi.Params{}}
+	request.params["chat_id"] = chat
+	request.params.AddNonZero64("message_thread_id", topicID)
+	request.params.AddNonEmpty("parse_mode", parseMode)
+	if telegramNotification.DisableNotification != nil {
+		disableNotification = *telegramNotification.DisableNotification
+	}
+	request.params.AddBool("disable_notification", disableNotification)
+	if len(telegramNotification.InlineKeyboard) > 0 {
+		if err := request.params.AddInterface("reply_markup", telegramNotification.replyMarkup()); err != nil {
+			return nil, err
+		}
+	}
+
+	var file *TelegramFile
+	var fileField string
+	switch {
+	case telegramNotification.Photo != nil:
+		request.method, file, fileField = "sendPhoto", telegramNotification.Photo, "photo"
+	case telegramNotification.Document != nil:
+		request.method, file, fileField = "sendDocument", telegramNotification.Document, "document"
+	default:
+		request.params["text"] = message
+		return request, nil
+	}
+	data, err := file.requestFile()
+	if err != nil {
+		return nil, err
+	}
+	request.params.AddNonEmpty("caption", message)
+	request.files = append(request.files, tgbotapi.RequestFile{Name: fileField, Data: data})
+	return request, nil
+}
+
+func (n *TelegramNotification) replyMarkup() tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, row := range n.InlineKeyboard {
+		var buttons []tgbotapi.InlineKeyboardButton
+		for _, button := range row {
+			if button.URL != "" {
+				buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonURL(button.Text, button.URL))
+			} else {
+				buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(button.Text, button.CallbackData))
+			}
+		}
+		rows = append(rows, buttons)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
 }
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTemplater_Telegram(t *testing.T) {
+	n := Notification{
+		Message: "fallback",
+		Telegram: &TelegramNotification{
+			ParseMode: "MarkdownV2",
+			Message:   "*{{escape .app}}* synced to `{{.revision}}`",
+		},
+	}
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var notification Notification
+	err = templater(&notification, map[string]interface{}{"app": "guest-book.v2", "revision": "abc"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "fallback", notification.Message)
+	assert.Equal(t, &TelegramNotification{ParseMode: "MarkdownV2", Message: `*guest\-book\.v2* synced to ` + "`abc`"}, notification.Telegram)
+}
+
+func TestGetTemplater_TelegramInvalidParseMode(t *testing.T) {
+	_, err := (&TelegramNotification{ParseMode: "Markdown3"}).GetTemplater("test", template.FuncMap{})
+	assert.EqualError(t, err, "error in 'test' telegram.parseMode : unsupported value 'Markdown3'")
+}
+
+func TestNewTelegramRequest(t *testing.T) {
+	request, err := newTelegramRequest(Notification{Message: "hello"}, Destination{Recipient: "-100123"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "sendMessage", request.method)
+	assert.Equal(t, tgbotapi.Params{"chat_id": "-100123", "parse_mode": "Markdown", "text": "hello"}, request.params)
+
+	request, err = newTelegramRequest(Notification{
+		Message:  "hello",
+		Telegram: &TelegramNotification{ParseMode: "HTML", Message: "<b>hello</b>"},
+	}, Destination{Recipient: "channel"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, tgbotapi.Params{"chat_id": "@channel", "parse_mode": "HTML", "text": "<b>hello</b>"}, request.params)
+
+	request, err = newTelegramRequest(Notification{
+		Message:  "snake_case",
+		Telegram: &TelegramNotification{ParseMode: "None"},
+	}, Destination{Recipient: "channel"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, tgbotapi.Params{"chat_id": "@channel", "text": "snake_case"}, request.params)
+
+	_, err = newTelegramRequest(Notification{Message: "hello"}, Destination{Recipient: "-abc"}, false)
+	assert.Error(t, err)
+}
+
+func TestNewTelegramRequest_Topic(t *testing.T) {
+	request, err := newTelegramRequest(Notification{Message: "hello"}, Destination{Recipient: "-100123|42"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "-100123", request.params["chat_id"])
+	assert.Equal(t, "42", request.params["message_thread_id"])
+
+	request, err = newTelegramRequest(Notification{Message: "hello"}, Destination{Recipient: "supergroup|7"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "@supergroup", request.params["chat_id"])
+	assert.Equal(t, "7", request.params["message_thread_id"])
+
+	_, err = newTelegramRequest(Notification{Message: "hello"}, Destination{Recipient: "-100123|general"}, false)
+	assert.ErrorContains(t, err, "invalid telegram topic id 'general'")
+
+	request, err = newTelegramRequest(Notification{Message: "hello"}, Destination{Recipient: "-100123", Parameters: map[string]string{"topic": "9"}}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "-100123", request.params["chat_id"])
+	assert.Equal(t, "9", request.params["message_thread_id"])
+}
+
+func TestGetTemplater_TelegramInlineKeyboard(t *testing.T) {
+	n := Notification{
+		Telegram: &TelegramNotification{
+			InlineKeyboard: [][]TelegramButton{{
+				{Text: "View in Argo CD", URL: "https://argocd.example.com/applications/{{.app}}"},
+				{Text: "Acknowledge", CallbackData: "ack:{{.app}}"},
+			}},
+		},
+	}
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var notification Notification
+	assert.NoError(t, templater(&notification, map[string]interface{}{"app": "guestbook"}))
+	assert.Equal(t, [][]TelegramButton{{
+		{Text: "View in Argo CD", URL: "https://argocd.example.com/applications/guestbook"},
+		{Text: "Acknowledge", CallbackData: "ack:guestbook"},
+	}}, notification.Telegram.InlineKeyboard)
+
+	request, err := newTelegramRequest(notification, Destination{Recipient: "channel"}, false)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"inline_keyboard": [[
+		{"text": "View in Argo CD", "url": "https://argocd.example.com/applications/guestbook"},
+		{"text": "Acknowledge", "callback_data": "ack:guestbook"}
+	]]}`, request.params["reply_markup"])
+}
+
+func TestGetTemplater_TelegramInvalidButton(t *testing.T) {
+	_, err := (&TelegramNotification{
+		InlineKeyboard: [][]TelegramButton{{{Text: "Open", URL: "https://example.com", CallbackData: "open"}}},
+	}).GetTemplater("test", template.FuncMap{})
+	assert.EqualError(t, err, "error in 'test' telegram.inlineKeyboard : button 'Open' must define either url or callbackData")
+
+	templater, err := (&TelegramNotification{
+		InlineKeyboard: [][]TelegramButton{{{Text: "Ack", CallbackData: "{{.data}}"}}},
+	}).GetTemplater("test", template.FuncMap{})
+	assert.NoError(t, err)
+	err = templater(&Notification{}, map[string]interface{}{"data": strings.Repeat("x", 65)})
+	assert.EqualError(t, err, "telegram callback data of button 'Ack' exceeds 64 bytes")
+}
+
+func TestNewTelegramRequest_Attachments(t *testing.T) {
+	n := Notification{
+		Message: "status",
+		Telegram: &TelegramNotification{
+			Photo: &TelegramFile{URL: "https://badges.example.com/{{.app}}.png"},
+		},
+	}
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var notification Notification
+	assert.NoError(t, templater(&notification, map[string]interface{}{"app": "guestbook"}))
+
+	request, err := newTelegramRequest(notification, Destination{Recipient: "-100123"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "sendPhoto", request.method)
+	assert.Equal(t, tgbotapi.Params{"chat_id": "-100123", "parse_mode": "Markdown", "caption": "status"}, request.params)
+	assert.Equal(t, []tgbotapi.RequestFile{{Name: "photo", Data: tgbotapi.FileURL("https://badges.example.com/guestbook.png")}}, request.files)
+
+	request, err = newTelegramRequest(Notification{
+		Message:  "logs",
+		Telegram: &TelegramNotification{Document: &TelegramFile{Data: "aGVsbG8=", Name: "sync.log"}},
+	}, Destination{Recipient: "channel"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "sendDocument", request.method)
+	assert.Equal(t, []tgbotapi.RequestFile{{Name: "document", Data: tgbotapi.FileBytes{Name: "sync.log", Bytes: []byte("hello")}}}, request.files)
+}
+
+func TestGetTemplater_TelegramInvalidAttachments(t *testing.T) {
+	_, err := (&TelegramNotification{Photo: &TelegramFile{}, Document: &TelegramFile{}}).GetTemplater("test", template.FuncMap{})
+	assert.EqualError(t, err, "error in 'test' telegram : photo and document cannot be combined")
+
+	_, err = (&TelegramNotification{Photo: &TelegramFile{URL: "https://example.com/a.png", Data: "aGVsbG8="}}).GetTemplater("test", template.FuncMap{})
+	assert.EqualError(t, err, "error in 'test' telegram.photo : either url or data must be set")
+}
+
+func TestNewTelegramRequest_DisableNotification(t *testing.T) {
+	request, err := newTelegramRequest(Notification{Message: "hello"}, Destination{Recipient: "channel"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "true", request.params["disable_notification"])
+
+	loud := false
+	request, err = newTelegramRequest(Notification{
+		Message:  "critical",
+		Telegram: &TelegramNotification{DisableNotification: &loud},
+	}, Destination{Recipient: "channel"}, true)
+	assert.NoError(t, err)
+	assert.NotContains(t, request.params, "disable_notification")
+
+	silent := true
+	templater, err := (&TelegramNotification{DisableNotification: &silent}).GetTemplater("", template.FuncMap{})
+	assert.NoError(t, err)
+	var notification Notification
+	assert.NoError(t, templater(&notification, map[string]interface{}{}))
+	request, err = newTelegramRequest(notification, Destination{Recipient: "channel"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "true", request.params["disable_notification"])
+}
+
+func TestSendWithContext_TelegramUpdate(t *testing.T) {
+	var requests []string
+	var edited string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		requests = append(requests, method)
+		switch method {
+		case "getMe":
+			_, _ = w.Write([]byte(`{"ok": true, "result": {"id": 1, "is_bot": true, "username": "argocd_bot"}}`))
+		case "sendMessage":
+			_, _ = w.Write([]byte(`{"ok": true, "result": {"message_id": 42, "chat": {"id": -100123}}}`))
+		case "editMessageText":
+			assert.Equal(t, "42", r.Form.Get("message_id"))
+			if r.Form.Get("text") == edited {
+				_, _ = w.Write([]byte(`{"ok": false, "error_code": 400, "description": "Bad Request: message is not modified"}`))
+				return
+			}
+			edited = r.Form.Get("text")
+			_, _ = w.Write([]byte(`{"ok": true, "result": {"message_id": 42, "chat": {"id": -100123}}}`))
+		}
+	}))
+	defer server.Close()
+
+	s := &telegramService{opts: TelegramOptions{Token: "token"}, apiEndpoint: server.URL + "/bot%s/%s"}
+	templater, err := (&TelegramNotification{GroupingKey: "{{.app}}", DeliveryPolicy: "PostAndUpdate"}).GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var notification Notification
+	assert.NoError(t, templater(&notification, map[string]interface{}{"app": "guestbook"}))
+
+	state := State{}
+	notification.Message = "Syncing"
+	assert.NoError(t, s.SendWithContext(context.Background(), notification, Destination{Recipient: "-100123"}, state))
+	assert.Equal(t, State{"telegramMessageId.-100123.guestbook": "42"}, state)
+
+	notification.Message = "Synced"
+	assert.NoError(t, s.SendWithContext(context.Background(), notification, Destination{Recipient: "-100123"}, state))
+	assert.NoError(t, s.SendWithContext(context.Background(), notification, Destination{Recipient: "-100123"}, state))
+	assert.Equal(t, "Synced", edited)
+	assert.Equal(t, []string{"getMe", "sendMessage", "getMe", "editMessageText", "getMe", "editMessageText"}, requests)
+
+	requests = nil
+	notification.Telegram.DeliveryPolicy = "Update"
+	assert.NoError(t, s.SendWithContext(context.Background(), notification, Destination{Recipient: "-100456"}, state))
+	assert.Equal(t, []string{"getMe"}, requests)
+}
+
+func TestNewTelegramEditRequest(t *testing.T) {
+	request, err := newTelegramRequest(Notification{
+		Message:  "synced",
+		Telegram: &TelegramNotification{Photo: &TelegramFile{URL: "https://badges.example.com/guestbook.png"}},
+	}, Destination{Recipient: "-100123|7"}, false)
+	assert.NoError(t, err)
+	method, params := newTelegramEditRequest(request, "42")
+	assert.Equal(t, "editMessageCaption", method)
+	assert.Equal(t, tgbotapi.Params{"chat_id": "-100123", "message_id": "42", "caption": "synced", "parse_mode": "Markdown"}, params)
+}
+
+func TestGetTemplater_TelegramInvalidDeliveryPolicy(t *testing.T) {
+	_, err := (&TelegramNotification{DeliveryPolicy: "Update"}).GetTemplater("test", template.FuncMap{})
+	assert.EqualError(t, err, "error in 'test' telegram.deliveryPolicy : Update requires groupingKey")
+
+	_, err = (&TelegramNotification{DeliveryPolicy: "Edit", GroupingKey: "key"}).GetTemplater("test", template.FuncMap{})
+	assert.EqualError(t, err, "error in 'test' telegram.deliveryPolicy : unsupported value 'Edit'")
+}
@@ -2,21 +2,27 @@ package services
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"regexp"
 	"strings"
+	texttemplate "text/template"
 
 	log "github.com/sirupsen/logrus"
 
 	httputil "github.com/argoproj/notifications-engine/pkg/util/http"
+	"github.com/argoproj/notifications-engine/pkg/util/text"
 )
 
 type WebexOptions struct {
 	Token  string `json:"token"`
 	ApiURL string `json:"apiURL"`
+	Proxy  string `json:"proxy"`
 }
 
 type webexService struct {
@@ -24,9 +30,84 @@ type webexService struct {
 }
 
 type webexMessage struct {
-	ToPersonEmail string `json:"toPersonEmail,omitempty"`
-	RoomId        string `json:"roomId,omitempty"`
-	Markdown      string `json:"markdown,omitempty"`
+	ToPersonEmail string            `json:"toPersonEmail,omitempty"`
+	RoomId        string            `json:"roomId,omitempty"`
+	Markdown      string            `json:"markdown,omitempty"`
+	Files         []string          `json:"files,omitempty"`
+	Attachments   []webexAttachment `json:"attachments,omitempty"`
+}
+
+type webexAttachment struct {
+	ContentType string          `json:"contentType"`
+	Content     json.RawMessage `json:"content"`
+}
+
+type WebexNotification struct {
+	// AdaptiveCard is the JSON of the Adaptive Card attached to the message. The message is shown by clients unable to render cards
+	AdaptiveCard string `json:"adaptiveCard,omitempty"`
+	// File is attached to the message, either downloaded by Webex from the public URL or uploaded from the base64 encoded data
+	File *WebexFile `json:"file,omitempty"`
+}
+
+type WebexFile struct {
+	URL  string `json:"url,omitempty"`
+	Data string `json:"data,omitempty"`
+	// Name is the name of the uploaded file
+	Name string `json:"name,omitempty"`
+}
+
+const webexAdaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+
+func (n *WebexNotification) GetTemplater(name string, f texttemplate.FuncMap) (Templater, error) {
+	if n.AdaptiveCard != "" && n.File != nil {
+		return nil, fmt.Errorf("error in '%s' webex : adaptiveCard and file cannot be combined", name)
+	}
+	adaptiveCard, err := texttemplate.New(name).Funcs(f).Parse(n.AdaptiveCard)
+	if err != nil {
+		return nil, fmt.Errorf("error in '%s' webex.adaptiveCard : %w", name, err)
+	}
+
+	var fileURL, fileData, fileName *texttemplate.Template
+	if n.File != nil {
+		if (n.File.URL == "") == (n.File.Data == "") {
+			return nil, fmt.Errorf("error in '%s' webex.file : either url or data must be set", name)
+		}
+		if fileURL, err = texttemplate.New(name).Funcs(f).Parse(n.File.URL); err != nil {
+			return nil, fmt.Errorf("error in '%s' webex.file.url : %w", name, err)
+		}
+		if fileData, err = texttemplate.New(name).Funcs(f).Parse(n.File.Data); err != nil {
+			return nil, fmt.Errorf("error in '%s' webex.file.data : %w", name, err)
+		}
+		if fileName, err = texttemplate.New(name).Funcs(f).Parse(n.File.Name); err != nil {
+			return nil, fmt.Errorf("error in '%s' webex.file.name : %w", name, err)
+		}
+	}
+
+	return func(notification *Notification, vars map[string]interface{}) error {
+		if notification.Webex == nil {
+			notification.Webex = &WebexNotification{}
+		}
+		var adaptiveCardData bytes.Buffer
+		if err := adaptiveCard.Execute(&adaptiveCardData, vars); err != nil {
+			return err
+		}
+		notification.Webex.AdaptiveCard = adaptiveCardData.String()
+
+		if n.File != nil {
+			var urlData, dataData, nameData bytes.Buffer
+			if err := fileURL.Execute(&urlData, vars); err != nil {
+				return err
+			}
+			if err := fileData.Execute(&dataData, vars); err != nil {
+				return err
+			}
+			if err := fileName.Execute(&nameData, vars); err != nil {
+				return err
+			}
+			notification.Webex.File = &WebexFile{URL: urlData.String(), Data: dataData.String(), Name: nameData.String()}
+		}
+		return nil
+	}, nil
 }
 
 func NewWebexService(opts WebexOptions) NotificationService {
@@ -41,11 +122,19 @@ func NewWebexService(opts WebexOptions) NotificationService {
 var validEmail = regexp.MustCompile(`^\S+@\S+\.\S+$`)
 
 func (w webexService) Send(notification Notification, dest Destination) error {
+	return w.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+// SendWithContext sends the notification using the given context
+func (w webexService) SendWithContext(ctx context.Context, notification Notification, dest Destination, _ State) error {
 	requestURL := fmt.Sprintf("%s/v1/messages", w.opts.ApiURL)
 
+	transport := httputil.NewTransport(requestURL, false)
+	if err := httputil.WithProxy(transport, w.opts.Proxy); err != nil {
+		return err
+	}
 	client := &http.Client{
-		Transport: httputil.NewLoggingRoundTripper(
-			httputil.NewTransport(requestURL, false), log.WithField("service", dest.Service)),
+		Transport: httputil.NewLoggingRoundTripper(transport, log.WithField("service", dest.Service)),
 	}
 
 	message := webexMessage{
@@ -59,19 +148,19 @@ func (w webexService) Send(notification Notification, dest Destination) error {
 		message.RoomId = dest.Recipient
 	}
 
-	jsonValue, err := json.Marshal(message)
+	body, contentType, err := newWebexRequestBody(message, notification.Webex)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, requestURL, bytes.NewBuffer(jsonValue))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, body)
 	if err != nil {
 		return err
 	}
 
 	apiToken := fmt.Sprintf("Bearer %s", w.opts.Token)
 
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("Authorization", apiToken)
 
 	response, err := client.Do(req)
@@ -89,8 +178,59 @@ func (w webexService) Send(notification Notification, dest Destination) error {
 	}
 
 	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("request to %s has failed with error code %d : %s", requestURL, response.StatusCode, string(data))
+		return NewHTTPError(response, fmt.Errorf("request to %s has failed with error code %d : %s", requestURL, response.StatusCode, string(data)))
 	}
 
 	return nil
 }
+
+// newWebexRequestBody returns the JSON body of the message, or a multipart body if the message uploads a file
+func newWebexRequestBody(message webexMessage, n *WebexNotification) (io.Reader, string, error) {
+	if n != nil && n.AdaptiveCard != "" {
+		var card map[string]interface{}
+		if err := json.Unmarshal([]byte(n.AdaptiveCard), &card); err != nil {
+			return nil, "", fmt.Errorf("webex adaptive card unmarshalling error: %w", err)
+		}
+		if card["type"] != "AdaptiveCard" {
+			return nil, "", fmt.Errorf("webex adaptive card must have the AdaptiveCard type")
+		}
+		message.Attachments = []webexAttachment{{ContentType: webexAdaptiveCardContentType, Content: json.RawMessage(n.AdaptiveCard)}}
+	}
+
+	if n != nil && n.File != nil && n.File.Data != "" {
+		data, err := base64.StdEncoding.DecodeString(n.File.Data)
+		if err != nil {
+			return nil, "", fmt.Errorf("webex file data is not base64 encoded: %w", err)
+		}
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		for field, value := range map[string]string{"toPersonEmail": message.ToPersonEmail, "roomId": message.RoomId, "markdown": message.Markdown} {
+			if value == "" {
+				continue
+			}
+			if err := writer.WriteField(field, value); err != nil {
+				return nil, "", err
+			}
+		}
+		part, err := writer.CreateFormFile("files", text.Coalesce(n.File.Name, "file"))
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(data); err != nil {
+			return nil, "", err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, "", err
+		}
+		return &body, writer.FormDataContentType(), nil
+	}
+
+	if n != nil && n.File != nil {
+		message.Files = []string{n.File.URL}
+	}
+	jsonValue, err := json.Marshal(message)
+	if err != nil {
+		return nil, "", err
+	}
+	return bytes.NewBuffer(jsonValue), "application/json", nil
+}
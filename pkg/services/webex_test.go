@@ -1,10 +1,12 @@
 package services
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"text/template"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -121,3 +123,82 @@ func TestSend_Webex(t *testing.T) {
 	})
 
 }
+
+func TestSend_WebexAdaptiveCard(t *testing.T) {
+	var body map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer ts.Close()
+
+	n := Notification{
+		Message: "{{.app}} synced",
+		Webex:   &WebexNotification{AdaptiveCard: `{"type": "AdaptiveCard", "version": "1.3", "body": [{"type": "TextBlock", "text": "{{.app}} synced"}]}`},
+	}
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	notification := Notification{Message: "guestbook synced"}
+	assert.NoError(t, templater(&notification, map[string]interface{}{"app": "guestbook"}))
+
+	service := NewWebexService(WebexOptions{Token: "token", ApiURL: ts.URL})
+	assert.NoError(t, service.Send(notification, Destination{Service: "webex", Recipient: "room"}))
+	assert.Equal(t, "guestbook synced", body["markdown"])
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"contentType": "application/vnd.microsoft.card.adaptive",
+		"content": map[string]interface{}{
+			"type":    "AdaptiveCard",
+			"version": "1.3",
+			"body":    []interface{}{map[string]interface{}{"type": "TextBlock", "text": "guestbook synced"}},
+		},
+	}}, body["attachments"])
+}
+
+func TestSend_WebexFile(t *testing.T) {
+	t.Run("url", func(t *testing.T) {
+		var body map[string]interface{}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		}))
+		defer ts.Close()
+
+		service := NewWebexService(WebexOptions{Token: "token", ApiURL: ts.URL})
+		err := service.Send(Notification{
+			Message: "report",
+			Webex:   &WebexNotification{File: &WebexFile{URL: "https://example.com/report.pdf"}},
+		}, Destination{Service: "webex", Recipient: "room"})
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{"https://example.com/report.pdf"}, body["files"])
+	})
+
+	t.Run("data", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.NoError(t, r.ParseMultipartForm(1024))
+			assert.Equal(t, "room", r.FormValue("roomId"))
+			assert.Equal(t, "logs", r.FormValue("markdown"))
+			file, header, err := r.FormFile("files")
+			if assert.NoError(t, err) {
+				data, _ := io.ReadAll(file)
+				assert.Equal(t, "hello", string(data))
+				assert.Equal(t, "sync.log", header.Filename)
+			}
+		}))
+		defer ts.Close()
+
+		service := NewWebexService(WebexOptions{Token: "token", ApiURL: ts.URL})
+		err := service.Send(Notification{
+			Message: "logs",
+			Webex:   &WebexNotification{File: &WebexFile{Data: "aGVsbG8=", Name: "sync.log"}},
+		}, Destination{Service: "webex", Recipient: "room"})
+		assert.NoError(t, err)
+	})
+}
+
+func TestGetTemplater_WebexInvalid(t *testing.T) {
+	_, err := (&WebexNotification{AdaptiveCard: "{}", File: &WebexFile{URL: "https://example.com"}}).GetTemplater("test", template.FuncMap{})
+	assert.EqualError(t, err, "error in 'test' webex : adaptiveCard and file cannot be combined")
+
+	_, err = (&WebexNotification{File: &WebexFile{}}).GetTemplater("test", template.FuncMap{})
+	assert.EqualError(t, err, "error in 'test' webex.file : either url or data must be set")
+}
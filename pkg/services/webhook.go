@@ -2,14 +2,27 @@ package services
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	texttemplate "text/template"
 	"time"
 
 	"github.com/hashicorp/go-retryablehttp"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"k8s.io/client-go/util/jsonpath"
 
 	log "github.com/sirupsen/logrus"
 
@@ -21,14 +34,29 @@ type WebhookNotification struct {
 	Method string `json:"method"`
 	Body   string `json:"body"`
 	Path   string `json:"path"`
+	// Headers are added to the request in addition to the headers configured in the service. Headers with empty values are omitted
+	Headers []Header `json:"headers,omitempty"`
+	// Capture maps notification state keys to JSONPath expressions evaluated against the JSON response body.
+	// Captured values are available in subsequent templates and triggers as {{.state.<key>}}
+	Capture map[string]string `json:"capture,omitempty"`
+	// URLs overrides the target URLs configured in the service. Templates rendering to an empty string are skipped
+	URLs []string `json:"urls,omitempty"`
 }
 
 type WebhookNotifications map[string]WebhookNotification
 
 type compiledWebhookTemplate struct {
-	body   *texttemplate.Template
-	path   *texttemplate.Template
-	method string
+	body    *texttemplate.Template
+	path    *texttemplate.Template
+	headers []compiledWebhookHeader
+	method  string
+	capture map[string]string
+	urls    []*texttemplate.Template
+}
+
+type compiledWebhookHeader struct {
+	name  string
+	value *texttemplate.Template
 }
 
 func (n WebhookNotifications) GetTemplater(name string, f texttemplate.FuncMap) (Templater, error) {
@@ -42,7 +70,28 @@ func (n WebhookNotifications) GetTemplater(name string, f texttemplate.FuncMap)
 		if err != nil {
 			return nil, err
 		}
-		webhooks[k] = compiledWebhookTemplate{body: body, method: v.Method, path: path}
+		var headers []compiledWebhookHeader
+		for _, header := range v.Headers {
+			value, err := texttemplate.New(name + k + header.Name).Funcs(f).Parse(header.Value)
+			if err != nil {
+				return nil, err
+			}
+			headers = append(headers, compiledWebhookHeader{name: header.Name, value: value})
+		}
+		for key, expr := range v.Capture {
+			if _, err := parseJSONPath(key, expr); err != nil {
+				return nil, err
+			}
+		}
+		var urls []*texttemplate.Template
+		for _, u := range v.URLs {
+			urlTemplate, err := texttemplate.New(name + k).Funcs(f).Parse(u)
+			if err != nil {
+				return nil, err
+			}
+			urls = append(urls, urlTemplate)
+		}
+		webhooks[k] = compiledWebhookTemplate{body: body, method: v.Method, path: path, headers: headers, capture: v.Capture, urls: urls}
 	}
 	return func(notification *Notification, vars map[string]interface{}) error {
 		for k, v := range webhooks {
@@ -59,10 +108,31 @@ func (n WebhookNotifications) GetTemplater(name string, f texttemplate.FuncMap)
 			if err != nil {
 				return err
 			}
+			var headers []Header
+			for _, header := range webhooks[k].headers {
+				var value bytes.Buffer
+				if err := header.value.Execute(&value, vars); err != nil {
+					return err
+				}
+				headers = append(headers, Header{Name: header.name, Value: value.String()})
+			}
+			var urls []string
+			for _, urlTemplate := range webhooks[k].urls {
+				var u bytes.Buffer
+				if err := urlTemplate.Execute(&u, vars); err != nil {
+					return err
+				}
+				if u.Len() > 0 {
+					urls = append(urls, u.String())
+				}
+			}
 			notification.Webhook[k] = WebhookNotification{
-				Method: v.method,
-				Body:   body.String(),
-				Path:   path.String(),
+				Method:  v.method,
+				Body:    body.String(),
+				Path:    path.String(),
+				Headers: headers,
+				Capture: v.capture,
+				URLs:    urls,
 			}
 		}
 		return nil
@@ -79,16 +149,145 @@ type BasicAuth struct {
 	Password string `json:"password"`
 }
 
+// WebhookSignature configures HMAC signing of the request body
+type WebhookSignature struct {
+	// Secret is the shared secret used to compute the signature
+	Secret string `json:"secret"`
+	// Header is the name of the header holding the signature. Defaults to X-Hub-Signature-256
+	Header string `json:"header"`
+	// Algorithm is the hash function used for HMAC: sha1, sha256 (default) or sha512
+	Algorithm string `json:"algorithm"`
+}
+
+var webhookSignatureAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// sign returns the signature of the given body in the <algorithm>=<hex digest> format used by GitHub
+func (s *WebhookSignature) sign(body []byte) (string, error) {
+	newHash, ok := webhookSignatureAlgorithms[s.Algorithm]
+	if !ok {
+		return "", fmt.Errorf("unsupported webhook signature algorithm '%s'", s.Algorithm)
+	}
+	mac := hmac.New(newHash, []byte(s.Secret))
+	_, _ = mac.Write(body)
+	return s.Algorithm + "=" + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// WebhookOAuth2 configures fetching bearer tokens using the OAuth2 client credentials flow
+type WebhookOAuth2 struct {
+	TokenURL     string   `json:"tokenURL"`
+	ClientID     string   `json:"clientID"`
+	ClientSecret string   `json:"clientSecret"`
+	Scopes       []string `json:"scopes"`
+	// EndpointParams holds additional parameters of the token request, e.g. audience
+	EndpointParams map[string]string `json:"endpointParams"`
+}
+
+func (o *WebhookOAuth2) tokenSource(transport *http.Transport) oauth2.TokenSource {
+	params := url.Values{}
+	for k, v := range o.EndpointParams {
+		params.Set(k, v)
+	}
+	cfg := clientcredentials.Config{
+		ClientID:       o.ClientID,
+		ClientSecret:   o.ClientSecret,
+		TokenURL:       o.TokenURL,
+		Scopes:         o.Scopes,
+		EndpointParams: params,
+	}
+	client := &http.Client{
+		Transport: httputil.NewLoggingRoundTripper(transport, log.WithField("service", "webhook-oauth2")),
+	}
+	// the returned token source caches the token and refreshes it once it expires
+	return cfg.TokenSource(context.WithValue(context.Background(), oauth2.HTTPClient, client))
+}
+
+// WebhookSuccessCriteria defines which responses are considered successful
+type WebhookSuccessCriteria struct {
+	// StatusCodes is the list of successful response status codes. Defaults to 2xx
+	StatusCodes []int `json:"statusCodes"`
+	// JSONPath is an expression evaluated against the JSON response body which must produce a non-empty result
+	JSONPath string `json:"jsonPath"`
+	// Value is the expected result of the JSONPath expression
+	Value string `json:"value"`
+}
+
+func (c *WebhookSuccessCriteria) matchesStatusCode(statusCode int) bool {
+	if c == nil || len(c.StatusCodes) == 0 {
+		return statusCode >= 200 && statusCode <= 299
+	}
+	for _, code := range c.StatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *WebhookSuccessCriteria) matchesBody(data []byte) error {
+	if c == nil || c.JSONPath == "" {
+		return nil
+	}
+	parser, err := parseJSONPath("success", c.JSONPath)
+	if err != nil {
+		return err
+	}
+	var body interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return fmt.Errorf("response is not valid JSON: %v", err)
+	}
+	var val bytes.Buffer
+	if err := parser.Execute(&val, body); err != nil {
+		return fmt.Errorf("success condition %s is not met: %v", c.JSONPath, err)
+	}
+	if c.Value != "" && val.String() != c.Value {
+		return fmt.Errorf("success condition %s is not met: expected '%s' but got '%s'", c.JSONPath, c.Value, val.String())
+	}
+	if c.Value == "" && val.Len() == 0 {
+		return fmt.Errorf("success condition %s is not met: result is empty", c.JSONPath)
+	}
+	return nil
+}
+
 type WebhookOptions struct {
-	URL                string        `json:"url"`
-	Headers            []Header      `json:"headers"`
-	BasicAuth          *BasicAuth    `json:"basicAuth"`
-	InsecureSkipVerify bool          `json:"insecureSkipVerify"`
-	RetryWaitMin       time.Duration `json:"retryWaitMin"`
-	RetryWaitMax       time.Duration `json:"retryWaitMax"`
-	RetryMax           int           `json:"retryMax"`
+	URL string `json:"url"`
+	// URLs lists additional target URLs. The notification is delivered to every URL
+	URLs               []string   `json:"urls"`
+	Headers            []Header   `json:"headers"`
+	BasicAuth          *BasicAuth `json:"basicAuth"`
+	InsecureSkipVerify bool       `json:"insecureSkipVerify"`
+	// ClientCert and ClientKey hold the PEM encoded client certificate and key used for mutual TLS authentication
+	ClientCert string `json:"clientCert"`
+	ClientKey  string `json:"clientKey"`
+	// CACert holds PEM encoded CA certificates used to verify the server certificate
+	CACert       string        `json:"caCert"`
+	RetryWaitMin time.Duration `json:"retryWaitMin"`
+	RetryWaitMax time.Duration `json:"retryWaitMax"`
+	RetryMax     int           `json:"retryMax"`
+	// Timeout is the number of seconds to wait for the response of a single request attempt; zero means no timeout
+	Timeout int `json:"timeout"`
+	// RetryStatusCodes overrides the list of response status codes that are retried. Defaults to 5xx responses except 501
+	RetryStatusCodes []int `json:"retryStatusCodes"`
+	// RetryBackoff is the strategy used to compute the wait time between retries: exponential (default) or linear
+	RetryBackoff string `json:"retryBackoff"`
+	// Signature enables signing of the request body using a shared secret
+	Signature *WebhookSignature `json:"signature"`
+	// OAuth2 enables bearer token authentication using the OAuth2 client credentials flow
+	OAuth2 *WebhookOAuth2 `json:"oauth2"`
+	// Success overrides the criteria of a successful response
+	Success *WebhookSuccessCriteria `json:"success"`
+	// Proxy is the URL of the HTTP proxy used instead of the proxy configured by environment variables
+	Proxy string `json:"proxy"`
 }
 
+const (
+	webhookRetryBackoffExponential = "exponential"
+	webhookRetryBackoffLinear      = "linear"
+)
+
 func NewWebhookService(opts WebhookOptions) NotificationService {
 	// Set default values if fields are zero
 	if opts.RetryWaitMin == 0 {
@@ -99,87 +298,254 @@ func NewWebhookService(opts WebhookOptions) NotificationService {
 	}
 	if opts.RetryMax == 0 {
 		opts.RetryMax = 3
+	} else if opts.RetryMax < 0 {
+		opts.RetryMax = 0
 	}
-	return &webhookService{opts: opts}
+	switch opts.RetryBackoff {
+	case "":
+		opts.RetryBackoff = webhookRetryBackoffExponential
+	case webhookRetryBackoffExponential, webhookRetryBackoffLinear:
+	default:
+		log.Warnf("Unknown webhook retry backoff '%s', falling back to %s", opts.RetryBackoff, webhookRetryBackoffExponential)
+		opts.RetryBackoff = webhookRetryBackoffExponential
+	}
+	if opts.Signature != nil {
+		signature := *opts.Signature
+		signature.Header = text.Coalesce(signature.Header, "X-Hub-Signature-256")
+		signature.Algorithm = text.Coalesce(strings.ToLower(signature.Algorithm), "sha256")
+		opts.Signature = &signature
+	}
+	service := &webhookService{opts: opts}
+	if opts.OAuth2 != nil {
+		transport := httputil.NewTransport(opts.OAuth2.TokenURL, opts.InsecureSkipVerify)
+		// invalid proxy url is reported by Send before the token is requested
+		_ = httputil.WithProxy(transport, opts.Proxy)
+		service.tokenSource = opts.OAuth2.tokenSource(transport)
+	}
+	return service
 }
 
 type webhookService struct {
-	opts WebhookOptions
+	opts        WebhookOptions
+	tokenSource oauth2.TokenSource
 }
 
 func (s webhookService) Send(notification Notification, dest Destination) error {
-	request := request{
-		body:        notification.Message,
-		method:      http.MethodGet,
-		url:         s.opts.URL,
-		destService: dest.Service,
+	return s.SendWithContext(context.Background(), notification, dest, State{})
+}
+
+// SendWithContext sends the notification using the given context and records values captured from the response in
+// the notification state
+func (s webhookService) SendWithContext(ctx context.Context, notification Notification, dest Destination, state State) error {
+	urls := s.urls()
+	webhookNotification, hasOverrides := notification.Webhook[dest.Service]
+	if hasOverrides && len(webhookNotification.URLs) > 0 {
+		urls = webhookNotification.URLs
+	}
+	if len(urls) == 0 {
+		return errors.New("webhook url is not specified")
 	}
 
-	if webhookNotification, ok := notification.Webhook[dest.Service]; ok {
-		request.applyOverridesFrom(webhookNotification)
+	var errs []error
+	captured := false
+	for _, u := range urls {
+		request := request{
+			body:        notification.Message,
+			method:      http.MethodGet,
+			url:         u,
+			destService: dest.Service,
+		}
+		if hasOverrides {
+			request.applyOverridesFrom(webhookNotification)
+		}
+
+		data, err := s.deliver(ctx, request)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// values are captured from the first successful response only
+		if !captured && hasOverrides && len(webhookNotification.Capture) > 0 && state != nil {
+			captureResponse(data, webhookNotification.Capture, state, log.WithField("service", dest.Service))
+			captured = true
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// urls returns all target URLs configured in the service
+func (s webhookService) urls() []string {
+	var urls []string
+	if s.opts.URL != "" {
+		urls = append(urls, s.opts.URL)
 	}
+	return append(urls, s.opts.URLs...)
+}
 
-	resp, err := request.execute(&s)
+// deliver executes the request and returns the response body if the response matches the success criteria
+func (s webhookService) deliver(ctx context.Context, request request) ([]byte, error) {
+	resp, err := request.execute(ctx, &s)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
 
-	if !(resp.StatusCode >= 200 && resp.StatusCode <= 299) {
-		data, err := io.ReadAll(resp.Body)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		data = []byte(fmt.Sprintf("unable to read response data: %v", err))
+	}
+
+	if !s.opts.Success.matchesStatusCode(resp.StatusCode) {
+		return nil, NewHTTPError(resp, fmt.Errorf("request to %s has failed with error code %d : %s", request, resp.StatusCode, string(data)))
+	}
+	if err := s.opts.Success.matchesBody(data); err != nil {
+		return nil, fmt.Errorf("request to %s has failed: %v : %s", request, err, string(data))
+	}
+	return data, nil
+}
+
+func parseJSONPath(name string, expr string) (*jsonpath.JSONPath, error) {
+	if !strings.HasPrefix(expr, "{") {
+		expr = "{" + expr + "}"
+	}
+	parser := jsonpath.New(name)
+	if err := parser.Parse(expr); err != nil {
+		return nil, fmt.Errorf("failed to parse JSONPath expression of %s: %v", name, err)
+	}
+	return parser, nil
+}
+
+// captureResponse evaluates capture expressions against the response body and stores the results in the given state.
+// Failures are logged only since the notification has been delivered already.
+func captureResponse(data []byte, capture map[string]string, state State, logEntry *log.Entry) {
+	var body interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		logEntry.Warnf("Failed to parse response as JSON to capture values: %v", err)
+		return
+	}
+	for key, expr := range capture {
+		parser, err := parseJSONPath(key, expr)
 		if err != nil {
-			data = []byte(fmt.Sprintf("unable to read response data: %v", err))
+			logEntry.Warn(err)
+			continue
 		}
-		return fmt.Errorf("request to %s has failed with error code %d : %s", request, resp.StatusCode, string(data))
+		var val bytes.Buffer
+		if err := parser.Execute(&val, body); err != nil {
+			logEntry.Warnf("Failed to capture %s from response: %v", key, err)
+			continue
+		}
+		state[key] = val.String()
 	}
-	return nil
 }
 
 type request struct {
 	body        string
 	method      string
 	url         string
+	headers     []Header
 	destService string
 }
 
 func (r *request) applyOverridesFrom(notification WebhookNotification) {
 	r.body = notification.Body
+	r.headers = notification.Headers
 	r.method = text.Coalesce(notification.Method, r.method)
 	if notification.Path != "" {
 		r.url = strings.TrimRight(r.url, "/") + "/" + strings.TrimLeft(notification.Path, "/")
 	}
 }
 
-func (r *request) intoRetryableHttpRequest(service *webhookService) (*retryablehttp.Request, error) {
+func (r *request) intoRetryableHttpRequest(ctx context.Context, service *webhookService) (*retryablehttp.Request, error) {
 	retryReq, err := retryablehttp.NewRequest(r.method, r.url, bytes.NewBufferString(r.body))
 	if err != nil {
 		return nil, err
 	}
+	retryReq = retryReq.WithContext(ctx)
 	for _, header := range service.opts.Headers {
 		retryReq.Header.Set(header.Name, header.Value)
 	}
+	for _, header := range r.headers {
+		if header.Value != "" {
+			retryReq.Header.Set(header.Name, header.Value)
+		}
+	}
 	if service.opts.BasicAuth != nil {
 		retryReq.SetBasicAuth(service.opts.BasicAuth.Username, service.opts.BasicAuth.Password)
 	}
+	if service.tokenSource != nil {
+		token, err := service.tokenSource.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get oauth2 token: %v", err)
+		}
+		token.SetAuthHeader(retryReq.Request)
+	}
+	if service.opts.Signature != nil {
+		signature, err := service.opts.Signature.sign([]byte(r.body))
+		if err != nil {
+			return nil, err
+		}
+		retryReq.Header.Set(service.opts.Signature.Header, signature)
+	}
 	return retryReq, nil
 }
 
-func (r *request) execute(service *webhookService) (*http.Response, error) {
-	req, err := r.intoRetryableHttpRequest(service)
+func (r *request) execute(ctx context.Context, service *webhookService) (*http.Response, error) {
+	httpTransport, err := service.newTransport(r.url)
 	if err != nil {
 		return nil, err
 	}
 
-	transport := httputil.NewLoggingRoundTripper(
-		httputil.NewTransport(r.url, service.opts.InsecureSkipVerify),
-		log.WithField("service", r.destService))
+	req, err := r.intoRetryableHttpRequest(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	transport := httputil.NewLoggingRoundTripper(httpTransport, log.WithField("service", r.destService))
 
 	client := retryablehttp.NewClient()
 	client.HTTPClient = &http.Client{
 		Transport: transport,
+		Timeout:   time.Duration(service.opts.Timeout) * time.Second,
 	}
 	client.RetryWaitMin = service.opts.RetryWaitMin
 	client.RetryWaitMax = service.opts.RetryWaitMax
 	client.RetryMax = service.opts.RetryMax
+	client.CheckRetry = service.checkRetry
+	if service.opts.RetryBackoff == webhookRetryBackoffLinear {
+		client.Backoff = retryablehttp.LinearJitterBackoff
+	}
 
 	return client.Do(req)
 }
+
+func (s *webhookService) newTransport(url string) (*http.Transport, error) {
+	transport := httputil.NewTransport(url, s.opts.InsecureSkipVerify)
+	if err := httputil.WithProxy(transport, s.opts.Proxy); err != nil {
+		return nil, err
+	}
+	if s.opts.CACert != "" && !s.opts.InsecureSkipVerify {
+		if err := httputil.WithRootCAs(transport, s.opts.CACert); err != nil {
+			return nil, err
+		}
+	}
+	if s.opts.ClientCert != "" || s.opts.ClientKey != "" {
+		if err := httputil.WithClientCertificate(transport, s.opts.ClientCert, s.opts.ClientKey); err != nil {
+			return nil, err
+		}
+	}
+	return transport, nil
+}
+
+// checkRetry retries connection errors and responses with one of the configured retryable status codes
+func (s *webhookService) checkRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if len(s.opts.RetryStatusCodes) == 0 || ctx.Err() != nil || err != nil {
+		return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+	}
+	for _, code := range s.opts.RetryStatusCodes {
+		if resp.StatusCode == code {
+			return true, nil
+		}
+	}
+	return false, nil
+}
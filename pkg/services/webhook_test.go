@@ -1,13 +1,24 @@
 package services
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -161,3 +172,527 @@ func TestWebhookService_Send_Retry(t *testing.T) {
 		t.Errorf("Expected 4 requests, got %d", count)
 	}
 }
+
+func TestWebhookService_Send_RetryStatusCodes(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		if count < 2 {
+			w.WriteHeader(http.StatusTooManyRequests)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	service := NewWebhookService(WebhookOptions{
+		URL:              server.URL,
+		RetryWaitMin:     time.Millisecond,
+		RetryWaitMax:     time.Millisecond,
+		RetryStatusCodes: []int{http.StatusTooManyRequests},
+	})
+	err := service.Send(Notification{}, Destination{Recipient: "test", Service: "test"})
+
+	// 429 is retried, but 503 is not part of the configured codes
+	assert.ErrorContains(t, err, "failed with error code 503")
+	assert.Equal(t, 2, count)
+}
+
+func TestWebhookService_Send_RetryDisabled(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	service := NewWebhookService(WebhookOptions{
+		URL:          server.URL,
+		RetryMax:     -1,
+		RetryBackoff: "linear",
+	})
+	err := service.Send(Notification{}, Destination{Recipient: "test", Service: "test"})
+
+	assert.ErrorContains(t, err, "giving up after 1 attempts")
+	assert.Equal(t, 1, count)
+}
+
+func TestWebhook_TemplatedHeaders(t *testing.T) {
+	var receivedHeaders http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		receivedHeaders = request.Header
+	}))
+	defer server.Close()
+
+	n := Notification{
+		Webhook: WebhookNotifications{
+			"test": {
+				Method: http.MethodPost,
+				Headers: []Header{
+					{Name: "Idempotency-Key", Value: "{{.app}}-{{.revision}}"},
+					{Name: "X-Tenant", Value: "{{.tenant}}"},
+					{Name: "X-Optional", Value: "{{if .missing}}{{.missing}}{{end}}"},
+				},
+			},
+		},
+	}
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var notification Notification
+	err = templater(&notification, map[string]interface{}{"app": "guestbook", "revision": "abc", "tenant": "payments"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	service := NewWebhookService(WebhookOptions{
+		URL:     server.URL,
+		Headers: []Header{{Name: "X-Tenant", Value: "default"}, {Name: "X-Static", Value: "static"}},
+	})
+	err = service.Send(notification, Destination{Recipient: "test", Service: "test"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "guestbook-abc", receivedHeaders.Get("Idempotency-Key"))
+	assert.Equal(t, "payments", receivedHeaders.Get("X-Tenant"))
+	assert.Equal(t, "static", receivedHeaders.Get("X-Static"))
+	assert.Empty(t, receivedHeaders.Values("X-Optional"))
+}
+
+func TestWebhook_Signature(t *testing.T) {
+	var receivedHeaders http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		receivedHeaders = request.Header
+	}))
+	defer server.Close()
+
+	service := NewWebhookService(WebhookOptions{
+		URL:       server.URL,
+		Signature: &WebhookSignature{Secret: "It's a Secret to Everybody"},
+	})
+	err := service.Send(Notification{
+		Webhook: map[string]WebhookNotification{
+			"test": {Body: "Hello, World!", Method: http.MethodPost},
+		},
+	}, Destination{Recipient: "test", Service: "test"})
+	assert.NoError(t, err)
+
+	// example from https://docs.github.com/en/webhooks/using-webhooks/validating-webhook-deliveries
+	assert.Equal(t, "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17", receivedHeaders.Get("X-Hub-Signature-256"))
+}
+
+func TestWebhook_SignatureCustomHeader(t *testing.T) {
+	var receivedHeaders http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		receivedHeaders = request.Header
+	}))
+	defer server.Close()
+
+	service := NewWebhookService(WebhookOptions{
+		URL:       server.URL,
+		Signature: &WebhookSignature{Secret: "secret", Header: "X-Signature", Algorithm: "SHA1"},
+	})
+	err := service.Send(Notification{}, Destination{Recipient: "test", Service: "test"})
+	assert.NoError(t, err)
+	assert.Equal(t, "sha1=25af6174a0fcecc4d346680a72b7ce644b9a88e8", receivedHeaders.Get("X-Signature"))
+}
+
+func TestWebhook_SignatureUnsupportedAlgorithm(t *testing.T) {
+	service := NewWebhookService(WebhookOptions{
+		URL:       "http://localhost",
+		Signature: &WebhookSignature{Secret: "secret", Algorithm: "md5"},
+	})
+	err := service.Send(Notification{}, Destination{Recipient: "test", Service: "test"})
+	assert.ErrorContains(t, err, "unsupported webhook signature algorithm")
+}
+
+func TestWebhook_OAuth2(t *testing.T) {
+	tokenRequests := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		tokenRequests++
+		assert.NoError(t, request.ParseForm())
+		assert.Equal(t, "client_credentials", request.Form.Get("grant_type"))
+		assert.Equal(t, "notifications", request.Form.Get("scope"))
+		assert.Equal(t, "https://receiver", request.Form.Get("audience"))
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(`{"access_token": "token123", "token_type": "bearer", "expires_in": 3600}`))
+	}))
+	defer tokenServer.Close()
+
+	var receivedAuth []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		receivedAuth = append(receivedAuth, request.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	service := NewWebhookService(WebhookOptions{
+		URL: server.URL,
+		OAuth2: &WebhookOAuth2{
+			TokenURL:       tokenServer.URL,
+			ClientID:       "client",
+			ClientSecret:   "secret",
+			Scopes:         []string{"notifications"},
+			EndpointParams: map[string]string{"audience": "https://receiver"},
+		},
+	})
+	assert.NoError(t, service.Send(Notification{}, Destination{Recipient: "test", Service: "test"}))
+	assert.NoError(t, service.Send(Notification{}, Destination{Recipient: "test", Service: "test"}))
+
+	assert.Equal(t, []string{"Bearer token123", "Bearer token123"}, receivedAuth)
+	assert.Equal(t, 1, tokenRequests)
+}
+
+func TestWebhook_OAuth2TokenError(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer tokenServer.Close()
+
+	service := NewWebhookService(WebhookOptions{
+		URL:    "http://localhost",
+		OAuth2: &WebhookOAuth2{TokenURL: tokenServer.URL, ClientID: "client", ClientSecret: "secret"},
+	})
+	err := service.Send(Notification{}, Destination{Recipient: "test", Service: "test"})
+	assert.ErrorContains(t, err, "failed to get oauth2 token")
+}
+
+// generateTestCertificate returns self-signed PEM encoded certificate and key valid for 127.0.0.1
+func generateTestCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "notifications-engine"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return string(certPEM), string(keyPEM)
+}
+
+func TestWebhook_ClientCertificate(t *testing.T) {
+	certPEM, keyPEM := generateTestCertificate(t)
+
+	var receivedCommonName string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if len(request.TLS.PeerCertificates) > 0 {
+			receivedCommonName = request.TLS.PeerCertificates[0].Subject.CommonName
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	service := NewWebhookService(WebhookOptions{
+		URL:                server.URL,
+		InsecureSkipVerify: true,
+		ClientCert:         certPEM,
+		ClientKey:          keyPEM,
+		RetryMax:           -1,
+	})
+	err := service.Send(Notification{}, Destination{Recipient: "test", Service: "test"})
+	assert.NoError(t, err)
+	assert.Equal(t, "notifications-engine", receivedCommonName)
+}
+
+func TestWebhook_InvalidClientCertificate(t *testing.T) {
+	service := NewWebhookService(WebhookOptions{
+		URL:        "https://localhost",
+		ClientCert: "invalid",
+		ClientKey:  "invalid",
+	})
+	err := service.Send(Notification{}, Destination{Recipient: "test", Service: "test"})
+	assert.ErrorContains(t, err, "failed to load client certificate")
+}
+
+func TestWebhook_CACert(t *testing.T) {
+	certPEM, keyPEM := generateTestCertificate(t)
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.StartTLS()
+	defer server.Close()
+
+	service := NewWebhookService(WebhookOptions{URL: server.URL, CACert: certPEM, RetryMax: -1})
+	err = service.Send(Notification{}, Destination{Recipient: "test", Service: "test"})
+	assert.NoError(t, err)
+
+	service = NewWebhookService(WebhookOptions{URL: server.URL, RetryMax: -1})
+	err = service.Send(Notification{}, Destination{Recipient: "test", Service: "test"})
+	assert.Error(t, err)
+}
+
+func TestWebhook_InvalidCACert(t *testing.T) {
+	service := NewWebhookService(WebhookOptions{URL: "https://localhost", CACert: "invalid"})
+	err := service.Send(Notification{}, Destination{Recipient: "test", Service: "test"})
+	assert.ErrorContains(t, err, "failed to parse CA certificates")
+}
+
+func TestWebhook_Timeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	service := NewWebhookService(WebhookOptions{URL: server.URL, Timeout: 1, RetryMax: -1})
+	start := time.Now()
+	err := service.Send(Notification{}, Destination{Recipient: "test", Service: "test"})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 3*time.Second)
+}
+
+func TestWebhook_ContextCancelled(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		count++
+	}))
+	defer server.Close()
+
+	service := NewWebhookService(WebhookOptions{URL: server.URL}).(*webhookService)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := service.SendWithContext(ctx, Notification{}, Destination{Recipient: "test", Service: "test"}, State{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, count)
+}
+
+func TestWebhook_CaptureResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(`{"incident": {"id": 42, "url": "https://incidents/42"}, "tags": ["a", "b"]}`))
+	}))
+	defer server.Close()
+
+	n := Notification{
+		Webhook: WebhookNotifications{
+			"test": {
+				Method: http.MethodPost,
+				Capture: map[string]string{
+					"incidentId":  "{.incident.id}",
+					"incidentUrl": ".incident.url",
+					"firstTag":    "{.tags[0]}",
+					"missing":     "{.missing}",
+				},
+			},
+		},
+	}
+	templater, err := n.GetTemplater("", template.FuncMap{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var notification Notification
+	if !assert.NoError(t, templater(&notification, map[string]interface{}{})) {
+		return
+	}
+
+	service := NewWebhookService(WebhookOptions{URL: server.URL}).(ContextNotificationService)
+	state := State{"existing": "value"}
+	err = service.SendWithContext(context.Background(), notification, Destination{Recipient: "test", Service: "test"}, state)
+	assert.NoError(t, err)
+
+	assert.Equal(t, State{
+		"existing":    "value",
+		"incidentId":  "42",
+		"incidentUrl": "https://incidents/42",
+		"firstTag":    "a",
+	}, state)
+}
+
+func TestGetTemplater_WebhookInvalidCapture(t *testing.T) {
+	n := Notification{
+		Webhook: WebhookNotifications{
+			"test": {Capture: map[string]string{"incidentId": "{.incident["}},
+		},
+	}
+	_, err := n.GetTemplater("", template.FuncMap{})
+	assert.ErrorContains(t, err, "failed to parse JSONPath expression of incidentId")
+}
+
+func TestWebhook_SuccessStatusCodes(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	service := NewWebhookService(WebhookOptions{
+		URL:     server.URL,
+		Success: &WebhookSuccessCriteria{StatusCodes: []int{http.StatusAccepted, http.StatusConflict}},
+	})
+
+	status = http.StatusConflict
+	assert.NoError(t, service.Send(Notification{}, Destination{Recipient: "test", Service: "test"}))
+
+	status = http.StatusOK
+	assert.ErrorContains(t, service.Send(Notification{}, Destination{Recipient: "test", Service: "test"}), "failed with error code 200")
+}
+
+func TestWebhook_SuccessJSONPath(t *testing.T) {
+	response := `{"ok": true}`
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	service := NewWebhookService(WebhookOptions{
+		URL:     server.URL,
+		Success: &WebhookSuccessCriteria{JSONPath: "{.ok}", Value: "true"},
+	})
+	assert.NoError(t, service.Send(Notification{}, Destination{Recipient: "test", Service: "test"}))
+
+	response = `{"ok": false, "error": "channel_not_found"}`
+	err := service.Send(Notification{}, Destination{Recipient: "test", Service: "test"})
+	assert.ErrorContains(t, err, "success condition {.ok} is not met: expected 'true' but got 'false'")
+
+	response = `not json`
+	err = service.Send(Notification{}, Destination{Recipient: "test", Service: "test"})
+	assert.ErrorContains(t, err, "response is not valid JSON")
+}
+
+func TestWebhook_SuccessJSONPathFilter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(`{"results": [{"status": "error"}]}`))
+	}))
+	defer server.Close()
+
+	service := NewWebhookService(WebhookOptions{
+		URL:     server.URL,
+		Success: &WebhookSuccessCriteria{JSONPath: `{.results[?(@.status=="ok")]}`},
+	})
+	err := service.Send(Notification{}, Destination{Recipient: "test", Service: "test"})
+	assert.ErrorContains(t, err, "result is empty")
+}
+
+func TestWebhook_MultipleURLs(t *testing.T) {
+	var received []string
+	handler := func(status int) http.HandlerFunc {
+		return func(writer http.ResponseWriter, request *http.Request) {
+			data, _ := io.ReadAll(request.Body)
+			received = append(received, request.Host+":"+string(data))
+			writer.WriteHeader(status)
+		}
+	}
+	primary := httptest.NewServer(handler(http.StatusOK))
+	defer primary.Close()
+	mirror := httptest.NewServer(handler(http.StatusOK))
+	defer mirror.Close()
+	broken := httptest.NewServer(handler(http.StatusBadRequest))
+	defer broken.Close()
+
+	service := NewWebhookService(WebhookOptions{
+		URL:  primary.URL,
+		URLs: []string{broken.URL, mirror.URL},
+	})
+	err := service.Send(Notification{
+		Webhook: map[string]WebhookNotification{
+			"test": {Method: http.MethodPost, Body: "hello"},
+		},
+	}, Destination{Recipient: "test", Service: "test"})
+
+	assert.ErrorContains(t, err, "failed with error code 400")
+	assert.NotContains(t, err.Error(), primary.URL)
+	assert.Equal(t, []string{
+		strings.TrimPrefix(primary.URL, "http://") + ":hello",
+		strings.TrimPrefix(broken.URL, "http://") + ":hello",
+		strings.TrimPrefix(mirror.URL, "http://") + ":hello",
+	}, received)
+}
+
+func TestWebhook_TemplatedURLs(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		paths = append(paths, request.URL.Path)
+	}))
+	defer server.Close()
+
+	templater, err := WebhookNotifications{
+		"test": {URLs: []string{
+			server.URL + "/{{.app}}",
+			"{{if .mirror}}" + server.URL + "/mirror{{end}}",
+		}},
+	}.GetTemplater("", template.FuncMap{})
+	assert.NoError(t, err)
+
+	notification := Notification{}
+	assert.NoError(t, templater(&notification, map[string]interface{}{"app": "guestbook"}))
+	assert.Equal(t, []string{server.URL + "/guestbook"}, notification.Webhook["test"].URLs)
+
+	service := NewWebhookService(WebhookOptions{URL: "http://unused.invalid"})
+	assert.NoError(t, service.Send(notification, Destination{Recipient: "test", Service: "test"}))
+	assert.Equal(t, []string{"/guestbook"}, paths)
+}
+
+func TestWebhook_Proxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		proxied = request.URL.String()
+	}))
+	defer proxy.Close()
+
+	service := NewWebhookService(WebhookOptions{
+		URL:   "http://receiver.example.com",
+		Proxy: proxy.URL,
+	})
+	err := service.Send(Notification{
+		Webhook: map[string]WebhookNotification{
+			"test": {Path: "/hooks"},
+		},
+	}, Destination{Recipient: "test", Service: "test"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "http://receiver.example.com/hooks", proxied)
+}
+
+func TestWebhook_InvalidProxy(t *testing.T) {
+	service := NewWebhookService(WebhookOptions{
+		URL:   "http://receiver.example.com",
+		Proxy: "proxy.example.com",
+	})
+	err := service.Send(Notification{}, Destination{Recipient: "test", Service: "test"})
+	assert.EqualError(t, err, "invalid proxy url: scheme and host are required")
+}
+
+func TestWebhook_SendWithContext_Cancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = io.ReadAll(request.Body)
+		select {
+		case <-request.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	service := NewWebhookService(WebhookOptions{URL: server.URL, RetryMax: -1})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := service.(ContextNotificationService).SendWithContext(ctx, Notification{
+		Webhook: map[string]WebhookNotification{
+			"test": {Body: "hello world", Method: http.MethodPost},
+		},
+	}, Destination{Recipient: "test", Service: "test"}, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -24,6 +24,39 @@ func NotifiedAnnotationKey() string {
 	return fmt.Sprintf("notified.%s", annotationPrefix)
 }
 
+// RetriesAnnotationKey returns the key of the annotation that holds the failed attempts of notification deliveries
+func RetriesAnnotationKey() string {
+	return fmt.Sprintf("retries.%s", annotationPrefix)
+}
+
+// HistoryAnnotationKey returns the key of the annotation that holds the delivery history of notifications
+func HistoryAnnotationKey() string {
+	return fmt.Sprintf("history.%s", annotationPrefix)
+}
+
+// StateAnnotationKey returns the key of the annotation that holds values recorded by notification services
+func StateAnnotationKey() string {
+	return fmt.Sprintf("state.%s", annotationPrefix)
+}
+
+// AcknowledgedAnnotationKey returns the key of the annotation that lists the triggers whose notifications were
+// acknowledged, acknowledged notifications are not escalated
+func AcknowledgedAnnotationKey() string {
+	return fmt.Sprintf("acknowledged.%s", annotationPrefix)
+}
+
+// ResolvedAnnotationKey returns the key of the annotation that lists the triggers whose notifications were resolved
+// externally, e.g. by the on-call engineer, notifications of resolved triggers are neither sent nor escalated
+func ResolvedAnnotationKey() string {
+	return fmt.Sprintf("resolved.%s", annotationPrefix)
+}
+
+// ActionsAnnotationKey returns the key of the annotation that holds the invocations of actions that were performed on
+// the resource, the tokens of performed invocations are rejected
+func ActionsAnnotationKey() string {
+	return fmt.Sprintf("actions.%s", annotationPrefix)
+}
+
 func parseRecipients(v string) []string {
 	var recipients []string
 	for _, recipient := range strings.Split(v, ";") {
@@ -52,15 +85,39 @@ func NewAnnotations(annotations map[string]string) Annotations {
 type Subscription struct {
 	Trigger      []string
 	Destinations []Destination
+	// When is the expression that the resource must meet for the notifications of the subscription to be sent
+	When string
+}
+
+// WhenParameter is the parameter of destinations that holds the send condition of their subscription
+const WhenParameter = "when"
+
+// WithCondition returns the parameters of a destination of the subscription with the send condition when. The
+// destinations that already have a send condition must meet both conditions
+func WithCondition(parameters map[string]string, when string) map[string]string {
+	if when == "" {
+		return parameters
+	}
+	res := map[string]string{}
+	for k, v := range parameters {
+		res[k] = v
+	}
+	if existing := parameters[WhenParameter]; existing != "" {
+		when = fmt.Sprintf("(%s) && (%s)", when, existing)
+	}
+	res[WhenParameter] = when
+	return res
 }
 
 // Destination holds notification destination details
 type Destination struct {
 	Service    string   `json:"service"`
 	Recipients []string `json:"recipients"`
+	// Parameters are passed to the service with every recipient of the destination
+	Parameters map[string]string `json:"parameters,omitempty"`
 }
 
-func (a Annotations) iterate(callback func(trigger string, service string, recipients []string, key string)) {
+func (a Annotations) iterate(callback func(trigger string, service string, recipients []string, parameters map[string]string, key string)) {
 	prefix := annotationPrefix + "/subscribe."
 	altPrefix := annotationPrefix + "/subscriptions"
 	var recipients []string
@@ -81,7 +138,7 @@ func (a Annotations) iterate(callback func(trigger string, service string, recip
 			} else {
 				recipients = parseRecipients(v)
 			}
-			callback(trigger, service, recipients, k)
+			callback(trigger, service, recipients, nil, k)
 		case strings.HasPrefix(k, altPrefix):
 			var subscriptions []Subscription
 			var source []byte
@@ -89,12 +146,12 @@ func (a Annotations) iterate(callback func(trigger string, service string, recip
 				source = []byte(v)
 			} else {
 				log.Errorf("Subscription is not defined")
-				callback("", "", recipients, k)
+				callback("", "", recipients, nil, k)
 			}
 			err := yaml.Unmarshal(source, &subscriptions)
 			if err != nil {
 				log.Errorf("Notification subscription unmarshal error: %v", err)
-				callback("", "", recipients, k)
+				callback("", "", recipients, nil, k)
 			}
 			for _, v := range subscriptions {
 				triggers := v.Trigger
@@ -104,13 +161,13 @@ func (a Annotations) iterate(callback func(trigger string, service string, recip
 					destination := ""
 					recipients = []string{}
 					log.Printf("Notification triggers and destinations are not configured")
-					callback(trigger, destination, recipients, k)
+					callback(trigger, destination, recipients, nil, k)
 				} else if len(triggers) == 0 && len(destinations) != 0 {
 					trigger := ""
 					log.Printf("Notification triggers are not configured")
 					for _, destination := range destinations {
 						log.Printf("trigger: %v, service: %v, recipient: %v \n", trigger, destination.Service, destination.Recipients)
-						callback(trigger, destination.Service, destination.Recipients, k)
+						callback(trigger, destination.Service, destination.Recipients, WithCondition(destination.Parameters, v.When), k)
 					}
 				} else if len(triggers) != 0 && len(destinations) == 0 {
 					service := ""
@@ -118,19 +175,19 @@ func (a Annotations) iterate(callback func(trigger string, service string, recip
 					log.Printf("Notification destinations are not configured")
 					for _, trigger := range triggers {
 						log.Printf("trigger: %v, service: %v, recipient: %v \n", trigger, service, recipients)
-						callback(trigger, service, recipients, k)
+						callback(trigger, service, recipients, nil, k)
 					}
 				} else {
 					for _, trigger := range triggers {
 						for _, destination := range destinations {
 							log.Printf("Notification trigger: %v, service: %v, recipient: %v \n", trigger, destination.Service, destination.Recipients)
-							callback(trigger, destination.Service, destination.Recipients, k)
+							callback(trigger, destination.Service, destination.Recipients, WithCondition(destination.Parameters, v.When), k)
 						}
 					}
 				}
 			}
 		default:
-			callback("", "", recipients, k)
+			callback("", "", recipients, nil, k)
 		}
 	}
 }
@@ -152,7 +209,7 @@ func (a Annotations) Subscribe(trigger string, service string, recipients ...str
 }
 
 func (a Annotations) Unsubscribe(trigger string, service string, recipient string) {
-	a.iterate(func(t string, s string, r []string, k string) {
+	a.iterate(func(t string, s string, r []string, _ map[string]string, k string) {
 		if trigger != t || s != service {
 			return
 		}
@@ -170,9 +227,69 @@ func (a Annotations) Unsubscribe(trigger string, service string, recipient strin
 	})
 }
 
+// Acknowledged returns true if the notifications of the trigger were acknowledged
+func (a Annotations) Acknowledged(trigger string) bool {
+	return a.listContains(AcknowledgedAnnotationKey(), trigger)
+}
+
+// Acknowledge records that the notifications of the trigger were acknowledged
+func (a Annotations) Acknowledge(trigger string) {
+	a.listAdd(AcknowledgedAnnotationKey(), trigger)
+}
+
+// Unacknowledge removes the acknowledgement of the notifications of the trigger
+func (a Annotations) Unacknowledge(trigger string) {
+	a.listRemove(AcknowledgedAnnotationKey(), trigger)
+}
+
+// Resolved returns true if the notifications of the trigger were resolved externally
+func (a Annotations) Resolved(trigger string) bool {
+	return a.listContains(ResolvedAnnotationKey(), trigger)
+}
+
+// Resolve records that the notifications of the trigger were resolved externally
+func (a Annotations) Resolve(trigger string) {
+	a.listAdd(ResolvedAnnotationKey(), trigger)
+}
+
+// Unresolve removes the resolution of the notifications of the trigger
+func (a Annotations) Unresolve(trigger string) {
+	a.listRemove(ResolvedAnnotationKey(), trigger)
+}
+
+func (a Annotations) listContains(key string, trigger string) bool {
+	for _, t := range parseRecipients(a[key]) {
+		if t == trigger {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Annotations) listAdd(key string, trigger string) {
+	if a.listContains(key, trigger) {
+		return
+	}
+	a[key] = strings.Join(append(parseRecipients(a[key]), trigger), ";")
+}
+
+func (a Annotations) listRemove(key string, trigger string) {
+	var triggers []string
+	for _, t := range parseRecipients(a[key]) {
+		if t != trigger {
+			triggers = append(triggers, t)
+		}
+	}
+	if len(triggers) == 0 {
+		delete(a, key)
+	} else {
+		a[key] = strings.Join(triggers, ";")
+	}
+}
+
 func (a Annotations) Has(service string, recipient string) bool {
 	has := false
-	a.iterate(func(t string, s string, r []string, k string) {
+	a.iterate(func(t string, s string, r []string, _ map[string]string, k string) {
 		if s != service {
 			return
 		}
@@ -188,7 +305,7 @@ func (a Annotations) Has(service string, recipient string) bool {
 
 func (a Annotations) GetDestinations(defaultTriggers []string, serviceDefaultTriggers map[string][]string) services.Destinations {
 	dests := services.Destinations{}
-	a.iterate(func(trigger string, service string, recipients []string, v string) {
+	a.iterate(func(trigger string, service string, recipients []string, parameters map[string]string, v string) {
 		for _, recipient := range recipients {
 			triggers := defaultTriggers
 			if trigger != "" {
@@ -199,8 +316,9 @@ func (a Annotations) GetDestinations(defaultTriggers []string, serviceDefaultTri
 
 			for i := range triggers {
 				dests[triggers[i]] = append(dests[triggers[i]], services.Destination{
-					Service:   service,
-					Recipient: recipient,
+					Service:    service,
+					Recipient:  recipient,
+					Parameters: parameters,
 				})
 			}
 		}
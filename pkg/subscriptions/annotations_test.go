@@ -121,7 +121,7 @@ func TestIterate(t *testing.T) {
 
 	for _, tt := range tests {
 		a := Annotations(tt.annotations)
-		a.iterate(func(trigger, service string, recipients []string, key string) {
+		a.iterate(func(trigger, service string, recipients []string, _ map[string]string, key string) {
 			for _, v := range tt.triggers {
 				for _, serv := range tt.service {
 					if trigger == v {
@@ -231,6 +231,45 @@ func TestGetDestinations(t *testing.T) {
 	}
 }
 
+func TestGetDestinations_Parameters(t *testing.T) {
+	a := Annotations(map[string]string{
+		"notifications.argoproj.io/subscriptions": `
+- trigger: [on-sync-succeeded]
+  destinations:
+  - service: telegram
+    recipients: ["-100123", "-100456"]
+    parameters:
+      topic: "42"
+`,
+	})
+	assert.Equal(t, services.Destinations{"on-sync-succeeded": {
+		{Service: "telegram", Recipient: "-100123", Parameters: map[string]string{"topic": "42"}},
+		{Service: "telegram", Recipient: "-100456", Parameters: map[string]string{"topic": "42"}},
+	}}, a.GetDestinations(nil, nil))
+}
+
+func TestGetDestinations_When(t *testing.T) {
+	a := Annotations(map[string]string{
+		"notifications.argoproj.io/subscriptions": `
+- trigger: [on-sync-succeeded]
+  when: app.spec.project == 'payments'
+  destinations:
+  - service: slack
+    recipients: [payments]
+  - service: telegram
+    recipients: ["-100123"]
+    parameters:
+      when: app.metadata.namespace == 'prod'
+`,
+	})
+	assert.Equal(t, services.Destinations{"on-sync-succeeded": {
+		{Service: "slack", Recipient: "payments", Parameters: map[string]string{WhenParameter: "app.spec.project == 'payments'"}},
+		{Service: "telegram", Recipient: "-100123", Parameters: map[string]string{
+			WhenParameter: "(app.spec.project == 'payments') && (app.metadata.namespace == 'prod')",
+		}},
+	}}, a.GetDestinations(nil, nil))
+}
+
 func TestSubscribe(t *testing.T) {
 	a := Annotations(map[string]string{})
 	a.Subscribe("my-trigger", "slack", "my-channel1")
@@ -258,6 +297,36 @@ func TestUnsubscribe(t *testing.T) {
 	assert.False(t, ok)
 }
 
+func TestAcknowledge(t *testing.T) {
+	a := Annotations{}
+	assert.False(t, a.Acknowledged("my-trigger"))
+
+	a.Acknowledge("my-trigger")
+	a.Acknowledge("my-trigger")
+	a.Acknowledge("other-trigger")
+	assert.True(t, a.Acknowledged("my-trigger"))
+	assert.Equal(t, "my-trigger;other-trigger", a["acknowledged.notifications.argoproj.io"])
+
+	a.Unacknowledge("my-trigger")
+	assert.False(t, a.Acknowledged("my-trigger"))
+	a.Unacknowledge("other-trigger")
+	assert.NotContains(t, a, "acknowledged.notifications.argoproj.io")
+}
+
+func TestResolve(t *testing.T) {
+	a := Annotations{}
+	assert.False(t, a.Resolved("my-trigger"))
+
+	a.Resolve("my-trigger")
+	a.Resolve("my-trigger")
+	assert.True(t, a.Resolved("my-trigger"))
+	assert.False(t, a.Acknowledged("my-trigger"))
+	assert.Equal(t, "my-trigger", a["resolved.notifications.argoproj.io"])
+
+	a.Unresolve("my-trigger")
+	assert.NotContains(t, a, "resolved.notifications.argoproj.io")
+}
+
 func TestSetAnnotationPrefix(t *testing.T) {
 	origPrefix := annotationPrefix
 	defer func() {
@@ -2,24 +2,37 @@ package subscriptions
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 )
 
 type rawSubscription struct {
-	Recipients []string `json:"recipients"`
-	Triggers   []string `json:"triggers"`
-	Selector   string   `json:"selector"`
+	Recipients    []string      `json:"recipients"`
+	Destinations  []Destination `json:"destinations,omitempty"`
+	Triggers      []string      `json:"triggers"`
+	Selector      string        `json:"selector"`
+	FieldSelector string        `json:"fieldSelector,omitempty"`
+	When          string        `json:"when,omitempty"`
 }
 
 // DefaultSubscription holds recipients that receives notification by default.
 type DefaultSubscription struct {
 	// Recipients comma separated list of recipients
 	Recipients []string
+	// Destinations holds recipients with service specific parameters
+	Destinations []Destination
 	// Optional trigger name
 	Triggers []string
 	// Options label selector that limits applied applications
 	Selector labels.Selector
+	// Optional field selector that limits applied applications
+	FieldSelector fields.Selector
+	// Optional expression that the resources must meet for the notifications to be sent
+	When string
 }
 
 func (s *DefaultSubscription) MatchesTrigger(trigger string) bool {
@@ -34,6 +47,31 @@ func (s *DefaultSubscription) MatchesTrigger(trigger string) bool {
 	return false
 }
 
+// MatchesResource returns true if the labels and the fields of the resource match the selectors of the subscription
+func (s *DefaultSubscription) MatchesResource(obj map[string]interface{}) bool {
+	if s.Selector != nil && !s.Selector.Matches(labels.Set((&unstructured.Unstructured{Object: obj}).GetLabels())) {
+		return false
+	}
+	return s.FieldSelector == nil || s.FieldSelector.Matches(resourceFields(obj, s.FieldSelector))
+}
+
+// resourceFields returns the values of the fields of the resource required by the selector, the fields that are
+// missing or are not scalars have an empty value
+func resourceFields(obj map[string]interface{}, selector fields.Selector) fields.Set {
+	set := fields.Set{}
+	for _, requirement := range selector.Requirements() {
+		val, found, err := unstructured.NestedFieldNoCopy(obj, strings.Split(requirement.Field, ".")...)
+		if !found || err != nil {
+			continue
+		}
+		switch val.(type) {
+		case string, bool, int64, float64:
+			set[requirement.Field] = fmt.Sprint(val)
+		}
+	}
+	return set
+}
+
 func (s *DefaultSubscription) UnmarshalJSON(data []byte) error {
 	raw := rawSubscription{}
 	if err := json.Unmarshal(data, &raw); err != nil {
@@ -41,22 +79,36 @@ func (s *DefaultSubscription) UnmarshalJSON(data []byte) error {
 	}
 	s.Triggers = raw.Triggers
 	s.Recipients = raw.Recipients
+	s.Destinations = raw.Destinations
+	s.When = raw.When
 	selector, err := labels.Parse(raw.Selector)
 	if err != nil {
 		return err
 	}
 	s.Selector = selector
+	if raw.FieldSelector != "" {
+		fieldSelector, err := fields.ParseSelector(raw.FieldSelector)
+		if err != nil {
+			return err
+		}
+		s.FieldSelector = fieldSelector
+	}
 	return nil
 }
 
 func (s *DefaultSubscription) MarshalJSON() ([]byte, error) {
 	raw := rawSubscription{
-		Triggers:   s.Triggers,
-		Recipients: s.Recipients,
+		Triggers:     s.Triggers,
+		Recipients:   s.Recipients,
+		Destinations: s.Destinations,
+		When:         s.When,
 	}
 	if s.Selector != nil {
 		raw.Selector = s.Selector.String()
 	}
+	if s.FieldSelector != nil {
+		raw.FieldSelector = s.FieldSelector.String()
+	}
 	return json.Marshal(raw)
 }
 
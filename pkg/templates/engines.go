@@ -0,0 +1,158 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+
+	"github.com/argoproj/notifications-engine/pkg/services"
+)
+
+const (
+	// TextEngine is the name of the default template engine, Go text/template
+	TextEngine = "text"
+	// ExprEngine is the name of the template engine that interpolates the expr expressions enclosed in ${ and }, e.g.
+	// "Application ${app.metadata.name} is ${upper(app.status.health.status)}". The expressions cannot have side
+	// effects and use the same language as trigger conditions. $${ renders a literal ${
+	ExprEngine = "expr"
+
+	// renderFieldFunc is the name of the template function that renders the fields compiled by engines
+	renderFieldFunc = "renderEngineField"
+)
+
+// Renderer renders the field of the template using the notification variables
+type Renderer func(vars map[string]interface{}) (string, error)
+
+// Engine compiles the fields of the templates that select the engine by name using the engine field of the template
+type Engine interface {
+	Compile(source string) (Renderer, error)
+}
+
+var (
+	enginesLock sync.RWMutex
+	engines     = map[string]Engine{ExprEngine: &exprEngine{}}
+)
+
+// RegisterEngine registers the template engine that the templates select by name. Engines must be registered before
+// the configuration is parsed
+func RegisterEngine(name string, engine Engine) {
+	enginesLock.Lock()
+	defer enginesLock.Unlock()
+	engines[name] = engine
+}
+
+func getEngine(name string) (Engine, bool) {
+	enginesLock.RLock()
+	defer enginesLock.RUnlock()
+	engine, ok := engines[name]
+	return engine, ok
+}
+
+// withEngine returns the copy of the template whose fields are compiled by the engine and the functions that render
+// them. Every field is replaced by the Go template calling the renderer of the field, so that notification services
+// render the fields of the template as usual
+func withEngine(template services.Notification, engine Engine, f texttemplate.FuncMap) (services.Notification, texttemplate.FuncMap, error) {
+	var renderers []Renderer
+	res, err := mapFields(template, func(field string) (string, error) {
+		if field == "" {
+			return field, nil
+		}
+		renderer, err := engine.Compile(field)
+		if err != nil {
+			return "", err
+		}
+		renderers = append(renderers, renderer)
+		return fmt.Sprintf("{{%s %d .}}", renderFieldFunc, len(renderers)-1), nil
+	})
+	if err != nil {
+		return template, nil, err
+	}
+
+	templateFuncs := texttemplate.FuncMap{}
+	for name, fn := range f {
+		templateFuncs[name] = fn
+	}
+	templateFuncs[renderFieldFunc] = func(i int, vars map[string]interface{}) (string, error) {
+		return renderers[i](vars)
+	}
+	return res, templateFuncs, nil
+}
+
+type exprEngine struct{}
+
+func (e *exprEngine) Compile(source string) (Renderer, error) {
+	var literals []string
+	var programs []*vm.Program
+	var literal strings.Builder
+	for i := 0; i < len(source); i++ {
+		switch {
+		case strings.HasPrefix(source[i:], "$${"):
+			literal.WriteString("${")
+			i += 2
+		case strings.HasPrefix(source[i:], "${"):
+			end, err := expressionEnd(source, i+2)
+			if err != nil {
+				return nil, err
+			}
+			prog, err := expr.Compile(source[i+2 : end])
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile expression '%s': %v", source[i+2:end], err)
+			}
+			literals = append(literals, literal.String())
+			programs = append(programs, prog)
+			literal.Reset()
+			i = end
+		default:
+			literal.WriteByte(source[i])
+		}
+	}
+	literals = append(literals, literal.String())
+
+	return func(vars map[string]interface{}) (string, error) {
+		var res strings.Builder
+		for i, prog := range programs {
+			res.WriteString(literals[i])
+			val, err := expr.Run(prog, vars)
+			if err != nil {
+				return "", err
+			}
+			if val != nil {
+				res.WriteString(fmt.Sprint(val))
+			}
+		}
+		res.WriteString(literals[len(literals)-1])
+		return res.String(), nil
+	}, nil
+}
+
+// expressionEnd returns the index of the brace that closes the expression starting at the index, braces of map
+// literals and braces in string literals are skipped
+func expressionEnd(source string, start int) (int, error) {
+	depth := 0
+	var quote byte
+	for i := start; i < len(source); i++ {
+		c := source[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			if depth == 0 {
+				return i, nil
+			}
+			depth--
+		}
+	}
+	return 0, fmt.Errorf("expression starting at %d is not closed", start-2)
+}
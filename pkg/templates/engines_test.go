@@ -0,0 +1,90 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/argoproj/notifications-engine/pkg/services"
+)
+
+func TestExprEngine(t *testing.T) {
+	vars := map[string]interface{}{"app": map[string]interface{}{"name": "guestbook", "replicas": 3}}
+	render := func(source string) string {
+		renderer, err := (&exprEngine{}).Compile(source)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		res, err := renderer(vars)
+		assert.NoError(t, err)
+		return res
+	}
+
+	assert.Equal(t, "plain {{text}}", render("plain {{text}}"))
+	assert.Equal(t, "guestbook has 3 replicas", render("${app.name} has ${app.replicas} replicas"))
+	assert.Equal(t, "GUESTBOOK}", render(`${upper({"name": app.name}.name)}}`))
+	assert.Equal(t, "a } b", render(`${"a } b"}`))
+	assert.Equal(t, "${app.name}", render("$${app.name}"))
+
+	_, err := (&exprEngine{}).Compile("${app.name")
+	assert.EqualError(t, err, "expression starting at 0 is not closed")
+	_, err = (&exprEngine{}).Compile("${app.name +}")
+	assert.ErrorContains(t, err, "failed to compile expression 'app.name +'")
+}
+
+func TestFormat_ExprEngine(t *testing.T) {
+	svc, err := NewService(map[string]services.Notification{
+		"test": {
+			Engine:  ExprEngine,
+			Message: "Application ${app.name} is {{not a template}}",
+			Slack:   &services.SlackNotification{Attachments: `[{"title": "${app.name}"}]`},
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	notification, err := svc.FormatNotification(map[string]interface{}{
+		"app": map[string]interface{}{"name": "guestbook"},
+	}, "test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Application guestbook is {{not a template}}", notification.Message)
+	assert.Equal(t, `[{"title": "guestbook"}]`, notification.Slack.Attachments)
+}
+
+type reverseEngine struct{}
+
+func (e *reverseEngine) Compile(source string) (Renderer, error) {
+	return func(vars map[string]interface{}) (string, error) {
+		runes := []rune(source)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return strings.ToUpper(string(runes)), nil
+	}, nil
+}
+
+func TestRegisterEngine(t *testing.T) {
+	_, err := NewService(map[string]services.Notification{"test": {Engine: "reverse", Message: "hello"}})
+	assert.EqualError(t, err, "template engine 'reverse' of template test is not supported")
+
+	RegisterEngine("reverse", &reverseEngine{})
+	defer func() {
+		enginesLock.Lock()
+		defer enginesLock.Unlock()
+		delete(engines, "reverse")
+	}()
+
+	svc, err := NewService(map[string]services.Notification{"test": {Engine: "reverse", Message: "hello"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	notification, err := svc.FormatNotification(map[string]interface{}{}, "test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "OLLEH", notification.Message)
+}
@@ -1,7 +1,12 @@
 package templates
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
 
 	"github.com/Masterminds/sprig/v3"
 
@@ -12,18 +17,71 @@ type Service interface {
 	FormatNotification(vars map[string]interface{}, templates ...string) (*services.Notification, error)
 }
 
-type service struct {
-	templaters map[string]services.Templater
+var (
+	customFuncsLock sync.RWMutex
+	customFuncs     = texttemplate.FuncMap{}
+)
+
+// RegisterFuncs registers functions that are available in all templates in addition to the Sprig functions, e.g. the
+// helpers of the resources of the embedding controller. The functions override the Sprig functions of the same name.
+// Functions must be registered before the configuration is parsed, so that the templates using them compile
+func RegisterFuncs(funcs texttemplate.FuncMap) {
+	customFuncsLock.Lock()
+	defer customFuncsLock.Unlock()
+	for name, f := range funcs {
+		customFuncs[name] = f
+	}
 }
 
-func NewService(templates map[string]services.Notification) (*service, error) {
+// funcMap returns the functions available in templates
+func funcMap() texttemplate.FuncMap {
 	f := sprig.TxtFuncMap()
 	delete(f, "env")
 	delete(f, "expandenv")
 
+	customFuncsLock.RLock()
+	defer customFuncsLock.RUnlock()
+	for name, custom := range customFuncs {
+		f[name] = custom
+	}
+	return f
+}
+
+type service struct {
+	templaters map[string]services.Templater
+}
+
+func NewService(templates map[string]services.Notification) (*service, error) {
+	return NewServiceWithPartials(templates, nil)
+}
+
+// NewServiceWithPartials returns the service of the templates that can include the partials by name, e.g.
+// {{template "footer" .}}. Partials can include other partials
+func NewServiceWithPartials(templates map[string]services.Notification, partials map[string]string) (*service, error) {
+	f := funcMap()
+
+	definitions, err := definePartials(partials, templates, f)
+	if err != nil {
+		return nil, err
+	}
+
 	svc := &service{templaters: map[string]services.Templater{}}
 	for name, cfg := range templates {
-		templater, err := cfg.GetTemplater(name, f)
+		templateFuncs := f
+		if cfg.Engine != "" && cfg.Engine != TextEngine {
+			engine, ok := getEngine(cfg.Engine)
+			if !ok {
+				return nil, fmt.Errorf("template engine '%s' of template %s is not supported", cfg.Engine, name)
+			}
+			if cfg, templateFuncs, err = withEngine(cfg, engine, f); err != nil {
+				return nil, fmt.Errorf("failed to compile template %s: %v", name, err)
+			}
+		} else if definitions != "" {
+			if cfg, err = withDefinitions(cfg, definitions); err != nil {
+				return nil, fmt.Errorf("failed to include partials in template %s: %v", name, err)
+			}
+		}
+		templater, err := cfg.GetTemplater(name, templateFuncs)
 		if err != nil {
 			return nil, err
 		}
@@ -47,3 +105,84 @@ func (s *service) FormatNotification(vars map[string]interface{}, templates ...s
 
 	return &notification, nil
 }
+
+// definePartials returns the definitions of the partials in name order
+func definePartials(partials map[string]string, templates map[string]services.Notification, f texttemplate.FuncMap) (string, error) {
+	names := make([]string, 0, len(partials))
+	for name := range partials {
+		if _, ok := templates[name]; ok {
+			return "", fmt.Errorf("partial '%s' conflicts with the template of the same name", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var definitions strings.Builder
+	for _, name := range names {
+		definition := fmt.Sprintf("{{define %q}}%s{{end}}", name, partials[name])
+		if _, err := texttemplate.New(name).Funcs(f).Parse(definition); err != nil {
+			return "", fmt.Errorf("failed to parse partial %s: %v", name, err)
+		}
+		definitions.WriteString(definition)
+	}
+	return definitions.String(), nil
+}
+
+// withDefinitions returns the copy of the template whose fields that hold template actions start with the definitions
+// of the partials. The definitions produce no output, so the fields render as before
+func withDefinitions(template services.Notification, definitions string) (services.Notification, error) {
+	return mapFields(template, func(field string) (string, error) {
+		if strings.Contains(field, "{{") {
+			return definitions + field, nil
+		}
+		return field, nil
+	})
+}
+
+// mapFields returns the copy of the template whose string fields are replaced by the result of the function, except
+// the fields that configure the template instead of the notification
+func mapFields(template services.Notification, f func(field string) (string, error)) (services.Notification, error) {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return template, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return template, err
+	}
+	for k, v := range fields {
+		if k == "engine" || k == "actions" {
+			continue
+		}
+		if fields[k], err = mapStrings(v, f); err != nil {
+			return template, err
+		}
+	}
+	if data, err = json.Marshal(fields); err != nil {
+		return template, err
+	}
+	var res services.Notification
+	err = json.Unmarshal(data, &res)
+	return res, err
+}
+
+func mapStrings(value interface{}, f func(field string) (string, error)) (interface{}, error) {
+	var err error
+	switch v := value.(type) {
+	case string:
+		return f(v)
+	case map[string]interface{}:
+		for k, item := range v {
+			if v[k], err = mapStrings(item, f); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if v[i], err = mapStrings(item, f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return value, nil
+}
@@ -2,6 +2,7 @@ package templates
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -29,3 +30,100 @@ func TestFormat_Message(t *testing.T) {
 
 	assert.Equal(t, "hello", notification.Message)
 }
+
+func TestFormat_Partials(t *testing.T) {
+	svc, err := NewServiceWithPartials(map[string]services.Notification{
+		"test": {
+			Message: "{{.foo}} {{template \"footer\" .}}",
+			Slack:   &services.SlackNotification{Attachments: "[{\"footer\": \"{{template \"link\" .}}\"}]"},
+		},
+	}, map[string]string{
+		"footer": "from {{template \"link\" .}}",
+		"link":   "https://{{.host}}",
+	})
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	notification, err := svc.FormatNotification(map[string]interface{}{
+		"foo":  "hello",
+		"host": "example.com",
+	}, "test")
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "hello from https://example.com", notification.Message)
+	assert.Equal(t, `[{"footer": "https://example.com"}]`, notification.Slack.Attachments)
+}
+
+func TestFormat_PartialsInvalid(t *testing.T) {
+	_, err := NewServiceWithPartials(map[string]services.Notification{}, map[string]string{"footer": "{{.foo"})
+	assert.ErrorContains(t, err, "failed to parse partial footer")
+
+	_, err = NewServiceWithPartials(map[string]services.Notification{"footer": {Message: "hello"}}, map[string]string{"footer": "bye"})
+	assert.EqualError(t, err, "partial 'footer' conflicts with the template of the same name")
+}
+
+func TestFormat_Sprig(t *testing.T) {
+	svc, err := NewService(map[string]services.Notification{
+		"test": {
+			Message: `{{.name | upper}} {{list "a" "b" | join ","}} {{(dict "key" "value").key}} {{dateModify "1h" .time | date "15:04"}}`,
+		},
+		"env": {
+			Message: `{{env "HOME"}}`,
+		},
+	})
+	assert.ErrorContains(t, err, `function "env" not defined`)
+	assert.Nil(t, svc)
+
+	svc, err = NewService(map[string]services.Notification{
+		"test": {
+			Message: `{{.name | upper}} {{list "a" "b" | join ","}} {{(dict "key" "value").key}} {{dateModify "1h" .time | date "15:04"}}`,
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	notification, err := svc.FormatNotification(map[string]interface{}{
+		"name": "guestbook",
+		"time": time.Date(2022, 1, 1, 10, 30, 0, 0, time.Local),
+	}, "test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "GUESTBOOK a,b value 11:30", notification.Message)
+}
+
+func TestFormat_CustomFuncs(t *testing.T) {
+	RegisterFuncs(map[string]interface{}{
+		"shortSha": func(sha string) string {
+			return sha[:7]
+		},
+	})
+	defer func() {
+		customFuncsLock.Lock()
+		defer customFuncsLock.Unlock()
+		delete(customFuncs, "shortSha")
+	}()
+
+	svc, err := NewService(map[string]services.Notification{
+		"test": {
+			Message: "{{shortSha .revision}}",
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	notification, err := svc.FormatNotification(map[string]interface{}{
+		"revision": "0123456789abcdef",
+	}, "test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "0123456", notification.Message)
+}
@@ -0,0 +1,159 @@
+// Package testing runs the fixtures of triggers and templates, so that the notifications configuration can be tested
+// in CI pipelines. Each fixture evaluates a trigger against a resource and compares the notifications rendered by
+// the templates of the triggered conditions with a golden file
+package testing
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/yaml"
+
+	"github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/services"
+)
+
+// defaultService is the service fixtures render the notifications for if they do not specify one
+const defaultService = "console"
+
+// Fixture is the test case of a trigger and of the notifications rendered by the templates of its conditions
+type Fixture struct {
+	Name string `json:"name"`
+	// Resource is the path of the YAML file of the resource, relative to the file of the fixtures
+	Resource string `json:"resource"`
+	Trigger  string `json:"trigger"`
+	// Triggered is the expected result of the trigger, i.e. true if any of its conditions is expected to be met
+	Triggered bool `json:"triggered"`
+	// Service and Recipient are the destination the notifications are rendered for, the service is console by default.
+	// The notifications are not sent
+	Service   string `json:"service,omitempty"`
+	Recipient string `json:"recipient,omitempty"`
+	// Golden is the path of the YAML file of the expected notifications of the triggered conditions, relative to the
+	// file of the fixtures. The notifications are not compared if it is not set
+	Golden string `json:"golden,omitempty"`
+}
+
+// Result is the result of the fixture
+type Result struct {
+	Fixture Fixture
+	// Failures describe how the results of the fixture differ from the expected results, the fixture passed if there
+	// are no failures
+	Failures []string
+}
+
+// Passed returns true if the results of the fixture are the expected results
+func (r Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// LoadFixtures loads the YAML list of fixtures of the file
+func LoadFixtures(path string) ([]Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixtures []Fixture
+	if err := yaml.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fixtures: %v", err)
+	}
+	return fixtures, nil
+}
+
+// recorder is the notification service that records the notifications instead of sending them
+type recorder struct {
+	notifications []services.Notification
+}
+
+func (r *recorder) Send(notification services.Notification, _ services.Destination) error {
+	r.notifications = append(r.notifications, notification)
+	return nil
+}
+
+// Run runs the fixtures of the file using the configuration and returns their results. The paths of the fixtures are
+// relative to the directory of the file. If update is true, the golden files are written instead of being compared
+func Run(cfg api.Config, getVars api.GetVars, path string, update bool) ([]Result, error) {
+	fixtures, err := LoadFixtures(path)
+	if err != nil {
+		return nil, err
+	}
+	// the notifications are rendered regardless of the settings that would prevent sending them
+	cfg.Services = nil
+	cfg.DryRun = false
+	cfg.DryRunServices = nil
+	cfg.Deduplication = nil
+
+	dir := filepath.Dir(path)
+	var results []Result
+	for _, fixture := range fixtures {
+		failures, err := runFixture(cfg, getVars, dir, fixture, update)
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+		results = append(results, Result{Fixture: fixture, Failures: failures})
+	}
+	return results, nil
+}
+
+func runFixture(cfg api.Config, getVars api.GetVars, dir string, fixture Fixture, update bool) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, fixture.Resource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resource: %v", err)
+	}
+	var obj map[string]interface{}
+	if err := yaml.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal resource: %v", err)
+	}
+
+	notificationsAPI, err := api.NewAPI(cfg, getVars)
+	if err != nil {
+		return nil, err
+	}
+	dest := services.Destination{Service: fixture.Service, Recipient: fixture.Recipient}
+	if dest.Service == "" {
+		dest.Service = defaultService
+	}
+	rec := &recorder{notifications: []services.Notification{}}
+	notificationsAPI.AddNotificationService(dest.Service, rec)
+
+	results, err := notificationsAPI.RunTrigger(fixture.Trigger, obj)
+	if err != nil {
+		return nil, err
+	}
+	triggered := false
+	for _, cr := range results {
+		if !cr.Triggered {
+			continue
+		}
+		triggered = true
+		if err := notificationsAPI.Send(obj, cr.Templates, dest); err != nil {
+			return nil, fmt.Errorf("failed to render the notification of condition %s: %v", cr.Key, err)
+		}
+	}
+
+	var failures []string
+	if triggered != fixture.Triggered {
+		failures = append(failures, fmt.Sprintf("expected trigger %s to return %v, got %v", fixture.Trigger, fixture.Triggered, triggered))
+	}
+	if fixture.Golden == "" {
+		return failures, nil
+	}
+	actual, err := yaml.Marshal(rec.notifications)
+	if err != nil {
+		return nil, err
+	}
+	golden := filepath.Join(dir, fixture.Golden)
+	if update {
+		return failures, os.WriteFile(golden, actual, 0o644)
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read golden file: %v", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		failures = append(failures, fmt.Sprintf("notifications differ from golden file %s (-expected +actual):\n%s", fixture.Golden, cmp.Diff(string(expected), string(actual))))
+	}
+	return failures, nil
+}
@@ -0,0 +1,100 @@
+package testing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/argoproj/notifications-engine/pkg/api"
+	"github.com/argoproj/notifications-engine/pkg/services"
+	"github.com/argoproj/notifications-engine/pkg/triggers"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	cfg := api.Config{
+		Triggers: map[string][]triggers.Condition{
+			"on-degraded": {{When: "app.status.health == 'Degraded'", Send: []string{"app-degraded"}}},
+		},
+		Templates: map[string]services.Notification{
+			"app-degraded": {Message: "{{.app.metadata.name}} is degraded, sent to {{.serviceType}}:{{.recipient}}"},
+		},
+		DryRun: true,
+	}
+	getVars := func(obj map[string]interface{}, _ services.Destination) map[string]interface{} {
+		return map[string]interface{}{"app": obj}
+	}
+	dir := writeFiles(t, map[string]string{
+		"degraded.yaml": `
+metadata:
+  name: guestbook
+status:
+  health: Degraded`,
+		"healthy.yaml": `
+metadata:
+  name: guestbook
+status:
+  health: Healthy`,
+		"tests.yaml": `
+- name: degraded
+  resource: degraded.yaml
+  trigger: on-degraded
+  triggered: true
+  service: slack
+  recipient: my-channel
+  golden: degraded.golden.yaml
+- name: healthy
+  resource: healthy.yaml
+  trigger: on-degraded
+  triggered: true`,
+	})
+
+	results, err := Run(cfg, getVars, filepath.Join(dir, "tests.yaml"), true)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.True(t, results[0].Passed())
+	assert.Equal(t, []string{"expected trigger on-degraded to return true, got false"}, results[1].Failures)
+
+	golden, err := os.ReadFile(filepath.Join(dir, "degraded.golden.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "- message: guestbook is degraded, sent to slack:my-channel\n", string(golden))
+
+	results, err = Run(cfg, getVars, filepath.Join(dir, "tests.yaml"), false)
+	require.NoError(t, err)
+	assert.True(t, results[0].Passed())
+
+	cfg.Templates["app-degraded"] = services.Notification{Message: "{{.app.metadata.name}} is unhealthy"}
+	results, err = Run(cfg, getVars, filepath.Join(dir, "tests.yaml"), false)
+	require.NoError(t, err)
+	if assert.Len(t, results[0].Failures, 1) {
+		assert.Contains(t, results[0].Failures[0], "notifications differ from golden file degraded.golden.yaml")
+	}
+}
+
+func TestRun_InvalidFixture(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"tests.yaml": `
+- name: missing
+  resource: missing.yaml
+  trigger: on-degraded`,
+	})
+
+	results, err := Run(api.Config{}, nil, filepath.Join(dir, "tests.yaml"), false)
+	require.NoError(t, err)
+	if assert.Len(t, results, 1) && assert.Len(t, results[0].Failures, 1) {
+		assert.Contains(t, results[0].Failures[0], "failed to read resource")
+	}
+
+	_, err = Run(api.Config{}, nil, filepath.Join(dir, "missing.yaml"), false)
+	assert.Error(t, err)
+}
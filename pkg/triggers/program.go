@@ -0,0 +1,109 @@
+package triggers
+
+import (
+	"fmt"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+	"github.com/google/cel-go/cel"
+	celast "github.com/google/cel-go/common/ast"
+)
+
+const (
+	// LanguageExpr is the default language of the expressions of conditions, https://expr-lang.org
+	LanguageExpr = "expr"
+	// LanguageCEL is the Common Expression Language, https://github.com/google/cel-spec
+	LanguageCEL = "cel"
+
+	// celCostLimit is the maximum cost of evaluating a CEL expression, the evaluation of more expensive expressions
+	// fails
+	celCostLimit = 1000000
+)
+
+// program is the compiled expression of a condition
+type program interface {
+	Run(vars map[string]interface{}) (interface{}, error)
+}
+
+type exprProgram struct {
+	prog *vm.Program
+}
+
+func (p *exprProgram) Run(vars map[string]interface{}) (interface{}, error) {
+	return expr.Run(p.prog, vars)
+}
+
+type celProgram struct {
+	prog cel.Program
+}
+
+func (p *celProgram) Run(vars map[string]interface{}) (interface{}, error) {
+	val, _, err := p.prog.Eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	return val.Value(), nil
+}
+
+var celEnv *cel.Env
+
+func init() {
+	var err error
+	if celEnv, err = cel.NewEnv(); err != nil {
+		panic(err)
+	}
+}
+
+// compile returns the program of the expression in the language
+func compile(language string, expression string) (program, error) {
+	switch language {
+	case "", LanguageExpr:
+		prog, err := expr.Compile(expression)
+		if err != nil {
+			return nil, err
+		}
+		return &exprProgram{prog: prog}, nil
+	case LanguageCEL:
+		// the expressions are not type checked since the variables differ by resource, e.g. the app variable of Argo CD
+		ast, issues := celEnv.Parse(expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, issues.Err()
+		}
+		if calls := celast.MatchDescendants(celast.NavigateCheckedAST(&celast.CheckedAST{Expr: ast.Expr()}), celast.FunctionMatcher(TriggeredFunc)); len(calls) > 0 {
+			return nil, fmt.Errorf("the %s function is not supported by %s conditions, use %s conditions to reference other triggers", TriggeredFunc, LanguageCEL, LanguageExpr)
+		}
+		prog, err := celEnv.Program(ast, cel.CostLimit(celCostLimit))
+		if err != nil {
+			return nil, err
+		}
+		return &celProgram{prog: prog}, nil
+	default:
+		return nil, fmt.Errorf("language '%s' is not supported, expected %s or %s", language, LanguageExpr, LanguageCEL)
+	}
+}
+
+// programKey returns the key of the compiled expression in the language
+func programKey(language string, expression string) string {
+	if language == "" {
+		language = LanguageExpr
+	}
+	return language + ":" + expression
+}
+
+// Evaluate returns the result of the expr expression against the variables, e.g. of the send condition of a
+// subscription, the expression must return a boolean
+func Evaluate(expression string, vars map[string]interface{}) (bool, error) {
+	prog, err := compile(LanguageExpr, expression)
+	if err != nil {
+		return false, err
+	}
+	res, err := prog.Run(vars)
+	if err != nil {
+		return false, err
+	}
+	matches, ok := res.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression '%s' returned %v, expected a boolean", expression, res)
+	}
+	return matches, nil
+}
@@ -4,11 +4,11 @@ import (
 	"crypto/sha1"
 	"encoding/base64"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/argoproj/notifications-engine/pkg/util/text"
 
-	"github.com/antonmedv/expr"
-	"github.com/antonmedv/expr/vm"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -18,6 +18,23 @@ type Condition struct {
 	When        string   `json:"when,omitempty"`
 	Description string   `json:"description,omitempty"`
 	Send        []string `json:"send,omitempty"`
+	// Severity is one of info, warning, error or critical and allows subscriptions to filter notifications by severity
+	Severity string `json:"severity,omitempty"`
+	// Delay is the number of seconds the condition must be met before the notification is sent
+	Delay int `json:"delay,omitempty"`
+	// RepeatEvery is the number of seconds after which the notification is sent again while the condition is met
+	RepeatEvery int `json:"repeatEvery,omitempty"`
+	// Cooldown is the number of seconds after the notification was sent during which the notification is not sent again,
+	// even if the condition stops being met and is met again
+	Cooldown int `json:"cooldown,omitempty"`
+	// Language is the language of the when and oncePer expressions, expr or cel, expr by default
+	Language string `json:"language,omitempty"`
+	// OncePerTTL is the number of seconds after which the notification is sent again for the same oncePer value, the
+	// notification is only sent once per value if it is not set
+	OncePerTTL int `json:"oncePerTTL,omitempty"`
+	// OncePerResetBy is the name of the recovery trigger whose conditions reset the oncePer values of the condition
+	// while the condition is not met, so that the notification is sent again for the same value
+	OncePerResetBy string `json:"oncePerResetBy,omitempty"`
 }
 
 type ConditionResult struct {
@@ -25,6 +42,17 @@ type ConditionResult struct {
 	OncePer   string
 	Templates []string
 	Triggered bool
+	Severity  string
+	// Delay is the number of seconds the condition must be met before the notification is sent
+	Delay int
+	// RepeatEvery is the number of seconds after which the notification is sent again while the condition is met
+	RepeatEvery int
+	// Cooldown is the number of seconds after the notification was sent during which it is not sent again
+	Cooldown int
+	// OncePerTTL is the number of seconds after which the notification is sent again for the same oncePer value
+	OncePerTTL int
+	// OncePerResetBy is the name of the trigger that resets the oncePer values of the condition
+	OncePerResetBy string
 }
 
 type Service interface {
@@ -33,58 +61,125 @@ type Service interface {
 }
 
 type service struct {
-	compiledConditions map[string]*vm.Program
-	compiledOncePer    map[string]*vm.Program
+	compiledConditions map[string]program
+	compiledOncePer    map[string]program
 	triggers           map[string][]Condition
 }
 
 func NewService(triggers map[string][]Condition) (*service, error) {
 	svc := service{
-		compiledConditions: map[string]*vm.Program{},
-		compiledOncePer:    map[string]*vm.Program{},
+		compiledConditions: map[string]program{},
+		compiledOncePer:    map[string]program{},
 		triggers:           triggers,
 	}
-	for _, t := range triggers {
+	for name, t := range triggers {
 		for _, condition := range t {
-			prog, err := expr.Compile(text.Coalesce(condition.When, "false"))
+			if _, err := SeverityLevel(condition.Severity); err != nil {
+				return nil, fmt.Errorf("trigger %s: %v", name, err)
+			}
+			if condition.Delay < 0 {
+				return nil, fmt.Errorf("trigger %s: delay must not be negative", name)
+			}
+			if condition.RepeatEvery < 0 {
+				return nil, fmt.Errorf("trigger %s: repeatEvery must not be negative", name)
+			}
+			if condition.Cooldown < 0 {
+				return nil, fmt.Errorf("trigger %s: cooldown must not be negative", name)
+			}
+			if condition.OncePerTTL < 0 {
+				return nil, fmt.Errorf("trigger %s: oncePerTTL must not be negative", name)
+			}
+			if condition.OncePerResetBy == name {
+				return nil, fmt.Errorf("trigger %s: oncePerResetBy must reference another trigger", name)
+			}
+			prog, err := compile(condition.Language, text.Coalesce(condition.When, "false"))
 			if err != nil {
 				return nil, err
 			}
-			svc.compiledConditions[condition.When] = prog
+			svc.compiledConditions[programKey(condition.Language, condition.When)] = prog
 
 			if condition.OncePer != "" {
-				prog, err := expr.Compile(condition.OncePer)
+				prog, err := compile(condition.Language, condition.OncePer)
 				if err != nil {
 					return nil, err
 				}
-				svc.compiledOncePer[condition.OncePer] = prog
+				svc.compiledOncePer[programKey(condition.Language, condition.OncePer)] = prog
 			}
 		}
 	}
 	return &svc, nil
 }
 
+// ConditionKey returns the key of the condition result of the condition with the given index
+func ConditionKey(index int, condition Condition) string {
+	return fmt.Sprintf("[%d].%s", index, hash(condition.When))
+}
+
 func hash(input string) string {
 	h := sha1.New()
 	_, _ = h.Write([]byte(input))
 	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
 }
 
+// TriggeredFunc is the name of the function of conditions that returns true if any condition of the trigger with the
+// given name is met, e.g. triggered('on-health-degraded') && !triggered('on-sync-running')
+const TriggeredFunc = "triggered"
+
 func (svc *service) Run(triggerName string, vars map[string]interface{}) ([]ConditionResult, error) {
+	return svc.run(triggerName, vars, map[string]bool{}, nil)
+}
+
+// run returns the results of the conditions of the trigger. The results of the triggers referenced by the conditions
+// are evaluated once per run, the path holds the triggers being evaluated and fails the run if a referenced trigger
+// is one of them
+func (svc *service) run(triggerName string, vars map[string]interface{}, triggered map[string]bool, path []string) ([]ConditionResult, error) {
 	t, ok := svc.triggers[triggerName]
 	if !ok {
 		return nil, fmt.Errorf("trigger '%s' is not configured", triggerName)
 	}
+	path = append(path[:len(path):len(path)], triggerName)
+	var refErr error
+	in := make(map[string]interface{}, len(vars)+1)
+	for k, v := range vars {
+		in[k] = v
+	}
+	in[TriggeredFunc] = func(name string) (bool, error) {
+		if i := slices.Index(path, name); i >= 0 {
+			refErr = fmt.Errorf("triggers reference each other: %s", strings.Join(append(slices.Clone(path[i:]), name), " -> "))
+			return false, refErr
+		}
+		if res, ok := triggered[name]; ok {
+			return res, nil
+		}
+		results, err := svc.run(name, vars, triggered, path)
+		if err != nil {
+			refErr = err
+			return false, err
+		}
+		res := false
+		for _, cr := range results {
+			res = res || cr.Triggered
+		}
+		triggered[name] = res
+		return res, nil
+	}
+
 	var res []ConditionResult
 	for i, condition := range t {
 		conditionResult := ConditionResult{
-			Templates: condition.Send,
-			Key:       fmt.Sprintf("[%d].%s", i, hash(condition.When)),
+			Templates:      condition.Send,
+			Severity:       condition.Severity,
+			Delay:          condition.Delay,
+			RepeatEvery:    condition.RepeatEvery,
+			Cooldown:       condition.Cooldown,
+			OncePerTTL:     condition.OncePerTTL,
+			OncePerResetBy: condition.OncePerResetBy,
+			Key:            ConditionKey(i, condition),
 		}
 		var whenResult bool
-		if prog, ok := svc.compiledConditions[condition.When]; !ok {
+		if prog, ok := svc.compiledConditions[programKey(condition.Language, condition.When)]; !ok {
 			return nil, fmt.Errorf("trigger configuration has changed after initialization")
-		} else if val, err := expr.Run(prog, vars); err == nil {
+		} else if val, err := prog.Run(in); err == nil {
 			boolRes, ok := val.(bool)
 			conditionResult.Triggered = ok && boolRes
 			whenResult = conditionResult.Triggered
@@ -93,8 +188,8 @@ func (svc *service) Run(triggerName string, vars map[string]interface{}) ([]Cond
 		}
 
 		if whenResult {
-			if prog, ok := svc.compiledOncePer[condition.OncePer]; ok {
-				if val, err := expr.Run(prog, vars); err == nil {
+			if prog, ok := svc.compiledOncePer[programKey(condition.Language, condition.OncePer)]; ok {
+				if val, err := prog.Run(in); err == nil {
 					conditionResult.OncePer = fmt.Sprintf("%v", val)
 				} else {
 					log.Errorf("failed to execute oncePer condition: %+v", err)
@@ -106,6 +201,9 @@ func (svc *service) Run(triggerName string, vars map[string]interface{}) ([]Cond
 
 		res = append(res, conditionResult)
 	}
+	if refErr != nil {
+		return nil, refErr
+	}
 
 	return res, nil
 }
@@ -159,3 +159,145 @@ func TestRun_OncePer_Evaluate(t *testing.T) {
 		}}, res)
 	}
 }
+
+func TestRun_Severity(t *testing.T) {
+	svc, err := NewService(map[string][]Condition{
+		"my-trigger": {{
+			When:     "var1 == 'abc'",
+			Send:     []string{"my-template"},
+			Severity: SeverityCritical,
+		}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	res, err := svc.Run("my-trigger", map[string]interface{}{"var1": "abc"})
+	if assert.NoError(t, err) && assert.Len(t, res, 1) {
+		assert.Equal(t, SeverityCritical, res[0].Severity)
+	}
+}
+
+func TestNewService_UnknownSeverity(t *testing.T) {
+	_, err := NewService(map[string][]Condition{
+		"my-trigger": {{When: "true", Severity: "fatal"}},
+	})
+	assert.ErrorContains(t, err, "trigger my-trigger: unknown severity 'fatal'")
+}
+
+func TestSeverityLevel(t *testing.T) {
+	info, err := SeverityLevel("")
+	assert.NoError(t, err)
+	critical, err := SeverityLevel(SeverityCritical)
+	assert.NoError(t, err)
+	warning, err := SeverityLevel(SeverityWarning)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, info)
+	assert.Less(t, warning, critical)
+}
+
+func TestRun_CEL(t *testing.T) {
+	svc, err := NewService(map[string][]Condition{
+		"my-trigger": {{
+			Language: LanguageCEL,
+			When:     "app.status.health == 'Degraded' && app.status.conditions.exists(c, c.type == 'SyncError')",
+			OncePer:  "app.status.revision",
+			Send:     []string{"my-template"},
+		}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	newVars := func(health string) map[string]interface{} {
+		return map[string]interface{}{"app": map[string]interface{}{"status": map[string]interface{}{
+			"health":     health,
+			"revision":   "abc",
+			"conditions": []interface{}{map[string]interface{}{"type": "SyncError"}},
+		}}}
+	}
+
+	res, err := svc.Run("my-trigger", newVars("Degraded"))
+	if assert.NoError(t, err) && assert.Len(t, res, 1) {
+		assert.True(t, res[0].Triggered)
+		assert.Equal(t, "abc", res[0].OncePer)
+	}
+
+	res, err = svc.Run("my-trigger", newVars("Healthy"))
+	if assert.NoError(t, err) && assert.Len(t, res, 1) {
+		assert.False(t, res[0].Triggered)
+	}
+
+	res, err = svc.Run("my-trigger", map[string]interface{}{})
+	if assert.NoError(t, err) && assert.Len(t, res, 1) {
+		assert.False(t, res[0].Triggered)
+	}
+}
+
+func TestNewService_InvalidLanguage(t *testing.T) {
+	_, err := NewService(map[string][]Condition{"my-trigger": {{Language: "rego", When: "true"}}})
+	assert.EqualError(t, err, "language 'rego' is not supported, expected expr or cel")
+
+	_, err = NewService(map[string][]Condition{"my-trigger": {{Language: LanguageCEL, When: "app.status ==="}}})
+	assert.Error(t, err)
+}
+
+func TestNewService_InvalidOncePer(t *testing.T) {
+	_, err := NewService(map[string][]Condition{"my-trigger": {{When: "true", OncePer: "a", OncePerTTL: -1}}})
+	assert.EqualError(t, err, "trigger my-trigger: oncePerTTL must not be negative")
+
+	_, err = NewService(map[string][]Condition{"my-trigger": {{When: "true", OncePer: "a", OncePerResetBy: "my-trigger"}}})
+	assert.EqualError(t, err, "trigger my-trigger: oncePerResetBy must reference another trigger")
+}
+
+func TestRun_Composite(t *testing.T) {
+	svc, err := NewService(map[string][]Condition{
+		"on-degraded": {{When: "health == 'Degraded'"}},
+		"on-syncing":  {{When: "phase == 'Running'"}},
+		"on-degraded-not-syncing": {{
+			When: "triggered('on-degraded') && !triggered('on-syncing')",
+			Send: []string{"my-template"},
+		}},
+		"on-loop":      {{When: "triggered('on-loop')"}},
+		"on-loop-a":    {{When: "triggered('on-loop-b')"}},
+		"on-loop-b":    {{When: "triggered('on-loop-a')"}},
+		"on-loop-c":    {{When: "triggered('on-loop-a')"}},
+		"on-undefined": {{When: "triggered('on-missing')"}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, tc := range []struct {
+		health, phase string
+		triggered     bool
+	}{
+		{"Degraded", "Succeeded", true},
+		{"Degraded", "Running", false},
+		{"Healthy", "Succeeded", false},
+	} {
+		res, err := svc.Run("on-degraded-not-syncing", map[string]interface{}{"health": tc.health, "phase": tc.phase})
+		if assert.NoError(t, err) && assert.Len(t, res, 1) {
+			assert.Equal(t, tc.triggered, res[0].Triggered, "%s %s", tc.health, tc.phase)
+		}
+	}
+
+	_, err = svc.Run("on-loop", map[string]interface{}{})
+	assert.EqualError(t, err, "triggers reference each other: on-loop -> on-loop")
+
+	_, err = svc.Run("on-loop-c", map[string]interface{}{})
+	assert.EqualError(t, err, "triggers reference each other: on-loop-a -> on-loop-b -> on-loop-a")
+
+	_, err = svc.Run("on-undefined", map[string]interface{}{})
+	assert.EqualError(t, err, "trigger 'on-missing' is not configured")
+}
+
+func TestNewService_CELTriggeredNotSupported(t *testing.T) {
+	_, err := NewService(map[string][]Condition{"my-trigger": {{When: "size(items) > 0 && triggered('on-degraded')", Language: LanguageCEL}}})
+	assert.EqualError(t, err, "the triggered function is not supported by cel conditions, use expr conditions to reference other triggers")
+}
+
+func TestNewService_NegativeCooldown(t *testing.T) {
+	_, err := NewService(map[string][]Condition{"my-trigger": {{When: "true", Cooldown: -1}}})
+	assert.EqualError(t, err, "trigger my-trigger: cooldown must not be negative")
+}
@@ -0,0 +1,25 @@
+package triggers
+
+import "fmt"
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityError    = "error"
+	SeverityCritical = "critical"
+)
+
+var severities = []string{SeverityInfo, SeverityWarning, SeverityError, SeverityCritical}
+
+// SeverityLevel returns the rank of the severity, from 0 for info to 3 for critical. Conditions without severity are info
+func SeverityLevel(severity string) (int, error) {
+	if severity == "" {
+		return 0, nil
+	}
+	for i := range severities {
+		if severities[i] == severity {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity '%s', supported severities are %v", severity, severities)
+}
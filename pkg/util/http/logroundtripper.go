@@ -5,10 +5,13 @@ import (
 	"net/http/httputil"
 
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
+// NewLoggingRoundTripper returns the round tripper that logs requests and responses at debug level and records the
+// requests as OpenTelemetry client spans, propagating the trace context of the request to the server
 func NewLoggingRoundTripper(roundTripper http.RoundTripper, entry *log.Entry) http.RoundTripper {
-	return &logRoundTripper{roundTripper: roundTripper, entry: entry}
+	return otelhttp.NewTransport(&logRoundTripper{roundTripper: roundTripper, entry: entry})
 }
 
 type logRoundTripper struct {
@@ -3,6 +3,7 @@ package http
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
 	"net/http"
 	"net/url"
 )
@@ -45,3 +46,56 @@ func getCertPoolFromPEMData(pemData []string) *x509.CertPool {
 	}
 	return certPool
 }
+
+// WithClientCertificate configures the transport to present the given PEM encoded
+// client certificate and key for mutual TLS authentication
+func WithClientCertificate(transport *http.Transport, certPEM string, keyPEM string) error {
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return fmt.Errorf("failed to load client certificate: %v", err)
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.Certificates = append(transport.TLSClientConfig.Certificates, cert)
+	return nil
+}
+
+// WithRootCAs configures the transport to trust the given PEM encoded CA certificates
+// in addition to the system certificate pool
+func WithRootCAs(transport *http.Transport, caPEM string) error {
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	pool := transport.TLSClientConfig.RootCAs
+	if pool == nil {
+		if systemPool, err := x509.SystemCertPool(); err == nil {
+			pool = systemPool
+		} else {
+			pool = x509.NewCertPool()
+		}
+	}
+	if !pool.AppendCertsFromPEM([]byte(caPEM)) {
+		return fmt.Errorf("failed to parse CA certificates")
+	}
+	transport.TLSClientConfig.RootCAs = pool
+	return nil
+}
+
+// WithProxy configures the transport to send requests through the given proxy instead of the proxy
+// configured by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables. Empty proxy URL keeps the transport unchanged
+func WithProxy(transport *http.Transport, proxyURL string) error {
+	if proxyURL == "" {
+		return nil
+	}
+	parsedURL, err := url.Parse(proxyURL)
+	if err != nil {
+		// the url error is not included since the proxy url might contain credentials
+		return fmt.Errorf("failed to parse proxy url")
+	}
+	if parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return fmt.Errorf("invalid proxy url: scheme and host are required")
+	}
+	transport.Proxy = http.ProxyURL(parsedURL)
+	return nil
+}
@@ -109,6 +109,11 @@ func (c *threadedClient) setThreadTimestamp(recipient string, groupingKey string
 }
 
 func (c *threadedClient) SendMessage(ctx context.Context, recipient string, groupingKey string, broadcast bool, policy DeliveryPolicy, options []sl.MsgOption) error {
+	return c.SendMessageToChannel(ctx, recipient, recipient, groupingKey, broadcast, policy, options)
+}
+
+// SendMessageToChannel sends the message to the given channel, the threads of the message are recorded by recipient
+func (c *threadedClient) SendMessageToChannel(ctx context.Context, recipient string, channel string, groupingKey string, broadcast bool, policy DeliveryPolicy, options []sl.MsgOption) error {
 	ts := c.getThreadTimestamp(recipient, groupingKey)
 	if groupingKey != "" && ts != "" {
 		options = append(options, sl.MsgOptionTS(ts))
@@ -119,7 +124,7 @@ func (c *threadedClient) SendMessage(ctx context.Context, recipient string, grou
 			c.Client,
 			ctx,
 			c.Limiter,
-			recipient,
+			channel,
 			sl.MsgOptionPost(),
 			buildPostOptions(broadcast, options),
 		)
@@ -0,0 +1,174 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/utils/strings/slices"
+
+	"github.com/argoproj/notifications-engine/pkg/api"
+)
+
+// ValidatePath is the path of the validating admission webhook served by the server
+const ValidatePath = "/validate"
+
+type handler struct {
+	settings api.Settings
+	secrets  v1listers.SecretLister
+}
+
+// Option configures the handler of the webhook
+type Option func(h *handler)
+
+// WithSecretLister validates the configuration of services using the Secrets of the settings in the namespace of the
+// configuration. The services are not instantiated if it is not set or the Secret does not exist, since the values
+// of the secret references are unknown, so only the structure of their configuration is validated
+func WithSecretLister(lister v1listers.SecretLister) Option {
+	return func(h *handler) {
+		h.secrets = lister
+	}
+}
+
+// NewHandler returns the handler of the validating admission webhook that rejects notification configurations that
+// fail to parse, contain triggers or templates that do not compile, or reference services, triggers and templates that
+// are not configured. The handler validates the ConfigMaps of the settings and the configuration resources, other
+// objects are allowed
+func NewHandler(settings api.Settings, opts ...Option) http.Handler {
+	h := &handler{settings: settings}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// getSecret returns the Secret of the settings merged with its overlays, or nil if the Secret is unknown
+func (h *handler) getSecret(namespace string) (*v1.Secret, error) {
+	if h.secrets == nil {
+		return nil, nil
+	}
+	var merged *v1.Secret
+	for _, name := range append([]string{h.settings.SecretName}, h.settings.OverlaySecretNames...) {
+		secret, err := h.secrets.Secrets(namespace).Get(name)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get secret %s: %v", name, err)
+		}
+		if merged == nil {
+			merged = &v1.Secret{Data: map[string][]byte{}}
+		}
+		for k, v := range secret.Data {
+			merged.Data[k] = v
+		}
+	}
+	return merged, nil
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var review admissionv1.AdmissionReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Request == nil {
+		http.Error(w, "invalid admission review", http.StatusBadRequest)
+		return
+	}
+
+	response := &admissionv1.AdmissionResponse{UID: review.Request.UID, Allowed: true}
+	if err := h.validate(review.Request); err != nil {
+		log.Infof("Rejected %s %s/%s: %v", review.Request.Kind.Kind, review.Request.Namespace, review.Request.Name, err)
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+			Message: err.Error(),
+		}
+	}
+	review.Request = nil
+	review.Response = response
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		log.Errorf("Failed to write admission review: %v", err)
+	}
+}
+
+func (h *handler) validate(req *admissionv1.AdmissionRequest) error {
+	if req.Operation == admissionv1.Delete {
+		return nil
+	}
+	switch {
+	case req.Kind.Group == "" && req.Kind.Kind == "ConfigMap":
+		var cm v1.ConfigMap
+		if err := json.Unmarshal(req.Object.Raw, &cm); err != nil {
+			return fmt.Errorf("failed to unmarshal ConfigMap: %v", err)
+		}
+		return h.validateConfigMap(&cm)
+	case req.Kind.Group == api.TriggersResource.Group:
+		var obj unstructured.Unstructured
+		if err := obj.UnmarshalJSON(req.Object.Raw); err != nil {
+			return fmt.Errorf("failed to unmarshal %s: %v", req.Kind.Kind, err)
+		}
+		resource := schema.GroupVersionResource{Group: req.Resource.Group, Version: req.Resource.Version, Resource: req.Resource.Resource}
+		secret, err := h.getSecret(req.Namespace)
+		if err != nil {
+			return err
+		}
+		return api.ValidateConfigResource(resource, &obj, secret)
+	}
+	return nil
+}
+
+// validateConfigMap validates the ConfigMap of the settings and its overlays, references are only validated for the
+// ConfigMap of the settings because overlays are incomplete on their own
+func (h *handler) validateConfigMap(cm *v1.ConfigMap) error {
+	isOverlay := slices.Contains(h.settings.OverlayConfigMapNames, cm.Name)
+	if cm.Name != h.settings.ConfigMapName && !isOverlay {
+		return nil
+	}
+	secret, err := h.getSecret(cm.Namespace)
+	if err != nil {
+		return err
+	}
+	if err := api.ValidateConfig(cm, secret); err != nil {
+		return err
+	}
+	cfg, err := api.ParseConfig(cm, secret)
+	if err != nil {
+		return err
+	}
+	if isOverlay {
+		return nil
+	}
+	return cfg.ValidateReferences()
+}
+
+// Serve serves the handler at the ValidatePath over HTTPS using the given certificate until the context is done
+func Serve(ctx context.Context, addr string, certFile string, keyFile string, handler http.Handler) error {
+	mux := http.NewServeMux()
+	mux.Handle(ValidatePath, handler)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Errorf("Failed to shut down the webhook server: %v", err)
+		}
+	}()
+
+	if err := server.ListenAndServeTLS(certFile, keyFile); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/argoproj/notifications-engine/pkg/api"
+)
+
+var settings = api.Settings{ConfigMapName: "notifications-cm", SecretName: "notifications-secret", OverlayConfigMapNames: []string{"team-cm"}}
+
+func review(t *testing.T, kind metav1.GroupVersionKind, resource metav1.GroupVersionResource, obj interface{}, opts ...Option) *admissionv1.AdmissionResponse {
+	raw, err := json.Marshal(obj)
+	require.NoError(t, err)
+	body, err := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("123"),
+			Kind:      kind,
+			Resource:  resource,
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	NewHandler(settings, opts...).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, ValidatePath, bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var res admissionv1.AdmissionReview
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	require.NotNil(t, res.Response)
+	assert.Equal(t, types.UID("123"), res.Response.UID)
+	return res.Response
+}
+
+func reviewConfigMap(t *testing.T, name string, data map[string]string, opts ...Option) *admissionv1.AdmissionResponse {
+	return review(t, metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, metav1.GroupVersionResource{Version: "v1", Resource: "configmaps"}, &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Data:       data,
+	}, opts...)
+}
+
+func TestValidateConfigMap(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		res := reviewConfigMap(t, "notifications-cm", map[string]string{
+			"service.slack":        "token: $slack-token",
+			"template.my-template": "message: hello {{.app.metadata.name}}",
+			"trigger.on-sync":      "[{when: 'true', send: [my-template]}]",
+			"subscriptions":        "[{recipients: ['slack:my-channel'], triggers: [on-sync]}]",
+		})
+		assert.True(t, res.Allowed)
+	})
+	t.Run("InvalidTemplate", func(t *testing.T) {
+		res := reviewConfigMap(t, "notifications-cm", map[string]string{
+			"template.my-template": "message: hello {{.app.metadata.name",
+		})
+		assert.False(t, res.Allowed)
+		assert.Contains(t, res.Result.Message, "my-template")
+	})
+	t.Run("InvalidTrigger", func(t *testing.T) {
+		res := reviewConfigMap(t, "notifications-cm", map[string]string{
+			"trigger.on-sync": "[{when: 'app.status ==', send: []}]",
+		})
+		assert.False(t, res.Allowed)
+	})
+	t.Run("MissingService", func(t *testing.T) {
+		res := reviewConfigMap(t, "notifications-cm", map[string]string{
+			"template.my-template": "message: hello",
+			"trigger.on-sync":      "[{when: 'true', send: [my-template, missing-template]}]",
+			"subscriptions":        "[{recipients: ['slack:my-channel']}]",
+		})
+		assert.False(t, res.Allowed)
+		assert.Equal(t, "invalid references: subscription 1 references service slack which is not configured; trigger on-sync references template missing-template which is not configured", res.Result.Message)
+	})
+	t.Run("Overlay", func(t *testing.T) {
+		res := reviewConfigMap(t, "team-cm", map[string]string{
+			"subscriptions": "[{recipients: ['slack:my-channel']}]",
+		})
+		assert.True(t, res.Allowed)
+	})
+	t.Run("OtherConfigMap", func(t *testing.T) {
+		res := reviewConfigMap(t, "other-cm", map[string]string{
+			"template.my-template": "message: hello {{.app.metadata.name",
+		})
+		assert.True(t, res.Allowed)
+	})
+}
+
+func TestValidateConfigMap_SecretReferences(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	data := map[string]string{
+		"service.github": "appID: $github-appID\ninstallationID: $github-installationID\nprivateKey: $github-privateKey",
+	}
+	newLister := func(secretData map[string][]byte) v1listers.SecretLister {
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		require.NoError(t, indexer.Add(&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "notifications-secret", Namespace: "default"}, Data: secretData}))
+		return v1listers.NewSecretLister(indexer)
+	}
+
+	t.Run("WithoutSecret", func(t *testing.T) {
+		assert.True(t, reviewConfigMap(t, "notifications-cm", data).Allowed)
+		emptyLister := v1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}))
+		assert.True(t, reviewConfigMap(t, "notifications-cm", data, WithSecretLister(emptyLister)).Allowed)
+	})
+	t.Run("ValidSecret", func(t *testing.T) {
+		res := reviewConfigMap(t, "notifications-cm", data, WithSecretLister(newLister(map[string][]byte{
+			"github-appID": []byte("12345"), "github-installationID": []byte("67890"), "github-privateKey": privateKey,
+		})))
+		assert.True(t, res.Allowed)
+	})
+	t.Run("InvalidSecret", func(t *testing.T) {
+		res := reviewConfigMap(t, "notifications-cm", data, WithSecretLister(newLister(map[string][]byte{
+			"github-appID": []byte("abc"), "github-installationID": []byte("67890"), "github-privateKey": privateKey,
+		})))
+		assert.False(t, res.Allowed)
+		assert.Contains(t, res.Result.Message, "abc")
+	})
+}
+
+func TestValidateConfigResource(t *testing.T) {
+	kind := metav1.GroupVersionKind{Group: api.TriggersResource.Group, Version: api.TriggersResource.Version, Kind: "NotificationTrigger"}
+	resource := metav1.GroupVersionResource{Group: api.TriggersResource.Group, Version: api.TriggersResource.Version, Resource: api.TriggersResource.Resource}
+	newTrigger := func(when string) map[string]interface{} {
+		return map[string]interface{}{
+			"apiVersion": "notifications.argoproj.io/v1alpha1",
+			"kind":       "NotificationTrigger",
+			"metadata":   map[string]interface{}{"name": "on-sync", "namespace": "default"},
+			"spec":       map[string]interface{}{"conditions": []interface{}{map[string]interface{}{"when": when, "send": []interface{}{"my-template"}}}},
+		}
+	}
+
+	assert.True(t, review(t, kind, resource, newTrigger("true")).Allowed)
+	assert.False(t, review(t, kind, resource, newTrigger("app.status ==")).Allowed)
+}
+
+func TestServeHTTP_InvalidReview(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	NewHandler(settings).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, ValidatePath, bytes.NewReader([]byte("{}"))))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}